@@ -0,0 +1,413 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const cliUsage = `Usage: server <command> [flags] [args]
+
+Client commands talk to a running server's HTTP API, with the URL and token saved by
+login. PINGLATER_URL and PINGLATER_TOKEN override the saved ones. Responses are printed
+as JSON.
+
+Commands:
+  (none)                     Run the server
+  migrate                    Manage the database schema; see "server migrate"
+  healthcheck                Exit non-zero unless this host's server and WhatsApp are healthy
+  login                      Log in with a username and password, or save an API token
+  logout                     Forget the saved login
+  send <phone> <message>     Send a message; "-" as the message reads it from stdin
+  status                     Show the WhatsApp connection
+  token create               Create an API token (needs a password login)
+  token list                 List your API tokens
+  token revoke <id>          Delete an API token
+  users list                 List users (admin)
+  users create               Create a user (admin)
+  users delete <id>          Delete a user (admin)
+  users enable <id>          Enable a user (admin)
+  users disable <id>         Disable a user (admin)
+  users reset-password <id>  Reset a user's password to a temporary one (admin)
+
+Run "server <command> -h" for a command's flags.`
+
+// defaultCLIURL is the server the CLI talks to before login saves another
+const defaultCLIURL = "http://localhost:8080"
+
+// cliCommands are the client subcommands of the server binary
+var cliCommands = map[string]func(args []string) error{
+	"login":  cliLogin,
+	"logout": cliLogout,
+	"send":   cliSend,
+	"status": cliStatus,
+	"token":  cliToken,
+	"users":  cliUsers,
+}
+
+// cliConfig is the login saved by "server login"
+type cliConfig struct {
+	URL   string `json:"url"`
+	Token string `json:"token"`
+}
+
+// runCLI runs a client subcommand and exits with its result
+func runCLI(command func(args []string) error, args []string) {
+	if err := command(args); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// cliConfigPath returns where the login is saved
+func cliConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "pinglater", "cli.json"), nil
+}
+
+// loadCLIConfig returns the saved login, with the environment's overrides
+func loadCLIConfig() cliConfig {
+	config := cliConfig{URL: defaultCLIURL}
+	if path, err := cliConfigPath(); err == nil {
+		if data, err := os.ReadFile(path); err == nil {
+			json.Unmarshal(data, &config)
+		}
+	}
+	if url := os.Getenv("PINGLATER_URL"); url != "" {
+		config.URL = url
+	}
+	if token := os.Getenv("PINGLATER_TOKEN"); token != "" {
+		config.Token = token
+	}
+	return config
+}
+
+// saveCLIConfig saves the login, readable only by the user as it holds a token
+func saveCLIConfig(config cliConfig) (string, error) {
+	path, err := cliConfigPath()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	data, _ := json.MarshalIndent(config, "", "  ")
+	return path, os.WriteFile(path, data, 0600)
+}
+
+// cliRequest calls the API and returns the response body. Error responses are returned
+// as errors with the API's message.
+func cliRequest(config cliConfig, method, path string, body interface{}) (json.RawMessage, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(config.URL, "/")+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+config.Token)
+	}
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 400 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			return nil, fmt.Errorf("%s (HTTP %d)", apiErr.Error, resp.StatusCode)
+		}
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return data, nil
+}
+
+// cliCall calls the API with the saved login and prints the response
+func cliCall(method, path string, body interface{}) error {
+	config := loadCLIConfig()
+	if config.Token == "" {
+		return fmt.Errorf("not logged in: run \"server login\" or set PINGLATER_TOKEN")
+	}
+	data, err := cliRequest(config, method, path, body)
+	if err != nil {
+		return err
+	}
+	return printJSON(data)
+}
+
+// printJSON prints a response body indented
+func printJSON(data json.RawMessage) error {
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	out.WriteByte('\n')
+	_, err := out.WriteTo(os.Stdout)
+	return err
+}
+
+// readPassword returns PINGLATER_PASSWORD, or reads a line from stdin
+func readPassword(prompt string) (string, error) {
+	if password := os.Getenv("PINGLATER_PASSWORD"); password != "" {
+		return password, nil
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// parseCLIFlags parses a subcommand's flags, and checks it got the number of arguments
+// its usage shows
+func parseCLIFlags(fs *flag.FlagSet, args []string, usage string, nargs int) ([]string, error) {
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: server "+usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != nargs {
+		fs.Usage()
+		return nil, flag.ErrHelp
+	}
+	return fs.Args(), nil
+}
+
+func cliLogin(args []string) error {
+	config := loadCLIConfig()
+	fs := flag.NewFlagSet("login", flag.ContinueOnError)
+	url := fs.String("url", config.URL, "Server URL")
+	username := fs.String("username", "", "Log in as this user; the password is read from PINGLATER_PASSWORD or stdin. The login lasts 24 hours.")
+	token := fs.String("token", "", "Save this API token instead of logging in")
+	if _, err := parseCLIFlags(fs, args, "login -username <name> | -token <token> [-url <url>]", 0); err != nil {
+		return err
+	}
+	if (*username == "") == (*token == "") {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	config = cliConfig{URL: *url, Token: *token}
+	if *username != "" {
+		password, err := readPassword("Password: ")
+		if err != nil {
+			return err
+		}
+		data, err := cliRequest(config, http.MethodPost, "/api/auth/login", map[string]string{
+			"username": *username,
+			"password": password,
+		})
+		if err != nil {
+			return err
+		}
+		var login struct {
+			Token string `json:"token"`
+		}
+		if err := json.Unmarshal(data, &login); err != nil || login.Token == "" {
+			return fmt.Errorf("unexpected login response")
+		}
+		config.Token = login.Token
+	} else if _, err := cliRequest(config, http.MethodGet, "/api/auth/token-info", nil); err != nil {
+		return fmt.Errorf("token rejected: %w", err)
+	}
+
+	path, err := saveCLIConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to save login: %w", err)
+	}
+	fmt.Fprintln(os.Stderr, "Logged in to", config.URL, "- saved to", path)
+	return nil
+}
+
+func cliLogout(args []string) error {
+	fs := flag.NewFlagSet("logout", flag.ContinueOnError)
+	if _, err := parseCLIFlags(fs, args, "logout", 0); err != nil {
+		return err
+	}
+	path, err := cliConfigPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func cliSend(args []string) error {
+	fs := flag.NewFlagSet("send", flag.ContinueOnError)
+	account := fs.String("account", "", "Account to send from, by account ID or phone number")
+	async := fs.Bool("async", false, "Queue the message and return at once instead of waiting for WhatsApp")
+	priority := fs.String("priority", "", "Send queue priority of an -async message: high, normal or low")
+	rest, err := parseCLIFlags(fs, args, "send [flags] <phone> <message>", 2)
+	if err != nil {
+		return err
+	}
+
+	message := rest[1]
+	if message == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read message: %w", err)
+		}
+		message = strings.TrimRight(string(data), "\n")
+	}
+	return cliCall(http.MethodPost, "/api/whatsapp/send", map[string]interface{}{
+		"phone_number": rest[0],
+		"message":      message,
+		"account":      *account,
+		"async":        *async,
+		"priority":     *priority,
+	})
+}
+
+func cliStatus(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	if _, err := parseCLIFlags(fs, args, "status", 0); err != nil {
+		return err
+	}
+	return cliCall(http.MethodGet, "/api/whatsapp/status", nil)
+}
+
+func cliToken(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: server token create|list|revoke")
+		return flag.ErrHelp
+	}
+
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("token create", flag.ContinueOnError)
+		name := fs.String("name", "", "Token name (required)")
+		scopes := fs.String("scopes", "", "Comma-separated scopes, e.g. messages:send,status:read (required)")
+		expires := fs.Duration("expires", 0, "Expire the token after this long, e.g. 720h; never by default")
+		perDay := fs.Int("messages-per-day", 0, "Daily message quota; 0 is unlimited")
+		perMinute := fs.Int("rate-limit", 0, "Requests per minute; 0 is unlimited")
+		if _, err := parseCLIFlags(fs, args[1:], "token create -name <name> -scopes <scopes> [flags]", 0); err != nil {
+			return err
+		}
+		if *name == "" || *scopes == "" {
+			fs.Usage()
+			return flag.ErrHelp
+		}
+
+		body := map[string]interface{}{
+			"name":                  *name,
+			"scopes":                strings.Split(*scopes, ","),
+			"messages_per_day":      *perDay,
+			"rate_limit_per_minute": *perMinute,
+		}
+		if *expires > 0 {
+			body["expires_at"] = time.Now().Add(*expires).UTC().Format(time.RFC3339)
+		}
+		return cliCall(http.MethodPost, "/api/auth/tokens", body)
+	case "list":
+		fs := flag.NewFlagSet("token list", flag.ContinueOnError)
+		if _, err := parseCLIFlags(fs, args[1:], "token list", 0); err != nil {
+			return err
+		}
+		return cliCall(http.MethodGet, "/api/auth/tokens", nil)
+	case "revoke":
+		fs := flag.NewFlagSet("token revoke", flag.ContinueOnError)
+		rest, err := parseCLIFlags(fs, args[1:], "token revoke <id>", 1)
+		if err != nil {
+			return err
+		}
+		return cliCall(http.MethodDelete, "/api/auth/tokens/"+rest[0], nil)
+	default:
+		fmt.Fprintln(os.Stderr, "Usage: server token create|list|revoke")
+		return flag.ErrHelp
+	}
+}
+
+func cliUsers(args []string) error {
+	const usage = "Usage: server users list|create|delete|enable|disable|reset-password"
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return flag.ErrHelp
+	}
+
+	switch args[0] {
+	case "list":
+		fs := flag.NewFlagSet("users list", flag.ContinueOnError)
+		if _, err := parseCLIFlags(fs, args[1:], "users list", 0); err != nil {
+			return err
+		}
+		return cliCall(http.MethodGet, "/api/users", nil)
+	case "create":
+		fs := flag.NewFlagSet("users create", flag.ContinueOnError)
+		username := fs.String("username", "", "Username (required)")
+		admin := fs.Bool("admin", false, "Make the user an admin")
+		if _, err := parseCLIFlags(fs, args[1:], "users create -username <name> [-admin]", 0); err != nil {
+			return err
+		}
+		if *username == "" {
+			fs.Usage()
+			return flag.ErrHelp
+		}
+		password, err := readPassword("New user's password: ")
+		if err != nil {
+			return err
+		}
+		return cliCall(http.MethodPost, "/api/users", map[string]interface{}{
+			"username": *username,
+			"password": password,
+			"is_admin": *admin,
+		})
+	case "delete", "enable", "disable", "reset-password":
+		fs := flag.NewFlagSet("users "+args[0], flag.ContinueOnError)
+		rest, err := parseCLIFlags(fs, args[1:], "users "+args[0]+" <id>", 1)
+		if err != nil {
+			return err
+		}
+		path := "/api/users/" + rest[0]
+		switch args[0] {
+		case "delete":
+			return cliCall(http.MethodDelete, path, nil)
+		case "enable", "disable":
+			return cliCall(http.MethodPut, path, map[string]bool{"is_active": args[0] == "enable"})
+		default:
+			return cliCall(http.MethodPost, path+"/reset-password", nil)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return flag.ErrHelp
+	}
+}
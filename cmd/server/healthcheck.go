@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/user/pinglater/internal/routes"
+)
+
+// healthReport is the part of GET /api/health the healthcheck looks at
+type healthReport struct {
+	Status   string            `json:"status"`
+	Checks   map[string]string `json:"checks"`
+	WhatsApp struct {
+		Connected      bool   `json:"connected"`
+		Reconnecting   bool   `json:"reconnecting"`
+		Degraded       bool   `json:"degraded"`
+		DegradedReason string `json:"degraded_reason"`
+	} `json:"whatsapp"`
+}
+
+// runHealthcheck checks the local server's health report and exits non-zero if the
+// API isn't ready or, unless -whatsapp=false, WhatsApp isn't connected and healthy.
+// It reads the same .env as the server to find its port and TLS settings.
+func runHealthcheck(args []string) {
+	godotenv.Load()
+
+	fs := flag.NewFlagSet("healthcheck", flag.ContinueOnError)
+	url := fs.String("url", "", "Server URL (default: this host's server, from PORT and the TLS settings)")
+	timeout := fs.Duration("timeout", 3*time.Second, "How long to wait for the server")
+	checkWhatsApp := fs.Bool("whatsapp", true, "Also require WhatsApp to be connected and healthy")
+	quiet := fs.Bool("quiet", false, "Only report failures")
+	if _, err := parseCLIFlags(fs, args, "healthcheck [flags]", 0); err != nil {
+		os.Exit(2)
+	}
+
+	if err := healthcheck(*url, *timeout, *checkWhatsApp); err != nil {
+		fmt.Fprintln(os.Stderr, "unhealthy:", err)
+		os.Exit(1)
+	}
+	if !*quiet {
+		fmt.Println("healthy")
+	}
+	os.Exit(0)
+}
+
+// healthcheck fetches the health report, returning why the server is unhealthy
+func healthcheck(url string, timeout time.Duration, checkWhatsApp bool) error {
+	client := &http.Client{Timeout: timeout}
+	if url == "" {
+		url = "http://localhost:" + routes.GetPort()
+		if tlsConfig := localTLSConfig(); tlsConfig != nil {
+			url = "https://localhost:" + routes.GetPort()
+			client.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+		}
+	}
+
+	resp, err := client.Get(strings.TrimRight(url, "/") + "/api/health")
+	if err != nil {
+		return fmt.Errorf("API unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var report healthReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return fmt.Errorf("API returned HTTP %d", resp.StatusCode)
+	}
+	if report.Status == "unhealthy" || resp.StatusCode != http.StatusOK {
+		for name, result := range report.Checks {
+			if result != "ok" {
+				return fmt.Errorf("%s: %s", name, result)
+			}
+		}
+		return fmt.Errorf("API returned HTTP %d", resp.StatusCode)
+	}
+
+	if checkWhatsApp {
+		switch {
+		case report.WhatsApp.Reconnecting:
+			return fmt.Errorf("WhatsApp reconnecting")
+		case !report.WhatsApp.Connected:
+			return fmt.Errorf("WhatsApp not connected")
+		case report.WhatsApp.Degraded:
+			return fmt.Errorf("WhatsApp degraded: %s", report.WhatsApp.DegradedReason)
+		}
+	}
+	return nil
+}
+
+// localTLSConfig returns how to reach the server over HTTPS from the same host, or nil
+// when it serves plain HTTP. Its certificate names the public host rather than
+// localhost: an autocert domain is asked for by name, and a certificate file isn't
+// verified.
+func localTLSConfig() *tls.Config {
+	if domains := splitList(os.Getenv("TLS_AUTOCERT_DOMAINS")); len(domains) > 0 {
+		return &tls.Config{ServerName: domains[0]}
+	}
+	if os.Getenv("TLS_CERT_FILE") != "" {
+		return &tls.Config{InsecureSkipVerify: true}
+	}
+	return nil
+}
@@ -1,8 +1,17 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/glebarez/go-sqlite"
@@ -10,22 +19,49 @@ import (
 	"github.com/user/pinglater/internal/api/handlers"
 	"github.com/user/pinglater/internal/api/middleware"
 	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/logging"
 	"github.com/user/pinglater/internal/models"
+	"github.com/user/pinglater/internal/passwords"
 	"github.com/user/pinglater/internal/routes"
 	"github.com/user/pinglater/internal/services"
+	"github.com/user/pinglater/internal/smtpgateway"
+	"github.com/user/pinglater/internal/version"
 	"github.com/user/pinglater/internal/whatsapp"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 func main() {
+	// Client subcommands ("server send ...") only talk to the HTTP API, so they skip
+	// the server's setup and logging
+	if len(os.Args) > 1 {
+		if command, ok := cliCommands[os.Args[1]]; ok {
+			runCLI(command, os.Args[2:])
+		}
+		if os.Args[1] == "healthcheck" {
+			runHealthcheck(os.Args[2:])
+		}
+		if os.Args[1] == "help" || os.Args[1] == "-h" || os.Args[1] == "--help" {
+			fmt.Println(cliUsage)
+			return
+		}
+	}
+
 	// Load .env file
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found, using environment variables")
 	}
+	logging.Setup()
+
+	log.Printf("PingLater %s (commit %s, built %s)", version.Version, version.Commit, version.BuildDate)
+
+	// "server migrate ..." manages the schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
 
 	// Initialize database
-	database, err := db.InitDatabase(os.Getenv("DB_PATH"))
+	database, err := db.InitDatabase(databaseConfig())
 	if err != nil {
 		log.Fatal("Failed to initialize database:", err)
 	}
@@ -33,69 +69,451 @@ func main() {
 	// Create default user if not exists
 	createDefaultUser(database)
 
+	// Start webhook delivery workers (drains any outbox rows left from a previous run)
+	services.GetWebhookService().SetEventCallback(func(userID uint, eventType, message, details string) {
+		handlers.BroadcastUserEvent(userID, models.EventType(eventType), message, details)
+	})
+
 	// Initialize WhatsApp client
 	initWhatsAppClient()
 
+	// Start the optional update check
+	if os.Getenv("UPDATE_CHECK_ENABLED") == "true" {
+		startUpdateCheck()
+	}
+
 	// Set JWT secret
 	middleware.SetJWTSecret(os.Getenv("JWT_SECRET"))
 
+	// Brute-force protection for /auth/login
+	handlers.ConfigureLoginThrottle(handlers.LoginThrottleConfig{
+		MaxFailures:   parseIntEnv("LOGIN_MAX_FAILURES", 5),
+		MaxIPFailures: parseIntEnv("LOGIN_MAX_FAILURES_PER_IP", 20),
+		Lockout:       parseDurationEnv("LOGIN_LOCKOUT", time.Minute),
+		MaxLockout:    parseDurationEnv("LOGIN_LOCKOUT_MAX", time.Hour),
+	})
+
+	// Recent events kept for event stream clients reconnecting with Last-Event-ID
+	handlers.ConfigureEventReplay(parseIntEnv("EVENT_REPLAY_SIZE", 1000))
+
+	// WhatsApp channel for Prometheus Alertmanager and Grafana alerting
+	if err := configureAlertReceiver(services.AlertReceiverAlertmanager, "ALERTMANAGER"); err != nil {
+		log.Fatal("Invalid Alertmanager configuration:", err)
+	}
+	if err := configureAlertReceiver(services.AlertReceiverGrafana, "GRAFANA"); err != nil {
+		log.Fatal("Invalid Grafana configuration:", err)
+	}
+
+	// Chat commands start with this, e.g. !status
+	if prefix := os.Getenv("BOT_COMMAND_PREFIX"); prefix != "" {
+		services.SetCommandPrefix(prefix)
+	}
+
+	// Direct messages that opt their sender out of campaigns, e.g. STOP
+	if keywords := os.Getenv("CAMPAIGN_OPT_OUT_KEYWORDS"); keywords != "" {
+		services.SetOptOutKeywords(strings.Split(keywords, ","))
+	}
+
+	// Instances sharing the database elect one to run the background jobs below
+	log.Printf("Instance ID %s", services.GetLeaderElection().InstanceID())
+
+	// Campaigns scheduled for later are sent when they're due
+	services.StartCampaignScheduler()
+
+	// Optional activity report each morning
+	if err := services.StartDailySummary(services.DailySummaryConfig{
+		At: os.Getenv("DAILY_SUMMARY_TIME"),
+		To: os.Getenv("DAILY_SUMMARY_TO"),
+	}); err != nil {
+		log.Fatal("Invalid DAILY_SUMMARY_TIME:", err)
+	}
+
 	// Set Gin mode
 	gin.SetMode(gin.ReleaseMode)
 
 	// Setup router
+	middleware.SetMaxBodySize(int64(parseIntEnv("HTTP_MAX_BODY_SIZE", 1<<20)))
+	middleware.SetIdempotencyWindow(parseDurationEnv("IDEMPOTENCY_WINDOW", 24*time.Hour))
 	r := routes.SetupRouter()
 
 	// Start server
 	port := routes.GetPort()
-	log.Printf("Server starting on port %s", port)
-	if err := r.Run(":" + port); err != nil {
-		log.Fatal("Failed to start server:", err)
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: r,
+		// Slow clients can't hold connections open forever; routes that stream or take
+		// large uploads set their own deadlines
+		ReadHeaderTimeout: parseDurationEnv("HTTP_READ_HEADER_TIMEOUT", 10*time.Second),
+		ReadTimeout:       parseDurationEnv("HTTP_READ_TIMEOUT", 30*time.Second),
+		WriteTimeout:      parseDurationEnv("HTTP_WRITE_TIMEOUT", 60*time.Second),
+		IdleTimeout:       parseDurationEnv("HTTP_IDLE_TIMEOUT", 2*time.Minute),
+	}
+	srv.RegisterOnShutdown(handlers.GetEventStream().Close)
+	useTLS, redirect, err := setupTLS(srv)
+	if err != nil {
+		log.Fatal("Invalid TLS configuration:", err)
+	}
+	if redirect != nil {
+		srv.RegisterOnShutdown(func() { redirect.Close() })
+		go func() {
+			log.Printf("Redirecting HTTP to HTTPS on port %s", redirect.Addr[1:])
+			if err := redirect.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal("Failed to start HTTP redirect server:", err)
+			}
+		}()
+	}
+	if addr := os.Getenv("SMTP_LISTEN_ADDR"); addr != "" {
+		startSMTPGateway(srv, addr, useTLS)
 	}
+	go func() {
+		var err error
+		if useTLS {
+			log.Printf("Server starting on port %s (HTTPS)", port)
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			log.Printf("Server starting on port %s", port)
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Failed to start server:", err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	stop()
+	shutdown(srv, parseDurationEnv("SHUTDOWN_TIMEOUT", 30*time.Second))
+}
+
+// shutdown stops accepting requests and waits for in-flight work before closing the
+// database, so a restart doesn't drop deliveries. A second signal exits immediately.
+func shutdown(srv *http.Server, timeout time.Duration) {
+	log.Println("Shutting down...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Println("Timed out waiting for requests to finish:", err)
+	}
+
+	// Finish the message being sent from the send queue; the rest wait for the next start
+	services.GetSendQueue().Stop()
+
+	// No new WhatsApp events after this, so nothing more is queued for webhooks
+	whatsapp.GetClient().Shutdown()
+
+	// Finish the event being processed; the rest are processed after the next start
+	services.GetInboundQueue().Stop()
+
+	done := make(chan struct{})
+	go func() {
+		services.GetWebhookService().Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Println("Timed out waiting for webhook deliveries to finish")
+	}
+
+	// Hand the background jobs to another instance right away
+	services.GetLeaderElection().Stop()
+
+	if err := db.Close(); err != nil {
+		log.Println("Failed to close database:", err)
+	}
+	log.Println("Shutdown complete")
 }
 
 func createDefaultUser(database *gorm.DB) {
 	var userCount int64
 	database.Model(&models.User{}).Count(&userCount)
 	if userCount == 0 {
-		passwordHash, _ := bcrypt.GenerateFromPassword([]byte(os.Getenv("DEFAULT_PASSWORD")), bcrypt.DefaultCost)
+		username, password := os.Getenv("DEFAULT_USERNAME"), os.Getenv("DEFAULT_PASSWORD")
+		if username == "" || password == "" {
+			log.Println("No users yet: create the first admin from the login page (POST /api/auth/setup)")
+			return
+		}
+		passwordHash, _ := passwords.Hash(password)
 		database.Create(&models.User{
-			Username:     os.Getenv("DEFAULT_USERNAME"),
-			PasswordHash: string(passwordHash),
+			Username:     username,
+			PasswordHash: passwordHash,
+			IsAdmin:      true,
+			IsActive:     true,
 		})
 		log.Println("Default user created")
+		return
+	}
+
+	// Databases from single-user versions have no admin yet: promote the original user
+	var adminCount int64
+	database.Model(&models.User{}).Where("is_admin = ?", true).Count(&adminCount)
+	if adminCount == 0 {
+		var first models.User
+		if err := database.Order("id asc").First(&first).Error; err == nil {
+			database.Model(&first).Updates(map[string]interface{}{"is_admin": true, "is_active": true})
+			log.Printf("Promoted %s to admin", first.Username)
+		}
 	}
 }
 
 func initWhatsAppClient() {
 	waClient := whatsapp.GetClient()
+	// whatsmeow's protocol logs go through the application log, warnings only by default
+	if err := waClient.ConfigureLogging(whatsapp.LogConfig{
+		Level: os.Getenv("WHATSAPP_LOG_LEVEL"),
+		File:  os.Getenv("WHATSAPP_LOG_FILE"),
+	}); err != nil {
+		log.Println("Ignoring WhatsApp log settings:", err)
+	}
 	if err := waClient.Initialize(); err != nil {
 		log.Fatal("Failed to initialize WhatsApp client:", err)
 	}
 
+	// Reply-mode webhooks answer chats through the WhatsApp client
+	services.GetWebhookService().SetReplySender(waClient)
+
+	// Queued sends (e.g. bulk sends) go out through the WhatsApp client too
+	services.GetSendQueue().SetCallback(handlers.QueuedMessageDone)
+	services.GetSendQueue().SetSender(waClient)
+
 	// Set up event callback to broadcast events and update metrics
-	waClient.SetEventCallback(func(eventType, message, details string, data interface{}) {
-		// Broadcast event to all connected SSE clients
-		handlers.BroadcastEvent(models.EventType(eventType), message, details)
+	// Events go to the webhooks and SSE clients of the user owning the device. They're
+	// stored in the inbound queue before the rules and webhooks see them, so one cut
+	// short by a crash is processed again after a restart.
+	services.GetInboundQueue().SetHandler(handleInboundEvent)
+	waClient.SetEventCallback(func(userID uint, eventType, message, details string, data interface{}) {
+		// Messages from ignored chats are dropped before anything records them
+		if services.IgnoresEvent(userID, data) {
+			return
+		}
 
-		// Update message received counter
-		if eventType == "message_received" {
-			handlers.IncrementMessagesReceived()
+		// Receipts arrive for every sent message and would drown out the activity feed,
+		// so they only go to webhooks.
+		if eventType != "message_delivered" && eventType != "message_read" {
+			handlers.BroadcastUserEvent(userID, models.EventType(eventType), message, details)
+		}
 
-			// Trigger webhooks for message_received events
-			if msgData, ok := data.(models.MessageReceivedData); ok {
-				// Get the first user (single-user system)
-				database := db.GetDB()
-				var user models.User
-				if result := database.First(&user); result.Error == nil {
-					webhookService := services.GetWebhookService()
-					webhookService.TriggerMessageReceived(user.ID, msgData)
-				}
+		switch eventType {
+		case "message_received":
+			// Update message received counter
+			handlers.IncrementMessagesReceived()
+			services.RecordMessageReceived(userID)
+		case "connected", "disconnected":
+			if eventType == "disconnected" {
+				services.RecordConnectionDrop()
+			}
+			data = models.ConnectionEventData{
+				PhoneNumber: waClient.GetPhoneNumber(),
+				Reason:      message,
+				Details:     details,
+				Timestamp:   time.Now().Unix(),
 			}
 		}
+
+		inbound := services.GetInboundQueue()
+		if userID != 0 && data != nil && inbound.Accepts(eventType) {
+			inbound.Enqueue(userID, eventType, data)
+		}
+	})
+
+	// Reconnect with backoff when the connection drops
+	waClient.ConfigureReconnect(whatsapp.ReconnectConfig{
+		BaseDelay:   parseDurationEnv("WHATSAPP_RECONNECT_BASE_DELAY", 2*time.Second),
+		MaxDelay:    parseDurationEnv("WHATSAPP_RECONNECT_MAX_DELAY", 5*time.Minute),
+		MaxAttempts: parseIntEnv("WHATSAPP_RECONNECT_MAX_ATTEMPTS", 10),
+	})
+
+	// Watch keepalives and the socket for connections that die silently
+	waClient.StartWatchdog(whatsapp.WatchdogConfig{
+		Interval:          parseDurationEnv("WHATSAPP_WATCHDOG_INTERVAL", 30*time.Second),
+		KeepAliveFailures: parseIntEnv("WHATSAPP_KEEPALIVE_FAILURES", 2),
+		MaxFailTime:       parseDurationEnv("WHATSAPP_KEEPALIVE_MAX_FAIL_TIME", 3*time.Minute),
+	})
+
+	// Anti-ban limits on every send, whichever path it comes from
+	waClient.ConfigureSendPolicy(whatsapp.SendPolicy{
+		MaxPerRecipientPerHour: parseIntEnv("SEND_MAX_PER_RECIPIENT_PER_HOUR", 0),
+		MaxPerMinute:           parseIntEnv("SEND_MAX_PER_MINUTE", 0),
+		MinDelay:               parseDurationEnv("SEND_MIN_DELAY", 0),
+		Jitter:                 parseDurationEnv("SEND_DELAY_JITTER", 0),
 	})
 
+	// Outgoing rules may change or stop every message, whichever path it comes from
+	waClient.AddSendHook("outgoing rules", services.ApplyOutgoingRules)
+
+	// Staging environments record sends instead of messaging real phones
+	if os.Getenv("SANDBOX_MODE") == "true" {
+		waClient.EnableSandbox()
+		log.Println("Sandbox mode: messages are recorded, not sent to WhatsApp")
+	}
+
 	// Auto-connect if there's an existing session
 	if err := waClient.AutoConnect(); err != nil {
 		log.Println("Failed to auto-connect WhatsApp:", err)
 	}
+
+	// Start the optional end-to-end self-test
+	waClient.StartSelfTest(whatsapp.SelfTestConfig{
+		Interval:  parseDurationEnv("SELF_TEST_INTERVAL", 0),
+		Timeout:   parseDurationEnv("SELF_TEST_TIMEOUT", 60*time.Second),
+		TargetJID: os.Getenv("SELF_TEST_JID"),
+	})
+}
+
+// handleInboundEvent processes an event from the inbound queue
+func handleInboundEvent(eventID, userID uint, eventType string, data interface{}) {
+	switch eventType {
+	case "message_received":
+		// Record campaign replies and opt-outs. Answer bot commands; other messages go
+		// through the auto-responder rules, then get the out-of-office reply and go to
+		// webhooks unless a rule blocked them.
+		if msgData, ok := data.(models.MessageReceivedData); ok {
+			services.RecordCampaignReply(userID, msgData)
+			services.HandleOptOut(userID, msgData)
+			switch {
+			case services.HandleCommand(userID, msgData):
+			case services.ApplyRules(userID, &msgData):
+				services.ApplyOutOfOffice(userID, msgData)
+				services.GetWebhookService().TriggerInboundWebhooks(eventID, userID, eventType, msgData)
+			}
+		}
+	case "connected", "disconnected", "reconnect_failed", "connection_degraded", "connection_restored":
+		// Trigger webhooks for connection changes
+		if connData, ok := data.(models.ConnectionEventData); ok {
+			services.GetWebhookService().TriggerInboundWebhooks(eventID, userID, eventType, connData)
+		}
+	case "message_delivered", "message_read":
+		// Track delivery of messages sent through the send queue
+		if receipt, ok := data.(models.MessageReceiptData); ok {
+			status := models.SendStatusDelivered
+			if eventType == "message_read" {
+				status = models.SendStatusRead
+			}
+			services.GetSendQueue().RecordReceipt(userID, receipt.MessageIDs, status)
+		}
+		services.GetWebhookService().TriggerInboundWebhooks(eventID, userID, eventType, data)
+	default:
+		services.GetWebhookService().TriggerInboundWebhooks(eventID, userID, eventType, data)
+	}
+}
+
+// startSMTPGateway starts the SMTP-to-WhatsApp gateway on addr, with STARTTLS when the
+// server has a certificate. It stops with srv.
+func startSMTPGateway(srv *http.Server, addr string, useTLS bool) {
+	config := smtpgateway.Config{
+		Addr:              addr,
+		Domain:            os.Getenv("SMTP_DOMAIN"),
+		MaxMessageBytes:   parseIntEnv("SMTP_MAX_MESSAGE_BYTES", 16<<20),
+		AllowInsecureAuth: os.Getenv("SMTP_ALLOW_INSECURE_AUTH") == "true",
+	}
+	if config.Domain == "" {
+		config.Domain = "localhost"
+	}
+	if useTLS {
+		config.TLSConfig = srv.TLSConfig.Clone()
+	} else if !config.AllowInsecureAuth {
+		log.Println("SMTP gateway has no TLS certificate and SMTP_ALLOW_INSECURE_AUTH is off, so clients can't log in")
+	}
+
+	gateway, err := smtpgateway.Start(config)
+	if err != nil {
+		log.Fatal("Failed to start SMTP gateway:", err)
+	}
+	srv.RegisterOnShutdown(gateway.Close)
+	log.Printf("SMTP gateway listening on %s", addr)
+}
+
+// databaseConfig reads the database settings from the environment. DB_PATH remains the
+// SQLite file when no DSN is given.
+func databaseConfig() db.Config {
+	dsn := os.Getenv("DB_DSN")
+	if dsn == "" {
+		dsn = os.Getenv("DB_PATH")
+	}
+	return db.Config{
+		Driver:       os.Getenv("DB_DRIVER"),
+		DSN:          dsn,
+		MaxOpenConns: parseIntEnv("DB_MAX_OPEN_CONNS", 0),
+		BusyTimeout:  parseDurationEnv("SQLITE_BUSY_TIMEOUT", 5*time.Second),
+	}
+}
+
+// configureAlertReceiver reads an alert receiver's recipients and template from the
+// environment, e.g. ALERTMANAGER_RECIPIENTS. The template is read from
+// <PREFIX>_TEMPLATE_FILE, or given inline in <PREFIX>_TEMPLATE.
+func configureAlertReceiver(kind, prefix string) error {
+	recipients, err := services.ParseAlertRecipients(os.Getenv(prefix + "_RECIPIENTS"))
+	if err != nil {
+		return err
+	}
+	tmpl := os.Getenv(prefix + "_TEMPLATE")
+	if path := os.Getenv(prefix + "_TEMPLATE_FILE"); path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		tmpl = string(content)
+	}
+	return services.ConfigureAlertReceiver(kind, services.AlertReceiverConfig{
+		Template:   tmpl,
+		Recipients: recipients,
+	})
+}
+
+// firstUserID returns the first active admin, who receives deployment-wide
+// notifications
+func firstUserID() (uint, bool) {
+	var user models.User
+	if result := db.GetDB().Where("is_admin = ? AND is_active = ?", true, true).Order("id asc").First(&user); result.Error != nil {
+		return 0, false
+	}
+	return user.ID, true
+}
+
+// parseDurationEnv reads a Go duration (e.g. "30m") from the environment, falling back to def
+func parseDurationEnv(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration for %s: %q, using default %s", key, value, def)
+		return def
+	}
+	return d
+}
+
+func startUpdateCheck() {
+	checker := version.GetUpdateChecker()
+	checker.SetCallback(func(info version.UpdateInfo) {
+		log.Printf("A newer PingLater release is available: %s (%s)", info.LatestVersion, info.ReleaseURL)
+		handlers.BroadcastEvent(models.EventTypeUpdateAvailable, "PingLater "+info.LatestVersion+" is available", info.ReleaseURL)
+
+		// Notify webhooks subscribed to update_available
+		if userID, ok := firstUserID(); ok {
+			services.GetWebhookService().TriggerWebhooks(userID, string(models.EventTypeUpdateAvailable), map[string]interface{}{
+				"current_version": version.Version,
+				"latest_version":  info.LatestVersion,
+				"release_url":     info.ReleaseURL,
+			})
+		}
+	})
+	checker.Start(parseDurationEnv("UPDATE_CHECK_INTERVAL", 24*time.Hour))
+}
+
+// parseIntEnv reads an integer from the environment, falling back to def
+func parseIntEnv(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid integer for %s: %q, using default %d", key, value, def)
+		return def
+	}
+	return n
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/user/pinglater/internal/db"
+)
+
+const migrateUsage = `Usage: server migrate <command>
+
+Commands:
+  status      List migrations and whether they have been applied
+  up          Apply pending migrations (the server also does this on startup)
+  down [n]    Revert the last n applied migrations (default 1)`
+
+// runMigrate manages the schema from the command line, e.g. to revert a migration
+// before downgrading
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+
+	database, err := db.Open(databaseConfig())
+	if err != nil {
+		log.Fatal("Failed to open database:", err)
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "status":
+		status, err := db.Status(database)
+		if err != nil {
+			log.Fatal("Failed to read migrations:", err)
+		}
+		for _, m := range status {
+			applied := "pending"
+			if m.AppliedAt != nil {
+				applied = "applied " + m.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%4d  %-40s %s\n", m.Version, m.Name, applied)
+		}
+	case "up":
+		if err := db.Migrate(database); err != nil {
+			log.Fatal(err)
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				log.Fatalf("Invalid number of migrations: %q", args[1])
+			}
+		}
+		if err := db.Rollback(database, steps); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+}
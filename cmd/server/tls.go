@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// setupTLS configures srv to serve HTTPS with the certificate in TLS_CERT_FILE and
+// TLS_KEY_FILE, or with certificates issued by Let's Encrypt for TLS_AUTOCERT_DOMAINS.
+// It returns false when neither is set. With TLS_REDIRECT_PORT, the returned redirect
+// server answers plain HTTP there, redirecting to HTTPS (and, for autocert, answering
+// ACME HTTP challenges).
+func setupTLS(srv *http.Server) (enabled bool, redirect *http.Server, err error) {
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	domains := splitList(os.Getenv("TLS_AUTOCERT_DOMAINS"))
+
+	var redirectHandler http.Handler = http.HandlerFunc(redirectToHTTPS)
+	switch {
+	case len(domains) > 0:
+		if certFile != "" || keyFile != "" {
+			return false, nil, fmt.Errorf("set either TLS_CERT_FILE/TLS_KEY_FILE or TLS_AUTOCERT_DOMAINS, not both")
+		}
+		cacheDir := os.Getenv("TLS_AUTOCERT_CACHE_DIR")
+		if cacheDir == "" {
+			cacheDir = "./data/autocert"
+		}
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(domains...),
+			Cache:      autocert.DirCache(cacheDir),
+			Email:      os.Getenv("TLS_AUTOCERT_EMAIL"),
+		}
+		srv.TLSConfig = manager.TLSConfig()
+		redirectHandler = manager.HTTPHandler(nil)
+		log.Printf("TLS certificates for %s are issued by Let's Encrypt", strings.Join(domains, ", "))
+	case certFile != "" || keyFile != "":
+		if certFile == "" || keyFile == "" {
+			return false, nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+		}
+		cert := &reloadingCert{certFile: certFile, keyFile: keyFile}
+		if _, err := cert.get(nil); err != nil {
+			return false, nil, err
+		}
+		srv.TLSConfig = &tls.Config{GetCertificate: cert.get}
+	default:
+		return false, nil, nil
+	}
+	srv.TLSConfig.MinVersion = tls.VersionTLS12
+
+	if port := os.Getenv("TLS_REDIRECT_PORT"); port != "" {
+		redirect = &http.Server{
+			Addr:              ":" + port,
+			Handler:           redirectHandler,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+	}
+	return true, redirect, nil
+}
+
+// redirectToHTTPS sends plain HTTP requests to the same URL over HTTPS. The HTTPS port
+// is assumed to be the default one.
+func redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if i := strings.LastIndex(host, ":"); i > strings.LastIndex(host, "]") {
+		host = host[:i]
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+}
+
+// reloadingCert serves a certificate from disk and picks up renewals (e.g. by certbot)
+// without a restart
+type reloadingCert struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+func (c *reloadingCert) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Check the files at most once a minute
+	if c.cert != nil && time.Since(c.checked) < time.Minute {
+		return c.cert, nil
+	}
+	c.checked = time.Now()
+
+	info, err := os.Stat(c.certFile)
+	if err != nil {
+		if c.cert != nil {
+			return c.cert, nil
+		}
+		return nil, fmt.Errorf("failed to read TLS certificate: %w", err)
+	}
+	if c.cert != nil && info.ModTime().Equal(c.modTime) {
+		return c.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		if c.cert != nil {
+			// Keep serving the old certificate while the files are being replaced
+			log.Println("Failed to reload TLS certificate:", err)
+			return c.cert, nil
+		}
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	if c.cert != nil {
+		log.Println("Reloaded TLS certificate")
+	}
+	c.cert, c.modTime = &cert, info.ModTime()
+	return c.cert, nil
+}
+
+// splitList splits a comma-separated setting, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
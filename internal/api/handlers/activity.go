@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/models"
+)
+
+// ListEvents returns the user's recent events from the event stream, oldest first, so
+// the dashboard can show recent activity after a reload. They come from the event log
+// kept for replay, so only the last EVENT_REPLAY_SIZE events are available.
+func ListEvents(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	limit := 50
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 500 {
+			limit = parsed
+		}
+	}
+
+	query := db.GetDB().Where("(user_id = 0 OR user_id = ?)", userID)
+	if since := c.Query("since"); since != "" {
+		// An event ID, to continue after the last event seen, or a time
+		if id, err := strconv.ParseUint(since, 10, 64); err == nil {
+			query = query.Where("id > ?", id)
+		} else if t, err := time.Parse(time.RFC3339, since); err == nil {
+			query = query.Where("timestamp > ?", t)
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since: must be an event ID or an RFC 3339 time"})
+			return
+		}
+	}
+	var types []string
+	for _, t := range strings.Split(c.Query("types"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+	if len(types) > 0 {
+		query = query.Where("type IN ?", types)
+	}
+
+	// The newest events, returned in the order they happened
+	events := []models.Event{}
+	if err := query.Order("id desc").Limit(limit).Find(&events).Error; err != nil {
+		fmt.Printf("[Events] Failed to list events: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list events"})
+		return
+	}
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"limit":  limit,
+	})
+}
@@ -1,13 +1,19 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/user/pinglater/internal/api/middleware"
 	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/ldapauth"
 	"github.com/user/pinglater/internal/models"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/user/pinglater/internal/passwords"
+	"gorm.io/gorm"
 )
 
 func Login(c *gin.Context) {
@@ -17,38 +23,258 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	// Refuse locked-out clients before checking the password
+	ip := c.ClientIP()
+	if wait := throttle.lockedFor(ip, req.Username); wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, try again later"})
+		return
+	}
+
 	database := db.GetDB()
 
 	// Find user by username
 	var user models.User
 	result := database.Where("username = ?", req.Username).First(&user)
-	if result.Error != nil {
+	found := result.Error == nil
+
+	// Unknown users and directory users are checked against LDAP when it's enabled;
+	// local users always use their local password
+	var err error
+	if (!found || user.AuthSource == models.AuthSourceLDAP) && ldapauth.Enabled() {
+		var existing *models.User
+		if found {
+			existing = &user
+		}
+		var ldapUser *models.User
+		ldapUser, err = loginLDAP(req, existing)
+		if err != nil && !errors.Is(err, ldapauth.ErrInvalidCredentials) && !errors.Is(err, ldapauth.ErrNotAuthorized) {
+			fmt.Printf("[Auth] LDAP login for %s failed: %v\n", req.Username, err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Directory server unavailable"})
+			return
+		}
+		if ldapUser != nil {
+			user = *ldapUser
+		}
+	} else if found && user.AuthSource != models.AuthSourceLDAP {
+		var needsRehash bool
+		needsRehash, err = passwords.Verify(req.Password, user.PasswordHash)
+		if err == nil && needsRehash {
+			// Migrate the stored hash to the configured algorithm/parameters
+			if newHash, hashErr := passwords.Hash(req.Password); hashErr == nil {
+				database.Model(&user).Update("password_hash", newHash)
+			}
+		}
+	} else {
+		err = ldapauth.ErrInvalidCredentials
+	}
+	if err != nil {
+		throttle.recordFailure(ip, req.Username)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
+	throttle.recordSuccess(req.Username)
 
-	// Check password
-	err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password))
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	if !user.IsActive {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account disabled"})
 		return
 	}
 
 	// Generate JWT token
-	token, err := middleware.GenerateToken(user.ID, user.Username)
+	token, err := middleware.GenerateToken(c, user.ID, user.Username, user.TokenVersion)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.LoginResponse{
+		Token:              token,
+		Username:           user.Username,
+		IsAdmin:            user.IsAdmin,
+		MustChangePassword: user.MustChangePassword,
+	})
+}
+
+// loginLDAP authenticates against the directory and creates the local user on first
+// login. When LDAP_ADMIN_GROUP is set the admin role follows group membership.
+func loginLDAP(req models.LoginRequest, existing *models.User) (*models.User, error) {
+	result, err := ldapauth.Authenticate(req.Username, req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	database := db.GetDB()
+	if existing == nil {
+		user := models.User{
+			Username:   req.Username,
+			AuthSource: models.AuthSourceLDAP,
+			IsAdmin:    result.IsAdmin,
+			IsActive:   true,
+		}
+		if err := database.Create(&user).Error; err != nil {
+			return nil, err
+		}
+		return &user, nil
+	}
+
+	if result.ManagesRoles && existing.IsAdmin != result.IsAdmin {
+		existing.IsAdmin = result.IsAdmin
+		if err := database.Model(existing).Update("is_admin", result.IsAdmin).Error; err != nil {
+			return nil, err
+		}
+	}
+	return existing, nil
+}
+
+// GetAuthStatus tells the login page whether any users exist yet
+func GetAuthStatus(c *gin.Context) {
+	var userCount int64
+	db.GetDB().Model(&models.User{}).Count(&userCount)
+
+	c.JSON(http.StatusOK, models.AuthStatusResponse{
+		UserCount:     userCount,
+		SetupRequired: userCount == 0,
+	})
+}
+
+// Setup creates the first admin on a fresh install and logs them in. It is refused
+// once any user exists.
+func Setup(c *gin.Context) {
+	var req models.LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if len(req.Password) < models.MinPasswordLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Password must be at least %d characters", models.MinPasswordLength)})
+		return
+	}
+
+	passwordHash, err := passwords.Hash(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	user := models.User{
+		Username:     req.Username,
+		PasswordHash: passwordHash,
+		IsAdmin:      true,
+		IsActive:     true,
+		AuthSource:   models.AuthSourceLocal,
+	}
+	errSetupDone := errors.New("setup already completed")
+	err = db.GetDB().Transaction(func(tx *gorm.DB) error {
+		var userCount int64
+		if err := tx.Model(&models.User{}).Count(&userCount).Error; err != nil {
+			return err
+		}
+		if userCount > 0 {
+			return errSetupDone
+		}
+		return tx.Create(&user).Error
+	})
+	if errors.Is(err, errSetupDone) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Setup has already been completed"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	token, err := middleware.GenerateToken(c, user.ID, user.Username, user.TokenVersion)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.LoginResponse{
+		Token:              token,
+		Username:           user.Username,
+		IsAdmin:            user.IsAdmin,
+		MustChangePassword: user.MustChangePassword,
+	})
+}
+
+// ChangePassword replaces the caller's password after checking the current one. All
+// existing sessions are logged out; the response carries a fresh token for the caller.
+func ChangePassword(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if len(req.NewPassword) < models.MinPasswordLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Password must be at least %d characters", models.MinPasswordLength)})
+		return
+	}
+
+	database := db.GetDB()
+
+	var user models.User
+	if err := database.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.AuthSource == models.AuthSourceLDAP {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is managed by the directory server"})
+		return
+	}
+
+	if _, err := passwords.Verify(req.CurrentPassword, user.PasswordHash); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+	if req.NewPassword == req.CurrentPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New password must differ from the current password"})
+		return
+	}
+
+	passwordHash, err := passwords.Hash(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	user.PasswordHash = passwordHash
+	user.TokenVersion++
+	user.MustChangePassword = false
+	err = database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"password_hash":        user.PasswordHash,
+			"token_version":        user.TokenVersion,
+			"must_change_password": false,
+		}).Error; err != nil {
+			return err
+		}
+		return middleware.RevokeUserSessions(tx, user.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	token, err := middleware.GenerateToken(c, user.ID, user.Username, user.TokenVersion)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
 	c.JSON(http.StatusOK, models.LoginResponse{
-		Token:    token,
-		Username: user.Username,
+		Token:              token,
+		Username:           user.Username,
+		IsAdmin:            user.IsAdmin,
+		MustChangePassword: user.MustChangePassword,
 	})
 }
 
+// Logout revokes the session of the JWT in the Authorization header, if any
 func Logout(c *gin.Context) {
-	// Client-side token removal, but we can add server-side token blacklist later
+	middleware.RevokeRequestSession(c)
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
 
@@ -57,7 +283,9 @@ func GetMe(c *gin.Context) {
 	username, _ := c.Get("username")
 
 	c.JSON(http.StatusOK, gin.H{
-		"user_id":  userID,
-		"username": username,
+		"user_id":              userID,
+		"username":             username,
+		"is_admin":             c.GetBool("isAdmin"),
+		"must_change_password": c.GetBool("mustChangePassword"),
 	})
 }
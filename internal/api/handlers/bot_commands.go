@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/models"
+	"github.com/user/pinglater/internal/services"
+)
+
+// ListBotCommands returns the user's bot commands
+func ListBotCommands(c *gin.Context) {
+	var commands []models.BotCommand
+	if err := db.GetDB().Where("user_id = ?", c.GetUint("userID")).Order("name").Find(&commands).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch commands"})
+		return
+	}
+
+	responses := make([]models.BotCommandResponse, len(commands))
+	for i := range commands {
+		responses[i] = commands[i].ToResponse()
+	}
+	c.JSON(http.StatusOK, gin.H{"prefix": services.CommandPrefix(), "commands": responses})
+}
+
+// CreateBotCommand creates a bot command for the user
+func CreateBotCommand(c *gin.Context) {
+	var req models.BotCommandRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	cmd := models.BotCommand{
+		UserID:   c.GetUint("userID"),
+		Name:     req.Name,
+		Action:   req.Action,
+		IsActive: true,
+	}
+	applyBotCommandRequest(&cmd, req)
+	if err := services.ValidateBotCommand(&cmd); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if botCommandNameTaken(cmd) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A command with this name already exists"})
+		return
+	}
+
+	if err := db.GetDB().Create(&cmd).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create command"})
+		return
+	}
+	c.JSON(http.StatusCreated, cmd.ToResponse())
+}
+
+// GetBotCommand returns one of the user's bot commands
+func GetBotCommand(c *gin.Context) {
+	var cmd models.BotCommand
+	if err := db.GetDB().Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("userID")).First(&cmd).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Command not found"})
+		return
+	}
+	c.JSON(http.StatusOK, cmd.ToResponse())
+}
+
+// UpdateBotCommand changes the fields of a bot command the request sets
+func UpdateBotCommand(c *gin.Context) {
+	var cmd models.BotCommand
+	if err := db.GetDB().Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("userID")).First(&cmd).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Command not found"})
+		return
+	}
+
+	var req models.BotCommandRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if req.Name != "" {
+		cmd.Name = req.Name
+	}
+	if req.Action != "" {
+		cmd.Action = req.Action
+	}
+	applyBotCommandRequest(&cmd, req)
+	if err := services.ValidateBotCommand(&cmd); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if botCommandNameTaken(cmd) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A command with this name already exists"})
+		return
+	}
+
+	if err := db.GetDB().Save(&cmd).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update command"})
+		return
+	}
+	c.JSON(http.StatusOK, cmd.ToResponse())
+}
+
+// DeleteBotCommand deletes a bot command
+func DeleteBotCommand(c *gin.Context) {
+	result := db.GetDB().Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("userID")).Delete(&models.BotCommand{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete command"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Command not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Command deleted successfully"})
+}
+
+// applyBotCommandRequest copies the optional fields the request sets
+func applyBotCommandRequest(cmd *models.BotCommand, req models.BotCommandRequest) {
+	if req.Description != nil {
+		cmd.Description = *req.Description
+	}
+	if req.IsActive != nil {
+		cmd.IsActive = *req.IsActive
+	}
+	if req.Template != nil {
+		cmd.Template = *req.Template
+	}
+	if req.WebhookID != nil {
+		cmd.WebhookID = req.WebhookID
+	}
+	if req.AllowedSenders != nil {
+		cmd.AllowedSenders = strings.Join(*req.AllowedSenders, ",")
+	}
+}
+
+// botCommandNameTaken reports whether another of the user's commands has the command's
+// name
+func botCommandNameTaken(cmd models.BotCommand) bool {
+	var count int64
+	db.GetDB().Model(&models.BotCommand{}).
+		Where("user_id = ? AND name = ? AND id <> ?", cmd.UserID, cmd.Name, cmd.ID).
+		Count(&count)
+	return count > 0
+}
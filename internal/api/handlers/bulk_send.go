@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/api/middleware"
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/models"
+	"github.com/user/pinglater/internal/services"
+	"github.com/user/pinglater/internal/whatsapp"
+	"gorm.io/gorm"
+)
+
+// maxBulkRecipients bounds the size of one bulk send
+const maxBulkRecipients = 1000
+
+// BulkMessage is one recipient's message in a bulk send
+type BulkMessage struct {
+	PhoneNumber string `json:"phone_number"`
+	Message     string `json:"message"`
+}
+
+// BulkSendRequest sends one message to many recipients (recipients and message), or
+// each recipient its own message (messages)
+type BulkSendRequest struct {
+	Recipients []string      `json:"recipients"`
+	Message    string        `json:"message"`
+	Messages   []BulkMessage `json:"messages"`
+	// Account to send from, by account ID or phone number; defaults to the linked account
+	Account string `json:"account,omitempty"`
+	// Send queue priority: high, normal (the default) or low
+	Priority string `json:"priority,omitempty"`
+}
+
+// SendBulkMessages queues a message for each recipient. The send queue sends them one
+// at a time, paced, and GetBulkSendJob reports their progress.
+func SendBulkMessages(c *gin.Context) {
+	var req BulkSendRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	messages := req.Messages
+	if len(req.Recipients) > 0 {
+		if len(messages) > 0 || req.Message == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: send recipients with a message, or messages"})
+			return
+		}
+		for _, phone := range req.Recipients {
+			messages = append(messages, BulkMessage{PhoneNumber: phone, Message: req.Message})
+		}
+	}
+	if len(messages) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: no recipients"})
+		return
+	}
+	priority, ok := models.NormalizeSendPriority(req.Priority)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: priority must be high, normal or low"})
+		return
+	}
+	if len(messages) > maxBulkRecipients {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Too many recipients: at most %d per request", maxBulkRecipients)})
+		return
+	}
+	for i, msg := range messages {
+		messages[i].PhoneNumber = strings.TrimPrefix(strings.TrimSpace(msg.PhoneNumber), "+")
+		if messages[i].PhoneNumber == "" || msg.Message == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: recipient %d needs a phone number and message", i+1)})
+			return
+		}
+	}
+
+	if status, message := checkSendAccount(c, whatsapp.GetClient(), req.Account); status != 0 {
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+
+	// Each recipient counts towards the token's daily quota
+	token, ok := takeMessageQuota(c, len(messages))
+	if !ok {
+		return
+	}
+
+	userID := c.GetUint("userID")
+	job := models.SendJob{UserID: userID}
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&job).Error; err != nil {
+			return err
+		}
+		queued := make([]models.OutgoingMessage, len(messages))
+		for i, msg := range messages {
+			queued[i] = models.OutgoingMessage{
+				UserID:      userID,
+				JobID:       &job.ID,
+				PhoneNumber: msg.PhoneNumber,
+				Message:     msg.Message,
+				Source:      models.MessageSourceBulk,
+				Priority:    priority,
+				TestMode:    isTestMode(c),
+			}
+		}
+		return services.GetSendQueue().Enqueue(tx, queued)
+	})
+	if err != nil {
+		if token != nil {
+			middleware.ReturnMessageQuotaN(token, len(messages))
+		}
+		fmt.Printf("[Send] Failed to queue bulk send: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue messages"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"job_id":     job.ID,
+		"queued":     len(messages),
+		"status_url": fmt.Sprintf("/api/whatsapp/send/bulk/%d", job.ID),
+	})
+}
+
+// takeMessageQuota counts n messages against the request's API token's daily quota,
+// all or none. It returns the token, nil for JWT requests, and false after responding
+// with an error when the quota can't take them.
+func takeMessageQuota(c *gin.Context, n int) (*models.APIToken, bool) {
+	value, exists := c.Get("apiToken")
+	if !exists {
+		return nil, true
+	}
+	token := value.(*models.APIToken)
+	allowed, remaining, reset, err := middleware.TakeMessageQuotaN(token, n)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check message quota"})
+		return nil, false
+	}
+	if token.MessagesPerDay > 0 {
+		c.Header("X-Quota-Limit", strconv.Itoa(token.MessagesPerDay))
+		c.Header("X-Quota-Remaining", strconv.Itoa(remaining))
+		c.Header("X-Quota-Reset", strconv.FormatInt(reset.Unix(), 10))
+	}
+	if !allowed {
+		c.Header("Retry-After", strconv.Itoa(int(time.Until(reset).Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("Daily message quota exceeded: %d messages left", remaining)})
+		return nil, false
+	}
+	return token, true
+}
+
+// GetBulkSendJob reports the progress of a bulk send and each recipient's status
+func GetBulkSendJob(c *gin.Context) {
+	var job models.SendJob
+	if err := db.GetDB().Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("userID")).First(&job).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Bulk send not found"})
+		return
+	}
+
+	var messages []models.OutgoingMessage
+	if err := db.GetDB().Where("job_id = ?", job.ID).Order("id").Find(&messages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load bulk send"})
+		return
+	}
+
+	counts := map[string]int{
+		models.SendStatusQueued:    0,
+		models.SendStatusSending:   0,
+		models.SendStatusSent:      0,
+		models.SendStatusDelivered: 0,
+		models.SendStatusRead:      0,
+		models.SendStatusFailed:    0,
+		models.SendStatusBlocked:   0,
+	}
+	for _, msg := range messages {
+		counts[msg.Status]++
+	}
+	status := "completed"
+	if pending := counts[models.SendStatusQueued] + counts[models.SendStatusSending]; pending == len(messages) {
+		status = "queued"
+	} else if pending > 0 {
+		status = "in_progress"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"job_id":     job.ID,
+		"status":     status,
+		"created_at": job.CreatedAt,
+		"total":      len(messages),
+		"counts":     counts,
+		"recipients": messages,
+	})
+}
+
+// QueuedMessageDone reports a message sent or failed by the send queue, like a message
+// sent directly through the API. Blocked messages were stopped on purpose, so they
+// aren't reported.
+func QueuedMessageDone(msg models.OutgoingMessage) {
+	if msg.Status == models.SendStatusBlocked {
+		return
+	}
+	if msg.Status == models.SendStatusFailed {
+		BroadcastUserEvent(msg.UserID, models.EventTypeConnectionError, "Failed to send message to "+msg.PhoneNumber, msg.Error)
+		return
+	}
+	content := msg.Message
+	if content == "" && msg.MediaFilename != "" {
+		content = "[" + msg.MediaFilename + "]"
+	}
+	recordSentMessage(msg.UserID, msg.PhoneNumber, content, msg.WhatsAppMessageID, msg.Source, msg.TestMode)
+}
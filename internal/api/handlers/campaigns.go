@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/api/middleware"
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/models"
+	"github.com/user/pinglater/internal/services"
+	"github.com/user/pinglater/internal/whatsapp"
+	"gorm.io/gorm"
+)
+
+// ListCampaigns returns the user's campaigns, newest first
+func ListCampaigns(c *gin.Context) {
+	var campaigns []models.Campaign
+	if err := db.GetDB().Where("user_id = ?", c.GetUint("userID")).Order("id DESC").Find(&campaigns).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch campaigns"})
+		return
+	}
+
+	responses := make([]models.CampaignResponse, len(campaigns))
+	for i := range campaigns {
+		responses[i] = campaigns[i].ToResponse()
+	}
+	c.JSON(http.StatusOK, gin.H{"campaigns": responses})
+}
+
+// CreateCampaign creates a draft campaign. SendCampaign sends it.
+func CreateCampaign(c *gin.Context) {
+	var req models.CampaignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	campaign := models.Campaign{
+		UserID: c.GetUint("userID"),
+		Name:   req.Name,
+		Status: models.CampaignStatusDraft,
+	}
+	applyCampaignRequest(&campaign, req)
+	if err := services.ValidateCampaign(&campaign); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := db.GetDB().Create(&campaign).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create campaign"})
+		return
+	}
+	c.JSON(http.StatusCreated, campaign.ToResponse())
+}
+
+// GetCampaign returns a campaign. Once it's sent, this includes its progress and each
+// recipient's status.
+func GetCampaign(c *gin.Context) {
+	campaign, ok := findCampaign(c)
+	if !ok {
+		return
+	}
+	if campaign.Status != models.CampaignStatusSent {
+		c.JSON(http.StatusOK, campaign.ToResponse())
+		return
+	}
+
+	recipients, err := services.CampaignRecipients(campaign.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load campaign recipients"})
+		return
+	}
+	counts := map[string]int{
+		models.SendStatusQueued:        0,
+		models.SendStatusSending:       0,
+		models.SendStatusSent:          0,
+		models.SendStatusDelivered:     0,
+		models.SendStatusRead:          0,
+		models.SendStatusFailed:        0,
+		models.SendStatusBlocked:       0,
+		models.RecipientStatusOptedOut: 0,
+	}
+	for _, recipient := range recipients {
+		counts[recipient.Status]++
+	}
+	progress := "completed"
+	if counts[models.SendStatusQueued]+counts[models.SendStatusSending] > 0 {
+		progress = "in_progress"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"campaign":   campaign.ToResponse(),
+		"progress":   progress,
+		"total":      len(recipients),
+		"counts":     counts,
+		"recipients": recipients,
+	})
+}
+
+// GetCampaignStats returns a campaign's delivery funnel: how many recipients' messages
+// were sent, delivered and read, how many failed, and how many recipients replied
+func GetCampaignStats(c *gin.Context) {
+	campaign, ok := findCampaign(c)
+	if !ok {
+		return
+	}
+
+	stats, err := services.CampaignStats(campaign.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute campaign stats"})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// UpdateCampaign changes the fields of a draft campaign the request sets
+func UpdateCampaign(c *gin.Context) {
+	campaign, ok := findCampaign(c)
+	if !ok {
+		return
+	}
+	if campaign.Status != models.CampaignStatusDraft {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only draft campaigns can be changed"})
+		return
+	}
+
+	var req models.CampaignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if req.Name != "" {
+		campaign.Name = req.Name
+	}
+	applyCampaignRequest(campaign, req)
+	if err := services.ValidateCampaign(campaign); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := db.GetDB().Save(campaign).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update campaign"})
+		return
+	}
+	c.JSON(http.StatusOK, campaign.ToResponse())
+}
+
+// DeleteCampaign deletes a campaign and its recipients. Messages it queued are still
+// sent.
+func DeleteCampaign(c *gin.Context) {
+	campaign, ok := findCampaign(c)
+	if !ok {
+		return
+	}
+
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("campaign_id = ?", campaign.ID).Delete(&models.CampaignRecipient{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(campaign).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete campaign"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Campaign deleted successfully"})
+}
+
+// SendCampaign queues a draft campaign's message to each contact on its list, except
+// those who opted out. The send queue paces them like a bulk send, and GetCampaign
+// reports their progress. With a future send_at, the campaign is scheduled instead,
+// and the campaign scheduler sends it then.
+func SendCampaign(c *gin.Context) {
+	campaign, ok := findCampaign(c)
+	if !ok {
+		return
+	}
+	switch campaign.Status {
+	case models.CampaignStatusScheduled:
+		c.JSON(http.StatusConflict, gin.H{"error": "Campaign already scheduled; unschedule it first"})
+		return
+	case models.CampaignStatusSent:
+		c.JSON(http.StatusConflict, gin.H{"error": "Campaign already sent"})
+		return
+	}
+
+	var req models.SendCampaignRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if isTestMode(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Campaigns can't be sent with a test-mode API token"})
+		return
+	}
+	if status, message := checkSendAccount(c, whatsapp.GetClient(), ""); status != 0 {
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+
+	if req.SendAt != nil && req.SendAt.After(time.Now()) {
+		scheduleCampaign(c, campaign, *req.SendAt)
+		return
+	}
+
+	recipients, messages, err := services.PrepareCampaign(campaign)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Each message counts towards the token's daily quota
+	token, ok := takeMessageQuota(c, len(messages))
+	if !ok {
+		return
+	}
+
+	if err := services.QueueCampaign(campaign, recipients, messages); err != nil {
+		if token != nil {
+			middleware.ReturnMessageQuotaN(token, len(messages))
+		}
+		if errors.Is(err, services.ErrCampaignSent) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Campaign already sent"})
+			return
+		}
+		fmt.Printf("[Campaigns] Failed to queue campaign %d: %v\n", campaign.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue campaign"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"campaign_id": campaign.ID,
+		"queued":      len(messages),
+		"opted_out":   len(recipients) - len(messages),
+		"status_url":  fmt.Sprintf("/api/campaigns/%d", campaign.ID),
+	})
+}
+
+// scheduleCampaign schedules a draft campaign for sendAt. Its messages are only worked
+// out then, so they can't count towards an API token's daily quota; tokens with a quota
+// have to send campaigns right away.
+func scheduleCampaign(c *gin.Context, campaign *models.Campaign, sendAt time.Time) {
+	if value, exists := c.Get("apiToken"); exists && value.(*models.APIToken).MessagesPerDay > 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API tokens with a daily message quota can't schedule campaigns"})
+		return
+	}
+	if err := services.ScheduleCampaign(campaign, sendAt); err != nil {
+		if errors.Is(err, services.ErrCampaignSent) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Campaign already sent or scheduled"})
+			return
+		}
+		fmt.Printf("[Campaigns] Failed to schedule campaign %d: %v\n", campaign.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule campaign"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"campaign_id":  campaign.ID,
+		"status":       campaign.Status,
+		"scheduled_at": campaign.ScheduledAt,
+		"status_url":   fmt.Sprintf("/api/campaigns/%d", campaign.ID),
+	})
+}
+
+// UnscheduleCampaign makes a scheduled campaign a draft again, so it can be changed or
+// sent now
+func UnscheduleCampaign(c *gin.Context) {
+	campaign, ok := findCampaign(c)
+	if !ok {
+		return
+	}
+
+	if err := services.UnscheduleCampaign(campaign); err != nil {
+		if errors.Is(err, services.ErrCampaignNotScheduled) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Campaign isn't scheduled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unschedule campaign"})
+		return
+	}
+	c.JSON(http.StatusOK, campaign.ToResponse())
+}
+
+// applyCampaignRequest copies the optional fields the request sets
+func applyCampaignRequest(campaign *models.Campaign, req models.CampaignRequest) {
+	if req.ListID != nil {
+		campaign.ListID = *req.ListID
+	}
+	if req.Tags != nil {
+		campaign.Tags = strings.Join(*req.Tags, ",")
+	}
+	if req.Template != nil {
+		campaign.Template = *req.Template
+	}
+	if req.Priority != nil {
+		campaign.Priority = *req.Priority
+	}
+}
+
+// findCampaign loads the user's campaign named by the :id parameter, writing an error
+// response if it doesn't exist
+func findCampaign(c *gin.Context) (*models.Campaign, bool) {
+	var campaign models.Campaign
+	if err := db.GetDB().Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("userID")).First(&campaign).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
+		return nil, false
+	}
+	return &campaign, true
+}
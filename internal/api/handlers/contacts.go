@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/models"
+	"github.com/user/pinglater/internal/services"
+	"gorm.io/gorm"
+)
+
+// maxContactsPerRequest bounds the contacts added by one request, like bulk sends
+const maxContactsPerRequest = 1000
+
+// AddContactsRequest adds contacts to a list
+type AddContactsRequest struct {
+	Contacts []models.ContactRequest `json:"contacts"`
+}
+
+// ListContactLists returns the user's contact lists with how many contacts each has
+func ListContactLists(c *gin.Context) {
+	var lists []models.ContactList
+	if err := db.GetDB().Where("user_id = ?", c.GetUint("userID")).Order("name").Find(&lists).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch contact lists"})
+		return
+	}
+
+	responses := make([]models.ContactListResponse, len(lists))
+	for i := range lists {
+		responses[i] = contactListResponse(&lists[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"lists": responses})
+}
+
+// CreateContactList creates a contact list for the user
+func CreateContactList(c *gin.Context) {
+	var req models.ContactListRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	list := models.ContactList{UserID: c.GetUint("userID"), Name: req.Name}
+	if req.Description != nil {
+		list.Description = *req.Description
+	}
+	if err := services.ValidateContactList(&list); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if contactListNameTaken(&list) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A contact list with this name already exists"})
+		return
+	}
+
+	if err := db.GetDB().Create(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create contact list"})
+		return
+	}
+	c.JSON(http.StatusCreated, contactListResponse(&list))
+}
+
+// GetContactList returns one of the user's contact lists
+func GetContactList(c *gin.Context) {
+	list, ok := findContactList(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, contactListResponse(list))
+}
+
+// UpdateContactList changes the fields of a contact list the request sets
+func UpdateContactList(c *gin.Context) {
+	list, ok := findContactList(c)
+	if !ok {
+		return
+	}
+
+	var req models.ContactListRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if req.Name != "" {
+		list.Name = req.Name
+	}
+	if req.Description != nil {
+		list.Description = *req.Description
+	}
+	if err := services.ValidateContactList(list); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if contactListNameTaken(list) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A contact list with this name already exists"})
+		return
+	}
+
+	if err := db.GetDB().Save(list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update contact list"})
+		return
+	}
+	c.JSON(http.StatusOK, contactListResponse(list))
+}
+
+// DeleteContactList deletes a contact list and its contacts. Campaigns already sent to
+// it keep their recipients.
+func DeleteContactList(c *gin.Context) {
+	list, ok := findContactList(c)
+	if !ok {
+		return
+	}
+
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("list_id = ?", list.ID).Delete(&models.Contact{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(list).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete contact list"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Contact list deleted successfully"})
+}
+
+// ListContacts returns the contacts on a list, optionally only those with a tag
+func ListContacts(c *gin.Context) {
+	list, ok := findContactList(c)
+	if !ok {
+		return
+	}
+
+	var contacts []models.Contact
+	if err := db.GetDB().Where("list_id = ?", list.ID).Order("id").Find(&contacts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch contacts"})
+		return
+	}
+	if tag := c.Query("tag"); tag != "" {
+		tagged := contacts[:0]
+		for _, contact := range contacts {
+			if contact.HasAnyTag([]string{tag}) {
+				tagged = append(tagged, contact)
+			}
+		}
+		contacts = tagged
+	}
+
+	phones := make([]string, len(contacts))
+	for i, contact := range contacts {
+		phones[i] = contact.PhoneNumber
+	}
+	optedOut, err := services.OptedOutNumbers(list.UserID, phones)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch contacts"})
+		return
+	}
+
+	responses := make([]models.ContactResponse, len(contacts))
+	for i := range contacts {
+		responses[i] = contacts[i].ToResponse(optedOut[contacts[i].PhoneNumber])
+	}
+	c.JSON(http.StatusOK, gin.H{"contacts": responses})
+}
+
+// AddContacts adds contacts to a list. A phone number already on the list updates that
+// contact instead: its name if given, and the tags and variables are added to its own.
+func AddContacts(c *gin.Context) {
+	list, ok := findContactList(c)
+	if !ok {
+		return
+	}
+
+	var req AddContactsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if len(req.Contacts) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: no contacts"})
+		return
+	}
+	if len(req.Contacts) > maxContactsPerRequest {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Too many contacts: at most %d per request", maxContactsPerRequest)})
+		return
+	}
+	for i := range req.Contacts {
+		req.Contacts[i].PhoneNumber = models.NormalizePhoneNumber(req.Contacts[i].PhoneNumber)
+		if req.Contacts[i].PhoneNumber == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: contact %d needs a phone number", i+1)})
+			return
+		}
+	}
+
+	added, updated := 0, 0
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		added, updated = 0, 0
+		for _, entry := range req.Contacts {
+			var existing []models.Contact
+			if err := tx.Where("list_id = ? AND phone_number = ?", list.ID, entry.PhoneNumber).Limit(1).Find(&existing).Error; err != nil {
+				return err
+			}
+			contact := models.Contact{ListID: list.ID, PhoneNumber: entry.PhoneNumber}
+			if len(existing) > 0 {
+				contact = existing[0]
+				updated++
+			} else {
+				added++
+			}
+			if entry.Name != nil {
+				contact.Name = strings.TrimSpace(*entry.Name)
+			}
+			tags := contact.GetTags()
+			for _, tag := range entry.Tags {
+				if tag = strings.TrimSpace(tag); tag != "" && !contact.HasAnyTag([]string{tag}) {
+					tags = append(tags, tag)
+					contact.Tags = strings.Join(tags, ",")
+				}
+			}
+			if len(entry.Variables) > 0 {
+				variables := contact.GetVariables()
+				for name, value := range entry.Variables {
+					if value == "" {
+						delete(variables, name)
+					} else {
+						variables[name] = value
+					}
+				}
+				contact.SetVariables(variables)
+			}
+			if err := tx.Save(&contact).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("[Contacts] Failed to add contacts to list %d: %v\n", list.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add contacts"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"added": added, "updated": updated})
+}
+
+// DeleteContact removes a contact from a list
+func DeleteContact(c *gin.Context) {
+	list, ok := findContactList(c)
+	if !ok {
+		return
+	}
+
+	result := db.GetDB().Where("id = ? AND list_id = ?", c.Param("contactId"), list.ID).Delete(&models.Contact{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete contact"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Contact not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Contact deleted successfully"})
+}
+
+// ListOptOuts returns the phone numbers that opted out of the user's campaigns
+func ListOptOuts(c *gin.Context) {
+	var optOuts []models.ContactOptOut
+	if err := db.GetDB().Where("user_id = ?", c.GetUint("userID")).Order("created_at DESC").Find(&optOuts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch opt-outs"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"opt_outs": optOuts})
+}
+
+// CreateOptOut opts a phone number out of the user's campaigns, e.g. when they asked
+// some other way than messaging an opt-out keyword
+func CreateOptOut(c *gin.Context) {
+	var req struct {
+		PhoneNumber string `json:"phone_number"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if models.NormalizePhoneNumber(req.PhoneNumber) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "phone_number is required"})
+		return
+	}
+
+	if err := services.RecordOptOut(c.GetUint("userID"), req.PhoneNumber, "api"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record opt-out"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Phone number opted out"})
+}
+
+// DeleteOptOut opts a phone number back in to the user's campaigns
+func DeleteOptOut(c *gin.Context) {
+	phone := models.NormalizePhoneNumber(c.Param("phone"))
+	result := db.GetDB().Where("user_id = ? AND phone_number = ?", c.GetUint("userID"), phone).Delete(&models.ContactOptOut{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete opt-out"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Opt-out not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Phone number opted back in"})
+}
+
+// findContactList loads the user's contact list named by the :id parameter, writing an
+// error response if it doesn't exist
+func findContactList(c *gin.Context) (*models.ContactList, bool) {
+	var list models.ContactList
+	if err := db.GetDB().Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("userID")).First(&list).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Contact list not found"})
+		return nil, false
+	}
+	return &list, true
+}
+
+// contactListNameTaken reports whether another of the user's lists has the list's name
+func contactListNameTaken(list *models.ContactList) bool {
+	var count int64
+	db.GetDB().Model(&models.ContactList{}).
+		Where("user_id = ? AND name = ? AND id <> ?", list.UserID, list.Name, list.ID).
+		Count(&count)
+	return count > 0
+}
+
+// contactListResponse converts a contact list to its API form
+func contactListResponse(list *models.ContactList) models.ContactListResponse {
+	response := models.ContactListResponse{ContactList: *list}
+	db.GetDB().Model(&models.Contact{}).Where("list_id = ?", list.ID).Count(&response.ContactCount)
+	return response
+}
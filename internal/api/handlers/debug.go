@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/services"
+)
+
+// GetRuntimeStats returns goroutine, memory and GC statistics, for spotting leaks
+// without taking a profile
+func GetRuntimeStats(c *gin.Context) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	var lastGC *time.Time
+	if mem.LastGC > 0 {
+		t := time.Unix(0, int64(mem.LastGC))
+		lastGC = &t
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"uptime_seconds": int64(time.Since(startedAt).Seconds()),
+		"go_version":     runtime.Version(),
+		"goroutines":     runtime.NumGoroutine(),
+		"gomaxprocs":     runtime.GOMAXPROCS(0),
+		"num_cpu":        runtime.NumCPU(),
+		"memory": gin.H{
+			"heap_alloc_bytes":  mem.HeapAlloc,
+			"heap_inuse_bytes":  mem.HeapInuse,
+			"heap_objects":      mem.HeapObjects,
+			"stack_inuse_bytes": mem.StackInuse,
+			"sys_bytes":         mem.Sys,
+			"total_alloc_bytes": mem.TotalAlloc,
+			"next_gc_bytes":     mem.NextGC,
+			"gc_cycles":         mem.NumGC,
+			"gc_pause_total_ns": mem.PauseTotalNs,
+			"gc_cpu_fraction":   mem.GCCPUFraction,
+			"last_gc":           lastGC,
+		},
+		"webhooks_in_flight": services.GetWebhookService().PipelineMetrics().InFlight,
+	})
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/openapi"
+)
+
+// swaggerUIVersion pins the Swagger UI assets loaded from the CDN
+const swaggerUIVersion = "5.17.14"
+
+var swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>PingLater API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@` + swaggerUIVersion + `/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@` + swaggerUIVersion + `/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({
+      url: "/api/docs/openapi.json",
+      dom_id: "#swagger-ui",
+      persistAuthorization: true
+    });
+  </script>
+</body>
+</html>
+`
+
+// GetAPIDocs serves Swagger UI for the OpenAPI document
+func GetAPIDocs(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUIPage))
+}
+
+// GetOpenAPISpec returns the OpenAPI document as JSON
+func GetOpenAPISpec(c *gin.Context) {
+	spec, err := openapi.JSON()
+	if err != nil {
+		fmt.Printf("[Docs] Failed to load OpenAPI document: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load API documentation"})
+		return
+	}
+	c.Data(http.StatusOK, "application/json", spec)
+}
+
+// GetOpenAPISpecYAML returns the OpenAPI document as YAML
+func GetOpenAPISpecYAML(c *gin.Context) {
+	c.Data(http.StatusOK, "application/yaml", openapi.YAML())
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/models"
+)
+
+// trimEvery is how many events are recorded between trims of the event log
+const trimEvery = 50
+
+var (
+	// eventReplaySize is how many recent events are kept for clients reconnecting with
+	// Last-Event-ID; 0 disables recording
+	eventReplaySize = 1000
+	// eventLogMu keeps event IDs in the order events are broadcast
+	eventLogMu      sync.Mutex
+	eventsSinceTrim int
+)
+
+// ConfigureEventReplay sets how many recent events are kept in the database, so
+// reconnecting event stream clients get the events they missed
+func ConfigureEventReplay(size int) {
+	eventLogMu.Lock()
+	defer eventLogMu.Unlock()
+	eventReplaySize = size
+}
+
+// recordEvent stores the event, assigning its ID, and drops events that fell out of the
+// replay buffer. Callers hold eventLogMu.
+func recordEvent(event *models.Event) {
+	database := db.GetDB()
+	if eventReplaySize <= 0 || database == nil {
+		return
+	}
+	if err := database.Create(event).Error; err != nil {
+		fmt.Printf("[Events] Failed to record event: %v\n", err)
+		return
+	}
+
+	eventsSinceTrim++
+	if eventsSinceTrim >= trimEvery && event.ID > uint(eventReplaySize) {
+		eventsSinceTrim = 0
+		database.Where("id <= ?", event.ID-uint(eventReplaySize)).Delete(&models.Event{})
+	}
+}
+
+// missedEvents returns the user's events after lastID, oldest first. gap reports that
+// some of the events the client missed are older than the replay buffer.
+func missedEvents(userID, lastID uint) (events []models.Event, gap bool) {
+	database := db.GetDB()
+	if eventReplaySize <= 0 || database == nil {
+		return nil, false
+	}
+
+	// The log is trimmed in batches, so bound the replay by ID rather than by row count
+	var newest uint
+	database.Model(&models.Event{}).Select("COALESCE(MAX(id), 0)").Scan(&newest)
+	after := lastID
+	if newest > uint(eventReplaySize) && after < newest-uint(eventReplaySize) {
+		after = newest - uint(eventReplaySize)
+		gap = true
+	}
+
+	database.Where("id > ? AND (user_id = 0 OR user_id = ?)", after, userID).Order("id").Find(&events)
+	return events, gap
+}
+
+// lastEventID returns the ID of the last event a reconnecting client received, from
+// the Last-Event-ID header EventSource sends or the last_event_id query parameter
+func lastEventID(c *gin.Context) (uint, bool) {
+	value := c.GetHeader("Last-Event-ID")
+	if value == "" {
+		value = c.Query("last_event_id")
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// eventTypeFilter returns whether an event matches the comma-separated types query
+// parameter; without it every event matches
+func eventTypeFilter(c *gin.Context) func(models.EventType) bool {
+	types := make(map[models.EventType]bool)
+	for _, t := range strings.Split(c.Query("types"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types[models.EventType(t)] = true
+		}
+	}
+	return func(t models.EventType) bool {
+		return len(types) == 0 || types[t]
+	}
+}
+
+// writeSSEvent sends an event with its ID, so clients can resume after it
+func writeSSEvent(c *gin.Context, event models.Event) {
+	var id string
+	if event.ID != 0 {
+		id = strconv.FormatUint(uint64(event.ID), 10)
+	}
+	c.Render(-1, sse.Event{
+		Id:    id,
+		Event: string(event.Type),
+		Data: gin.H{
+			"message":   event.Message,
+			"details":   event.Details,
+			"timestamp": event.Timestamp,
+		},
+	})
+	c.Writer.Flush()
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/services"
+	"github.com/user/pinglater/internal/version"
+	"github.com/user/pinglater/internal/whatsapp"
+)
+
+// healthCheckTimeout bounds each dependency check, so a hung database fails the probe
+// instead of stalling it
+const healthCheckTimeout = 2 * time.Second
+
+var startedAt = time.Now()
+
+// Liveness reports that the process is up and serving requests
+func Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readiness reports whether the dependencies needed to serve requests are available:
+// the database and the WhatsApp device store
+func Readiness(c *gin.Context) {
+	checks, ok := readinessChecks(c.Request.Context())
+	status, code := "ready", http.StatusOK
+	if !ok {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{"status": status, "checks": checks})
+}
+
+// GetHealth returns a detailed health report for uptime monitors. It answers 503 when
+// not ready, and reports "degraded" while WhatsApp is disconnected or the connection
+// is unhealthy.
+func GetHealth(c *gin.Context) {
+	checks, ok := readinessChecks(c.Request.Context())
+
+	client := whatsapp.GetClient()
+	waStatus := client.GetStatus()
+	webhookService := services.GetWebhookService()
+	pipeline := webhookService.PipelineMetrics()
+
+	status, code := "healthy", http.StatusOK
+	switch {
+	case !ok:
+		status, code = "unhealthy", http.StatusServiceUnavailable
+	case !waStatus.Connected || waStatus.Degraded || !webhookService.Running():
+		status = "degraded"
+	}
+
+	c.JSON(code, gin.H{
+		"status":         status,
+		"version":        version.Get().Version,
+		"uptime_seconds": int64(time.Since(startedAt).Seconds()),
+		"checks":         checks,
+		"whatsapp": gin.H{
+			"connected":       waStatus.Connected,
+			"reconnecting":    client.IsReconnecting(),
+			"degraded":        waStatus.Degraded,
+			"degraded_reason": waStatus.DegradedReason,
+		},
+		"instance": gin.H{
+			"id":     services.GetLeaderElection().InstanceID(),
+			"leader": services.IsLeader(),
+		},
+		"webhooks": gin.H{
+			"running":       webhookService.Running(),
+			"workers":       pipeline.Workers,
+			"queue_depth":   pipeline.QueueDepth,
+			"retry_backlog": pipeline.RetryBacklog,
+			"retries_due":   pipeline.RetriesDue,
+		},
+	})
+}
+
+// readinessChecks checks the database and the WhatsApp device store, returning "ok" or
+// the error for each
+func readinessChecks(ctx context.Context) (gin.H, bool) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	checks := gin.H{"database": "ok", "whatsapp_store": "ok"}
+	ok := true
+
+	database := db.GetDB()
+	if database == nil {
+		checks["database"], ok = "not connected", false
+	} else if sqlDB, err := database.DB(); err != nil {
+		checks["database"], ok = err.Error(), false
+	} else if err := sqlDB.PingContext(ctx); err != nil {
+		checks["database"], ok = err.Error(), false
+	}
+
+	if err := whatsapp.GetClient().CheckStore(ctx); err != nil {
+		checks["whatsapp_store"], ok = err.Error(), false
+	}
+	return checks, ok
+}
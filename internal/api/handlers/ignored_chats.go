@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/models"
+	"github.com/user/pinglater/internal/services"
+)
+
+// ListIgnoredChats returns the user's ignore list
+func ListIgnoredChats(c *gin.Context) {
+	entries := []models.IgnoredChat{}
+	if err := db.GetDB().Where("user_id = ?", c.GetUint("userID")).Order("id").Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ignored chats"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ignored_chats": entries})
+}
+
+// CreateIgnoredChat adds a chat or JID pattern to the user's ignore list
+func CreateIgnoredChat(c *gin.Context) {
+	var req models.IgnoredChatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	pattern, err := models.NormalizeChatPattern(req.Pattern)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetUint("userID")
+	var count int64
+	db.GetDB().Model(&models.IgnoredChat{}).Where("user_id = ? AND pattern = ?", userID, pattern).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "This chat is already ignored"})
+		return
+	}
+
+	entry := models.IgnoredChat{UserID: userID, Pattern: pattern, Note: req.Note}
+	if err := db.GetDB().Create(&entry).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to ignore chat"})
+		return
+	}
+	services.InvalidateIgnoreList(userID)
+	c.JSON(http.StatusCreated, entry)
+}
+
+// DeleteIgnoredChat removes an entry from the user's ignore list
+func DeleteIgnoredChat(c *gin.Context) {
+	userID := c.GetUint("userID")
+	result := db.GetDB().Where("id = ? AND user_id = ?", c.Param("id"), userID).Delete(&models.IgnoredChat{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete ignored chat"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ignored chat not found"})
+		return
+	}
+	services.InvalidateIgnoreList(userID)
+	c.JSON(http.StatusOK, gin.H{"message": "Chat no longer ignored"})
+}
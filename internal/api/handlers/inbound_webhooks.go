@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/models"
+	"github.com/user/pinglater/internal/services"
+)
+
+// ListInboundWebhooks returns the user's inbound webhooks
+func ListInboundWebhooks(c *gin.Context) {
+	var hooks []models.InboundWebhook
+	if err := db.GetDB().Where("user_id = ?", c.GetUint("userID")).Order("name").Find(&hooks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch inbound webhooks"})
+		return
+	}
+
+	responses := make([]models.InboundWebhookResponse, len(hooks))
+	for i := range hooks {
+		responses[i] = hooks[i].ToResponse()
+	}
+	c.JSON(http.StatusOK, gin.H{"inbound_webhooks": responses})
+}
+
+// CreateInboundWebhook creates an inbound webhook for the user
+func CreateInboundWebhook(c *gin.Context) {
+	var req models.InboundWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	hook := models.InboundWebhook{
+		UserID:   c.GetUint("userID"),
+		Name:     req.Name,
+		Template: req.Template,
+		IsActive: true,
+	}
+	applyInboundWebhookRequest(&hook, req)
+	if err := services.ValidateInboundWebhook(&hook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if inboundWebhookNameTaken(hook) {
+		c.JSON(http.StatusConflict, gin.H{"error": "An inbound webhook with this name already exists"})
+		return
+	}
+
+	if err := db.GetDB().Create(&hook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create inbound webhook"})
+		return
+	}
+	c.JSON(http.StatusCreated, hook.ToResponse())
+}
+
+// GetInboundWebhook returns one of the user's inbound webhooks
+func GetInboundWebhook(c *gin.Context) {
+	var hook models.InboundWebhook
+	if err := db.GetDB().Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("userID")).First(&hook).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Inbound webhook not found"})
+		return
+	}
+	c.JSON(http.StatusOK, hook.ToResponse())
+}
+
+// UpdateInboundWebhook changes the fields of an inbound webhook the request sets
+func UpdateInboundWebhook(c *gin.Context) {
+	var hook models.InboundWebhook
+	if err := db.GetDB().Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("userID")).First(&hook).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Inbound webhook not found"})
+		return
+	}
+
+	var req models.InboundWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if req.Name != "" {
+		hook.Name = req.Name
+	}
+	if req.Template != "" {
+		hook.Template = req.Template
+	}
+	applyInboundWebhookRequest(&hook, req)
+	if err := services.ValidateInboundWebhook(&hook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if inboundWebhookNameTaken(hook) {
+		c.JSON(http.StatusConflict, gin.H{"error": "An inbound webhook with this name already exists"})
+		return
+	}
+
+	if err := db.GetDB().Save(&hook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update inbound webhook"})
+		return
+	}
+	c.JSON(http.StatusOK, hook.ToResponse())
+}
+
+// DeleteInboundWebhook deletes an inbound webhook
+func DeleteInboundWebhook(c *gin.Context) {
+	result := db.GetDB().Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("userID")).Delete(&models.InboundWebhook{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete inbound webhook"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Inbound webhook not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Inbound webhook deleted successfully"})
+}
+
+// applyInboundWebhookRequest copies the optional fields the request sets
+func applyInboundWebhookRequest(hook *models.InboundWebhook, req models.InboundWebhookRequest) {
+	if req.Description != nil {
+		hook.Description = *req.Description
+	}
+	if req.IsActive != nil {
+		hook.IsActive = *req.IsActive
+	}
+	if req.Recipients != nil {
+		hook.SetRecipients(*req.Recipients)
+	}
+	if req.Routes != nil {
+		hook.SetRoutes(*req.Routes)
+	}
+}
+
+// inboundWebhookNameTaken reports whether another of the user's inbound webhooks has
+// the webhook's name
+func inboundWebhookNameTaken(hook models.InboundWebhook) bool {
+	var count int64
+	db.GetDB().Model(&models.InboundWebhook{}).
+		Where("user_id = ? AND name = ? AND id <> ?", hook.UserID, hook.Name, hook.ID).
+		Count(&count)
+	return count > 0
+}
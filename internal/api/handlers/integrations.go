@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/api/middleware"
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/models"
+	"github.com/user/pinglater/internal/services"
+	"github.com/user/pinglater/internal/whatsapp"
+)
+
+// ReceiveAlertmanagerNotification sends a Prometheus Alertmanager webhook notification to
+// the WhatsApp recipients configured for its alerts' severity
+func ReceiveAlertmanagerNotification(c *gin.Context) {
+	receiveAlerts(c, services.AlertReceiverAlertmanager, "Alertmanager", models.MessageSourceAlertmanager)
+}
+
+// ReceiveGrafanaNotification sends a Grafana alerting webhook notification to the
+// WhatsApp recipients configured for its alerts' severity
+func ReceiveGrafanaNotification(c *gin.Context) {
+	receiveAlerts(c, services.AlertReceiverGrafana, "Grafana", models.MessageSourceGrafana)
+}
+
+func receiveAlerts(c *gin.Context, kind, name, source string) {
+	if !services.AlertReceiverEnabled(kind) {
+		c.JSON(http.StatusNotFound, gin.H{"error": name + " integration is not configured"})
+		return
+	}
+
+	payload, ok := readIntegrationBody(c)
+	if !ok {
+		return
+	}
+
+	rendered, err := services.RenderAlertMessages(kind, payload)
+	if errors.Is(err, services.ErrInvalidAlertPayload) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Printf("[%s] %v\n", name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetUint("userID")
+	var messages []models.OutgoingMessage
+	for _, msg := range rendered {
+		for _, recipient := range msg.Recipients {
+			messages = append(messages, models.OutgoingMessage{
+				UserID:      userID,
+				PhoneNumber: recipient,
+				Message:     msg.Message,
+				Source:      source,
+			})
+		}
+	}
+	queueIntegrationMessages(c, name, messages)
+}
+
+// ReceiveInboundWebhook renders a request with the user's inbound webhook of that name
+// and sends the message to the recipients its routes pick
+func ReceiveInboundWebhook(c *gin.Context) {
+	var hook models.InboundWebhook
+	if err := db.GetDB().Where("user_id = ? AND name = ?", c.GetUint("userID"), c.Param("name")).First(&hook).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Inbound webhook not found"})
+		return
+	}
+	if !hook.IsActive {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Inbound webhook is disabled"})
+		return
+	}
+
+	payload, ok := readIntegrationBody(c)
+	if !ok {
+		return
+	}
+
+	message, recipients, err := services.RenderInboundWebhook(&hook, payload)
+	if err != nil {
+		// Templates are checked when saved, so it's the request that doesn't fit
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	var messages []models.OutgoingMessage
+	if message != "" {
+		for _, recipient := range recipients {
+			messages = append(messages, models.OutgoingMessage{
+				UserID:      hook.UserID,
+				PhoneNumber: recipient,
+				Message:     message,
+				Source:      models.MessageSourceInboundWebhook,
+			})
+		}
+	}
+	queueIntegrationMessages(c, "Inbound", messages)
+}
+
+// readIntegrationBody reads a receiver's request body, responding with an error when
+// it can't
+func readIntegrationBody(c *gin.Context) ([]byte, bool) {
+	payload, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body too large"})
+			return nil, false
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return nil, false
+	}
+	return payload, true
+}
+
+// queueIntegrationMessages queues a receiver's messages for the send queue, so they're
+// paced and not lost while WhatsApp reconnects. Every message counts towards the API
+// token's daily quota.
+func queueIntegrationMessages(c *gin.Context, name string, messages []models.OutgoingMessage) {
+	if len(messages) == 0 {
+		c.JSON(http.StatusOK, gin.H{"queued": 0})
+		return
+	}
+
+	if status, message := checkSendAccount(c, whatsapp.GetClient(), ""); status != 0 {
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+	token, ok := takeMessageQuota(c, len(messages))
+	if !ok {
+		return
+	}
+
+	for i := range messages {
+		messages[i].TestMode = isTestMode(c)
+	}
+	if err := services.GetSendQueue().Enqueue(db.GetDB(), messages); err != nil {
+		if token != nil {
+			middleware.ReturnMessageQuotaN(token, len(messages))
+		}
+		fmt.Printf("[%s] Failed to queue messages: %v\n", name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue messages"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"queued": len(messages)})
+}
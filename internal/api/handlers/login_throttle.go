@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/models"
+	"github.com/user/pinglater/internal/services"
+)
+
+// LoginThrottleConfig controls brute-force protection on /auth/login. A client IP or
+// username is locked out after too many failed logins in a row; each further lockout
+// of the same key doubles in length up to MaxLockout.
+type LoginThrottleConfig struct {
+	MaxFailures   int           // Failures per username before a lockout (0 disables)
+	MaxIPFailures int           // Failures per client IP before a lockout (0 disables)
+	Lockout       time.Duration // Length of the first lockout
+	MaxLockout    time.Duration // Upper bound for repeated lockouts
+}
+
+// loginAttempts tracks the failed logins of one IP or username
+type loginAttempts struct {
+	failures    int
+	lockouts    int // Lockouts so far; drives the exponential lockout length
+	lockedUntil time.Time
+	lastFailure time.Time
+}
+
+type loginThrottle struct {
+	mu        sync.Mutex
+	config    LoginThrottleConfig
+	attempts  map[string]*loginAttempts
+	lastSweep time.Time
+}
+
+var throttle = &loginThrottle{
+	config: LoginThrottleConfig{
+		MaxFailures:   5,
+		MaxIPFailures: 20,
+		Lockout:       time.Minute,
+		MaxLockout:    time.Hour,
+	},
+	attempts: make(map[string]*loginAttempts),
+}
+
+// ConfigureLoginThrottle replaces the login throttling limits
+func ConfigureLoginThrottle(config LoginThrottleConfig) {
+	throttle.mu.Lock()
+	defer throttle.mu.Unlock()
+	throttle.config = config
+}
+
+func ipKey(ip string) string             { return "ip:" + ip }
+func usernameKey(username string) string { return "user:" + username }
+
+// lockedFor returns how much longer the IP or username is locked out, or 0
+func (t *loginThrottle) lockedFor(ip, username string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var wait time.Duration
+	for _, key := range []string{ipKey(ip), usernameKey(username)} {
+		if a, ok := t.attempts[key]; ok {
+			if remaining := time.Until(a.lockedUntil); remaining > wait {
+				wait = remaining
+			}
+		}
+	}
+	return wait
+}
+
+// recordFailure counts a failed login and locks out the IP and/or username once they
+// reach their limit
+func (t *loginThrottle) recordFailure(ip, username string) {
+	t.mu.Lock()
+	now := time.Now()
+	t.sweep(now)
+
+	type lockout struct {
+		scope, key string
+		failures   int
+		until      time.Time
+	}
+	var lockouts []lockout
+	for _, k := range []struct {
+		scope, key string
+		max        int
+	}{
+		{"ip", ipKey(ip), t.config.MaxIPFailures},
+		{"username", usernameKey(username), t.config.MaxFailures},
+	} {
+		if k.max <= 0 {
+			continue
+		}
+		a, ok := t.attempts[k.key]
+		if !ok {
+			a = &loginAttempts{}
+			t.attempts[k.key] = a
+		}
+		a.failures++
+		a.lastFailure = now
+		if a.failures < k.max {
+			continue
+		}
+
+		a.lockouts++
+		a.failures = 0
+		a.lockedUntil = now.Add(t.lockoutDuration(a.lockouts))
+		lockouts = append(lockouts, lockout{k.scope, k.key, k.max, a.lockedUntil})
+	}
+	t.mu.Unlock()
+
+	for _, l := range lockouts {
+		notifyLoginLockout(models.LoginLockoutData{
+			Scope:       l.scope,
+			Username:    username,
+			IPAddress:   ip,
+			Failures:    l.failures,
+			LockedUntil: l.until,
+		})
+	}
+}
+
+// recordSuccess clears the failures of a username after a successful login. The IP's
+// failures are kept so one valid account can't be used to reset an IP's count.
+func (t *loginThrottle) recordSuccess(username string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.attempts, usernameKey(username))
+}
+
+// lockoutDuration doubles the base lockout for every lockout after the first
+func (t *loginThrottle) lockoutDuration(lockouts int) time.Duration {
+	d := t.config.Lockout
+	for i := 1; i < lockouts && d < t.config.MaxLockout; i++ {
+		d *= 2
+	}
+	if t.config.MaxLockout > 0 && d > t.config.MaxLockout {
+		d = t.config.MaxLockout
+	}
+	return d
+}
+
+// sweep forgets keys that have been quiet for longer than the maximum lockout, which
+// also resets their exponential backoff. Callers must hold t.mu.
+func (t *loginThrottle) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < time.Minute {
+		return
+	}
+	t.lastSweep = now
+
+	quiet := t.config.MaxLockout
+	if quiet < t.config.Lockout {
+		quiet = t.config.Lockout
+	}
+	for key, a := range t.attempts {
+		if now.After(a.lockedUntil) && now.Sub(a.lastFailure) > quiet {
+			delete(t.attempts, key)
+		}
+	}
+}
+
+// notifyLoginLockout reports a lockout on the event streams and to the webhooks of all
+// admins and of the targeted user
+func notifyLoginLockout(data models.LoginLockoutData) {
+	var message string
+	if data.Scope == "ip" {
+		message = fmt.Sprintf("Login locked for %s after %d failed attempts", data.IPAddress, data.Failures)
+	} else {
+		message = fmt.Sprintf("Login locked for user %s after %d failed attempts", data.Username, data.Failures)
+	}
+	details := "Locked until " + data.LockedUntil.Format(time.RFC3339)
+
+	var userIDs []uint
+	db.GetDB().Model(&models.User{}).
+		Where("is_active = ? AND (is_admin = ? OR username = ?)", true, true, data.Username).
+		Pluck("id", &userIDs)
+	for _, userID := range userIDs {
+		BroadcastUserEvent(userID, models.EventTypeLoginLockout, message, details)
+		services.GetWebhookService().TriggerWebhooks(userID, string(models.EventTypeLoginLockout), data)
+	}
+}
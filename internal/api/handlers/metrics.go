@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/services"
+)
+
+// maxTimeseriesBuckets bounds the size of a time series response
+const maxTimeseriesBuckets = 1000
+
+var timeseriesIntervals = map[string]time.Duration{
+	"hour": time.Hour,
+	"day":  24 * time.Hour,
+}
+
+// GetMessageTimeseries returns the user's sent and received message counts bucketed by
+// hour or day, for activity charts
+func GetMessageTimeseries(c *gin.Context) {
+	name := c.DefaultQuery("interval", "hour")
+	interval, ok := timeseriesIntervals[name]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid interval: must be hour or day"})
+		return
+	}
+
+	to := time.Now().UTC()
+	if value := c.Query("to"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to: expected an RFC 3339 timestamp"})
+			return
+		}
+		to = t.UTC()
+	}
+	// By default show the last 24 hours, or the last 30 days
+	from := to.Add(-24 * time.Hour)
+	if name == "day" {
+		from = to.AddDate(0, 0, -30)
+	}
+	if value := c.Query("from"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from: expected an RFC 3339 timestamp"})
+			return
+		}
+		from = t.UTC()
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid range: from must be before to"})
+		return
+	}
+	if to.Sub(from.Truncate(interval)) > maxTimeseriesBuckets*interval {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Range too large: at most %d buckets per request", maxTimeseriesBuckets)})
+		return
+	}
+
+	points, err := services.MessageTimeseries(c.GetUint("userID"), from, to, interval)
+	if err != nil {
+		fmt.Printf("[Metrics] Failed to load message volume: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load message volume"})
+		return
+	}
+
+	var sent, received int64
+	for _, point := range points {
+		sent += point.Sent
+		received += point.Received
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"interval": name,
+		"from":     from,
+		"to":       to,
+		"points":   points,
+		"total":    gin.H{"sent": sent, "received": received},
+	})
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/models"
+	"github.com/user/pinglater/internal/services"
+)
+
+// GetOutOfOffice returns the user's out-of-office mode, off if it was never set up
+func GetOutOfOffice(c *gin.Context) {
+	ooo := loadOutOfOffice(c.GetUint("userID"))
+	c.JSON(http.StatusOK, ooo.ToResponse())
+}
+
+// UpdateOutOfOffice changes the fields of the user's out-of-office mode the request
+// sets. Turning the mode on starts everyone's daily cooldown afresh.
+func UpdateOutOfOffice(c *gin.Context) {
+	userID := c.GetUint("userID")
+	ooo := loadOutOfOffice(userID)
+	wasActive := ooo.IsActive
+
+	var req models.OutOfOfficeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if req.IsActive != nil {
+		ooo.IsActive = *req.IsActive
+	}
+	if req.Message != nil {
+		ooo.Message = *req.Message
+	}
+	var err error
+	if req.StartsAt != nil {
+		if ooo.StartsAt, err = parseOptionalTime(*req.StartsAt); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid starts_at: expected RFC 3339"})
+			return
+		}
+	}
+	if req.EndsAt != nil {
+		if ooo.EndsAt, err = parseOptionalTime(*req.EndsAt); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ends_at: expected RFC 3339"})
+			return
+		}
+	}
+	if err := services.ValidateOutOfOffice(&ooo); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := db.GetDB().Save(&ooo).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update out-of-office"})
+		return
+	}
+	if ooo.IsActive && !wasActive {
+		if err := services.ResetOutOfOfficeReplies(userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset out-of-office replies"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, ooo.ToResponse())
+}
+
+// loadOutOfOffice returns the user's out-of-office mode, or a new one that's off
+func loadOutOfOffice(userID uint) models.OutOfOffice {
+	var settings []models.OutOfOffice
+	db.GetDB().Where("user_id = ?", userID).Limit(1).Find(&settings)
+	if len(settings) == 0 {
+		return models.OutOfOffice{UserID: userID}
+	}
+	return settings[0]
+}
+
+// parseOptionalTime parses an RFC 3339 time; empty is no time
+func parseOptionalTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
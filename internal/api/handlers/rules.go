@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/models"
+	"github.com/user/pinglater/internal/services"
+)
+
+// ListRules returns the user's auto-responder rules, in the order they're evaluated,
+// optionally only those of one direction
+func ListRules(c *gin.Context) {
+	query := db.GetDB().Where("user_id = ?", c.GetUint("userID"))
+	if direction := c.Query("direction"); direction != "" {
+		query = query.Where("direction = ?", direction)
+	}
+
+	var rules []models.Rule
+	if err := query.Order("position, id").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch rules"})
+		return
+	}
+
+	responses := make([]models.RuleResponse, len(rules))
+	for i := range rules {
+		responses[i] = rules[i].ToResponse()
+	}
+	c.JSON(http.StatusOK, gin.H{"rules": responses})
+}
+
+// CreateRule creates an auto-responder rule for the user
+func CreateRule(c *gin.Context) {
+	var req models.RuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	rule := models.Rule{
+		UserID:   c.GetUint("userID"),
+		Name:     req.Name,
+		IsActive: true,
+	}
+	applyRuleRequest(&rule, req)
+	if err := services.ValidateRule(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := db.GetDB().Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create rule"})
+		return
+	}
+	c.JSON(http.StatusCreated, rule.ToResponse())
+}
+
+// GetRule returns one of the user's rules
+func GetRule(c *gin.Context) {
+	var rule models.Rule
+	if err := db.GetDB().Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("userID")).First(&rule).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+	c.JSON(http.StatusOK, rule.ToResponse())
+}
+
+// UpdateRule changes the fields of a rule the request sets
+func UpdateRule(c *gin.Context) {
+	var rule models.Rule
+	if err := db.GetDB().Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("userID")).First(&rule).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+
+	var req models.RuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if req.Name != "" {
+		rule.Name = req.Name
+	}
+	applyRuleRequest(&rule, req)
+	if err := services.ValidateRule(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := db.GetDB().Save(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update rule"})
+		return
+	}
+	c.JSON(http.StatusOK, rule.ToResponse())
+}
+
+// DeleteRule deletes a rule
+func DeleteRule(c *gin.Context) {
+	result := db.GetDB().Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("userID")).Delete(&models.Rule{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete rule"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Rule deleted successfully"})
+}
+
+// applyRuleRequest copies the optional fields the request sets
+func applyRuleRequest(rule *models.Rule, req models.RuleRequest) {
+	if req.Description != nil {
+		rule.Description = *req.Description
+	}
+	if req.IsActive != nil {
+		rule.IsActive = *req.IsActive
+	}
+	if req.Position != nil {
+		rule.Position = *req.Position
+	}
+	if req.StopProcessing != nil {
+		rule.StopProcessing = *req.StopProcessing
+	}
+	if req.Direction != nil {
+		rule.Direction = *req.Direction
+	}
+	if req.ChatType != nil {
+		rule.ChatType = *req.ChatType
+	}
+	if req.Senders != nil {
+		rule.Senders = strings.Join(*req.Senders, ",")
+	}
+	if req.Groups != nil {
+		rule.Groups = strings.Join(*req.Groups, ",")
+	}
+	if req.Keywords != nil {
+		rule.Keywords = strings.Join(*req.Keywords, ",")
+	}
+	if req.Pattern != nil {
+		rule.Pattern = *req.Pattern
+	}
+	if req.StartTime != nil {
+		rule.StartTime = *req.StartTime
+	}
+	if req.EndTime != nil {
+		rule.EndTime = *req.EndTime
+	}
+	if req.Days != nil {
+		rule.Days = strings.Join(*req.Days, ",")
+	}
+	if req.Timezone != nil {
+		rule.Timezone = *req.Timezone
+	}
+	if req.Actions != nil {
+		rule.SetActions(*req.Actions)
+	}
+}
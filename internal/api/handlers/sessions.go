@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/models"
+)
+
+// ListSessions returns the current user's active login sessions
+func ListSessions(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var sessions []models.AuthSession
+	result := db.GetDB().Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at desc").Find(&sessions)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	currentID := c.GetUint("sessionID")
+	responses := make([]models.AuthSessionResponse, len(sessions))
+	for i, s := range sessions {
+		responses[i] = s.ToResponse(currentID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": responses})
+}
+
+// DeleteSession logs out one of the current user's sessions
+func DeleteSession(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	sessionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	result := db.GetDB().Where("id = ? AND user_id = ?", sessionID, userID).Delete(&models.AuthSession{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete session"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session logged out"})
+}
@@ -2,20 +2,20 @@ package handlers
 
 import (
 	"crypto/rand"
-	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 	"net/http"
-	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/api/middleware"
 	"github.com/user/pinglater/internal/db"
 	"github.com/user/pinglater/internal/models"
+	"gorm.io/gorm"
 )
 
-// generateToken generates a secure random API token
-// Format: plt_live_xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx
-func generateToken() string {
-	const prefix = "plt_live_"
+// generateTokenSecret generates the secret part of an API token
+func generateTokenSecret() string {
 	const tokenLength = 32
 
 	// Generate 32 random bytes
@@ -23,15 +23,13 @@ func generateToken() string {
 	rand.Read(bytes)
 
 	// Convert to hex string
-	randomPart := hex.EncodeToString(bytes)
-
-	return prefix + randomPart
+	return hex.EncodeToString(bytes)
 }
 
-// hashToken hashes a token using SHA-256
-func hashToken(token string) string {
-	hash := sha256.Sum256([]byte(token))
-	return hex.EncodeToString(hash[:])
+// formatToken builds the raw API token. The ID lets the middleware load the token by
+// primary key. Format: plt_live_<id>_<secret>, or plt_test_<id>_<secret> in test mode.
+func formatToken(token *models.APIToken, secret string) string {
+	return fmt.Sprintf("%s%d_%s", token.Prefix(), token.ID, secret)
 }
 
 // CreateToken creates a new API token
@@ -43,32 +41,7 @@ func CreateToken(c *gin.Context) {
 	}
 
 	// Validate scopes
-	availableScopes := models.AllAvailableScopes()
-	scopeMap := make(map[string]bool)
-	for _, s := range availableScopes {
-		scopeMap[s] = true
-	}
-
-	// If 'all' scope is selected, only store 'all'
-	hasAllScope := false
-	for _, scope := range req.Scopes {
-		if scope == models.ScopeAll {
-			hasAllScope = true
-			break
-		}
-	}
-
-	validatedScopes := []string{}
-	if hasAllScope {
-		validatedScopes = []string{models.ScopeAll}
-	} else {
-		for _, scope := range req.Scopes {
-			if scopeMap[scope] {
-				validatedScopes = append(validatedScopes, scope)
-			}
-		}
-	}
-
+	validatedScopes := validateScopes(req.Scopes)
 	if len(validatedScopes) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one valid scope is required"})
 		return
@@ -81,39 +54,71 @@ func CreateToken(c *gin.Context) {
 		return
 	}
 
-	// Generate raw token (shown only once)
-	rawToken := generateToken()
-	tokenHash := hashToken(rawToken)
+	if req.ServiceAccount && !c.GetBool("isAdmin") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can create service-account tokens"})
+		return
+	}
+
+	// Generate the secret; only its hash is stored
+	secret := generateTokenSecret()
+	tokenHash := middleware.HashToken(secret)
 
 	// Create token record
 	token := models.APIToken{
-		UserID:    userID.(uint),
-		Name:      req.Name,
-		TokenHash: tokenHash,
-		IsActive:  true,
-		ExpiresAt: req.ExpiresAt,
+		UserID:             userID.(uint),
+		Name:               req.Name,
+		TokenHash:          tokenHash,
+		IsActive:           true,
+		ExpiresAt:          req.ExpiresAt,
+		RateLimitPerMinute: req.RateLimitPerMinute,
+		MessagesPerDay:     req.MessagesPerDay,
+		TestMode:           req.TestMode,
 	}
 	token.SetScopes(validatedScopes)
+	token.SetAccounts(req.Accounts)
 
-	// Save to database
+	// Save to database. A service-account token gets its own user, which owns
+	// everything created with the token.
 	database := db.GetDB()
-	if err := database.Create(&token).Error; err != nil {
+	err := database.Transaction(func(tx *gorm.DB) error {
+		if req.ServiceAccount {
+			serviceUser := models.User{
+				Username:         serviceAccountUsername(req.Name),
+				AuthSource:       models.AuthSourceLocal,
+				IsActive:         true,
+				IsServiceAccount: true,
+			}
+			if err := tx.Create(&serviceUser).Error; err != nil {
+				return err
+			}
+			token.UserID = serviceUser.ID
+		}
+		return tx.Create(&token).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
 		return
 	}
+	rawToken := formatToken(&token, secret)
 
 	// Return response with raw token (shown only once!)
 	c.JSON(http.StatusCreated, models.CreateTokenResponse{
-		ID:        token.ID,
-		Name:      token.Name,
-		Token:     rawToken, // Raw token shown ONLY once
-		Scopes:    token.GetScopes(),
-		ExpiresAt: token.ExpiresAt,
-		CreatedAt: token.CreatedAt,
+		ID:                 token.ID,
+		Name:               token.Name,
+		Token:              rawToken, // Raw token shown ONLY once
+		Scopes:             token.GetScopes(),
+		ExpiresAt:          token.ExpiresAt,
+		CreatedAt:          token.CreatedAt,
+		RateLimitPerMinute: token.RateLimitPerMinute,
+		MessagesPerDay:     token.MessagesPerDay,
+		Accounts:           token.GetAccounts(),
+		ServiceAccount:     req.ServiceAccount,
+		TestMode:           token.TestMode,
 	})
 }
 
-// ListTokens lists all API tokens for the current user
+// ListTokens lists all API tokens for the current user, plus all service-account
+// tokens for admins
 func ListTokens(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -121,9 +126,12 @@ func ListTokens(c *gin.Context) {
 		return
 	}
 
+	// Write buffered last_used_at values so the list is current
+	middleware.FlushTokenUsage()
+
 	database := db.GetDB()
 	var tokens []models.APIToken
-	if err := database.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error; err != nil {
+	if err := accessibleTokens(c, database).Order("created_at DESC").Find(&tokens).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tokens"})
 		return
 	}
@@ -132,6 +140,7 @@ func ListTokens(c *gin.Context) {
 	responses := make([]models.TokenResponse, len(tokens))
 	for i, token := range tokens {
 		responses[i] = token.ToResponse()
+		responses[i].ServiceAccount = token.UserID != userID.(uint)
 	}
 
 	c.JSON(http.StatusOK, gin.H{"tokens": responses})
@@ -144,6 +153,69 @@ func GetAvailableScopes(c *gin.Context) {
 	})
 }
 
+// CreateStreamToken issues a short-lived token for opening the event streams, so that
+// browsers don't have to put the session JWT or API token in the stream's URL
+func CreateStreamToken(c *gin.Context) {
+	token, expiresAt, err := middleware.GenerateStreamToken(c)
+	if err != nil {
+		fmt.Printf("[Tokens] Failed to create stream token: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create stream token"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"token":      token,
+		"expires_at": expiresAt,
+		"expires_in": int(middleware.StreamTokenTTL.Seconds()),
+	})
+}
+
+// GetTokenInfo describes the API token making the request: its scopes, expiry and the
+// current state of its rate limit and message quota
+func GetTokenInfo(c *gin.Context) {
+	value, exists := c.Get("apiToken")
+	if !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authenticated with an API token"})
+		return
+	}
+	token := value.(*models.APIToken)
+
+	var user models.User
+	db.GetDB().Select("is_service_account").First(&user, token.UserID)
+
+	info := models.TokenInfoResponse{
+		ID:             token.ID,
+		Name:           token.Name,
+		Username:       c.GetString("username"),
+		Scopes:         token.GetScopes(),
+		ExpiresAt:      token.ExpiresAt,
+		Accounts:       token.GetAccounts(),
+		ServiceAccount: user.IsServiceAccount,
+		TestMode:       token.TestMode,
+	}
+	if remaining, reset := middleware.TokenRateLimitState(token); remaining >= 0 {
+		info.RateLimit = &models.TokenLimitState{
+			Limit:     token.RateLimitPerMinute,
+			Remaining: remaining,
+			ResetAt:   reset,
+		}
+	}
+	if token.MessagesPerDay > 0 {
+		// Quotas reset at midnight UTC
+		now := time.Now().UTC()
+		remaining := token.MessagesPerDay - token.MessagesSentToday()
+		if remaining < 0 {
+			remaining = 0
+		}
+		info.MessageQuota = &models.TokenLimitState{
+			Limit:     token.MessagesPerDay,
+			Remaining: remaining,
+			ResetAt:   time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC),
+		}
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
 // DeleteToken revokes/deletes an API token
 func DeleteToken(c *gin.Context) {
 	userID, exists := c.Get("userID")
@@ -160,15 +232,27 @@ func DeleteToken(c *gin.Context) {
 
 	database := db.GetDB()
 
-	// Find token and ensure it belongs to current user
+	// Find token and ensure the current user may manage it
 	var token models.APIToken
-	if err := database.Where("id = ? AND user_id = ?", tokenID, userID).First(&token).Error; err != nil {
+	if err := accessibleTokens(c, database).Where("id = ?", tokenID).First(&token).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
 		return
 	}
 
-	// Delete the token
-	if err := database.Delete(&token).Error; err != nil {
+	// Delete the token. Deleting a service-account token also deletes its user and
+	// whatever was created with it.
+	var err error
+	if token.UserID != userID.(uint) {
+		err = database.Transaction(func(tx *gorm.DB) error {
+			if err := deleteUserData(tx, token.UserID); err != nil {
+				return err
+			}
+			return tx.Delete(&models.User{}, token.UserID).Error
+		})
+	} else {
+		err = database.Delete(&token).Error
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete token"})
 		return
 	}
@@ -192,25 +276,31 @@ func RotateToken(c *gin.Context) {
 
 	database := db.GetDB()
 
-	// Find token and ensure it belongs to current user
+	// Find token and ensure the current user may manage it
 	var oldToken models.APIToken
-	if err := database.Where("id = ? AND user_id = ?", tokenID, userID).First(&oldToken).Error; err != nil {
+	if err := accessibleTokens(c, database).Where("id = ?", tokenID).First(&oldToken).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
 		return
 	}
 
 	// Generate new token
-	rawToken := generateToken()
-	tokenHash := hashToken(rawToken)
+	secret := generateTokenSecret()
+	tokenHash := middleware.HashToken(secret)
 
 	// Create new token with same properties
 	newToken := models.APIToken{
-		UserID:    userID.(uint),
-		Name:      oldToken.Name,
-		TokenHash: tokenHash,
-		Scopes:    oldToken.Scopes,
-		IsActive:  true,
-		ExpiresAt: oldToken.ExpiresAt,
+		UserID:             oldToken.UserID,
+		Name:               oldToken.Name,
+		TokenHash:          tokenHash,
+		Scopes:             oldToken.Scopes,
+		IsActive:           true,
+		ExpiresAt:          oldToken.ExpiresAt,
+		RateLimitPerMinute: oldToken.RateLimitPerMinute,
+		MessagesPerDay:     oldToken.MessagesPerDay,
+		DailyMessageCount:  oldToken.DailyMessageCount,
+		DailyMessageDate:   oldToken.DailyMessageDate,
+		Accounts:           oldToken.Accounts,
+		TestMode:           oldToken.TestMode,
 	}
 
 	// Save new token
@@ -218,6 +308,7 @@ func RotateToken(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create new token"})
 		return
 	}
+	rawToken := formatToken(&newToken, secret)
 
 	// Delete old token
 	if err := database.Delete(&oldToken).Error; err != nil {
@@ -225,19 +316,28 @@ func RotateToken(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, models.CreateTokenResponse{
-		ID:        newToken.ID,
-		Name:      newToken.Name,
-		Token:     rawToken, // Raw token shown ONLY once
-		Scopes:    newToken.GetScopes(),
-		ExpiresAt: newToken.ExpiresAt,
-		CreatedAt: newToken.CreatedAt,
+		ID:                 newToken.ID,
+		Name:               newToken.Name,
+		Token:              rawToken, // Raw token shown ONLY once
+		Scopes:             newToken.GetScopes(),
+		ExpiresAt:          newToken.ExpiresAt,
+		CreatedAt:          newToken.CreatedAt,
+		RateLimitPerMinute: newToken.RateLimitPerMinute,
+		MessagesPerDay:     newToken.MessagesPerDay,
+		Accounts:           newToken.GetAccounts(),
+		ServiceAccount:     newToken.UserID != userID.(uint),
+		TestMode:           newToken.TestMode,
 	})
 }
 
-// UpdateToken updates token properties (name, scopes, active status)
+// UpdateToken updates token properties (name, scopes, active status, quotas, accounts)
 type UpdateTokenRequest struct {
-	Name     string `json:"name,omitempty"`
-	IsActive *bool  `json:"is_active,omitempty"`
+	Name               string   `json:"name,omitempty"`
+	Scopes             []string `json:"scopes,omitempty"`
+	IsActive           *bool    `json:"is_active,omitempty"`
+	RateLimitPerMinute *int     `json:"rate_limit_per_minute,omitempty" binding:"omitempty,min=0"`
+	MessagesPerDay     *int     `json:"messages_per_day,omitempty" binding:"omitempty,min=0"`
+	Accounts           *[]uint  `json:"accounts,omitempty"` // An empty list lifts the restriction
 }
 
 func UpdateToken(c *gin.Context) {
@@ -261,9 +361,9 @@ func UpdateToken(c *gin.Context) {
 
 	database := db.GetDB()
 
-	// Find token and ensure it belongs to current user
+	// Find token and ensure the current user may manage it
 	var token models.APIToken
-	if err := database.Where("id = ? AND user_id = ?", tokenID, userID).First(&token).Error; err != nil {
+	if err := accessibleTokens(c, database).Where("id = ?", tokenID).First(&token).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
 		return
 	}
@@ -273,9 +373,28 @@ func UpdateToken(c *gin.Context) {
 	if req.Name != "" {
 		updates["name"] = req.Name
 	}
+	if req.Scopes != nil {
+		scopes := validateScopes(req.Scopes)
+		if len(scopes) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "At least one valid scope is required"})
+			return
+		}
+		token.SetScopes(scopes)
+		updates["scopes"] = token.Scopes
+	}
 	if req.IsActive != nil {
 		updates["is_active"] = *req.IsActive
 	}
+	if req.RateLimitPerMinute != nil {
+		updates["rate_limit_per_minute"] = *req.RateLimitPerMinute
+	}
+	if req.MessagesPerDay != nil {
+		updates["messages_per_day"] = *req.MessagesPerDay
+	}
+	if req.Accounts != nil {
+		token.SetAccounts(*req.Accounts)
+		updates["accounts"] = token.Accounts
+	}
 
 	if err := database.Model(&token).Updates(updates).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update token"})
@@ -285,28 +404,49 @@ func UpdateToken(c *gin.Context) {
 	// Reload token
 	database.First(&token, token.ID)
 
-	c.JSON(http.StatusOK, token.ToResponse())
+	response := token.ToResponse()
+	response.ServiceAccount = token.UserID != userID.(uint)
+	c.JSON(http.StatusOK, response)
 }
 
-// ValidateAndGetToken validates an API token and returns the token record
-// This is used by the middleware
-func ValidateAndGetToken(tokenStr string) (*models.APIToken, error) {
-	if !strings.HasPrefix(tokenStr, "plt_live_") {
-		return nil, nil
+// validateScopes drops unknown scopes. If 'all' is among them, only 'all' is kept.
+func validateScopes(requested []string) []string {
+	scopeMap := make(map[string]bool)
+	for _, s := range models.AllAvailableScopes() {
+		scopeMap[s] = true
 	}
 
-	tokenHash := hashToken(tokenStr)
-
-	database := db.GetDB()
-	var token models.APIToken
-	if err := database.Where("token_hash = ? AND is_active = ?", tokenHash, true).First(&token).Error; err != nil {
-		return nil, err
+	validatedScopes := []string{}
+	for _, scope := range requested {
+		if scope == models.ScopeAll {
+			return []string{models.ScopeAll}
+		}
+		if scopeMap[scope] {
+			validatedScopes = append(validatedScopes, scope)
+		}
 	}
+	return validatedScopes
+}
 
-	// Check if expired
-	if token.IsExpired() {
-		return nil, nil
+// accessibleTokens scopes a token query to the tokens the current user may manage:
+// their own, and for admins also all service-account tokens
+func accessibleTokens(c *gin.Context, database *gorm.DB) *gorm.DB {
+	userID := c.GetUint("userID")
+	if !c.GetBool("isAdmin") {
+		return database.Where("user_id = ?", userID)
 	}
+	serviceUsers := database.Model(&models.User{}).Select("id").Where("is_service_account = ?", true)
+	return database.Where("user_id = ? OR user_id IN (?)", userID, serviceUsers)
+}
 
-	return &token, nil
+// serviceAccountUsername derives a unique username for a service-account user
+func serviceAccountUsername(tokenName string) string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return "service:" + tokenName + ":" + hex.EncodeToString(suffix)
+}
+
+// ValidateAndGetToken validates an API token and returns the token record
+func ValidateAndGetToken(tokenStr string) (*models.APIToken, error) {
+	return middleware.ValidateAPIToken(tokenStr)
 }
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/api/middleware"
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/models"
+	"github.com/user/pinglater/internal/services"
+	"github.com/user/pinglater/internal/whatsapp"
+)
+
+// twilioAPIVersion is the Twilio REST API version the shim mimics
+const twilioAPIVersion = "2010-04-01"
+
+// TwilioMessage is a message in the shape of Twilio's Message resource
+type TwilioMessage struct {
+	Sid                 string  `json:"sid"`
+	AccountSid          string  `json:"account_sid"`
+	MessagingServiceSid *string `json:"messaging_service_sid"`
+	From                string  `json:"from"`
+	To                  string  `json:"to"`
+	Body                string  `json:"body"`
+	Status              string  `json:"status"`
+	Direction           string  `json:"direction"`
+	NumMedia            string  `json:"num_media"`
+	NumSegments         string  `json:"num_segments"`
+	ErrorCode           *int    `json:"error_code"`
+	ErrorMessage        *string `json:"error_message"`
+	Price               *string `json:"price"`
+	PriceUnit           *string `json:"price_unit"`
+	APIVersion          string  `json:"api_version"`
+	DateCreated         string  `json:"date_created"`
+	DateUpdated         string  `json:"date_updated"`
+	DateSent            *string `json:"date_sent"`
+	URI                 string  `json:"uri"`
+}
+
+// twilioError responds with an error in Twilio's format
+func twilioError(c *gin.Context, status, code int, message string) {
+	c.JSON(status, gin.H{
+		"code":      code,
+		"message":   message,
+		"more_info": fmt.Sprintf("https://www.twilio.com/docs/errors/%d", code),
+		"status":    status,
+	})
+}
+
+// CreateTwilioMessage accepts Twilio's "create a message" request, so tools written for
+// Twilio's WhatsApp API can send through PingLater by changing their base URL. The
+// message goes through the send queue; From and StatusCallback are ignored.
+func CreateTwilioMessage(c *gin.Context) {
+	to := strings.TrimSpace(c.PostForm("To"))
+	body := c.PostForm("Body")
+	mediaURLs := c.PostFormArray("MediaUrl")
+
+	if to == "" {
+		twilioError(c, http.StatusBadRequest, 21604, "A 'To' phone number is required.")
+		return
+	}
+	phone := strings.TrimPrefix(strings.TrimPrefix(to, "whatsapp:"), "+")
+	if _, err := strconv.ParseUint(phone, 10, 64); err != nil {
+		twilioError(c, http.StatusBadRequest, 21211, fmt.Sprintf("The 'To' number %s is not a valid phone number.", to))
+		return
+	}
+	if body == "" && len(mediaURLs) == 0 {
+		twilioError(c, http.StatusBadRequest, 21602, "Message body is required.")
+		return
+	}
+	if len(mediaURLs) > 1 {
+		twilioError(c, http.StatusBadRequest, 21623, "WhatsApp messages can have at most one MediaUrl.")
+		return
+	}
+
+	client := whatsapp.GetClient()
+	if status, message := checkSendAccount(c, client, ""); status != 0 {
+		twilioError(c, status, 20403, message)
+		return
+	}
+
+	msg := models.OutgoingMessage{
+		UserID:      c.GetUint("userID"),
+		PhoneNumber: phone,
+		Message:     body,
+		Source:      models.MessageSourceTwilio,
+		TestMode:    isTestMode(c),
+	}
+	if len(mediaURLs) == 1 {
+		media, err := services.GetWebhookService().LoadMedia(&models.WebhookReplyMedia{URL: mediaURLs[0]})
+		if err != nil {
+			twilioError(c, http.StatusBadRequest, 21620, "Invalid media URL: "+err.Error())
+			return
+		}
+		msg.MediaData = media.Data
+		msg.MediaMimeType = media.MimeType
+		msg.MediaFilename = media.Filename
+	}
+
+	token, ok := takeMessageQuota(c, 1)
+	if !ok {
+		return
+	}
+
+	queued := []models.OutgoingMessage{msg}
+	if err := services.GetSendQueue().Enqueue(db.GetDB(), queued); err != nil {
+		if token != nil {
+			middleware.ReturnMessageQuota(token)
+		}
+		fmt.Printf("[Twilio] Failed to queue message: %v\n", err)
+		twilioError(c, http.StatusInternalServerError, 20500, "Failed to queue message")
+		return
+	}
+
+	c.JSON(http.StatusCreated, twilioMessage(c.Param("accountSid"), client, &queued[0], to))
+}
+
+// GetTwilioMessage returns a message sent through the Twilio-compatible API, so clients
+// can poll its status
+func GetTwilioMessage(c *gin.Context) {
+	sid := strings.TrimSuffix(c.Param("messageSid"), ".json")
+	id, err := strconv.ParseUint(strings.TrimPrefix(sid, "SM"), 16, 64)
+	if err != nil || !strings.HasPrefix(sid, "SM") {
+		twilioError(c, http.StatusNotFound, 20404, fmt.Sprintf("The requested resource %s was not found", c.Request.URL.Path))
+		return
+	}
+
+	var msg models.OutgoingMessage
+	if err := db.GetDB().Where("id = ? AND user_id = ?", id, c.GetUint("userID")).First(&msg).Error; err != nil {
+		twilioError(c, http.StatusNotFound, 20404, fmt.Sprintf("The requested resource %s was not found", c.Request.URL.Path))
+		return
+	}
+
+	to := "whatsapp:+" + msg.PhoneNumber
+	if strings.Contains(msg.PhoneNumber, "@") {
+		to = "whatsapp:" + msg.PhoneNumber // A group
+	}
+	c.JSON(http.StatusOK, twilioMessage(c.Param("accountSid"), whatsapp.GetClient(), &msg, to))
+}
+
+// twilioMessage converts a queued message to Twilio's Message resource. The send
+// queue's statuses (queued, sending, sent, delivered, read, failed) are also Twilio's;
+// blocked messages are failed ones to Twilio.
+func twilioMessage(accountSid string, client *whatsapp.Client, msg *models.OutgoingMessage, to string) TwilioMessage {
+	sid := fmt.Sprintf("SM%032x", msg.ID)
+
+	resource := TwilioMessage{
+		Sid:         sid,
+		AccountSid:  accountSid,
+		To:          to,
+		Body:        msg.Message,
+		Status:      msg.Status,
+		Direction:   "outbound-api",
+		NumMedia:    "0",
+		NumSegments: "1",
+		APIVersion:  twilioAPIVersion,
+		DateCreated: msg.CreatedAt.UTC().Format(time.RFC1123Z),
+		DateUpdated: msg.CreatedAt.UTC().Format(time.RFC1123Z),
+		URI:         fmt.Sprintf("/%s/Accounts/%s/Messages/%s.json", twilioAPIVersion, accountSid, sid),
+	}
+	if phone := client.GetPhoneNumber(); phone != "" {
+		resource.From = "whatsapp:+" + phone
+	}
+	if msg.MediaMimeType != "" {
+		resource.NumMedia = "1"
+	}
+	if msg.SentAt != nil {
+		sent := msg.SentAt.UTC().Format(time.RFC1123Z)
+		resource.DateSent = &sent
+		resource.DateUpdated = sent
+	}
+	switch msg.Status {
+	case models.SendStatusBlocked:
+		code := 30007 // Message filtered
+		resource.Status = models.SendStatusFailed
+		resource.ErrorCode = &code
+		resource.ErrorMessage = &msg.Error
+	case models.SendStatusFailed:
+		code := 30008 // Unknown error
+		resource.ErrorCode = &code
+		resource.ErrorMessage = &msg.Error
+	}
+	return resource
+}
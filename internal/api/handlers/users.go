@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/api/middleware"
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/models"
+	"github.com/user/pinglater/internal/passwords"
+	"gorm.io/gorm"
+)
+
+// errLastAdmin is returned when a change would leave no active admin
+var errLastAdmin = errors.New("at least one active admin is required")
+
+// ListUsers returns all users (admin only)
+func ListUsers(c *gin.Context) {
+	var users []models.User
+	if result := db.GetDB().Order("id asc").Find(&users); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+
+	responses := make([]models.UserResponse, len(users))
+	for i, u := range users {
+		responses[i] = u.ToResponse()
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": responses})
+}
+
+// CreateUser creates a user (admin only)
+func CreateUser(c *gin.Context) {
+	var req models.UserCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.Username = strings.TrimSpace(req.Username)
+	if req.Username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username is required"})
+		return
+	}
+	if len(req.Password) < models.MinPasswordLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Password must be at least %d characters", models.MinPasswordLength)})
+		return
+	}
+
+	database := db.GetDB()
+	var existing int64
+	database.Model(&models.User{}).Where("username = ?", req.Username).Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
+		return
+	}
+
+	passwordHash, err := passwords.Hash(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	user := models.User{
+		Username:     req.Username,
+		PasswordHash: passwordHash,
+		IsAdmin:      req.IsAdmin,
+		IsActive:     true,
+		AuthSource:   models.AuthSourceLocal,
+	}
+	if result := database.Create(&user); result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, user.ToResponse())
+}
+
+// GetUser returns a single user (admin only)
+func GetUser(c *gin.Context) {
+	user, ok := findUser(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, user.ToResponse())
+}
+
+// UpdateUser enables/disables a user or changes their admin role (admin only)
+func UpdateUser(c *gin.Context) {
+	user, ok := findUser(c)
+	if !ok {
+		return
+	}
+
+	var req models.UserUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := make(map[string]interface{})
+	if req.IsActive != nil {
+		updates["is_active"] = *req.IsActive
+	}
+	if req.IsAdmin != nil {
+		updates["is_admin"] = *req.IsAdmin
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+
+	if user.IsServiceAccount && req.IsAdmin != nil && *req.IsAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Service accounts can't be admins"})
+		return
+	}
+
+	// Admins can't lock themselves out
+	if user.ID == c.GetUint("userID") && ((req.IsActive != nil && !*req.IsActive) || (req.IsAdmin != nil && !*req.IsAdmin)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't disable or demote your own account"})
+		return
+	}
+
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(updates).Error; err != nil {
+			return err
+		}
+		if req.IsActive != nil && !*req.IsActive {
+			if err := middleware.RevokeUserSessions(tx, user.ID); err != nil {
+				return err
+			}
+		}
+		return ensureActiveAdmin(tx)
+	})
+	if errors.Is(err, errLastAdmin) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one active admin is required"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+
+	db.GetDB().First(user, user.ID)
+	c.JSON(http.StatusOK, user.ToResponse())
+}
+
+// DeleteUser deletes a user together with their webhooks, delivery history and API
+// tokens (admin only)
+func DeleteUser(c *gin.Context) {
+	user, ok := findUser(c)
+	if !ok {
+		return
+	}
+
+	if user.ID == c.GetUint("userID") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't delete your own account"})
+		return
+	}
+
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := deleteUserData(tx, user.ID); err != nil {
+			return err
+		}
+		if err := tx.Delete(user).Error; err != nil {
+			return err
+		}
+		return ensureActiveAdmin(tx)
+	})
+	if errors.Is(err, errLastAdmin) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one active admin is required"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+}
+
+// ResetUserPassword replaces a user's password with a one-time temporary password that
+// they must change on their next login. Their existing sessions are logged out (admin
+// only).
+func ResetUserPassword(c *gin.Context) {
+	user, ok := findUser(c)
+	if !ok {
+		return
+	}
+
+	if user.ID == c.GetUint("userID") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Use change-password to change your own password"})
+		return
+	}
+	if user.AuthSource == models.AuthSourceLDAP {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is managed by the directory server"})
+		return
+	}
+	if user.IsServiceAccount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Service accounts can't log in"})
+		return
+	}
+
+	temporaryPassword := generateTemporaryPassword()
+	passwordHash, err := passwords.Hash(temporaryPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	err = db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"password_hash":        passwordHash,
+			"token_version":        user.TokenVersion + 1,
+			"must_change_password": true,
+		}).Error; err != nil {
+			return err
+		}
+		return middleware.RevokeUserSessions(tx, user.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.PasswordResetResponse{TemporaryPassword: temporaryPassword})
+}
+
+// generateTemporaryPassword returns a random password for admin resets
+func generateTemporaryPassword() string {
+	bytes := make([]byte, 12)
+	rand.Read(bytes)
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
+
+// deleteUserData deletes everything a user owns: webhooks with their delivery history,
+// API tokens and login sessions
+func deleteUserData(tx *gorm.DB, userID uint) error {
+	webhookIDs := tx.Unscoped().Model(&models.Webhook{}).Select("id").Where("user_id = ?", userID)
+	if err := tx.Where("webhook_id IN (?)", webhookIDs).Delete(&models.WebhookDelivery{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("webhook_id IN (?)", webhookIDs).Delete(&models.WebhookOutbox{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.Webhook{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&models.APIToken{}).Error; err != nil {
+		return err
+	}
+	// Devices of a deleted user fall back to the default owner
+	if err := tx.Where("user_id = ?", userID).Delete(&models.WhatsAppDevice{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&models.WhatsAppSession{}).Error; err != nil {
+		return err
+	}
+	return middleware.RevokeUserSessions(tx, userID)
+}
+
+// findUser loads the user named by the :id parameter, writing an error response if it
+// doesn't exist
+func findUser(c *gin.Context) (*models.User, bool) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+
+	var user models.User
+	if err := db.GetDB().First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// ensureActiveAdmin fails when no active admin is left
+func ensureActiveAdmin(tx *gorm.DB) error {
+	var admins int64
+	if err := tx.Model(&models.User{}).Where("is_admin = ? AND is_active = ?", true, true).Count(&admins).Error; err != nil {
+		return err
+	}
+	if admins == 0 {
+		return errLastAdmin
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/version"
+)
+
+// GetVersion returns the build version and, if update checks are enabled, the latest release
+func GetVersion(c *gin.Context) {
+	response := gin.H{"version": version.Get()}
+	if latest := version.GetUpdateChecker().Latest(); latest != nil {
+		response["update"] = latest
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -1,14 +1,20 @@
 package handlers
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/user/pinglater/internal/db"
 	"github.com/user/pinglater/internal/models"
 	"github.com/user/pinglater/internal/services"
+	"gorm.io/gorm"
 )
 
 // ListWebhooks returns all webhooks for the authenticated user
@@ -69,6 +75,58 @@ func CreateWebhook(c *gin.Context) {
 		return
 	}
 
+	if req.RateLimitPerMinute < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "rate_limit_per_minute must not be negative"})
+		return
+	}
+
+	// Validate the delivery target; non-HTTP targets get a display URL from their config
+	targetType := req.TargetType
+	if targetType == "" {
+		targetType = models.TargetTypeHTTP
+	}
+	targetConfig, targetURL, err := services.ValidateWebhookTarget(targetType, req.TargetConfig)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid target: " + err.Error()})
+		return
+	}
+	if targetType == models.TargetTypeHTTP {
+		if req.URL == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "url is required"})
+			return
+		}
+		// Block private and reserved destinations
+		if err := services.GetURLGuard().ValidateURL(req.URL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Webhook URL not allowed: " + err.Error()})
+			return
+		}
+	} else {
+		req.URL = targetURL
+	}
+	if req.ReplyEnabled && targetType != models.TargetTypeHTTP {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reply_enabled is only supported for http targets"})
+		return
+	}
+
+	// Validate payload template
+	if err := services.ValidatePayloadTemplate(req.PayloadTemplate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload_template: " + err.Error()})
+		return
+	}
+
+	if req.PayloadVersion == 0 {
+		req.PayloadVersion = models.PayloadVersion1
+	}
+	if !models.ValidPayloadVersion(req.PayloadVersion) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("payload_version must be between 1 and %d", models.LatestPayloadVersion)})
+		return
+	}
+	maxRetries, maxDeliveryAge, err := retryLimits(req.MaxRetries, req.MaxDeliveryAge)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Create webhook
 	webhook := models.Webhook{
 		UserID:               userID.(uint),
@@ -82,6 +140,39 @@ func CreateWebhook(c *gin.Context) {
 		FilterChatType:       req.FilterChatType,
 		FilterGroupJIDs:      models.JoinEventTypes(req.FilterGroupJIDs),
 		FilterGroupNames:     models.JoinEventTypes(req.FilterGroupNames),
+		PayloadTemplate:      req.PayloadTemplate,
+		RateLimitPerMinute:   req.RateLimitPerMinute,
+		TLSCACert:            req.TLSCACert,
+		TLSClientCert:        req.TLSClientCert,
+		TLSClientKey:         req.TLSClientKey,
+		ProxyURL:             req.ProxyURL,
+		CompressPayloads:     req.CompressPayloads,
+		CollapseDuplicates:   req.CollapseDuplicates,
+		TargetType:           targetType,
+		TargetConfig:         targetConfig,
+		ReplyEnabled:         req.ReplyEnabled,
+		TestMode:             req.TestMode || isTestMode(c), // Test-mode tokens only create test webhooks
+		PayloadVersion:       req.PayloadVersion,
+		MaxRetries:           maxRetries,
+		MaxDeliveryAge:       maxDeliveryAge,
+		AuthJWTAlgorithm:     req.AuthJWTAlgorithm,
+		AuthJWTKey:           req.AuthJWTKey,
+		AuthJWTAudience:      req.AuthJWTAudience,
+	}
+
+	if err := services.ValidateWebhookTLS(&webhook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid TLS configuration: " + err.Error()})
+		return
+	}
+
+	if err := services.ValidateWebhookProxy(&webhook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid proxy_url: " + err.Error()})
+		return
+	}
+
+	if err := services.ValidateWebhookJWT(&webhook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JWT configuration: " + err.Error()})
+		return
 	}
 
 	database := db.GetDB()
@@ -160,12 +251,60 @@ func UpdateWebhook(c *gin.Context) {
 		return
 	}
 
+	// Validate the delivery target. Changing the target type or config replaces the
+	// whole config, so credentials must be sent again.
+	targetType := webhook.TargetTypeOrDefault()
+	targetChanged := req.TargetType != "" || req.TargetConfig != nil
+	var targetConfig, targetURL string
+	if targetChanged {
+		if req.TargetType != "" {
+			targetType = req.TargetType
+		}
+		targetConfig, targetURL, err = services.ValidateWebhookTarget(targetType, req.TargetConfig)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid target: " + err.Error()})
+			return
+		}
+	}
+	if targetType == models.TargetTypeHTTP {
+		// Switching back to HTTP needs a real URL again
+		if targetChanged && webhook.TargetTypeOrDefault() != models.TargetTypeHTTP && req.URL == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "url is required"})
+			return
+		}
+		// Block private and reserved destinations
+		if req.URL != "" {
+			if err := services.GetURLGuard().ValidateURL(req.URL); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Webhook URL not allowed: " + err.Error()})
+				return
+			}
+		}
+	} else if req.URL != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url cannot be set for " + targetType + " targets"})
+		return
+	}
+
+	// Validate payload template
+	if req.PayloadTemplate != nil {
+		if err := services.ValidatePayloadTemplate(*req.PayloadTemplate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload_template: " + err.Error()})
+			return
+		}
+	}
+
 	// Update fields
 	updates := make(map[string]interface{})
 
 	if req.URL != "" {
 		updates["url"] = req.URL
 	}
+	if targetChanged {
+		updates["target_type"] = targetType
+		updates["target_config"] = targetConfig
+		if targetType != models.TargetTypeHTTP {
+			updates["url"] = targetURL
+		}
+	}
 	if req.Secret != "" {
 		updates["secret"] = req.Secret
 	}
@@ -179,6 +318,12 @@ func UpdateWebhook(c *gin.Context) {
 	}
 	if req.IsActive != nil {
 		updates["is_active"] = *req.IsActive
+		// Re-enabling clears the automatic disable state
+		if *req.IsActive {
+			updates["consecutive_failures"] = 0
+			updates["disabled_reason"] = ""
+			updates["disabled_at"] = nil
+		}
 	}
 	// Filter fields - update even if empty array (to clear filters)
 	if req.FilterPhoneNumbers != nil {
@@ -196,6 +341,106 @@ func UpdateWebhook(c *gin.Context) {
 	if req.FilterGroupNames != nil {
 		updates["filter_group_names"] = models.JoinEventTypes(req.FilterGroupNames)
 	}
+	if req.PayloadTemplate != nil {
+		updates["payload_template"] = *req.PayloadTemplate
+	}
+	if req.ReplyEnabled != nil {
+		updates["reply_enabled"] = *req.ReplyEnabled
+	}
+	if req.TestMode != nil {
+		if !*req.TestMode && isTestMode(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "A test-mode API token can't turn off test mode"})
+			return
+		}
+		updates["test_mode"] = *req.TestMode
+	}
+	if req.PayloadVersion != nil {
+		if !models.ValidPayloadVersion(*req.PayloadVersion) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("payload_version must be between 1 and %d", models.LatestPayloadVersion)})
+			return
+		}
+		updates["payload_version"] = *req.PayloadVersion
+	}
+	if req.MaxRetries != nil || req.MaxDeliveryAge != nil {
+		maxRetries, maxDeliveryAge, err := retryLimits(req.MaxRetries, req.MaxDeliveryAge)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.MaxRetries != nil {
+			updates["max_retries"] = maxRetries
+		}
+		if req.MaxDeliveryAge != nil {
+			updates["max_delivery_age"] = maxDeliveryAge
+		}
+	}
+	replyEnabled := webhook.ReplyEnabled
+	if req.ReplyEnabled != nil {
+		replyEnabled = *req.ReplyEnabled
+	}
+	if replyEnabled && targetType != models.TargetTypeHTTP {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reply_enabled is only supported for http targets"})
+		return
+	}
+	if req.RateLimitPerMinute != nil {
+		if *req.RateLimitPerMinute < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "rate_limit_per_minute must not be negative"})
+			return
+		}
+		updates["rate_limit_per_minute"] = *req.RateLimitPerMinute
+	}
+	if req.TLSCACert != nil || req.TLSClientCert != nil || req.TLSClientKey != nil {
+		candidate := webhook
+		if req.TLSCACert != nil {
+			candidate.TLSCACert = *req.TLSCACert
+			updates["tls_ca_cert"] = *req.TLSCACert
+		}
+		if req.TLSClientCert != nil {
+			candidate.TLSClientCert = *req.TLSClientCert
+			updates["tls_client_cert"] = *req.TLSClientCert
+		}
+		if req.TLSClientKey != nil {
+			candidate.TLSClientKey = *req.TLSClientKey
+			updates["tls_client_key"] = *req.TLSClientKey
+		}
+		if err := services.ValidateWebhookTLS(&candidate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid TLS configuration: " + err.Error()})
+			return
+		}
+	}
+	if req.ProxyURL != nil {
+		candidate := webhook
+		candidate.ProxyURL = *req.ProxyURL
+		if err := services.ValidateWebhookProxy(&candidate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid proxy_url: " + err.Error()})
+			return
+		}
+		updates["proxy_url"] = *req.ProxyURL
+	}
+	if req.CompressPayloads != nil {
+		updates["compress_payloads"] = *req.CompressPayloads
+	}
+	if req.CollapseDuplicates != nil {
+		updates["collapse_duplicates"] = *req.CollapseDuplicates
+	}
+	if req.AuthJWTAlgorithm != nil || req.AuthJWTKey != nil || req.AuthJWTAudience != nil {
+		candidate := webhook
+		if req.AuthJWTAlgorithm != nil {
+			candidate.AuthJWTAlgorithm = *req.AuthJWTAlgorithm
+			updates["auth_jwt_algorithm"] = *req.AuthJWTAlgorithm
+		}
+		if req.AuthJWTKey != nil {
+			candidate.AuthJWTKey = *req.AuthJWTKey
+			updates["auth_jwt_key"] = *req.AuthJWTKey
+		}
+		if req.AuthJWTAudience != nil {
+			updates["auth_jwt_audience"] = *req.AuthJWTAudience
+		}
+		if err := services.ValidateWebhookJWT(&candidate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JWT configuration: " + err.Error()})
+			return
+		}
+	}
 
 	if len(updates) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
@@ -236,16 +481,117 @@ func DeleteWebhook(c *gin.Context) {
 		return
 	}
 
-	// Delete associated deliveries first
-	database.Where("webhook_id = ?", webhookID).Delete(&models.WebhookDelivery{})
+	// Move it to the trash, keeping its delivery history. Events waiting for it are
+	// dropped and failed deliveries aren't retried.
+	err = database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", webhook.ID).Delete(&models.WebhookOutbox{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.WebhookDelivery{}).
+			Where("webhook_id = ? AND next_retry_at IS NOT NULL", webhook.ID).
+			Update("next_retry_at", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&webhook).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook moved to trash"})
+}
+
+// retryLimits validates a webhook's retry ceiling and maximum delivery age. Negative
+// values become nil, so the server's defaults apply.
+func retryLimits(maxRetries, maxDeliveryAge *int) (*int, *int, error) {
+	if maxRetries != nil && *maxRetries < 0 {
+		maxRetries = nil
+	}
+	if maxRetries != nil && *maxRetries > models.MaxWebhookRetries {
+		return nil, nil, fmt.Errorf("max_retries must be at most %d", models.MaxWebhookRetries)
+	}
+	if maxDeliveryAge != nil && *maxDeliveryAge < 0 {
+		maxDeliveryAge = nil
+	}
+	return maxRetries, maxDeliveryAge, nil
+}
+
+// ListWebhookTrash returns the user's deleted webhooks, which can still be restored
+func ListWebhookTrash(c *gin.Context) {
+	var webhooks []models.Webhook
+	if err := db.GetDB().Unscoped().
+		Where("user_id = ? AND deleted_at IS NOT NULL", c.GetUint("userID")).
+		Order("deleted_at DESC").Find(&webhooks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhooks"})
+		return
+	}
+
+	responses := make([]models.WebhookResponse, len(webhooks))
+	for i := range webhooks {
+		responses[i] = webhooks[i].ToResponse()
+	}
+	c.JSON(http.StatusOK, gin.H{"webhooks": responses})
+}
+
+// RestoreWebhook takes a webhook out of the trash. It gets events again, and its
+// delivery history is back, but failed deliveries aren't retried.
+func RestoreWebhook(c *gin.Context) {
+	webhook, ok := findTrashedWebhook(c)
+	if !ok {
+		return
+	}
+
+	if err := db.GetDB().Unscoped().Model(webhook).Update("deleted_at", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore webhook"})
+		return
+	}
+	webhook.DeletedAt = gorm.DeletedAt{}
+	c.JSON(http.StatusOK, webhook.ToResponse())
+}
+
+// PurgeWebhook deletes a webhook in the trash for good, with its delivery history
+func PurgeWebhook(c *gin.Context) {
+	webhook, ok := findTrashedWebhook(c)
+	if !ok {
+		return
+	}
 
-	// Delete webhook
-	if result := database.Delete(&webhook); result.Error != nil {
+	if err := services.PurgeWebhooks(db.GetDB(), []uint{webhook.ID}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
 		return
 	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted permanently"})
+}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+// findTrashedWebhook loads the user's webhook in the trash named by the :id parameter,
+// writing an error response if there's none
+func findTrashedWebhook(c *gin.Context) (*models.Webhook, bool) {
+	var webhook models.Webhook
+	if err := db.GetDB().Unscoped().
+		Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", c.Param("id"), c.GetUint("userID")).
+		First(&webhook).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found in trash"})
+		return nil, false
+	}
+	return &webhook, true
+}
+
+// GetWebhooksHealth returns a delivery health summary for all of the user's webhooks
+func GetWebhooksHealth(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	health, err := services.GetWebhookService().GetWebhookHealth(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get webhook health"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhooks": health})
 }
 
 // ListWebhookEvents returns available webhook event types
@@ -292,11 +638,17 @@ func ListWebhookDeliveries(c *gin.Context) {
 		}
 	}
 
+	query, err := filterDeliveries(database.Model(&models.WebhookDelivery{}).Where("webhook_id = ?", webhookID), c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	var deliveries []models.WebhookDelivery
 	var total int64
 
-	database.Model(&models.WebhookDelivery{}).Where("webhook_id = ?", webhookID).Count(&total)
-	database.Where("webhook_id = ?", webhookID).
+	query.Session(&gorm.Session{}).Count(&total)
+	query.Session(&gorm.Session{}).
 		Order("created_at desc").
 		Limit(limit).
 		Offset(offset).
@@ -305,16 +657,7 @@ func ListWebhookDeliveries(c *gin.Context) {
 	// Convert to response format
 	responses := make([]models.WebhookDeliveryResponse, len(deliveries))
 	for i, d := range deliveries {
-		responses[i] = models.WebhookDeliveryResponse{
-			ID:             d.ID,
-			EventType:      d.EventType,
-			Success:        d.Success,
-			ResponseStatus: d.ResponseStatus,
-			ErrorMessage:   d.ErrorMessage,
-			RetryCount:     d.RetryCount,
-			NextRetryAt:    d.NextRetryAt,
-			CreatedAt:      d.CreatedAt,
-		}
+		responses[i] = d.ToResponse()
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -325,7 +668,174 @@ func ListWebhookDeliveries(c *gin.Context) {
 	})
 }
 
-// TestWebhook sends a test payload to a webhook
+// deliveryExportBatchSize is how many delivery rows an export reads at a time
+const deliveryExportBatchSize = 500
+
+// deliveryExportColumns are the CSV columns of a delivery export
+var deliveryExportColumns = []string{
+	"id", "delivery_id", "event_type", "success", "response_status", "error_message",
+	"retry_count", "next_retry_at", "abandoned_reason", "duration_ms", "created_at", "payload", "response_body",
+}
+
+// ExportWebhookDeliveries streams a webhook's full delivery log as CSV or NDJSON,
+// oldest first. Accepts the same filters as ListWebhookDeliveries.
+func ExportWebhookDeliveries(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	webhookID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "ndjson" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be 'csv' or 'ndjson'"})
+		return
+	}
+
+	database := db.GetDB()
+	var webhook models.Webhook
+
+	// Verify webhook belongs to user
+	result := database.Where("id = ? AND user_id = ?", webhookID, userID).First(&webhook)
+	if result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	query, err := filterDeliveries(database.Model(&models.WebhookDelivery{}).Where("webhook_id = ?", webhookID), c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("webhook-%d-deliveries.%s", webhook.ID, format)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	var writeRow func(d *models.WebhookDelivery) error
+	var flush func() error
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		w := csv.NewWriter(c.Writer)
+		w.Write(deliveryExportColumns)
+		writeRow = func(d *models.WebhookDelivery) error {
+			nextRetryAt := ""
+			if d.NextRetryAt != nil {
+				nextRetryAt = d.NextRetryAt.UTC().Format(time.RFC3339)
+			}
+			return w.Write([]string{
+				strconv.FormatUint(uint64(d.ID), 10),
+				d.DeliveryIDOrDefault(),
+				d.EventType,
+				strconv.FormatBool(d.Success),
+				strconv.Itoa(d.ResponseStatus),
+				d.ErrorMessage,
+				strconv.Itoa(d.RetryCount),
+				nextRetryAt,
+				d.AbandonedReason,
+				strconv.FormatInt(d.DurationMs, 10),
+				d.CreatedAt.UTC().Format(time.RFC3339Nano),
+				d.Payload,
+				d.ResponseBody,
+			})
+		}
+		flush = func() error {
+			w.Flush()
+			return w.Error()
+		}
+	} else {
+		c.Header("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(c.Writer)
+		writeRow = func(d *models.WebhookDelivery) error {
+			d.DeliveryID = d.DeliveryIDOrDefault()
+			return enc.Encode(d)
+		}
+		flush = func() error { return nil }
+	}
+	c.Status(http.StatusOK)
+
+	// Read in batches so large logs aren't loaded into memory at once
+	var batch []models.WebhookDelivery
+	result = query.Order("id asc").FindInBatches(&batch, deliveryExportBatchSize, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			if err := writeRow(&batch[i]); err != nil {
+				return err
+			}
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if result.Error != nil {
+		// Headers are already sent, so the client sees a truncated file
+		fmt.Printf("[Webhook Export] Export of webhook %d deliveries failed: %v\n", webhook.ID, result.Error)
+	}
+	flush()
+}
+
+// filterDeliveries applies the delivery history query filters:
+// success (true/false), event_type, abandoned (true/false), status (HTTP status code), from and to (RFC3339)
+func filterDeliveries(query *gorm.DB, c *gin.Context) (*gorm.DB, error) {
+	if v := c.Query("success"); v != "" {
+		success, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("success must be true or false")
+		}
+		query = query.Where("success = ?", success)
+	}
+
+	if v := c.Query("event_type"); v != "" {
+		query = query.Where("event_type = ?", v)
+	}
+
+	if v := c.Query("abandoned"); v != "" {
+		abandoned, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("abandoned must be true or false")
+		}
+		if abandoned {
+			query = query.Where("abandoned_reason <> ''")
+		} else {
+			query = query.Where("abandoned_reason IS NULL OR abandoned_reason = ''")
+		}
+	}
+
+	if v := c.Query("status"); v != "" {
+		status, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("status must be an HTTP status code")
+		}
+		query = query.Where("response_status = ?", status)
+	}
+
+	if v := c.Query("from"); v != "" {
+		from, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("from must be an RFC3339 timestamp")
+		}
+		query = query.Where("created_at >= ?", from)
+	}
+
+	if v := c.Query("to"); v != "" {
+		to, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("to must be an RFC3339 timestamp")
+		}
+		query = query.Where("created_at <= ?", to)
+	}
+
+	return query, nil
+}
+
+// TestWebhook sends a test payload to a webhook: the generic test event, a sample of a
+// given event type, or a replay of the latest real delivery
 func TestWebhook(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -349,12 +859,37 @@ func TestWebhook(c *gin.Context) {
 		return
 	}
 
+	// The body is optional; an empty one sends the generic test event
+	var req models.WebhookTestRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Send test webhook
 	webhookService := services.GetWebhookService()
-	delivery, err := webhookService.TestWebhook(&webhook)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send test webhook: " + err.Error()})
-		return
+	var delivery *models.WebhookDelivery
+	if req.Replay {
+		var source models.WebhookDelivery
+		query := database.Where("webhook_id = ? AND event_type <> ?", webhook.ID, "test")
+		if req.EventType != "" {
+			query = query.Where("event_type = ?", req.EventType)
+		}
+		if err := query.Order("id desc").First(&source).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No delivery to replay"})
+			return
+		}
+		delivery = webhookService.ReplayDelivery(&webhook, &source)
+	} else {
+		delivery, err = webhookService.TestWebhook(&webhook, req.EventType)
+		if errors.Is(err, services.ErrNoSampleEvent) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send test webhook: " + err.Error()})
+			return
+		}
 	}
 
 	// Save the test delivery
@@ -364,19 +899,44 @@ func TestWebhook(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Test webhook sent",
-		"delivery": models.WebhookDeliveryResponse{
-			ID:             delivery.ID,
-			EventType:      delivery.EventType,
-			Success:        delivery.Success,
-			ResponseStatus: delivery.ResponseStatus,
-			ErrorMessage:   delivery.ErrorMessage,
-			RetryCount:     delivery.RetryCount,
-			CreatedAt:      delivery.CreatedAt,
-		},
+		"message":  "Test webhook sent",
+		"delivery": delivery.ToResponse(),
 	})
 }
 
+// TestWebhookFilters reports whether a sample message_received event would match a
+// webhook's filters, and why, without sending anything
+func TestWebhookFilters(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	webhookID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	var webhook models.Webhook
+	if err := db.GetDB().Where("id = ? AND user_id = ?", webhookID, userID).First(&webhook).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	var sample models.MessageReceivedData
+	if err := c.ShouldBindJSON(&sample); errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A sample message_received event is required"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, services.GetWebhookService().TestFilters(&webhook, sample))
+}
+
 // GetWebhookStats returns statistics for a webhook
 func GetWebhookStats(c *gin.Context) {
 	userID, exists := c.Get("userID")
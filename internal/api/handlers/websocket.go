@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/user/pinglater/internal/api/middleware"
+	"github.com/user/pinglater/internal/models"
+)
+
+// WebSocketMessage is a frame sent to WebSocket clients. Events carry the same data as
+// their SSE counterparts; command replies echo the command's ID.
+type WebSocketMessage struct {
+	Event string      `json:"event"`
+	ID    string      `json:"id,omitempty"`
+	Data  interface{} `json:"data,omitempty"`
+	Error string      `json:"error,omitempty"`
+	// HTTP status the same request gets from the REST API, on command replies
+	Status int `json:"status,omitempty"`
+}
+
+// WebSocketCommand is a frame received from WebSocket clients. The only action is
+// "send", which takes the fields of POST /whatsapp/send.
+type WebSocketCommand struct {
+	Action string `json:"action"`
+	ID     string `json:"id,omitempty"` // Chosen by the client to match the reply
+	SendMessageRequest
+}
+
+// Requests authenticate with a token rather than cookies, so any origin may connect
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// WhatsAppWebSocket streams the real-time events of GetEvents over a WebSocket, for
+// clients that handle WebSockets better than SSE, and accepts send commands
+func WhatsAppWebSocket(c *gin.Context) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade has already written the error response
+		return
+	}
+	conn.SetReadLimit(64 << 10)
+	wanted := eventTypeFilter(c)
+
+	// Event and command replies are written from different goroutines
+	var writeMu sync.Mutex
+	write := func(msg WebSocketMessage) bool {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		return conn.WriteJSON(msg) == nil
+	}
+
+	eventChan := GetEventStream().Subscribe(c.GetUint("userID"))
+	defer GetEventStream().Unsubscribe(eventChan)
+
+	// Commands are read alongside the event stream. The reader uses c, which gin reuses
+	// once the handler returns, so wait for it to finish.
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var cmd WebSocketCommand
+			reply := WebSocketMessage{Event: "error", Status: http.StatusBadRequest, Error: "Invalid command: expected a JSON object"}
+			if json.Unmarshal(data, &cmd) == nil {
+				reply = handleWebSocketCommand(c, cmd)
+			}
+			if !write(reply) {
+				return
+			}
+		}
+	}()
+	defer func() {
+		conn.Close()
+		<-readDone
+	}()
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	if !write(WebSocketMessage{Event: "ping", Data: gin.H{"status": "connected", "timestamp": time.Now()}}) {
+		return
+	}
+	for {
+		select {
+		case event, ok := <-eventChan:
+			if !ok {
+				return
+			}
+			if !wanted(event.Type) {
+				continue
+			}
+			if !write(WebSocketMessage{Event: string(event.Type), Data: gin.H{
+				"message":   event.Message,
+				"details":   event.Details,
+				"timestamp": event.Timestamp,
+			}}) {
+				return
+			}
+		case <-heartbeat.C:
+			if !write(WebSocketMessage{Event: "ping", Data: gin.H{"timestamp": time.Now()}}) {
+				return
+			}
+		case <-readDone:
+			return
+		case <-GetEventStream().Done():
+			writeMu.Lock()
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+				time.Now().Add(time.Second))
+			writeMu.Unlock()
+			return
+		}
+	}
+}
+
+// handleWebSocketCommand runs a command under the same scope, rate limit and quota
+// checks as the matching REST endpoint
+func handleWebSocketCommand(c *gin.Context, cmd WebSocketCommand) WebSocketMessage {
+	reply := WebSocketMessage{Event: cmd.Action + "_result", ID: cmd.ID}
+	fail := func(status int, message string) WebSocketMessage {
+		reply.Status, reply.Error = status, message
+		return reply
+	}
+
+	if cmd.Action != "send" {
+		reply.Event = "error"
+		return fail(http.StatusBadRequest, fmt.Sprintf("Unknown action %q", cmd.Action))
+	}
+	if cmd.PhoneNumber == "" || cmd.Message == "" {
+		return fail(http.StatusBadRequest, "Invalid request: phone_number and message are required")
+	}
+
+	value, isToken := c.Get("apiToken")
+	var token *models.APIToken
+	if isToken {
+		token = value.(*models.APIToken)
+		if !token.HasScope(models.ScopeMessagesSend) {
+			return fail(http.StatusForbidden, "Insufficient permissions. Required scope: "+models.ScopeMessagesSend)
+		}
+		if allowed, _, _ := middleware.TakeTokenRequest(token); !allowed {
+			return fail(http.StatusTooManyRequests, "API token rate limit exceeded")
+		}
+		allowed, _, _, err := middleware.TakeMessageQuota(token)
+		if err != nil {
+			return fail(http.StatusInternalServerError, "Failed to check message quota")
+		}
+		if !allowed {
+			return fail(http.StatusTooManyRequests, "Daily message quota exceeded")
+		}
+	}
+
+	status, response := sendTextMessage(c, cmd.SendMessageRequest)
+	if status >= http.StatusBadRequest {
+		if token != nil {
+			middleware.ReturnMessageQuota(token)
+		}
+		message, _ := response["error"].(string)
+		return fail(status, message)
+	}
+	reply.Status, reply.Data = status, response
+	return reply
+}
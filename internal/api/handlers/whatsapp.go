@@ -1,14 +1,23 @@
 package handlers
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+	"github.com/user/pinglater/internal/api/middleware"
 	"github.com/user/pinglater/internal/db"
 	"github.com/user/pinglater/internal/models"
+	"github.com/user/pinglater/internal/services"
 	"github.com/user/pinglater/internal/whatsapp"
 )
 
@@ -36,26 +45,53 @@ func GetDashboardMetrics() *models.DashboardMetrics {
 }
 
 func BroadcastEvent(eventType models.EventType, message string, details string) {
+	BroadcastUserEvent(0, eventType, message, details)
+}
+
+// BroadcastUserEvent sends an event to the event streams of one user, or of everyone
+// when userID is 0
+func BroadcastUserEvent(userID uint, eventType models.EventType, message string, details string) {
 	event := models.Event{
 		Type:      eventType,
 		Message:   message,
 		Details:   details,
 		Timestamp: time.Now(),
+		UserID:    userID,
 	}
+
+	eventLogMu.Lock()
+	defer eventLogMu.Unlock()
+	recordEvent(&event)
 	GetEventStream().Broadcast(event)
 }
 
 func GetWhatsAppStatus(c *gin.Context) {
 	client := whatsapp.GetClient()
 	status := client.GetStatus()
+	status.AccountID = client.AccountID()
 
 	c.JSON(http.StatusOK, status)
 }
 
+// GetWhatsAppDevice returns details of the linked phone and account
+func GetWhatsAppDevice(c *gin.Context) {
+	info, err := whatsapp.GetClient().DeviceInfo()
+	if errors.Is(err, whatsapp.ErrNotLinked) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
+
 func ConnectWhatsApp(c *gin.Context) {
 	client := whatsapp.GetClient()
 
-	if err := client.Connect(); err != nil {
+	// A new pairing links the device to the user starting it
+	if err := client.ConnectAs(c.GetUint("userID")); err != nil {
 		// If already connected, return success instead of error
 		if err.Error() == "already connected" {
 			c.JSON(http.StatusOK, gin.H{"message": "WhatsApp already connected"})
@@ -68,6 +104,46 @@ func ConnectWhatsApp(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "WhatsApp connection initiated"})
 }
 
+// PairCodeRequest links a device by phone number
+type PairCodeRequest struct {
+	PhoneNumber string `json:"phone_number" binding:"required"` // International format, digits only
+}
+
+// PairWithCode starts pairing by phone number and returns the code to enter on the
+// phone, for deployments where scanning a QR code is impractical
+func PairWithCode(c *gin.Context) {
+	var req PairCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	phone := strings.NewReplacer("+", "", " ", "", "-", "").Replace(req.PhoneNumber)
+	if len(phone) < 7 || len(phone) > 15 || strings.Trim(phone, "0123456789") != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "phone_number must be an international number with country code"})
+		return
+	}
+
+	code, err := whatsapp.GetClient().PairPhone(c.GetUint("userID"), phone)
+	if err != nil {
+		if err.Error() == "already connected" {
+			c.JSON(http.StatusConflict, gin.H{"error": "WhatsApp already connected"})
+			return
+		}
+		if errors.Is(err, whatsapp.ErrSessionExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    code,
+		"message": "On the phone, open WhatsApp > Linked devices > Link with phone number instead and enter the code",
+	})
+}
+
 func DisconnectWhatsApp(c *gin.Context) {
 	client := whatsapp.GetClient()
 
@@ -79,6 +155,25 @@ func DisconnectWhatsApp(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "WhatsApp disconnected"})
 }
 
+// LogoutWhatsApp unlinks the WhatsApp device so the account can be paired again
+func LogoutWhatsApp(c *gin.Context) {
+	remote, err := whatsapp.GetClient().Logout()
+	if err != nil {
+		if errors.Is(err, whatsapp.ErrNotLinked) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	message := "WhatsApp logged out"
+	if !remote {
+		message = "WhatsApp logged out locally; remove PingLater from the phone's linked devices"
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message, "unlinked_on_phone": remote})
+}
+
 func GetWhatsAppQR(c *gin.Context) {
 	client := whatsapp.GetClient()
 
@@ -166,10 +261,64 @@ func GetCurrentQRCode(c *gin.Context) {
 	})
 }
 
+// GetQRCodeImage renders the current pairing QR code as a PNG, or with ?format=base64
+// as a data URI in JSON, for clients that can't render QR codes themselves. The optional
+// size parameter sets the width in pixels (default 256).
+func GetQRCodeImage(c *gin.Context) {
+	qrCode, expired, connected := whatsapp.GetClient().GetCurrentQR()
+	switch {
+	case connected:
+		c.JSON(http.StatusConflict, gin.H{"status": "connected", "error": "WhatsApp is already connected"})
+		return
+	case expired:
+		c.JSON(http.StatusNotFound, gin.H{"status": "expired", "error": "QR code expired, please reconnect"})
+		return
+	case qrCode == "":
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusNotFound, gin.H{"status": "waiting", "error": "No QR code yet, connect first"})
+		return
+	}
+
+	size := 256
+	if value := c.Query("size"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 64 || n > 1024 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "size must be between 64 and 1024"})
+			return
+		}
+		size = n
+	}
+
+	png, err := qrcode.Encode(qrCode, qrcode.Medium, size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render QR code"})
+		return
+	}
+
+	// QR codes rotate every 20 seconds or so
+	c.Header("Cache-Control", "no-store")
+	if c.Query("format") == "base64" {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "pending",
+			"qr_code": qrCode,
+			"image":   "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+		})
+		return
+	}
+	c.Data(http.StatusOK, "image/png", png)
+}
+
 // SendMessageRequest represents the request body for sending a message
 type SendMessageRequest struct {
 	PhoneNumber string `json:"phone_number" binding:"required"`
 	Message     string `json:"message" binding:"required"`
+	// Account to send from, by account ID or phone number; defaults to the linked account
+	Account string `json:"account,omitempty"`
+	// Queue the message and return at once instead of waiting for WhatsApp; the
+	// response's status_url reports when it's sent
+	Async bool `json:"async,omitempty"`
+	// Send queue priority of an async message: high, normal (the default) or low
+	Priority string `json:"priority,omitempty"`
 }
 
 // SendMessage sends a WhatsApp message to a phone number
@@ -180,37 +329,207 @@ func SendMessage(c *gin.Context) {
 		return
 	}
 
+	c.JSON(sendTextMessage(c, req))
+}
+
+// sendTextMessage sends a text message for the request's user and returns the response
+// status and body. The WebSocket API sends through here too.
+func sendTextMessage(c *gin.Context, req SendMessageRequest) (int, gin.H) {
 	client := whatsapp.GetClient()
 
+	priority, ok := models.NormalizeSendPriority(req.Priority)
+	if !ok {
+		return http.StatusBadRequest, gin.H{"error": "Invalid request: priority must be high, normal or low"}
+	}
+	req.Priority = priority
+
+	if req.Async {
+		return queueTextMessage(c, client, req)
+	}
+	if isTestMode(c) {
+		return simulateTextMessage(c, client, req)
+	}
+
 	// Check if connected
-	if !client.IsConnected() {
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "WhatsApp not connected"})
-		return
+	if !client.CanSend() {
+		return http.StatusServiceUnavailable, gin.H{"error": "WhatsApp not connected"}
+	}
+
+	if status, message := checkSendAccount(c, client, req.Account); status != 0 {
+		return status, gin.H{"error": message}
 	}
 
 	// Format phone number to JID (WhatsApp ID format: number@s.whatsapp.net)
 	jid := req.PhoneNumber + "@s.whatsapp.net"
 
 	// Send the message
-	if err := client.SendMessage(jid, req.Message); err != nil {
-		BroadcastEvent(models.EventTypeConnectionError, "Failed to send message", err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message: " + err.Error()})
+	messageID, sent, err := client.SendMessage(c.GetUint("userID"), jid, req.Message)
+	var throttled *whatsapp.ThrottledError
+	if errors.As(err, &throttled) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		return http.StatusTooManyRequests, gin.H{"error": err.Error()}
+	}
+	if errors.Is(err, whatsapp.ErrRateLimited) {
+		return http.StatusTooManyRequests, gin.H{"error": err.Error()}
+	}
+	if errors.Is(err, whatsapp.ErrSendVetoed) {
+		return http.StatusUnprocessableEntity, gin.H{"error": err.Error()}
+	}
+	if err != nil {
+		BroadcastUserEvent(c.GetUint("userID"), models.EventTypeConnectionError, "Failed to send message", err.Error())
+		return http.StatusInternalServerError, gin.H{"error": "Failed to send message: " + err.Error()}
+	}
+
+	recordSentMessage(c.GetUint("userID"), req.PhoneNumber, sent, messageID, models.MessageSourceAPI, false)
+
+	return http.StatusOK, gin.H{
+		"message": "Message sent successfully",
+		"to":      req.PhoneNumber,
+	}
+}
+
+// simulateTextMessage answers a send with a test-mode API token as if the message was
+// sent, without WhatsApp. Only test-mode webhooks hear of it.
+func simulateTextMessage(c *gin.Context, client *whatsapp.Client, req SendMessageRequest) (int, gin.H) {
+	if status, message := checkSendAccount(c, client, req.Account); status != 0 {
+		return status, gin.H{"error": message}
+	}
+
+	messageID := services.TestMessageID()
+	recordSentMessage(c.GetUint("userID"), req.PhoneNumber, req.Message, messageID, models.MessageSourceAPI, true)
+
+	return http.StatusOK, gin.H{
+		"message":    "Test message simulated, not sent",
+		"to":         req.PhoneNumber,
+		"message_id": messageID,
+		"test":       true,
+	}
+}
+
+// queueTextMessage queues a message for the send queue, which sends it once WhatsApp is
+// connected
+func queueTextMessage(c *gin.Context, client *whatsapp.Client, req SendMessageRequest) (int, gin.H) {
+	if status, message := checkSendAccount(c, client, req.Account); status != 0 {
+		return status, gin.H{"error": message}
+	}
+
+	msg := models.OutgoingMessage{
+		UserID:      c.GetUint("userID"),
+		PhoneNumber: strings.TrimPrefix(strings.TrimSpace(req.PhoneNumber), "+"),
+		Message:     req.Message,
+		Source:      models.MessageSourceAPI,
+		Priority:    req.Priority,
+		TestMode:    isTestMode(c),
+	}
+	queued := []models.OutgoingMessage{msg}
+	if err := services.GetSendQueue().Enqueue(db.GetDB(), queued); err != nil {
+		fmt.Printf("[Send] Failed to queue message: %v\n", err)
+		return http.StatusInternalServerError, gin.H{"error": "Failed to queue message"}
+	}
+
+	return http.StatusAccepted, gin.H{
+		"id":         queued[0].ID,
+		"status":     queued[0].Status,
+		"to":         msg.PhoneNumber,
+		"status_url": fmt.Sprintf("/api/messages/%d", queued[0].ID),
+	}
+}
+
+// GetOutgoingMessage reports the status of a message sent through the send queue
+func GetOutgoingMessage(c *gin.Context) {
+	var msg models.OutgoingMessage
+	if err := db.GetDB().Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("userID")).First(&msg).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
 		return
 	}
+	c.JSON(http.StatusOK, msg)
+}
 
+// GetSandboxMessages lists the messages recorded instead of sent in sandbox mode, newest
+// first
+func GetSandboxMessages(c *gin.Context) {
+	client := whatsapp.GetClient()
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":  client.Sandboxed(),
+		"messages": client.SandboxMessages(),
+	})
+}
+
+// ClearSandboxMessages forgets the messages recorded in sandbox mode
+func ClearSandboxMessages(c *gin.Context) {
+	whatsapp.GetClient().ClearSandbox()
+	c.JSON(http.StatusOK, gin.H{"message": "Sandbox messages cleared"})
+}
+
+// recordSentMessage updates the metrics and emits the message_sent event and webhooks
+// for a message sent to a phone number. A message simulated in test mode only goes to
+// test-mode webhooks.
+func recordSentMessage(userID uint, phoneNumber, content, messageID, source string, testMode bool) {
+	if !testMode {
+		recordLiveMessage(userID, phoneNumber, content)
+	}
+
+	// Trigger message_sent webhooks
+	if userID != 0 {
+		toPhone := phoneNumber
+		if strings.Contains(phoneNumber, "@") {
+			toPhone = "" // A group
+		}
+		data := models.MessageSentData{
+			To:        services.RecipientJID(phoneNumber),
+			ToPhone:   toPhone,
+			Content:   content,
+			MessageID: messageID,
+			Source:    source,
+			Timestamp: time.Now().Unix(),
+		}
+		if testMode {
+			services.GetWebhookService().TriggerTestWebhooks(userID, string(models.EventTypeMessageSent), data)
+		} else {
+			services.GetWebhookService().TriggerMessageSent(userID, data)
+		}
+	}
+}
+
+// recordLiveMessage updates the metrics and dashboard for a message really sent
+func recordLiveMessage(userID uint, phoneNumber, content string) {
 	// Update metrics
 	metricsMutex.Lock()
 	m := GetDashboardMetrics()
 	m.TotalMessagesSent++
 	metricsMutex.Unlock()
+	services.RecordMessageSent(userID)
 
 	// Broadcast success event
-	BroadcastEvent(models.EventTypeMessageSent, "Message sent to "+req.PhoneNumber, req.Message)
+	BroadcastUserEvent(userID, models.EventTypeMessageSent, "Message sent to "+phoneNumber, content)
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Message sent successfully",
-		"to":      req.PhoneNumber,
-	})
+// checkSendAccount resolves the account a message is sent from and checks that the
+// user and the request's API token may use it. It returns 0 when allowed, otherwise the
+// error status and message.
+func checkSendAccount(c *gin.Context, client *whatsapp.Client, account string) (int, string) {
+	accountID := client.AccountID()
+	if account != "" && account != strconv.FormatUint(uint64(accountID), 10) &&
+		strings.TrimPrefix(account, "+") != client.GetPhoneNumber() {
+		return http.StatusNotFound, "WhatsApp account not found"
+	}
+	if !middleware.CanUseDevice(c, client) {
+		return http.StatusForbidden, "You may not send from this WhatsApp account"
+	}
+
+	if value, exists := c.Get("apiToken"); exists {
+		if !value.(*models.APIToken).CanUseAccount(accountID) {
+			return http.StatusForbidden, "API token may not send from this WhatsApp account"
+		}
+	}
+	return 0, ""
+}
+
+// isTestMode reports whether the request uses a test-mode API token, whose messages are
+// simulated rather than sent
+func isTestMode(c *gin.Context) bool {
+	value, exists := c.Get("apiToken")
+	return exists && value.(*models.APIToken).TestMode
 }
 
 // GetEvents handles Server-Sent Events for real-time updates
@@ -226,7 +545,8 @@ func GetEvents(c *gin.Context) {
 	c.Writer.Flush()
 
 	// Subscribe to event stream
-	eventChan := GetEventStream().Subscribe()
+	userID := c.GetUint("userID")
+	eventChan := GetEventStream().Subscribe(userID)
 	defer GetEventStream().Unsubscribe(eventChan)
 
 	// Create a ticker for heartbeat to keep connection alive
@@ -237,18 +557,33 @@ func GetEvents(c *gin.Context) {
 	c.SSEvent("ping", gin.H{"status": "connected", "timestamp": time.Now()})
 	c.Writer.Flush()
 
+	// Catch up a reconnecting client. Subscribing first means nothing falls between the
+	// replay and the live stream; live events already replayed are skipped.
+	wanted := eventTypeFilter(c)
+	var replayed uint
+	if lastID, ok := lastEventID(c); ok {
+		events, gap := missedEvents(userID, lastID)
+		if gap {
+			c.SSEvent("replay_gap", gin.H{"message": "Some missed events are no longer available", "timestamp": time.Now()})
+		}
+		for _, event := range events {
+			if wanted(event.Type) {
+				writeSSEvent(c, event)
+			}
+			replayed = event.ID
+		}
+	}
+
 	c.Stream(func(w io.Writer) bool {
 		select {
 		case event, ok := <-eventChan:
 			if !ok {
 				return false
 			}
-			c.SSEvent(string(event.Type), gin.H{
-				"message":   event.Message,
-				"details":   event.Details,
-				"timestamp": event.Timestamp,
-			})
-			c.Writer.Flush()
+			if (event.ID != 0 && event.ID <= replayed) || !wanted(event.Type) {
+				return true
+			}
+			writeSSEvent(c, event)
 			return true
 		case <-heartbeat.C:
 			// Send heartbeat to keep connection alive
@@ -257,6 +592,8 @@ func GetEvents(c *gin.Context) {
 			return true
 		case <-c.Request.Context().Done():
 			return false
+		case <-GetEventStream().Done():
+			return false
 		}
 	})
 }
@@ -264,9 +601,11 @@ func GetEvents(c *gin.Context) {
 // GetMetrics returns dashboard metrics
 func GetMetrics(c *gin.Context) {
 	client := whatsapp.GetClient()
+	pipeline := services.GetWebhookService().PipelineMetrics()
 
 	metricsMutex.RLock()
 	m := GetDashboardMetrics()
+	m.Webhooks = &pipeline
 
 	// Update connection status from client
 	m.Connected = client.IsConnected()
@@ -284,7 +623,7 @@ func GetMetrics(c *gin.Context) {
 		database := db.GetDB()
 		if database != nil {
 			var session models.WhatsAppSession
-			if err := database.First(&session).Error; err == nil {
+			if err := database.Where("user_id = ?", client.OwnerID()).First(&session).Error; err == nil {
 				if session.LastConnectedAt != nil {
 					m.LastConnectedAt = *session.LastConnectedAt
 				}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/whatsapp"
+)
+
+const minBackupPassphraseLength = 12
+
+// BackupRequest holds the passphrase a session backup is encrypted with
+type BackupRequest struct {
+	Passphrase string `json:"passphrase" binding:"required"`
+}
+
+// ExportWhatsAppSession downloads an encrypted backup of the WhatsApp device store
+func ExportWhatsAppSession(c *gin.Context) {
+	var req BackupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	if len(req.Passphrase) < minBackupPassphraseLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Passphrase must be at least %d characters", minBackupPassphraseLength)})
+		return
+	}
+
+	var archive bytes.Buffer
+	if err := whatsapp.GetClient().ExportStore(&archive, req.Passphrase); err != nil {
+		fmt.Printf("[Backup] Failed to export WhatsApp session: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export WhatsApp session"})
+		return
+	}
+
+	filename := "pinglater-whatsapp-" + time.Now().Format("20060102-150405") + ".backup"
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Data(http.StatusOK, "application/octet-stream", archive.Bytes())
+}
+
+// RestoreWhatsAppSession replaces the WhatsApp device store with an uploaded backup
+// (multipart field "backup") and connects with the restored session
+func RestoreWhatsAppSession(c *gin.Context) {
+	passphrase := c.PostForm("passphrase")
+	file, err := c.FormFile("backup")
+	if err != nil || passphrase == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A backup file and passphrase are required"})
+		return
+	}
+	if file.Size > whatsapp.MaxBackupSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Backup file is too large"})
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read backup file"})
+		return
+	}
+	defer f.Close()
+	archive, err := io.ReadAll(f)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read backup file"})
+		return
+	}
+
+	client := whatsapp.GetClient()
+	if err := client.RestoreStore(archive, passphrase, c.GetUint("userID")); err != nil {
+		switch {
+		case errors.Is(err, whatsapp.ErrRestoreWhileConnected):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, whatsapp.ErrInvalidBackup), errors.Is(err, whatsapp.ErrEmptyBackup):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			fmt.Printf("[Backup] Failed to restore WhatsApp session: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore WhatsApp session: " + err.Error()})
+		}
+		return
+	}
+
+	// The store is in place even if WhatsApp can't be reached right now
+	response := gin.H{"message": "WhatsApp session restored"}
+	if err := client.AutoConnect(); err != nil {
+		response["connect_error"] = err.Error()
+	}
+	response["status"] = client.GetStatus()
+	c.JSON(http.StatusOK, response)
+}
@@ -2,10 +2,12 @@ package middleware
 
 import (
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -13,24 +15,50 @@ import (
 	"github.com/user/pinglater/internal/models"
 )
 
-// hashToken hashes a token using SHA-256
-func hashToken(token string) string {
+// HashToken hashes an API token's secret using SHA-256, as it's stored
+func HashToken(token string) string {
 	hash := sha256.Sum256([]byte(token))
 	return hex.EncodeToString(hash[:])
 }
 
-// validateAndGetToken validates an API token and returns the token record
-func validateAndGetToken(tokenStr string) (*models.APIToken, error) {
-	if !strings.HasPrefix(tokenStr, "plt_live_") {
+// isAPIToken reports whether a bearer token is an API token rather than a JWT
+func isAPIToken(tokenStr string) bool {
+	return strings.HasPrefix(tokenStr, models.TokenPrefixLive) || strings.HasPrefix(tokenStr, models.TokenPrefixTest)
+}
+
+// ValidateAPIToken validates an API token and returns the token record. Tokens of the
+// form plt_live_<id>_<secret> (plt_test_ in test mode) are loaded by ID and their
+// secret's hash compared in constant time; older plt_live_<secret> tokens are looked up
+// by hash.
+func ValidateAPIToken(tokenStr string) (*models.APIToken, error) {
+	if !isAPIToken(tokenStr) {
 		return nil, nil
 	}
 
-	tokenHash := hashToken(tokenStr)
-
 	database := db.GetDB()
 	var token models.APIToken
-	if err := database.Where("token_hash = ? AND is_active = ?", tokenHash, true).First(&token).Error; err != nil {
-		return nil, err
+	prefix := tokenStr[:len(models.TokenPrefixLive)] // Both prefixes are the same length
+	if idStr, secret, ok := strings.Cut(strings.TrimPrefix(tokenStr, prefix), "_"); ok {
+		id, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			return nil, nil
+		}
+		if err := database.Where("is_active = ?", true).First(&token, id).Error; err != nil {
+			return nil, err
+		}
+		if subtle.ConstantTimeCompare([]byte(HashToken(secret)), []byte(token.TokenHash)) != 1 {
+			return nil, nil
+		}
+	} else {
+		tokenHash := HashToken(tokenStr)
+		if err := database.Where("token_hash = ? AND is_active = ?", tokenHash, true).First(&token).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// A token only works with the prefix of its mode
+	if token.Prefix() != prefix {
+		return nil, nil
 	}
 
 	// Check if expired
@@ -51,93 +79,131 @@ func APITokenMiddleware(requiredScopes ...string) gin.HandlerFunc {
 			return
 		}
 
-		var tokenStr string
-
-		// Try to get token from Authorization header
-		authHeader := c.GetHeader("Authorization")
-		if authHeader != "" {
-			bearerToken := strings.Split(authHeader, " ")
-			if len(bearerToken) == 2 && bearerToken[0] == "Bearer" {
-				tokenStr = bearerToken[1]
-			}
-		}
-
+		tokenStr := bearerToken(c)
 		if tokenStr == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization required"})
 			c.Abort()
 			return
 		}
 
-		// Check if it's an API token (starts with plt_live_)
-		if !strings.HasPrefix(tokenStr, "plt_live_") {
+		// Check if it's an API token (starts with plt_live_ or plt_test_)
+		if !isAPIToken(tokenStr) {
 			// Not an API token, let JWT middleware handle it
 			c.Next()
 			return
 		}
 
-		// Validate API token
-		token, err := validateAndGetToken(tokenStr)
-		if err != nil || token == nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API token"})
-			c.Abort()
+		if !authenticateAPIToken(c, tokenStr, requiredScopes) {
 			return
 		}
+		c.Next()
+	}
+}
 
-		// Check if token is expired
-		if token.IsExpired() {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "API token has expired"})
-			c.Abort()
-			return
-		}
+// bearerToken returns the token of the request's Authorization header. Credentials
+// aren't taken from the query string, which ends up in logs; event streams take stream
+// tokens there instead (see StreamAuthMiddleware).
+func bearerToken(c *gin.Context) string {
+	bearerToken := strings.Split(c.GetHeader("Authorization"), " ")
+	if len(bearerToken) == 2 && bearerToken[0] == "Bearer" {
+		return bearerToken[1]
+	}
+	return ""
+}
 
-		// Check required scopes
-		if len(requiredScopes) > 0 {
-			hasRequiredScope := false
-			for _, scope := range requiredScopes {
-				if token.HasScope(scope) {
-					hasRequiredScope = true
-					break
-				}
-			}
-			if !hasRequiredScope {
-				c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
-				c.Abort()
-				return
-			}
-		}
+// authenticateAPIToken validates an API token and authenticates the request with it;
+// it aborts the request and returns false if the token is invalid or lacks all of the
+// scopes
+func authenticateAPIToken(c *gin.Context, tokenStr string, requiredScopes []string) bool {
+	token, err := ValidateAPIToken(tokenStr)
+	if err != nil || token == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API token"})
+		c.Abort()
+		return false
+	}
+	return setAPIToken(c, token, requiredScopes)
+}
 
-		// Update last used timestamp
-		now := time.Now()
-		token.LastUsedAt = &now
-		db.GetDB().Model(token).Update("last_used_at", now)
+// setAPIToken authenticates the request with a valid API token, which must have one of
+// the scopes if any are given
+func setAPIToken(c *gin.Context, token *models.APIToken, requiredScopes []string) bool {
+	if len(requiredScopes) > 0 && !hasAnyScope(token, requiredScopes) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		c.Abort()
+		return false
+	}
 
-		// Set user info in context
-		c.Set("userID", token.UserID)
-		c.Set("apiToken", token)
+	// Update last used timestamp (buffered)
+	markTokenUsed(token)
 
-		c.Next()
+	// Set user info in context
+	if !setActiveUser(c, token.UserID) {
+		return false
 	}
+	if !allowTokenRequest(c, token) {
+		return false
+	}
+	c.Set("apiToken", token)
+	return true
 }
 
-// AuthMiddlewareWithFallback tries JWT first, then API token
-func AuthMiddlewareWithFallback(requiredScopes ...string) gin.HandlerFunc {
+// hasAnyScope reports whether an API token has at least one of the scopes
+func hasAnyScope(token *models.APIToken, scopes []string) bool {
+	for _, scope := range scopes {
+		if token.HasScope(scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthenticateAPIToken authenticates an API token outside of HTTP requests (e.g. SMTP
+// AUTH): the token must be valid, have the scope, and belong to an active user
+func AuthenticateAPIToken(tokenStr, scope string) (*models.APIToken, error) {
+	token, err := ValidateAPIToken(tokenStr)
+	if err != nil || token == nil {
+		return nil, errors.New("invalid or expired API token")
+	}
+	if !token.HasScope(scope) {
+		return nil, errors.New("insufficient permissions")
+	}
+	var user models.User
+	if err := db.GetDB().First(&user, token.UserID).Error; err != nil || !user.IsActive {
+		return nil, errors.New("account disabled")
+	}
+	markTokenUsed(token)
+	return token, nil
+}
+
+// BasicAuthAPIToken lets clients that only speak HTTP Basic auth, such as Twilio's
+// libraries (which send AccountSid:AuthToken), authenticate with an API token as the
+// password. It goes before AuthMiddlewareWithFallback.
+func BasicAuthAPIToken() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var tokenStr string
-
-		// Try to get token from Authorization header
-		authHeader := c.GetHeader("Authorization")
-		if authHeader != "" {
-			bearerToken := strings.Split(authHeader, " ")
-			if len(bearerToken) == 2 && bearerToken[0] == "Bearer" {
-				tokenStr = bearerToken[1]
-			}
+		if _, password, ok := c.Request.BasicAuth(); ok && password != "" {
+			c.Request.Header.Set("Authorization", "Bearer "+password)
 		}
+		c.Next()
+	}
+}
 
-		// If no token in header, try query parameter (for SSE)
-		if tokenStr == "" {
-			tokenStr = c.Query("token")
+// QueryAPIToken lets systems that can't set headers authenticate with an API token in
+// the token query parameter. Only API tokens are taken there, never JWTs. It goes
+// before AuthMiddlewareWithFallback, on the routes of such systems only.
+func QueryAPIToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if tokenStr := c.Query("token"); c.GetHeader("Authorization") == "" && isAPIToken(tokenStr) {
+			c.Request.Header.Set("Authorization", "Bearer "+tokenStr)
 		}
+		c.Next()
+	}
+}
 
+// AuthMiddlewareWithFallback authenticates requests with an API token or, failing
+// that, a JWT
+func AuthMiddlewareWithFallback(requiredScopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenStr := bearerToken(c)
 		if tokenStr == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization required"})
 			c.Abort()
@@ -145,48 +211,10 @@ func AuthMiddlewareWithFallback(requiredScopes ...string) gin.HandlerFunc {
 		}
 
 		// Check if it's an API token
-		if strings.HasPrefix(tokenStr, "plt_live_") {
-			// Try API token authentication
-			token, err := validateAndGetToken(tokenStr)
-			if err != nil || token == nil {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API token"})
-				c.Abort()
-				return
-			}
-
-			// Check if token is expired
-			if token.IsExpired() {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "API token has expired"})
-				c.Abort()
-				return
+		if isAPIToken(tokenStr) {
+			if authenticateAPIToken(c, tokenStr, requiredScopes) {
+				c.Next()
 			}
-
-			// Check required scopes
-			if len(requiredScopes) > 0 {
-				hasRequiredScope := false
-				for _, scope := range requiredScopes {
-					if token.HasScope(scope) {
-						hasRequiredScope = true
-						break
-					}
-				}
-				if !hasRequiredScope {
-					c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
-					c.Abort()
-					return
-				}
-			}
-
-			// Update last used timestamp
-			now := time.Now()
-			token.LastUsedAt = &now
-			db.GetDB().Model(token).Update("last_used_at", now)
-
-			// Set user info in context
-			c.Set("userID", token.UserID)
-			c.Set("apiToken", token)
-
-			c.Next()
 			return
 		}
 
@@ -202,8 +230,9 @@ func AuthMiddlewareWithFallback(requiredScopes ...string) gin.HandlerFunc {
 		}
 
 		if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-			c.Set("userID", claims.UserID)
-			c.Set("username", claims.Username)
+			if !setSessionUser(c, claims) {
+				return
+			}
 			c.Next()
 		} else {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
@@ -212,14 +241,13 @@ func AuthMiddlewareWithFallback(requiredScopes ...string) gin.HandlerFunc {
 	}
 }
 
-// RequireScope middleware checks if the authenticated token has the required scope
-func RequireScope(scope string) gin.HandlerFunc {
+// RequireScope middleware checks that an API token has at least one of the scopes
+func RequireScope(scopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Check if authenticated via API token
+		// Check if authenticated via API token; any one of the scopes is enough
 		if token, exists := c.Get("apiToken"); exists {
-			apiToken := token.(*models.APIToken)
-			if !apiToken.HasScope(scope) && !apiToken.HasScope(models.ScopeAll) {
-				c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions. Required scope: " + scope})
+			if !hasAnyScope(token.(*models.APIToken), scopes) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions. Required scope: " + strings.Join(scopes, " or ")})
 				c.Abort()
 				return
 			}
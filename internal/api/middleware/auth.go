@@ -2,11 +2,11 @@ package middleware
 
 import (
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 var jwtSecret []byte
@@ -18,18 +18,29 @@ func SetJWTSecret(secret string) {
 type Claims struct {
 	UserID   uint   `json:"user_id"`
 	Username string `json:"username"`
+	// TokenVersion must match the user's current version; bumping it logs out
+	// every session
+	TokenVersion uint `json:"token_version"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID uint, username string) (string, error) {
+// GenerateToken issues a JWT for the client making the request and records its session
+// so it can be listed and revoked
+func GenerateToken(c *gin.Context, userID uint, username string, tokenVersion uint) (string, error) {
+	expiresAt := time.Now().Add(24 * time.Hour)
 	claims := Claims{
-		UserID:   userID,
-		Username: username,
+		UserID:       userID,
+		Username:     username,
+		TokenVersion: tokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ID:        uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
+	if err := createSession(c, userID, claims.ID, expiresAt); err != nil {
+		return "", err
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(jwtSecret)
@@ -37,22 +48,7 @@ func GenerateToken(userID uint, username string) (string, error) {
 
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var tokenStr string
-
-		// Try to get token from Authorization header
-		authHeader := c.GetHeader("Authorization")
-		if authHeader != "" {
-			bearerToken := strings.Split(authHeader, " ")
-			if len(bearerToken) == 2 && bearerToken[0] == "Bearer" {
-				tokenStr = bearerToken[1]
-			}
-		}
-
-		// If no token in header, try query parameter (for SSE)
-		if tokenStr == "" {
-			tokenStr = c.Query("token")
-		}
-
+		tokenStr := bearerToken(c)
 		if tokenStr == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization required"})
 			c.Abort()
@@ -69,8 +65,9 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-			c.Set("userID", claims.UserID)
-			c.Set("username", claims.Username)
+			if !setSessionUser(c, claims) {
+				return
+			}
 			c.Next()
 		} else {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/whatsapp"
+)
+
+// CanUseDevice reports whether the request's user may use the linked WhatsApp device:
+// its owner, admins, and the service accounts admins create may
+func CanUseDevice(c *gin.Context, client *whatsapp.Client) bool {
+	if c.GetBool("isAdmin") || c.GetBool("isServiceAccount") {
+		return true
+	}
+	return client.OwnerID() == c.GetUint("userID")
+}
+
+// RequireDeviceOwner restricts routes to the users that may use the linked WhatsApp
+// device. While none is linked, any user may pair one. It must run after an auth
+// middleware.
+func RequireDeviceOwner() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client := whatsapp.GetClient()
+		if client.AccountID() != 0 && !CanUseDevice(c, client) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "The linked WhatsApp account belongs to another user"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
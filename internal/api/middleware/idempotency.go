@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/models"
+	"gorm.io/gorm/clause"
+)
+
+// idempotencyWindow is how long a key's response is kept for retries
+var idempotencyWindow = 24 * time.Hour
+
+// SetIdempotencyWindow sets how long responses are kept for retries
+func SetIdempotencyWindow(window time.Duration) {
+	idempotencyWindow = window
+}
+
+// responseRecorder keeps a copy of the response body
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency makes requests with an Idempotency-Key header safe to retry: a repeat
+// within the window returns the first request's response (marked with an
+// Idempotent-Replayed header) instead of running again. Only successful responses are
+// kept; after a failure the key may be retried.
+func Idempotency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" || idempotencyWindow <= 0 {
+			c.Next()
+			return
+		}
+		if len(key) > 255 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body too large"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		hash := sha256.Sum256(append([]byte(c.Request.Method+" "+c.FullPath()+"\n"), body...))
+
+		userID := c.GetUint("userID")
+		database := db.GetDB()
+		now := time.Now()
+		database.Where("user_id = ? AND expires_at < ?", userID, now).Delete(&models.IdempotencyKey{})
+
+		record := models.IdempotencyKey{
+			UserID:      userID,
+			Key:         key,
+			RequestHash: hex.EncodeToString(hash[:]),
+			ExpiresAt:   now.Add(idempotencyWindow),
+		}
+		// The unique index lets only one of several concurrent requests claim the key
+		result := database.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check Idempotency-Key"})
+			c.Abort()
+			return
+		}
+		if result.RowsAffected == 0 {
+			replayIdempotentResponse(c, userID, key, record.RequestHash)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		status := recorder.Status()
+		if status < http.StatusOK || status >= http.StatusMultipleChoices {
+			database.Delete(&record)
+			return
+		}
+		database.Model(&record).Updates(map[string]interface{}{
+			"status_code": status,
+			"response":    recorder.body.String(),
+		})
+	}
+}
+
+// replayIdempotentResponse answers a request whose key was already claimed
+func replayIdempotentResponse(c *gin.Context, userID uint, key, hash string) {
+	defer c.Abort()
+
+	var existing models.IdempotencyKey
+	if err := db.GetDB().Where("user_id = ? AND idempotency_key = ?", userID, key).First(&existing).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check Idempotency-Key"})
+		return
+	}
+	switch {
+	case existing.RequestHash != hash:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+	case existing.StatusCode == 0:
+		c.JSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still in progress"})
+	default:
+		c.Header("Idempotent-Replayed", "true")
+		c.Data(existing.StatusCode, "application/json; charset=utf-8", []byte(existing.Response))
+	}
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBodySize caps request bodies on routes without a limit of their own
+var maxBodySize int64 = 1 << 20
+
+// routeBodyLimits holds the routes' own limits, by full path
+var routeBodyLimits = make(map[string]int64)
+
+// SetMaxBodySize sets the default request body limit; 0 removes it
+func SetMaxBodySize(limit int64) {
+	maxBodySize = limit
+}
+
+// SetRouteBodyLimit replaces the default request body limit for one route (by its full
+// path), e.g. for uploads. Call it while registering routes.
+func SetRouteBodyLimit(path string, limit int64) {
+	routeBodyLimits[path] = limit
+}
+
+// BodyLimit rejects request bodies over the route's limit
+func BodyLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, ok := routeBodyLimits[c.FullPath()]
+		if !ok {
+			limit = maxBodySize
+		}
+		if limit <= 0 || c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength > limit {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body too large"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+// RouteTimeout gives a slow route its own deadline in place of the server's read and
+// write timeouts, and cancels the request context when it passes
+func RouteTimeout(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deadline := time.Now().Add(timeout)
+		setDeadlines(c, deadline)
+
+		ctx, cancel := context.WithDeadline(c.Request.Context(), deadline)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// NoTimeout lifts the server's read and write timeouts for long-lived streams
+func NoTimeout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		setDeadlines(c, time.Time{})
+		c.Next()
+	}
+}
+
+func setDeadlines(c *gin.Context, deadline time.Time) {
+	rc := http.NewResponseController(c.Writer)
+	// Not every writer supports deadlines (e.g. in tests); the server's timeouts apply
+	_ = rc.SetReadDeadline(deadline)
+	_ = rc.SetWriteDeadline(deadline)
+}
@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/models"
+	"gorm.io/gorm"
+)
+
+// rateWindow counts one token's requests in the current minute
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+var (
+	rateWindows   = make(map[uint]*rateWindow)
+	rateWindowsMu sync.Mutex
+)
+
+// allowTokenRequest enforces an API token's requests-per-minute limit, setting the
+// X-RateLimit-* headers. It writes a 429 and returns false once the limit is reached.
+func allowTokenRequest(c *gin.Context, token *models.APIToken) bool {
+	if token.RateLimitPerMinute <= 0 {
+		return true
+	}
+
+	allowed, remaining, reset := TakeTokenRequest(token)
+	c.Header("X-RateLimit-Limit", strconv.Itoa(token.RateLimitPerMinute))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	c.Header("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	if !allowed {
+		c.Header("Retry-After", strconv.Itoa(int(time.Until(reset).Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "API token rate limit exceeded"})
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+// TakeTokenRequest counts one request against an API token's requests-per-minute
+// limit, for requests that don't go through the middleware (e.g. WebSocket commands).
+// Tokens without a limit are always allowed.
+func TakeTokenRequest(token *models.APIToken) (allowed bool, remaining int, reset time.Time) {
+	if token.RateLimitPerMinute <= 0 {
+		return true, -1, time.Time{}
+	}
+
+	now := time.Now()
+	rateWindowsMu.Lock()
+	defer rateWindowsMu.Unlock()
+	w, ok := rateWindows[token.ID]
+	if !ok || now.Sub(w.start) >= time.Minute {
+		// Drop windows of tokens that went quiet while we hold the lock anyway
+		if !ok && len(rateWindows) > 1000 {
+			for id, old := range rateWindows {
+				if now.Sub(old.start) >= time.Minute {
+					delete(rateWindows, id)
+				}
+			}
+		}
+		w = &rateWindow{start: now}
+		rateWindows[token.ID] = w
+	}
+	allowed = w.count < token.RateLimitPerMinute
+	if allowed {
+		w.count++
+	}
+	return allowed, token.RateLimitPerMinute - w.count, w.start.Add(time.Minute)
+}
+
+// RequireMessageQuota enforces the messages-per-day quota of the API token sending the
+// request. Each request counts as one message; requests that fail (status >= 400) are
+// not counted. JWT sessions are not limited.
+func RequireMessageQuota() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, exists := c.Get("apiToken")
+		if !exists {
+			c.Next()
+			return
+		}
+		token := value.(*models.APIToken)
+		if token.MessagesPerDay <= 0 {
+			c.Next()
+			return
+		}
+
+		allowed, remaining, reset, err := TakeMessageQuota(token)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check message quota"})
+			c.Abort()
+			return
+		}
+		c.Header("X-Quota-Limit", strconv.Itoa(token.MessagesPerDay))
+		c.Header("X-Quota-Remaining", strconv.Itoa(remaining))
+		c.Header("X-Quota-Reset", strconv.FormatInt(reset.Unix(), 10))
+
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(time.Until(reset).Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Daily message quota exceeded"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+
+		// Give the message back when it wasn't sent
+		if c.Writer.Status() >= http.StatusBadRequest {
+			ReturnMessageQuota(token)
+		}
+	}
+}
+
+// TakeMessageQuota counts one message against an API token's daily quota. It reports
+// false once the quota is used up. Tokens without a quota are always allowed.
+func TakeMessageQuota(token *models.APIToken) (allowed bool, remaining int, reset time.Time, err error) {
+	return TakeMessageQuotaN(token, 1)
+}
+
+// TakeMessageQuotaN counts n messages against an API token's daily quota, all or none:
+// it reports false, counting nothing, when fewer than n are left
+func TakeMessageQuotaN(token *models.APIToken, n int) (allowed bool, remaining int, reset time.Time, err error) {
+	if token.MessagesPerDay <= 0 {
+		return true, -1, time.Time{}, nil
+	}
+
+	// Quotas reset at midnight UTC
+	now := time.Now().UTC()
+	today := now.Format("2006-01-02")
+	reset = time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+
+	database := db.GetDB()
+	result := database.Model(&models.APIToken{}).
+		Where("id = ? AND (((daily_message_date <> ? OR daily_message_date IS NULL) AND ? <= ?) OR daily_message_count + ? <= ?)",
+			token.ID, today, n, token.MessagesPerDay, n, token.MessagesPerDay).
+		Updates(map[string]interface{}{
+			"daily_message_count": gorm.Expr("CASE WHEN daily_message_date = ? THEN daily_message_count + ? ELSE ? END", today, n, n),
+			"daily_message_date":  today,
+		})
+	if result.Error != nil {
+		return false, 0, reset, result.Error
+	}
+
+	var used int
+	database.Model(&models.APIToken{}).Where("id = ?", token.ID).Select("daily_message_count").Scan(&used)
+	remaining = token.MessagesPerDay - used
+	if remaining < 0 {
+		remaining = 0
+	}
+	return result.RowsAffected > 0, remaining, reset, nil
+}
+
+// ReturnMessageQuota gives back a message counted by TakeMessageQuota that wasn't sent
+func ReturnMessageQuota(token *models.APIToken) {
+	ReturnMessageQuotaN(token, 1)
+}
+
+// ReturnMessageQuotaN gives back n messages counted by TakeMessageQuotaN
+func ReturnMessageQuotaN(token *models.APIToken, n int) {
+	if token.MessagesPerDay <= 0 {
+		return
+	}
+	today := time.Now().UTC().Format("2006-01-02")
+	db.GetDB().Model(&models.APIToken{}).
+		Where("id = ? AND daily_message_date = ? AND daily_message_count >= ?", token.ID, today, n).
+		Update("daily_message_count", gorm.Expr("daily_message_count - ?", n))
+}
+
+// TokenRateLimitState returns how many requests the API token has left in its current
+// one-minute window and when the window resets. Tokens without a limit return -1.
+func TokenRateLimitState(token *models.APIToken) (remaining int, reset time.Time) {
+	if token.RateLimitPerMinute <= 0 {
+		return -1, time.Time{}
+	}
+
+	now := time.Now()
+	rateWindowsMu.Lock()
+	defer rateWindowsMu.Unlock()
+	w, ok := rateWindows[token.ID]
+	if !ok || now.Sub(w.start) >= time.Minute {
+		return token.RateLimitPerMinute, now.Add(time.Minute)
+	}
+	return token.RateLimitPerMinute - w.count, w.start.Add(time.Minute)
+}
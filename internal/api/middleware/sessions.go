@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/models"
+	"gorm.io/gorm"
+)
+
+// lastSeenInterval limits how often a session's last_seen_at is written
+const lastSeenInterval = 1 * time.Minute
+
+// createSession records a newly issued JWT along with the client that requested it and
+// drops the user's expired sessions
+func createSession(c *gin.Context, userID uint, jti string, expiresAt time.Time) error {
+	database := db.GetDB()
+	database.Where("user_id = ? AND expires_at < ?", userID, time.Now()).Delete(&models.AuthSession{})
+	return database.Create(&models.AuthSession{
+		UserID:     userID,
+		JTI:        jti,
+		IPAddress:  c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+		LastSeenAt: time.Now(),
+		ExpiresAt:  expiresAt,
+	}).Error
+}
+
+// touchSession looks up the session of a JWT and stores its ID in the context. It
+// returns false when the session has been revoked.
+func touchSession(c *gin.Context, userID uint, jti string) bool {
+	if jti == "" {
+		return false
+	}
+
+	var session models.AuthSession
+	if err := db.GetDB().Where("jti = ? AND user_id = ?", jti, userID).First(&session).Error; err != nil {
+		return false
+	}
+	if time.Since(session.LastSeenAt) > lastSeenInterval {
+		db.GetDB().Model(&session).Update("last_seen_at", time.Now())
+	}
+
+	c.Set("sessionID", session.ID)
+	return true
+}
+
+// RevokeRequestSession revokes the JWT the request was made with, if any. Expired
+// tokens are accepted so that logging out never fails.
+func RevokeRequestSession(c *gin.Context) {
+	bearerToken := strings.Split(c.GetHeader("Authorization"), " ")
+	if len(bearerToken) != 2 || bearerToken[0] != "Bearer" {
+		return
+	}
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(bearerToken[1], claims, func(token *jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	}, jwt.WithoutClaimsValidation())
+	if err != nil || claims.ID == "" {
+		return
+	}
+
+	db.GetDB().Where("jti = ? AND user_id = ?", claims.ID, claims.UserID).Delete(&models.AuthSession{})
+}
+
+// RevokeUserSessions logs a user out everywhere
+func RevokeUserSessions(tx *gorm.DB, userID uint) error {
+	return tx.Where("user_id = ?", userID).Delete(&models.AuthSession{}).Error
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/models"
+)
+
+// StreamTokenTTL is how long a stream token can be used to open an event stream
+const StreamTokenTTL = 60 * time.Second
+
+// streamTokenPurpose marks stream tokens, so they're never taken for session JWTs
+const streamTokenPurpose = "stream"
+
+// StreamClaims are the claims of a stream token: a short-lived JWT that opens the event
+// streams in place of the session JWT or API token it was issued to, which browsers'
+// EventSource and WebSocket would otherwise have to put in the URL
+type StreamClaims struct {
+	UserID       uint   `json:"user_id"`
+	Purpose      string `json:"purpose"`
+	TokenVersion uint   `json:"token_version"`
+	SessionID    uint   `json:"session_id,omitempty"`   // Login session it was issued to
+	APITokenID   uint   `json:"api_token_id,omitempty"` // API token it was issued to
+	jwt.RegisteredClaims
+}
+
+// GenerateStreamToken issues a stream token for the credentials of the request. Stream
+// tokens stop working when those are revoked.
+func GenerateStreamToken(c *gin.Context) (string, time.Time, error) {
+	userID := c.GetUint("userID")
+	var user models.User
+	if err := db.GetDB().Select("id", "token_version").First(&user, userID).Error; err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := time.Now().Add(StreamTokenTTL)
+	claims := StreamClaims{
+		UserID:       userID,
+		Purpose:      streamTokenPurpose,
+		TokenVersion: user.TokenVersion,
+		SessionID:    c.GetUint("sessionID"),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+	if value, exists := c.Get("apiToken"); exists {
+		claims.APITokenID = value.(*models.APIToken).ID
+	}
+	if claims.SessionID == 0 && claims.APITokenID == 0 {
+		return "", time.Time{}, errors.New("request has no session or API token")
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+	return token, expiresAt, err
+}
+
+// StreamAuthMiddleware authenticates event stream requests. Requests with an
+// Authorization header go through AuthMiddlewareWithFallback; otherwise the token query
+// parameter must hold a stream token. Session JWTs and API tokens aren't taken from the
+// query string, which ends up in logs.
+func StreamAuthMiddleware(requiredScopes ...string) gin.HandlerFunc {
+	fallback := AuthMiddlewareWithFallback(requiredScopes...)
+	return func(c *gin.Context) {
+		tokenStr := c.Query("token")
+		if c.GetHeader("Authorization") != "" || tokenStr == "" {
+			fallback(c)
+			return
+		}
+		claims := &StreamClaims{}
+		if _, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+			return jwtSecret, nil
+		}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()})); err != nil || claims.Purpose != streamTokenPurpose {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "The token query parameter takes only stream tokens from POST /auth/stream-token"})
+			c.Abort()
+			return
+		}
+
+		if claims.APITokenID != 0 {
+			if !setStreamAPIToken(c, claims, requiredScopes) {
+				return
+			}
+		} else if !setStreamSession(c, claims) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// setStreamAPIToken authenticates a stream token issued to an API token, which must
+// still be active and have one of the scopes
+func setStreamAPIToken(c *gin.Context, claims *StreamClaims, requiredScopes []string) bool {
+	var token models.APIToken
+	if err := db.GetDB().Where("is_active = ? AND user_id = ?", true, claims.UserID).First(&token, claims.APITokenID).Error; err != nil || token.IsExpired() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API token"})
+		c.Abort()
+		return false
+	}
+	return setAPIToken(c, &token, requiredScopes)
+}
+
+// setStreamSession authenticates a stream token issued to a login session, which must
+// not have been revoked since
+func setStreamSession(c *gin.Context, claims *StreamClaims) bool {
+	var session models.AuthSession
+	if err := db.GetDB().Where("id = ? AND user_id = ? AND expires_at > ?", claims.SessionID, claims.UserID, time.Now()).First(&session).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired"})
+		c.Abort()
+		return false
+	}
+	return setSessionUser(c, &Claims{
+		UserID:           claims.UserID,
+		TokenVersion:     claims.TokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{ID: session.JTI},
+	})
+}
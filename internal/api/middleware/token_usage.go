@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/models"
+)
+
+// tokenUsageFlushInterval is how often buffered last_used_at values are written
+const tokenUsageFlushInterval = 30 * time.Second
+
+// tokenUsage buffers API token last_used_at updates so authenticated requests don't
+// each write to the database
+var tokenUsage = struct {
+	sync.Mutex
+	pending map[uint]time.Time
+	once    sync.Once
+}{pending: make(map[uint]time.Time)}
+
+// markTokenUsed records that a token was just used. The database is updated by the
+// next flush.
+func markTokenUsed(token *models.APIToken) {
+	now := time.Now()
+	token.LastUsedAt = &now
+
+	tokenUsage.once.Do(func() {
+		go func() {
+			for range time.Tick(tokenUsageFlushInterval) {
+				FlushTokenUsage()
+			}
+		}()
+	})
+
+	tokenUsage.Lock()
+	tokenUsage.pending[token.ID] = now
+	tokenUsage.Unlock()
+}
+
+// FlushTokenUsage writes buffered last_used_at values to the database
+func FlushTokenUsage() {
+	tokenUsage.Lock()
+	pending := tokenUsage.pending
+	tokenUsage.pending = make(map[uint]time.Time)
+	tokenUsage.Unlock()
+
+	for tokenID, usedAt := range pending {
+		if err := db.GetDB().Model(&models.APIToken{}).Where("id = ?", tokenID).Update("last_used_at", usedAt).Error; err != nil {
+			log.Printf("Failed to update last_used_at of API token %d: %v", tokenID, err)
+		}
+	}
+}
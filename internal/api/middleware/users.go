@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/models"
+)
+
+// setActiveUser loads the authenticated user and stores it in the context. Tokens of
+// deleted or disabled users stop working immediately, even before they expire.
+func setActiveUser(c *gin.Context, userID uint) bool {
+	user, ok := loadActiveUser(c, userID)
+	if !ok {
+		return false
+	}
+	setUserContext(c, user)
+	return true
+}
+
+// setSessionUser is setActiveUser for JWTs, which are also rejected once their session
+// has been revoked or the user's token version has moved on (e.g. after a password
+// change)
+func setSessionUser(c *gin.Context, claims *Claims) bool {
+	user, ok := loadActiveUser(c, claims.UserID)
+	if !ok {
+		return false
+	}
+	if claims.TokenVersion != user.TokenVersion || !touchSession(c, user.ID, claims.ID) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired"})
+		c.Abort()
+		return false
+	}
+	if user.MustChangePassword && !passwordChangeRoutes[c.FullPath()] {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Password change required"})
+		c.Abort()
+		return false
+	}
+	setUserContext(c, user)
+	return true
+}
+
+// passwordChangeRoutes are the only routes a session can use while its user has to
+// replace a temporary password
+var passwordChangeRoutes = map[string]bool{
+	"/api/auth/me":              true,
+	"/api/auth/change-password": true,
+}
+
+func loadActiveUser(c *gin.Context, userID uint) (*models.User, bool) {
+	var user models.User
+	if err := db.GetDB().First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		c.Abort()
+		return nil, false
+	}
+	if !user.IsActive {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account disabled"})
+		c.Abort()
+		return nil, false
+	}
+	return &user, true
+}
+
+func setUserContext(c *gin.Context, user *models.User) {
+	c.Set("userID", user.ID)
+	c.Set("username", user.Username)
+	c.Set("isAdmin", user.IsAdmin)
+	c.Set("isServiceAccount", user.IsServiceAccount)
+	c.Set("mustChangePassword", user.MustChangePassword)
+}
+
+// AdminMiddleware restricts routes to admins. It must run after an auth middleware.
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("isAdmin") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -1,46 +1,118 @@
 package db
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/glebarez/sqlite"
-	"github.com/user/pinglater/internal/models"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"log"
 )
 
 var DB *gorm.DB
 
-func InitDatabase(dbPath string) (*gorm.DB, error) {
-	var err error
+// Config selects and tunes the application database
+type Config struct {
+	Driver string // sqlite (the default), postgres or mysql
+	DSN    string // For sqlite, the path of the database file
+	// Connection pool size; 0 uses the driver default (4 for SQLite, unlimited otherwise)
+	MaxOpenConns int
+	// How long SQLite waits for a lock held by another connection before failing
+	BusyTimeout time.Duration
+}
 
-	// Ensure the database directory exists
-	dir := filepath.Dir(dbPath)
-	if dir != "" && dir != "." {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return nil, err
+// sqliteMaxOpenConns keeps SQLite's pool small: there is only ever one writer, and every
+// extra connection is one more waiting on its lock
+const sqliteMaxOpenConns = 4
+
+// InitDatabase connects to the database and applies pending migrations
+func InitDatabase(config Config) (*gorm.DB, error) {
+	if _, err := Open(config); err != nil {
+		return nil, err
+	}
+	if err := Migrate(DB); err != nil {
+		return nil, err
+	}
+
+	log.Println("Database migrated successfully")
+	return DB, nil
+}
+
+// Open connects to the database without touching the schema
+func Open(config Config) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	var name string
+	maxOpenConns := config.MaxOpenConns
+	switch config.Driver {
+	case "", "sqlite":
+		// Ensure the database directory exists
+		dir := filepath.Dir(config.DSN)
+		if dir != "" && dir != "." {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return nil, err
+			}
+		}
+		// Using github.com/glebarez/sqlite driver (pure Go, no CGO required)
+		dialector, name = sqlite.Open(sqliteDSN(config.DSN, config.BusyTimeout)), "SQLite"
+		if maxOpenConns == 0 {
+			maxOpenConns = sqliteMaxOpenConns
 		}
+	case "postgres":
+		dialector, name = postgres.Open(config.DSN), "PostgreSQL"
+	case "mysql":
+		dialector, name = mysql.Open(config.DSN), "MySQL"
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q (use sqlite, postgres or mysql)", config.Driver)
 	}
 
-	// Using github.com/glebarez/sqlite driver (pure Go, no CGO required)
-	DB, err = gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	var err error
+	DB, err = gorm.Open(dialector, &gorm.Config{})
 	if err != nil {
 		return nil, err
 	}
-
-	log.Println("Connected to SQLite database")
-
-	// Auto-migrate the schema
-	err = DB.AutoMigrate(&models.User{}, &models.WhatsAppSession{}, &models.Webhook{}, &models.WebhookDelivery{}, &models.APIToken{})
+	sqlDB, err := DB.DB()
 	if err != nil {
 		return nil, err
 	}
+	sqlDB.SetMaxOpenConns(maxOpenConns)
+	if maxOpenConns > 0 {
+		sqlDB.SetMaxIdleConns(maxOpenConns)
+	}
 
-	log.Println("Database migrated successfully")
+	log.Println("Connected to " + name + " database")
 	return DB, nil
 }
 
+// sqliteDSN adds the connection settings that let concurrent webhook writes and API
+// reads share the file: WAL so readers don't block the writer, a busy timeout so a
+// locked database is waited on rather than reported, and immediate transactions so two
+// transactions never deadlock upgrading their read locks. A path that already carries
+// parameters is used as is.
+func sqliteDSN(path string, busyTimeout time.Duration) string {
+	if strings.Contains(path, "?") {
+		return path
+	}
+	return fmt.Sprintf("%s?_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(%d)&_txlock=immediate",
+		path, busyTimeout.Milliseconds())
+}
+
 func GetDB() *gorm.DB {
 	return DB
 }
+
+// Close closes the database connection
+func Close() error {
+	if DB == nil {
+		return nil
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
@@ -0,0 +1,451 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/user/pinglater/internal/models"
+	"gorm.io/gorm"
+)
+
+// Migration is one step of the schema's history. Up applies it and Down reverts it;
+// both run in a transaction (MySQL commits DDL immediately, so a failed step there may
+// need fixing by hand).
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaVersion records an applied migration
+type SchemaVersion struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (SchemaVersion) TableName() string {
+	return "schema_version"
+}
+
+// MigrationStatus reports whether a migration has been applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// migrations lists every migration in order. Append new ones with the next version;
+// never edit or reorder one that has shipped. New tables also go in schemaModels, which
+// new databases are created from.
+var migrations = []Migration{
+	{
+		// Creates the current schema from the models. A new database, or one from before
+		// versioned migrations, starts here and is then up to date, so later migrations
+		// are recorded as applied without running.
+		Version: 1,
+		Name:    "initial schema",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(schemaModels()...)
+		},
+		Down: func(tx *gorm.DB) error {
+			tables := schemaModels()
+			for i := len(tables) - 1; i >= 0; i-- {
+				if err := tx.Migrator().DropTable(tables[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 2,
+		Name:    "idempotency keys",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.IdempotencyKey{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.IdempotencyKey{})
+		},
+	},
+	{
+		Version: 3,
+		Name:    "send queue",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.SendJob{}, &models.OutgoingMessage{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.OutgoingMessage{}, &models.SendJob{})
+		},
+	},
+	{
+		Version: 4,
+		Name:    "inbound webhooks",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.InboundWebhook{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.InboundWebhook{})
+		},
+	},
+	{
+		Version: 5,
+		Name:    "send queue media",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.OutgoingMessage{})
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, column := range []string{"media_data", "media_mime_type", "media_filename"} {
+				if err := tx.Migrator().DropColumn(&models.OutgoingMessage{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 6,
+		Name:    "auto-responder rules",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.Rule{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.Rule{})
+		},
+	},
+	{
+		Version: 7,
+		Name:    "bot commands",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.BotCommand{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.BotCommand{})
+		},
+	},
+	{
+		Version: 8,
+		Name:    "out of office",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.OutOfOffice{}, &models.OutOfOfficeReply{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.OutOfOfficeReply{}, &models.OutOfOffice{})
+		},
+	},
+	{
+		Version: 9,
+		Name:    "contact lists and campaigns",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.ContactList{}, &models.Contact{}, &models.ContactOptOut{},
+				&models.Campaign{}, &models.CampaignRecipient{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.CampaignRecipient{}, &models.Campaign{},
+				&models.ContactOptOut{}, &models.Contact{}, &models.ContactList{})
+		},
+	}, {
+		Version: 10,
+		Name:    "campaign replies",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.CampaignRecipient{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropIndex(&models.CampaignRecipient{}, "idx_campaign_recipients_phone_number"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&models.CampaignRecipient{}, "replied_at")
+		},
+	},
+	{
+		Version: 11,
+		Name:    "webhook trash",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.Webhook{})
+		},
+		Down: func(tx *gorm.DB) error {
+			// Webhooks in the trash would come back to life without the column
+			trashed := tx.Unscoped().Model(&models.Webhook{}).Select("id").Where("deleted_at IS NOT NULL")
+			if err := tx.Where("webhook_id IN (?)", trashed).Delete(&models.WebhookDelivery{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Where("deleted_at IS NOT NULL").Delete(&models.Webhook{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Migrator().DropIndex(&models.Webhook{}, "idx_webhooks_deleted_at"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&models.Webhook{}, "deleted_at")
+		},
+	},
+	{
+		Version: 12,
+		Name:    "test mode",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.APIToken{}, &models.Webhook{}, &models.OutgoingMessage{})
+		},
+		Down: func(tx *gorm.DB) error {
+			// Without the column, test tokens and webhooks would turn live and queued
+			// test messages would really be sent
+			if err := tx.Where("test_mode = ?", true).Delete(&models.APIToken{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("test_mode = ?", true).Delete(&models.OutgoingMessage{}).Error; err != nil {
+				return err
+			}
+			testWebhooks := tx.Unscoped().Model(&models.Webhook{}).Select("id").Where("test_mode = ?", true)
+			if err := tx.Where("webhook_id IN (?)", testWebhooks).Delete(&models.WebhookDelivery{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("webhook_id IN (?)", testWebhooks).Delete(&models.WebhookOutbox{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Where("test_mode = ?", true).Delete(&models.Webhook{}).Error; err != nil {
+				return err
+			}
+			for _, table := range []interface{}{&models.APIToken{}, &models.Webhook{}, &models.OutgoingMessage{}} {
+				if err := tx.Migrator().DropColumn(table, "test_mode"); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 13,
+		Name:    "send priority",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.OutgoingMessage{}, &models.Campaign{})
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, table := range []interface{}{&models.OutgoingMessage{}, &models.Campaign{}} {
+				if err := tx.Migrator().DropColumn(table, "priority"); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 14,
+		Name:    "scheduled campaigns",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.Contact{}, &models.Campaign{})
+		},
+		Down: func(tx *gorm.DB) error {
+			// Nothing would send scheduled campaigns anymore
+			if err := tx.Model(&models.Campaign{}).Where("status = ?", models.CampaignStatusScheduled).
+				Update("status", models.CampaignStatusDraft).Error; err != nil {
+				return err
+			}
+			for _, column := range []string{"scheduled_at", "schedule_error"} {
+				if err := tx.Migrator().DropColumn(&models.Campaign{}, column); err != nil {
+					return err
+				}
+			}
+			return tx.Migrator().DropColumn(&models.Contact{}, "variables")
+		},
+	},
+	{
+		Version: 15,
+		Name:    "webhook payload versions",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.Webhook{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&models.Webhook{}, "payload_version")
+		},
+	},
+	{
+		Version: 16,
+		Name:    "inbound event queue",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.InboundEvent{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.InboundEvent{})
+		},
+	},
+	{
+		Version: 17,
+		Name:    "leader leases",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.LeaderLease{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.LeaderLease{})
+		},
+	},
+	{
+		Version: 18,
+		Name:    "ignored chats",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.IgnoredChat{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.IgnoredChat{})
+		},
+	},
+	{
+		Version: 19,
+		Name:    "webhook retry limits",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&models.Webhook{}, &models.WebhookDelivery{}); err != nil {
+				return err
+			}
+			// Deliveries that already used up the 5 retries they used to get
+			return tx.Model(&models.WebhookDelivery{}).
+				Where("success = ? AND next_retry_at IS NULL AND retry_count >= ?", false, 5).
+				Update("abandoned_reason", models.AbandonedMaxRetries).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, column := range []string{"max_retries", "max_delivery_age"} {
+				if err := tx.Migrator().DropColumn(&models.Webhook{}, column); err != nil {
+					return err
+				}
+			}
+			return tx.Migrator().DropColumn(&models.WebhookDelivery{}, "abandoned_reason")
+		},
+	},
+	{
+		Version: 20,
+		Name:    "outgoing rules",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.Rule{})
+		},
+		Down: func(tx *gorm.DB) error {
+			// Without the column, outgoing rules would run on received messages
+			if err := tx.Where("direction = ?", models.RuleDirectionOutgoing).Delete(&models.Rule{}).Error; err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&models.Rule{}, "direction")
+		},
+	},
+	{
+		Version: 21,
+		Name:    "outbox claimed by",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.WebhookOutbox{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&models.WebhookOutbox{}, "claimed_by")
+		},
+	},
+}
+
+// schemaModels lists the application's tables, referenced tables first
+func schemaModels() []interface{} {
+	return []interface{}{
+		&models.User{}, &models.WhatsAppSession{}, &models.WhatsAppDevice{}, &models.Webhook{},
+		&models.WebhookDelivery{}, &models.WebhookOutbox{}, &models.APIToken{}, &models.AuthSession{},
+		&models.Event{}, &models.MessageVolume{}, &models.IdempotencyKey{},
+		&models.SendJob{}, &models.OutgoingMessage{}, &models.InboundWebhook{}, &models.Rule{},
+		&models.BotCommand{}, &models.OutOfOffice{}, &models.OutOfOfficeReply{},
+		&models.ContactList{}, &models.Contact{}, &models.ContactOptOut{}, &models.Campaign{},
+		&models.CampaignRecipient{}, &models.InboundEvent{}, &models.LeaderLease{},
+		&models.IgnoredChat{},
+	}
+}
+
+// Migrate applies the pending migrations in order
+func Migrate(db *gorm.DB) error {
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return err
+	}
+
+	if len(applied) == 0 {
+		// A new database, or one from before versioned migrations: the initial schema
+		// brings it up to date
+		return applyMigration(db, migrations[0], migrations)
+	}
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := applyMigration(db, m, []Migration{m}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyMigration runs m and records the given migrations as applied
+func applyMigration(db *gorm.DB, m Migration, record []Migration) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := m.Up(tx); err != nil {
+			return err
+		}
+		versions := make([]SchemaVersion, len(record))
+		for i, r := range record {
+			versions[i] = SchemaVersion{Version: r.Version, Name: r.Name, AppliedAt: time.Now()}
+		}
+		return tx.Create(&versions).Error
+	})
+	if err != nil {
+		return fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+	}
+	log.Printf("Applied migration %d: %s", m.Version, m.Name)
+	return nil
+}
+
+// Rollback reverts the most recently applied migrations, newest first
+func Rollback(db *gorm.DB, steps int) error {
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return err
+	}
+
+	for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaVersion{}, m.Version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("rolling back migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		log.Printf("Rolled back migration %d: %s", m.Version, m.Name)
+		steps--
+	}
+	return nil
+}
+
+// Status lists every migration and when it was applied
+func Status(db *gorm.DB) ([]MigrationStatus, error) {
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		status[i] = MigrationStatus{Version: m.Version, Name: m.Name}
+		if v, ok := applied[m.Version]; ok {
+			status[i].AppliedAt = &v.AppliedAt
+		}
+	}
+	return status, nil
+}
+
+func appliedVersions(db *gorm.DB) (map[int]SchemaVersion, error) {
+	if err := db.AutoMigrate(&SchemaVersion{}); err != nil {
+		return nil, err
+	}
+	var versions []SchemaVersion
+	if err := db.Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int]SchemaVersion, len(versions))
+	for _, v := range versions {
+		applied[v.Version] = v
+	}
+	return applied, nil
+}
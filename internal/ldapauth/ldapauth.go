@@ -0,0 +1,196 @@
+// Package ldapauth authenticates logins against an LDAP or Active Directory server.
+package ldapauth
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/user/pinglater/internal/logging"
+)
+
+var ldapLog = logging.Logger("ldap")
+
+// ErrInvalidCredentials is returned when the user doesn't exist in the directory or
+// the password is wrong
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// ErrNotAuthorized is returned when the user authenticated but isn't in LDAP_USER_GROUP
+var ErrNotAuthorized = errors.New("user is not a member of the required group")
+
+const (
+	defaultUserFilter     = "(uid=%s)"
+	defaultGroupAttribute = "memberOf"
+	dialTimeout           = 10 * time.Second
+)
+
+// Config describes the directory. Users are found with a search (bound as BindDN, or
+// anonymously) and then authenticated by binding as their own DN.
+type Config struct {
+	URL            string // ldap://host:389 or ldaps://host:636; empty disables LDAP
+	StartTLS       bool
+	SkipTLSVerify  bool
+	BindDN         string
+	BindPassword   string
+	BaseDN         string
+	UserFilter     string // %s is replaced by the escaped username
+	GroupAttribute string // Attribute listing the user's group DNs
+	AdminGroup     string // Members become admins
+	UserGroup      string // When set, only members may log in
+}
+
+// Result is an authenticated directory user
+type Result struct {
+	DN      string
+	IsAdmin bool
+	// ManagesRoles is set when LDAP_ADMIN_GROUP is configured; IsAdmin then overrides
+	// the role stored locally
+	ManagesRoles bool
+}
+
+var (
+	config     Config
+	configOnce sync.Once
+)
+
+func loadConfig() Config {
+	configOnce.Do(func() {
+		config = Config{
+			URL:            os.Getenv("LDAP_URL"),
+			StartTLS:       os.Getenv("LDAP_START_TLS") == "true",
+			SkipTLSVerify:  os.Getenv("LDAP_TLS_SKIP_VERIFY") == "true",
+			BindDN:         os.Getenv("LDAP_BIND_DN"),
+			BindPassword:   os.Getenv("LDAP_BIND_PASSWORD"),
+			BaseDN:         os.Getenv("LDAP_BASE_DN"),
+			UserFilter:     os.Getenv("LDAP_USER_FILTER"),
+			GroupAttribute: os.Getenv("LDAP_GROUP_ATTRIBUTE"),
+			AdminGroup:     os.Getenv("LDAP_ADMIN_GROUP"),
+			UserGroup:      os.Getenv("LDAP_USER_GROUP"),
+		}
+		if config.UserFilter == "" {
+			config.UserFilter = defaultUserFilter
+		}
+		if config.GroupAttribute == "" {
+			config.GroupAttribute = defaultGroupAttribute
+		}
+		if config.URL != "" {
+			ldapLog.Info("LDAP authentication enabled", "url", config.URL, "base_dn", config.BaseDN)
+		}
+	})
+	return config
+}
+
+// Enabled reports whether LDAP_URL is configured
+func Enabled() bool {
+	return loadConfig().URL != ""
+}
+
+// Authenticate checks a username and password against the directory and maps the
+// user's groups to a role
+func Authenticate(username, password string) (*Result, error) {
+	cfg := loadConfig()
+	// An empty password would be an unauthenticated bind, which most servers accept
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := dial(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if cfg.BindDN != "" {
+		if err := conn.Bind(cfg.BindDN, cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("service account bind failed: %w", err)
+		}
+	}
+
+	search := ldap.NewSearchRequest(
+		cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(dialTimeout.Seconds()), false,
+		fmt.Sprintf(cfg.UserFilter, ldap.EscapeFilter(username)),
+		[]string{"dn", cfg.GroupAttribute}, nil,
+	)
+	sr, err := conn.Search(search)
+	if err != nil {
+		return nil, fmt.Errorf("user search failed: %w", err)
+	}
+	if len(sr.Entries) != 1 {
+		// Unknown or ambiguous usernames are treated like a wrong password
+		return nil, ErrInvalidCredentials
+	}
+	entry := sr.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("user bind failed: %w", err)
+	}
+
+	groups := entry.GetAttributeValues(cfg.GroupAttribute)
+	if cfg.UserGroup != "" && !memberOf(groups, cfg.UserGroup) && !memberOf(groups, cfg.AdminGroup) {
+		return nil, ErrNotAuthorized
+	}
+
+	return &Result{
+		DN:           entry.DN,
+		IsAdmin:      memberOf(groups, cfg.AdminGroup),
+		ManagesRoles: cfg.AdminGroup != "",
+	}, nil
+}
+
+func dial(cfg Config) (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.SkipTLSVerify}
+	if u, err := url.Parse(cfg.URL); err == nil {
+		// StartTLS needs the server name for certificate verification
+		tlsConfig.ServerName = u.Hostname()
+	}
+
+	conn, err := ldap.DialURL(cfg.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: dialTimeout}),
+		ldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to LDAP server: %w", err)
+	}
+	conn.SetTimeout(dialTimeout)
+
+	if cfg.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("StartTLS failed: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// memberOf reports whether group is one of the user's group DNs. DNs are compared
+// case-insensitively, ignoring spaces after commas.
+func memberOf(groups []string, group string) bool {
+	if group == "" {
+		return false
+	}
+	want := normalizeDN(group)
+	for _, g := range groups {
+		if normalizeDN(g) == want {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeDN(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i, p := range parts {
+		parts[i] = strings.TrimSpace(p)
+	}
+	return strings.ToLower(strings.Join(parts, ","))
+}
@@ -0,0 +1,78 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Setup configures the default logger from LOG_LEVEL (debug, info, warn or error;
+// default info) and LOG_FORMAT (text or json; default text). The standard log package
+// is routed through the same handler, at info level.
+func Setup() {
+	level := slog.LevelInfo
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		if err := level.UnmarshalText([]byte(v)); err != nil {
+			slog.Warn("Ignoring invalid LOG_LEVEL", "value", v)
+		}
+	}
+
+	slog.SetDefault(slog.New(NewHandler(os.Stderr, level)))
+}
+
+// NewHandler returns a handler writing to w in the format set by LOG_FORMAT, for logs
+// that go to their own destination
+func NewHandler(w io.Writer, level slog.Leveler) slog.Handler {
+	opts := &slog.HandlerOptions{Level: level}
+	if strings.EqualFold(os.Getenv("LOG_FORMAT"), "json") {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+// Logger returns a logger tagged with a component name. Loggers are usually created in
+// package variables, before Setup runs, so they always write through the current default.
+func Logger(component string) *slog.Logger {
+	return slog.New(defaultHandler{}).With("component", component)
+}
+
+// defaultHandler forwards records to slog.Default's handler at the time they're logged
+type defaultHandler struct {
+	wrap func(slog.Handler) slog.Handler // Attributes and groups added with With/WithGroup
+}
+
+func (h defaultHandler) target() slog.Handler {
+	handler := slog.Default().Handler()
+	if h.wrap != nil {
+		handler = h.wrap(handler)
+	}
+	return handler
+}
+
+func (h defaultHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return slog.Default().Handler().Enabled(ctx, level)
+}
+
+func (h defaultHandler) Handle(ctx context.Context, record slog.Record) error {
+	return h.target().Handle(ctx, record)
+}
+
+func (h defaultHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.chain(func(next slog.Handler) slog.Handler { return next.WithAttrs(attrs) })
+}
+
+func (h defaultHandler) WithGroup(name string) slog.Handler {
+	return h.chain(func(next slog.Handler) slog.Handler { return next.WithGroup(name) })
+}
+
+func (h defaultHandler) chain(step func(slog.Handler) slog.Handler) defaultHandler {
+	prev := h.wrap
+	return defaultHandler{wrap: func(next slog.Handler) slog.Handler {
+		if prev != nil {
+			next = prev(next)
+		}
+		return step(next)
+	}}
+}
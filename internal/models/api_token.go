@@ -1,16 +1,27 @@
 package models
 
 import (
+	"strconv"
 	"time"
 )
 
 // Available scopes for API tokens
 const (
-	ScopeAll          = "all"
-	ScopeMessagesSend = "messages:send"
-	ScopeMessagesRead = "messages:read"
-	ScopeMetricsRead  = "metrics:read"
-	ScopeStatusRead   = "status:read"
+	ScopeAll            = "all"
+	ScopeMessagesSend   = "messages:send"
+	ScopeMessagesRead   = "messages:read" // Also the real-time event stream, which carries message content
+	ScopeMetricsRead    = "metrics:read"
+	ScopeStatusRead     = "status:read"
+	ScopeSessionManage  = "session:manage" // Connect, disconnect and pair WhatsApp
+	ScopeWebhooksRead   = "webhooks:read"
+	ScopeWebhooksManage = "webhooks:manage" // Implies webhooks:read
+)
+
+// API token prefixes. Test-mode tokens work like live ones, but the messages they send
+// are simulated rather than sent, and their events only go to test-mode webhooks.
+const (
+	TokenPrefixLive = "plt_live_"
+	TokenPrefixTest = "plt_test_"
 )
 
 // AllAvailableScopes returns all available scopes
@@ -21,6 +32,9 @@ func AllAvailableScopes() []string {
 		ScopeMessagesRead,
 		ScopeMetricsRead,
 		ScopeStatusRead,
+		ScopeSessionManage,
+		ScopeWebhooksRead,
+		ScopeWebhooksManage,
 	}
 }
 
@@ -34,8 +48,19 @@ type APIToken struct {
 	IsActive   bool       `gorm:"default:true" json:"is_active"`
 	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
 	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
-	CreatedAt  time.Time  `json:"created_at"`
-	UpdatedAt  time.Time  `json:"updated_at"`
+	// Quotas; 0 means unlimited
+	RateLimitPerMinute int `gorm:"default:0" json:"rate_limit_per_minute"` // Requests per minute
+	MessagesPerDay     int `gorm:"default:0" json:"messages_per_day"`      // Messages sent per UTC day
+	// Usage of MessagesPerDay on DailyMessageDate (YYYY-MM-DD, UTC)
+	DailyMessageCount int    `gorm:"default:0" json:"-"`
+	DailyMessageDate  string `json:"-"`
+	// WhatsApp account (device) IDs the token may send from, comma-separated; empty
+	// allows any account
+	Accounts string `gorm:"type:text" json:"accounts"`
+	// Test mode: messages are simulated and never reach WhatsApp (plt_test_ tokens)
+	TestMode  bool      `gorm:"default:false" json:"test_mode"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 // HasScope checks if the token has a specific scope (or 'all')
@@ -68,6 +93,48 @@ func (t *APIToken) SetScopes(scopes []string) {
 	t.Scopes = joinScopes(scopes)
 }
 
+// GetAccounts returns the WhatsApp account IDs the token is restricted to
+func (t *APIToken) GetAccounts() []uint {
+	accounts := []uint{}
+	for _, s := range splitScopes(t.Accounts) {
+		if id, err := strconv.ParseUint(s, 10, 32); err == nil {
+			accounts = append(accounts, uint(id))
+		}
+	}
+	return accounts
+}
+
+// SetAccounts restricts the token to the given WhatsApp account IDs (none: any account)
+func (t *APIToken) SetAccounts(accounts []uint) {
+	ids := make([]string, len(accounts))
+	for i, id := range accounts {
+		ids[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	t.Accounts = joinScopes(ids)
+}
+
+// CanUseAccount checks if the token may send from a WhatsApp account
+func (t *APIToken) CanUseAccount(accountID uint) bool {
+	accounts := t.GetAccounts()
+	if len(accounts) == 0 {
+		return true
+	}
+	for _, id := range accounts {
+		if id == accountID {
+			return true
+		}
+	}
+	return false
+}
+
+// Prefix returns the prefix of the token's raw form, which says its mode
+func (t *APIToken) Prefix() string {
+	if t.TestMode {
+		return TokenPrefixTest
+	}
+	return TokenPrefixLive
+}
+
 // IsExpired checks if the token has expired
 func (t *APIToken) IsExpired() bool {
 	if t.ExpiresAt == nil {
@@ -109,41 +176,96 @@ func joinScopes(scopes []string) string {
 
 // CreateTokenRequest represents a request to create a new API token
 type CreateTokenRequest struct {
-	Name      string     `json:"name" binding:"required"`
-	Scopes    []string   `json:"scopes" binding:"required"`
-	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Name               string     `json:"name" binding:"required"`
+	Scopes             []string   `json:"scopes" binding:"required"`
+	ExpiresAt          *time.Time `json:"expires_at,omitempty"`
+	RateLimitPerMinute int        `json:"rate_limit_per_minute,omitempty" binding:"min=0"`
+	MessagesPerDay     int        `json:"messages_per_day,omitempty" binding:"min=0"`
+	// Accounts restricts sending to these WhatsApp account IDs
+	Accounts []uint `json:"accounts,omitempty"`
+	// ServiceAccount creates the token for a new service-account user instead of the
+	// caller, so it survives the caller's deletion (admin only)
+	ServiceAccount bool `json:"service_account,omitempty"`
+	// TestMode creates a plt_test_ token, whose messages are simulated
+	TestMode bool `json:"test_mode,omitempty"`
 }
 
 // CreateTokenResponse represents the response after creating a token
 type CreateTokenResponse struct {
-	ID        uint       `json:"id"`
-	Name      string     `json:"name"`
-	Token     string     `json:"token"` // Raw token shown only once
-	Scopes    []string   `json:"scopes"`
-	ExpiresAt *time.Time `json:"expires_at,omitempty"`
-	CreatedAt time.Time  `json:"created_at"`
+	ID                 uint       `json:"id"`
+	Name               string     `json:"name"`
+	Token              string     `json:"token"` // Raw token shown only once
+	Scopes             []string   `json:"scopes"`
+	ExpiresAt          *time.Time `json:"expires_at,omitempty"`
+	RateLimitPerMinute int        `json:"rate_limit_per_minute"`
+	MessagesPerDay     int        `json:"messages_per_day"`
+	Accounts           []uint     `json:"accounts"`
+	ServiceAccount     bool       `json:"service_account"`
+	TestMode           bool       `json:"test_mode"`
+	CreatedAt          time.Time  `json:"created_at"`
 }
 
 // TokenResponse represents a token in list responses (without the raw token)
 type TokenResponse struct {
-	ID         uint       `json:"id"`
-	Name       string     `json:"name"`
-	Scopes     []string   `json:"scopes"`
-	IsActive   bool       `json:"is_active"`
-	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
-	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
-	CreatedAt  time.Time  `json:"created_at"`
+	ID                 uint       `json:"id"`
+	Name               string     `json:"name"`
+	Scopes             []string   `json:"scopes"`
+	IsActive           bool       `json:"is_active"`
+	ExpiresAt          *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt         *time.Time `json:"last_used_at,omitempty"`
+	RateLimitPerMinute int        `json:"rate_limit_per_minute"`
+	MessagesPerDay     int        `json:"messages_per_day"`
+	MessagesSentToday  int        `json:"messages_sent_today"`
+	Accounts           []uint     `json:"accounts"`
+	ServiceAccount     bool       `json:"service_account"`
+	TestMode           bool       `json:"test_mode"`
+	CreatedAt          time.Time  `json:"created_at"`
 }
 
 // ToResponse converts APIToken to TokenResponse
 func (t *APIToken) ToResponse() TokenResponse {
 	return TokenResponse{
-		ID:         t.ID,
-		Name:       t.Name,
-		Scopes:     t.GetScopes(),
-		IsActive:   t.IsActive,
-		ExpiresAt:  t.ExpiresAt,
-		LastUsedAt: t.LastUsedAt,
-		CreatedAt:  t.CreatedAt,
+		ID:                 t.ID,
+		Name:               t.Name,
+		Scopes:             t.GetScopes(),
+		IsActive:           t.IsActive,
+		ExpiresAt:          t.ExpiresAt,
+		LastUsedAt:         t.LastUsedAt,
+		RateLimitPerMinute: t.RateLimitPerMinute,
+		MessagesPerDay:     t.MessagesPerDay,
+		MessagesSentToday:  t.MessagesSentToday(),
+		Accounts:           t.GetAccounts(),
+		TestMode:           t.TestMode,
+		CreatedAt:          t.CreatedAt,
 	}
 }
+
+// MessagesSentToday returns how much of the messages-per-day quota is used (UTC day)
+func (t *APIToken) MessagesSentToday() int {
+	if t.DailyMessageDate != time.Now().UTC().Format("2006-01-02") {
+		return 0
+	}
+	return t.DailyMessageCount
+}
+
+// TokenInfoResponse describes the API token making the request
+type TokenInfoResponse struct {
+	ID             uint       `json:"id"`
+	Name           string     `json:"name"`
+	Username       string     `json:"username"`
+	Scopes         []string   `json:"scopes"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	Accounts       []uint     `json:"accounts"`
+	ServiceAccount bool       `json:"service_account"`
+	TestMode       bool       `json:"test_mode"`
+	// Nil when the token has no such limit
+	RateLimit    *TokenLimitState `json:"rate_limit"`
+	MessageQuota *TokenLimitState `json:"message_quota"`
+}
+
+// TokenLimitState is the current state of a token's rate limit or message quota
+type TokenLimitState struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	ResetAt   time.Time `json:"reset_at"`
+}
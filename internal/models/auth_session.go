@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+)
+
+// AuthSession is a JWT issued by login. A JWT is only accepted while its session row
+// exists, so deleting the row revokes the token before it expires.
+type AuthSession struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	UserID     uint      `gorm:"not null;index" json:"user_id"`
+	JTI        string    `gorm:"column:jti;uniqueIndex;not null" json:"-"` // The token's "jti" claim
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `gorm:"index" json:"expires_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// AuthSessionResponse represents a session in GET /auth/sessions
+type AuthSessionResponse struct {
+	ID         uint      `json:"id"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	Current    bool      `json:"current"` // The session making the request
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ToResponse converts AuthSession to AuthSessionResponse
+func (s *AuthSession) ToResponse(currentID uint) AuthSessionResponse {
+	return AuthSessionResponse{
+		ID:         s.ID,
+		IPAddress:  s.IPAddress,
+		UserAgent:  s.UserAgent,
+		Current:    s.ID == currentID,
+		LastSeenAt: s.LastSeenAt,
+		ExpiresAt:  s.ExpiresAt,
+		CreatedAt:  s.CreatedAt,
+	}
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"time"
+)
+
+// Actions of bot commands: built-in ones answer in the chat, forward hands the command
+// to a webhook
+const (
+	CommandActionHelp    = "help"    // List the commands the sender may use
+	CommandActionStatus  = "status"  // Report the WhatsApp connection and message counts
+	CommandActionPing    = "ping"    // Answer "pong"
+	CommandActionReply   = "reply"   // Reply with a template
+	CommandActionForward = "forward" // Deliver a command_received event to a webhook
+)
+
+// CommandReceivedEvent is the event forwarded to webhooks for forward commands
+const CommandReceivedEvent = "command_received"
+
+// BotCommand is a chat command, e.g. !status, that PingLater answers when someone on
+// its allowlist sends it
+type BotCommand struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	UserID      uint   `gorm:"not null;uniqueIndex:idx_bot_command_user_name" json:"user_id"`
+	Name        string `gorm:"not null;uniqueIndex:idx_bot_command_user_name" json:"name"` // Without the prefix
+	Description string `json:"description"`
+	IsActive    bool   `gorm:"not null" json:"is_active"`
+
+	Action    string `gorm:"not null" json:"action"` // One of the CommandAction constants
+	Template  string `gorm:"type:text" json:"template,omitempty"`
+	WebhookID *uint  `json:"webhook_id,omitempty"`
+
+	// Comma-separated phone numbers that may issue the command, or * for anyone
+	AllowedSenders string `gorm:"type:text" json:"-"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BotCommandRequest creates a command, or updates the fields it sets
+type BotCommandRequest struct {
+	Name           string    `json:"name"`
+	Description    *string   `json:"description"`
+	IsActive       *bool     `json:"is_active"`
+	Action         string    `json:"action"`
+	Template       *string   `json:"template"`
+	WebhookID      *uint     `json:"webhook_id"`
+	AllowedSenders *[]string `json:"allowed_senders"`
+}
+
+// BotCommandResponse is a command as returned by the API
+type BotCommandResponse struct {
+	BotCommand
+	AllowedSenders []string `json:"allowed_senders"`
+}
+
+// CommandReceivedData is a parsed command, for reply templates and forwarded
+// command_received events
+type CommandReceivedData struct {
+	Command   string   `json:"command"`  // Name, without the prefix
+	Args      []string `json:"args"`     // Arguments, split on spaces; quotes group words
+	ArgText   string   `json:"arg_text"` // Everything after the command
+	Chat      string   `json:"chat"`
+	From      string   `json:"from"`
+	FromPhone string   `json:"from_phone"`
+	FromName  string   `json:"from_name,omitempty"`
+	IsGroup   bool     `json:"is_group"`
+	MessageID string   `json:"message_id"`
+	Timestamp int64    `json:"timestamp"`
+}
+
+// GetAllowedSenders returns who may issue the command
+func (c *BotCommand) GetAllowedSenders() []string {
+	return splitList(c.AllowedSenders)
+}
+
+// ToResponse converts a command to its API form
+func (c *BotCommand) ToResponse() BotCommandResponse {
+	return BotCommandResponse{
+		BotCommand:     *c,
+		AllowedSenders: c.GetAllowedSenders(),
+	}
+}
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"time"
+)
+
+// Statuses of campaigns
+const (
+	CampaignStatusDraft     = "draft"     // Not sent yet; can still be changed
+	CampaignStatusScheduled = "scheduled" // Sent at ScheduledAt
+	CampaignStatusSent      = "sent"      // Queued to its recipients
+)
+
+// RecipientStatusOptedOut is the status of campaign recipients who opted out, and so
+// weren't sent the campaign. Other recipients have the status of their queued message.
+const RecipientStatusOptedOut = "opted_out"
+
+// Campaign is a templated message broadcast to a contact list through the send queue
+type Campaign struct {
+	ID     uint   `gorm:"primaryKey" json:"id"`
+	UserID uint   `gorm:"not null;index" json:"user_id"`
+	Name   string `gorm:"not null" json:"name"`
+	ListID uint   `gorm:"not null;index" json:"list_id"`
+	// Comma-separated; when set, only contacts with one of the tags get the campaign
+	Tags string `gorm:"type:text" json:"-"`
+	// Go template over the contact: phone_number, name and tags
+	Template string `gorm:"type:text;not null" json:"template"`
+	Status   string `gorm:"not null" json:"status"`
+	// Send queue priority of the campaign's messages: high, normal or low
+	Priority string `gorm:"not null;default:'normal'" json:"priority"`
+
+	// When a scheduled campaign is sent. Its recipients and their messages are worked
+	// out then, from the list as it is at the time.
+	ScheduledAt *time.Time `json:"scheduled_at,omitempty"`
+	// Why the scheduled send failed, leaving the campaign a draft again
+	ScheduleError string `json:"schedule_error,omitempty"`
+
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	SentAt    *time.Time `json:"sent_at,omitempty"`
+}
+
+// SendCampaignRequest sends a campaign now, or schedules it for later
+type SendCampaignRequest struct {
+	SendAt *time.Time `json:"send_at"`
+}
+
+// CampaignRecipient is a contact a campaign was sent to, as it was at the time
+type CampaignRecipient struct {
+	ID          uint   `gorm:"primaryKey" json:"-"`
+	CampaignID  uint   `gorm:"not null;index" json:"-"`
+	PhoneNumber string `gorm:"not null;index" json:"phone_number"`
+	Name        string `json:"name"`
+	// The queued message; nil for recipients who opted out
+	MessageID *uint  `gorm:"index" json:"message_id,omitempty"`
+	Status    string `gorm:"-" json:"status"` // From the queued message
+	Error     string `gorm:"-" json:"error,omitempty"`
+
+	// When the recipient first messaged back after the campaign
+	RepliedAt *time.Time `json:"replied_at,omitempty"`
+}
+
+// CampaignStats is a sent campaign's delivery funnel. Each stage counts the recipients
+// whose message got at least that far, so a read message is also sent and delivered.
+type CampaignStats struct {
+	CampaignID uint  `json:"campaign_id"`
+	Recipients int64 `json:"recipients"`
+	OptedOut   int64 `json:"opted_out"` // Opted out before the campaign was sent
+	Queued     int64 `json:"queued"`    // Messages queued for sending
+	Pending    int64 `json:"pending"`   // Still waiting in the send queue
+	Sent       int64 `json:"sent"`
+	Delivered  int64 `json:"delivered"`
+	Read       int64 `json:"read"`
+	Failed     int64 `json:"failed"`
+	Blocked    int64 `json:"blocked"` // Stopped by outgoing rules
+	Replied    int64 `json:"replied"`
+
+	// Ratios of the stages, 0 when the earlier stage is empty
+	DeliveryRate float64 `json:"delivery_rate"` // delivered / sent
+	ReadRate     float64 `json:"read_rate"`     // read / delivered
+	ReplyRate    float64 `json:"reply_rate"`    // replied / sent
+}
+
+// CampaignRequest creates a campaign, or updates the fields it sets
+type CampaignRequest struct {
+	Name     string    `json:"name"`
+	ListID   *uint     `json:"list_id"`
+	Tags     *[]string `json:"tags"`
+	Template *string   `json:"template"`
+	Priority *string   `json:"priority"`
+}
+
+// CampaignResponse is a campaign as returned by the API
+type CampaignResponse struct {
+	Campaign
+	Tags []string `json:"tags"`
+}
+
+// GetTags returns the tags the campaign is limited to
+func (c *Campaign) GetTags() []string {
+	return splitList(c.Tags)
+}
+
+// ToResponse converts a campaign to its API form
+func (c *Campaign) ToResponse() CampaignResponse {
+	return CampaignResponse{
+		Campaign: *c,
+		Tags:     c.GetTags(),
+	}
+}
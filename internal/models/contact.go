@@ -0,0 +1,115 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// ContactList is a named list of contacts that campaigns are sent to
+type ContactList struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      uint      `gorm:"not null;uniqueIndex:idx_contact_list_user_name" json:"user_id"`
+	Name        string    `gorm:"not null;uniqueIndex:idx_contact_list_user_name" json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Contact is a recipient on a contact list. A phone number is on a list at most once.
+type Contact struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	ListID      uint   `gorm:"not null;uniqueIndex:idx_contact_list_phone" json:"list_id"`
+	PhoneNumber string `gorm:"not null;uniqueIndex:idx_contact_list_phone" json:"phone_number"` // Digits only
+	Name        string `json:"name"`
+	Tags        string `gorm:"type:text" json:"-"` // Comma-separated
+	// JSON object of the contact's own values for campaign templates, e.g. an order number
+	Variables string    `gorm:"type:text" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ContactOptOut records that a phone number asked not to get campaigns from the user.
+// Opted-out numbers are skipped by every campaign, whatever list they're on.
+type ContactOptOut struct {
+	ID          uint      `gorm:"primaryKey" json:"-"`
+	UserID      uint      `gorm:"not null;uniqueIndex:idx_contact_opt_out_user_phone" json:"-"`
+	PhoneNumber string    `gorm:"not null;uniqueIndex:idx_contact_opt_out_user_phone" json:"phone_number"`
+	Reason      string    `json:"reason"` // "keyword" when they messaged an opt-out keyword, "api" otherwise
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ContactListRequest creates a contact list, or updates the fields it sets
+type ContactListRequest struct {
+	Name        string  `json:"name"`
+	Description *string `json:"description"`
+}
+
+// ContactListResponse is a contact list as returned by the API
+type ContactListResponse struct {
+	ContactList
+	ContactCount int64 `json:"contact_count"`
+}
+
+// ContactRequest adds a contact to a list, or updates the contact with its phone number
+type ContactRequest struct {
+	PhoneNumber string   `json:"phone_number"`
+	Name        *string  `json:"name"`
+	Tags        []string `json:"tags"` // Added to the contact's tags
+	// Merged into the contact's variables; an empty value removes one
+	Variables map[string]string `json:"variables"`
+}
+
+// ContactResponse is a contact as returned by the API
+type ContactResponse struct {
+	Contact
+	Tags      []string          `json:"tags"`
+	Variables map[string]string `json:"variables"`
+	OptedOut  bool              `json:"opted_out"`
+}
+
+// GetTags returns the contact's tags
+func (c *Contact) GetTags() []string {
+	return splitList(c.Tags)
+}
+
+// GetVariables returns the contact's template variables
+func (c *Contact) GetVariables() map[string]string {
+	variables := map[string]string{}
+	if c.Variables != "" {
+		json.Unmarshal([]byte(c.Variables), &variables)
+	}
+	return variables
+}
+
+// SetVariables sets the contact's template variables
+func (c *Contact) SetVariables(variables map[string]string) {
+	if len(variables) == 0 {
+		c.Variables = ""
+		return
+	}
+	data, _ := json.Marshal(variables)
+	c.Variables = string(data)
+}
+
+// HasAnyTag reports whether the contact has one of tags, ignoring case
+func (c *Contact) HasAnyTag(tags []string) bool {
+	for _, tag := range c.GetTags() {
+		for _, want := range tags {
+			if strings.EqualFold(tag, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ToResponse converts a contact to its API form
+func (c *Contact) ToResponse(optedOut bool) ContactResponse {
+	return ContactResponse{
+		Contact:   *c,
+		Tags:      c.GetTags(),
+		Variables: c.GetVariables(),
+		OptedOut:  optedOut,
+	}
+}
@@ -14,33 +14,72 @@ const (
 	EventTypeMessageReceived EventType = "message_received"
 	EventTypeQRGenerated     EventType = "qr_generated"
 	EventTypeConnectionError EventType = "connection_error"
+	EventTypeSelfTestPassed  EventType = "self_test_passed"
+	EventTypeSelfTestFailed  EventType = "self_test_failed"
+	EventTypeUpdateAvailable EventType = "update_available"
+	EventTypeWebhookDisabled EventType = "webhook_disabled"
+	EventTypeLoginLockout    EventType = "login_lockout"
+	EventTypeReconnecting    EventType = "reconnecting"
+	EventTypeReconnectFailed EventType = "reconnect_failed"
+
+	EventTypeConnectionDegraded EventType = "connection_degraded"
+	EventTypeConnectionRestored EventType = "connection_restored"
+
+	EventTypeStreamError  EventType = "stream_error"
+	EventTypeTemporaryBan EventType = "temporary_ban"
+	EventTypeRateLimited  EventType = "rate_limited"
+
+	EventTypeMessageDelivered        EventType = "message_delivered"
+	EventTypeMessageRead             EventType = "message_read"
+	EventTypeGroupParticipantChanged EventType = "group_participant_changed"
+	EventTypeCallReceived            EventType = "call_received"
+	EventTypeDailySummary            EventType = "daily_summary"
+	EventTypeSandboxMessage          EventType = "sandbox_message"
 )
 
+// Event is a real-time event for the event streams. Recent events are kept in the
+// database so reconnecting clients can catch up.
 type Event struct {
-	ID        uint      `json:"id"`
-	Type      EventType `json:"type"`
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Type      EventType `gorm:"not null" json:"type"`
 	Message   string    `json:"message"`
-	Details   string    `json:"details,omitempty"`
+	Details   string    `gorm:"type:text" json:"details,omitempty"`
 	Timestamp time.Time `json:"timestamp"`
+	// UserID limits the event to one user's subscribers; 0 sends it to everyone
+	UserID uint `gorm:"index" json:"-"`
 }
 
 type EventStream struct {
-	Clients map[chan Event]bool
+	Clients map[chan Event]uint // Subscriber channels and their user IDs
 	Mutex   sync.RWMutex
+	done    chan struct{}
+	close   sync.Once
 }
 
 func NewEventStream() *EventStream {
 	return &EventStream{
-		Clients: make(map[chan Event]bool),
+		Clients: make(map[chan Event]uint),
+		done:    make(chan struct{}),
 	}
 }
 
-func (es *EventStream) Subscribe() chan Event {
+// Close ends all subscriptions, so open streams finish during shutdown
+func (es *EventStream) Close() {
+	es.close.Do(func() { close(es.done) })
+}
+
+// Done is closed once the stream is closed
+func (es *EventStream) Done() <-chan struct{} {
+	return es.done
+}
+
+// Subscribe returns a channel receiving the user's events and events for everyone
+func (es *EventStream) Subscribe(userID uint) chan Event {
 	es.Mutex.Lock()
 	defer es.Mutex.Unlock()
 
 	ch := make(chan Event, 10)
-	es.Clients[ch] = true
+	es.Clients[ch] = userID
 	return ch
 }
 
@@ -56,7 +95,10 @@ func (es *EventStream) Broadcast(event Event) {
 	es.Mutex.RLock()
 	defer es.Mutex.RUnlock()
 
-	for ch := range es.Clients {
+	for ch, userID := range es.Clients {
+		if event.UserID != 0 && event.UserID != userID {
+			continue
+		}
 		select {
 		case ch <- event:
 		default:
@@ -72,4 +114,20 @@ type DashboardMetrics struct {
 	TotalMessagesSent     int       `json:"total_messages_sent"`
 	TotalMessagesReceived int       `json:"total_messages_received"`
 	ConnectionUptime      int64     `json:"connection_uptime_seconds"`
+
+	Webhooks *WebhookPipelineMetrics `json:"webhooks,omitempty"`
+}
+
+// WebhookPipelineMetrics shows how busy webhook delivery is. A growing queue depth or
+// oldest_queued_seconds means events are arriving faster than they can be delivered.
+type WebhookPipelineMetrics struct {
+	InFlight            int64 `json:"in_flight"`             // Deliveries (including retries) being sent right now
+	Workers             int   `json:"workers"`               // Outbox delivery workers
+	QueueDepth          int64 `json:"queue_depth"`           // Events waiting in the outbox, including rate-limited ones
+	QueueDeferred       int64 `json:"queue_deferred"`        // Of those, events held back by a rate limit
+	OldestQueuedSeconds int64 `json:"oldest_queued_seconds"` // Age of the oldest waiting event
+	RetryBacklog        int64 `json:"retry_backlog"`         // Failed deliveries with retries remaining
+	RetriesDue          int64 `json:"retries_due"`           // Of those, retries whose time has come
+	DeliveredTotal      int64 `json:"delivered_total"`       // Successful attempts since startup
+	FailedTotal         int64 `json:"failed_total"`          // Failed attempts since startup
 }
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// IdempotencyKey remembers the outcome of a request sent with an Idempotency-Key header,
+// so a retried request gets the same response instead of running again
+type IdempotencyKey struct {
+	ID     uint   `gorm:"primaryKey"`
+	UserID uint   `gorm:"not null;uniqueIndex:idx_idempotency_user_key,priority:1"`
+	Key    string `gorm:"column:idempotency_key;size:255;not null;uniqueIndex:idx_idempotency_user_key,priority:2"`
+	// Hash of the request, so a key reused for a different request is caught
+	RequestHash string `gorm:"not null"`
+	StatusCode  int    // 0 while the request is still running
+	Response    string `gorm:"type:text"`
+	CreatedAt   time.Time
+	ExpiresAt   time.Time `gorm:"index"`
+}
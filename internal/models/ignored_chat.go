@@ -0,0 +1,63 @@
+package models
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"time"
+)
+
+// IgnoredChat makes PingLater ignore the messages of matching chats, such as busy
+// groups: they aren't counted, recorded, shown in the event stream, answered or sent
+// to webhooks
+type IgnoredChat struct {
+	ID     uint `gorm:"primaryKey" json:"id"`
+	UserID uint `gorm:"not null;index" json:"user_id"`
+	// A chat JID, a phone number, or a JID pattern where * matches anything, e.g.
+	// 1203630*@g.us or *@newsletter
+	Pattern   string    `gorm:"not null" json:"pattern"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// IgnoredChatRequest adds a chat to the ignore list
+type IgnoredChatRequest struct {
+	Pattern string `json:"pattern"`
+	Note    string `json:"note"`
+}
+
+// NormalizeChatPattern validates an ignore list pattern, turning phone numbers into
+// their chat JIDs
+func NormalizeChatPattern(pattern string) (string, error) {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if pattern == "" {
+		return "", errors.New("pattern is required")
+	}
+	if !strings.ContainsAny(pattern, "@*") {
+		phone := NormalizePhoneNumber(pattern)
+		if phone == "" {
+			return "", errors.New("pattern must be a JID, a phone number or a JID pattern")
+		}
+		return phone + "@s.whatsapp.net", nil
+	}
+	if strings.Trim(pattern, "*") == "" {
+		return "", errors.New("pattern would match every chat")
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return "", errors.New("invalid pattern: " + err.Error())
+	}
+	return pattern, nil
+}
+
+// MatchesChat reports whether the pattern matches any of the JIDs
+func (i *IgnoredChat) MatchesChat(jids ...string) bool {
+	for _, jid := range jids {
+		if jid == "" {
+			continue
+		}
+		if ok, _ := path.Match(i.Pattern, strings.ToLower(jid)); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// InboundEvent is a WhatsApp event waiting to be processed: run through the rules and
+// queued for webhooks. Events are stored as they arrive and deleted once processed, so
+// one interrupted by a crash or restart is processed again on the next start.
+type InboundEvent struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null"`
+	EventType string `gorm:"not null"`
+	Data      string `gorm:"type:text"` // JSON
+	// Times processing started; an event that keeps failing is dropped
+	Attempts  int `gorm:"not null;default:0"`
+	CreatedAt time.Time
+}
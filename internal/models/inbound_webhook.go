@@ -0,0 +1,95 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// InboundWebhook turns requests from other systems into WhatsApp messages: the request
+// body is rendered with a template and sent to the recipients its routes pick
+type InboundWebhook struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	UserID      uint   `gorm:"not null;uniqueIndex:idx_inbound_webhook_user_name" json:"user_id"`
+	Name        string `gorm:"not null;uniqueIndex:idx_inbound_webhook_user_name" json:"name"` // Part of the receive URL
+	Description string `json:"description"`
+	IsActive    bool   `gorm:"not null" json:"is_active"`
+
+	// Go template over the request's JSON body
+	Template string `gorm:"type:text;not null" json:"template"`
+	// Comma-separated phone numbers or group JIDs for requests no route matches
+	Recipients string `gorm:"type:text" json:"-"`
+	// JSON list of InboundRoute, tried in order
+	Routes string `gorm:"type:text" json:"-"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// InboundRoute sends requests whose field (a dotted path into the JSON body, e.g.
+// "labels.severity") equals value to its recipients
+type InboundRoute struct {
+	Field      string   `json:"field"`
+	Value      string   `json:"value"`
+	Recipients []string `json:"recipients"`
+}
+
+// InboundWebhookRequest creates an inbound webhook, or updates the fields it sets
+type InboundWebhookRequest struct {
+	Name        string          `json:"name"`
+	Description *string         `json:"description"`
+	IsActive    *bool           `json:"is_active"`
+	Template    string          `json:"template"`
+	Recipients  *[]string       `json:"recipients"`
+	Routes      *[]InboundRoute `json:"routes"`
+}
+
+// InboundWebhookResponse is an inbound webhook as returned by the API
+type InboundWebhookResponse struct {
+	InboundWebhook
+	Recipients []string       `json:"recipients"`
+	Routes     []InboundRoute `json:"routes"`
+	URL        string         `json:"url"`
+}
+
+// GetRecipients returns the default recipients
+func (w *InboundWebhook) GetRecipients() []string {
+	if w.Recipients == "" {
+		return []string{}
+	}
+	return strings.Split(w.Recipients, ",")
+}
+
+// SetRecipients sets the default recipients
+func (w *InboundWebhook) SetRecipients(recipients []string) {
+	w.Recipients = strings.Join(recipients, ",")
+}
+
+// GetRoutes returns the routes, in order
+func (w *InboundWebhook) GetRoutes() []InboundRoute {
+	routes := []InboundRoute{}
+	if w.Routes != "" {
+		json.Unmarshal([]byte(w.Routes), &routes)
+	}
+	return routes
+}
+
+// SetRoutes sets the routes
+func (w *InboundWebhook) SetRoutes(routes []InboundRoute) {
+	if len(routes) == 0 {
+		w.Routes = ""
+		return
+	}
+	data, _ := json.Marshal(routes)
+	w.Routes = string(data)
+}
+
+// ToResponse converts an inbound webhook to its API form
+func (w *InboundWebhook) ToResponse() InboundWebhookResponse {
+	return InboundWebhookResponse{
+		InboundWebhook: *w,
+		Recipients:     w.GetRecipients(),
+		Routes:         w.GetRoutes(),
+		URL:            "/api/integrations/inbound/" + w.Name,
+	}
+}
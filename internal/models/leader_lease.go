@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// LeaderLease records which server instance runs the background jobs, when several share
+// a database. The holder renews it while running; once it expires, another instance
+// takes over.
+type LeaderLease struct {
+	Name      string    `gorm:"primaryKey;size:64"`
+	Holder    string    `gorm:"not null;size:255"` // Instance ID
+	ExpiresAt time.Time `gorm:"not null"`
+	UpdatedAt time.Time
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// MessageVolume counts one user's sent and received messages in one UTC hour, for
+// activity charts. Only counts are kept, never message content.
+type MessageVolume struct {
+	ID       uint      `gorm:"primaryKey" json:"-"`
+	UserID   uint      `gorm:"not null;uniqueIndex:idx_message_volume_user_hour,priority:1" json:"-"`
+	Hour     time.Time `gorm:"not null;uniqueIndex:idx_message_volume_user_hour,priority:2" json:"hour"`
+	Sent     int64     `gorm:"not null;default:0" json:"sent"`
+	Received int64     `gorm:"not null;default:0" json:"received"`
+}
+
+// MessageVolumePoint is one bucket of the message volume time series
+type MessageVolumePoint struct {
+	Timestamp time.Time `json:"timestamp"` // Start of the bucket
+	Sent      int64     `json:"sent"`
+	Received  int64     `json:"received"`
+}
+
+// DailySummary is the activity report sent each morning, covering Since to Until
+type DailySummary struct {
+	Since            time.Time `json:"since"`
+	Until            time.Time `json:"until"`
+	MessagesSent     int64     `json:"messages_sent"`
+	MessagesReceived int64     `json:"messages_received"`
+	WebhookFailures  int64     `json:"webhook_failures"` // Failed delivery attempts, retries included
+	QueueBacklog     int64     `json:"queue_backlog"`    // Messages waiting in the send queue now
+	QueueFailed      int64     `json:"queue_failed"`     // Queued messages that failed
+	// Disconnects since the previous summary, or since the server started
+	ConnectionDrops int64 `json:"connection_drops"`
+	Connected       bool  `json:"connected"`
+}
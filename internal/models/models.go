@@ -5,17 +5,79 @@ import (
 )
 
 type User struct {
-	ID           uint      `gorm:"primaryKey" json:"id"`
-	Username     string    `gorm:"unique;not null" json:"username"`
-	PasswordHash string    `gorm:"not null" json:"-"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID                 uint      `gorm:"primaryKey" json:"id"`
+	Username           string    `gorm:"unique;not null" json:"username"`
+	PasswordHash       string    `gorm:"not null" json:"-"`
+	IsAdmin            bool      `gorm:"default:false" json:"is_admin"`
+	IsActive           bool      `gorm:"default:true" json:"is_active"`             // Disabled users can't log in or use their API tokens
+	TokenVersion       uint      `gorm:"default:0" json:"-"`                        // Bumped to invalidate all issued JWTs
+	MustChangePassword bool      `gorm:"default:false" json:"must_change_password"` // Set by an admin reset; sessions can only change the password
+	AuthSource         string    `gorm:"default:local" json:"auth_source"`          // "local" or "ldap"
+	IsServiceAccount   bool      `gorm:"default:false" json:"is_service_account"`   // Owns a service-account API token; can't log in
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// Where a user's password is checked
+const (
+	AuthSourceLocal = "local"
+	AuthSourceLDAP  = "ldap" // Created on first login; the password lives in the directory
+)
+
+// MinPasswordLength is the shortest password accepted for new and changed passwords
+const MinPasswordLength = 8
+
+// ChangePasswordRequest is the body of POST /auth/change-password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// UserCreateRequest represents the request body for creating a user
+type UserCreateRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	IsAdmin  bool   `json:"is_admin"`
+}
+
+// UserUpdateRequest represents the request body for updating a user
+type UserUpdateRequest struct {
+	IsActive *bool `json:"is_active,omitempty"`
+	IsAdmin  *bool `json:"is_admin,omitempty"`
+}
+
+// UserResponse represents a user in API responses
+type UserResponse struct {
+	ID                 uint      `json:"id"`
+	Username           string    `json:"username"`
+	IsAdmin            bool      `json:"is_admin"`
+	IsActive           bool      `json:"is_active"`
+	MustChangePassword bool      `json:"must_change_password"`
+	AuthSource         string    `json:"auth_source"`
+	IsServiceAccount   bool      `json:"is_service_account"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// ToResponse converts User to UserResponse
+func (u *User) ToResponse() UserResponse {
+	return UserResponse{
+		ID:                 u.ID,
+		Username:           u.Username,
+		IsAdmin:            u.IsAdmin,
+		IsActive:           u.IsActive,
+		MustChangePassword: u.MustChangePassword,
+		AuthSource:         u.AuthSource,
+		IsServiceAccount:   u.IsServiceAccount,
+		CreatedAt:          u.CreatedAt,
+		UpdatedAt:          u.UpdatedAt,
+	}
 }
 
 type WhatsAppSession struct {
 	ID              uint       `gorm:"primaryKey" json:"id"`
 	UserID          uint       `gorm:"not null" json:"user_id"`
-	SessionData     []byte     `gorm:"type:blob" json:"-"`
+	SessionData     []byte     `json:"-"`
 	Connected       bool       `json:"connected"`
 	LastConnectedAt *time.Time `json:"last_connected_at"`
 	PhoneNumber     string     `json:"phone_number"`
@@ -23,18 +85,68 @@ type WhatsAppSession struct {
 	UpdatedAt       time.Time  `json:"updated_at"`
 }
 
+// WhatsAppDevice maps a linked WhatsApp device to the user who paired it. That user's
+// webhooks and event streams receive the device's events.
+type WhatsAppDevice struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      uint      `gorm:"not null;index" json:"user_id"`
+	JID         string    `gorm:"column:jid;uniqueIndex;not null" json:"jid"`
+	PhoneNumber string    `json:"phone_number"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
 type LoginRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
 
 type LoginResponse struct {
-	Token    string `json:"token"`
-	Username string `json:"username"`
+	Token              string `json:"token"`
+	Username           string `json:"username"`
+	IsAdmin            bool   `json:"is_admin"`
+	MustChangePassword bool   `json:"must_change_password"`
+}
+
+// PasswordResetResponse carries the one-time password generated by an admin reset
+type PasswordResetResponse struct {
+	TemporaryPassword string `json:"temporary_password"`
+}
+
+// AuthStatusResponse tells the login page whether first-run setup is needed
+type AuthStatusResponse struct {
+	UserCount     int64 `json:"user_count"`
+	SetupRequired bool  `json:"setup_required"` // No users yet; POST /auth/setup creates the first admin
 }
 
 type WhatsAppStatus struct {
 	Connected       bool   `json:"connected"`
 	PhoneNumber     string `json:"phone_number"`
 	QRCodeAvailable bool   `json:"qr_code_available"`
+	AccountID       uint   `json:"account_id,omitempty"` // Linked account, for choosing it on send
+	// Degraded is set while keepalive pings fail on an open connection
+	Degraded       bool   `json:"degraded"`
+	DegradedReason string `json:"degraded_reason,omitempty"`
+	// Sandbox is set when sends are recorded instead of sent (SANDBOX_MODE)
+	Sandbox bool `json:"sandbox,omitempty"`
+}
+
+// WhatsAppDeviceInfo describes the linked phone and account, from the device store
+type WhatsAppDeviceInfo struct {
+	AccountID    uint       `json:"account_id,omitempty"`
+	JID          string     `json:"jid"`
+	PhoneNumber  string     `json:"phone_number"`
+	Platform     string     `json:"platform"`      // Phone platform reported at pairing, e.g. "android" or "smbi"
+	PushName     string     `json:"push_name"`     // Profile name of the account
+	BusinessName string     `json:"business_name"` // Set for WhatsApp Business accounts
+	PairedAt     *time.Time `json:"paired_at,omitempty"`
+	Connected    bool       `json:"connected"`
+}
+
+// MediaAttachment is a file to send as a WhatsApp media message
+type MediaAttachment struct {
+	Data     []byte
+	MimeType string
+	Filename string
+	Caption  string
 }
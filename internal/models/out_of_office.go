@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+)
+
+// OutOfOffice is a user's out-of-office mode: while it's on, people who message the
+// user directly get an automatic reply, at most once a day each
+type OutOfOffice struct {
+	ID       uint   `gorm:"primaryKey" json:"-"`
+	UserID   uint   `gorm:"not null;uniqueIndex" json:"user_id"`
+	IsActive bool   `gorm:"not null" json:"is_active"`
+	Message  string `gorm:"type:text" json:"message"` // Go template over the message_received data
+
+	// Optional period the mode is on for; either end may be open
+	StartsAt *time.Time `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at"`
+
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"-"`
+}
+
+// OutOfOfficeReply records when a contact last got the out-of-office reply, so they get
+// it once a day rather than for every message
+type OutOfOfficeReply struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_ooo_reply_user_contact"`
+	Contact   string    `gorm:"not null;uniqueIndex:idx_ooo_reply_user_contact"` // Phone number
+	RepliedAt time.Time `gorm:"not null"`
+}
+
+// OutOfOfficeRequest changes the fields of the out-of-office mode it sets. An empty
+// starts_at or ends_at clears that end of the period.
+type OutOfOfficeRequest struct {
+	IsActive *bool   `json:"is_active"`
+	Message  *string `json:"message"`
+	StartsAt *string `json:"starts_at"` // RFC 3339
+	EndsAt   *string `json:"ends_at"`   // RFC 3339
+}
+
+// OutOfOfficeResponse is the out-of-office mode as returned by the API
+type OutOfOfficeResponse struct {
+	OutOfOffice
+	// Whether replies are being sent now: the mode is on and now is within its period
+	ActiveNow bool `json:"active_now"`
+}
+
+// ActiveAt reports whether the mode is on and t is within its period
+func (o *OutOfOffice) ActiveAt(t time.Time) bool {
+	if !o.IsActive {
+		return false
+	}
+	if o.StartsAt != nil && t.Before(*o.StartsAt) {
+		return false
+	}
+	return o.EndsAt == nil || t.Before(*o.EndsAt)
+}
+
+// ToResponse converts the mode to its API form
+func (o *OutOfOffice) ToResponse() OutOfOfficeResponse {
+	return OutOfOfficeResponse{
+		OutOfOffice: *o,
+		ActiveNow:   o.ActiveAt(time.Now()),
+	}
+}
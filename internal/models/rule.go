@@ -0,0 +1,165 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Actions of auto-responder rules
+const (
+	RuleActionReply   = "reply"   // Reply in the chat with a template
+	RuleActionTag     = "tag"     // Add a tag to the message_received event
+	RuleActionForward = "forward" // Deliver the message to one of the user's webhooks
+	RuleActionBlock   = "block"   // Drop the message: later rules and webhooks don't see it; outgoing, don't send it
+	RuleActionAppend  = "append"  // Outgoing: add text to the end of the message
+	RuleActionRedact  = "redact"  // Outgoing: replace matches of a pattern, or card numbers
+)
+
+// Directions of rules
+const (
+	RuleDirectionIncoming = "incoming" // Received messages
+	RuleDirectionOutgoing = "outgoing" // Messages about to be sent, from any source
+)
+
+// RedactPresetCardNumbers redacts payment card numbers (13 to 19 digits that pass the
+// Luhn check, optionally grouped with spaces or dashes)
+const RedactPresetCardNumbers = "card_numbers"
+
+// Rule is an auto-responder rule: its actions run on each received message that meets
+// all its conditions, or with direction outgoing, on each message about to be sent.
+// Conditions left empty match every message.
+type Rule struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	UserID      uint   `gorm:"not null;index" json:"user_id"`
+	Name        string `gorm:"not null" json:"name"`
+	Description string `json:"description"`
+	IsActive    bool   `gorm:"not null" json:"is_active"`
+	Position    int    `gorm:"not null" json:"position"` // Rules are evaluated lowest first
+	// Skip the later rules when this one matches
+	StopProcessing bool `gorm:"not null" json:"stop_processing"`
+	// "incoming" or "outgoing"
+	Direction string `gorm:"not null;default:'incoming'" json:"direction"`
+
+	// Conditions
+	ChatType string `json:"chat_type"`                // "all", "individual" or "group"
+	Senders  string `gorm:"type:text" json:"-"`       // Comma-separated phone numbers; the recipients of outgoing rules
+	Groups   string `gorm:"type:text" json:"-"`       // Comma-separated group JIDs
+	Keywords string `gorm:"type:text" json:"-"`       // Comma-separated; any one matches, ignoring case
+	Pattern  string `gorm:"type:text" json:"pattern"` // Regular expression over the message text
+	// Time window, HH:MM in Timezone (the server's when empty). A window that ends
+	// before it starts spans midnight.
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+	Days      string `json:"-"` // Comma-separated mon...sun
+	Timezone  string `json:"timezone"`
+
+	// JSON list of RuleAction, run in order
+	Actions string `gorm:"type:text;not null" json:"-"`
+
+	MatchCount    int64      `gorm:"not null;default:0" json:"match_count"`
+	LastMatchedAt *time.Time `json:"last_matched_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// RuleAction is something a rule does with a matching message
+type RuleAction struct {
+	Type      string `json:"type"`                 // reply, tag, forward, block, append or redact
+	Template  string `json:"template,omitempty"`   // reply: Go template over the message_received data
+	Tag       string `json:"tag,omitempty"`        // tag
+	WebhookID uint   `json:"webhook_id,omitempty"` // forward
+	Reason    string `json:"reason,omitempty"`     // block, outgoing: why the message wasn't sent
+	Text      string `json:"text,omitempty"`       // append
+
+	// redact: a regular expression, or a preset such as RedactPresetCardNumbers, and
+	// what matches are replaced with
+	Pattern     string `json:"pattern,omitempty"`
+	Preset      string `json:"preset,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// RuleRequest creates a rule, or updates the fields it sets
+type RuleRequest struct {
+	Name           string        `json:"name"`
+	Description    *string       `json:"description"`
+	IsActive       *bool         `json:"is_active"`
+	Position       *int          `json:"position"`
+	StopProcessing *bool         `json:"stop_processing"`
+	Direction      *string       `json:"direction"`
+	ChatType       *string       `json:"chat_type"`
+	Senders        *[]string     `json:"senders"`
+	Groups         *[]string     `json:"groups"`
+	Keywords       *[]string     `json:"keywords"`
+	Pattern        *string       `json:"pattern"`
+	StartTime      *string       `json:"start_time"`
+	EndTime        *string       `json:"end_time"`
+	Days           *[]string     `json:"days"`
+	Timezone       *string       `json:"timezone"`
+	Actions        *[]RuleAction `json:"actions"`
+}
+
+// RuleResponse is a rule as returned by the API
+type RuleResponse struct {
+	Rule
+	Senders  []string     `json:"senders"`
+	Groups   []string     `json:"groups"`
+	Keywords []string     `json:"keywords"`
+	Days     []string     `json:"days"`
+	Actions  []RuleAction `json:"actions"`
+}
+
+// splitList splits a comma-separated column into its entries
+func splitList(value string) []string {
+	if value == "" {
+		return []string{}
+	}
+	return strings.Split(value, ",")
+}
+
+// GetSenders returns the phone numbers the rule is limited to
+func (r *Rule) GetSenders() []string {
+	return splitList(r.Senders)
+}
+
+// GetGroups returns the group JIDs the rule is limited to
+func (r *Rule) GetGroups() []string {
+	return splitList(r.Groups)
+}
+
+// GetKeywords returns the rule's keywords
+func (r *Rule) GetKeywords() []string {
+	return splitList(r.Keywords)
+}
+
+// GetDays returns the weekdays of the rule's time window
+func (r *Rule) GetDays() []string {
+	return splitList(r.Days)
+}
+
+// GetActions returns the rule's actions, in order
+func (r *Rule) GetActions() []RuleAction {
+	actions := []RuleAction{}
+	if r.Actions != "" {
+		json.Unmarshal([]byte(r.Actions), &actions)
+	}
+	return actions
+}
+
+// SetActions sets the rule's actions
+func (r *Rule) SetActions(actions []RuleAction) {
+	data, _ := json.Marshal(actions)
+	r.Actions = string(data)
+}
+
+// ToResponse converts a rule to its API form
+func (r *Rule) ToResponse() RuleResponse {
+	return RuleResponse{
+		Rule:     *r,
+		Senders:  r.GetSenders(),
+		Groups:   r.GetGroups(),
+		Keywords: r.GetKeywords(),
+		Days:     r.GetDays(),
+		Actions:  r.GetActions(),
+	}
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Statuses of messages in the send queue
+const (
+	SendStatusQueued  = "queued"
+	SendStatusSending = "sending"
+	SendStatusSent    = "sent"
+	SendStatusFailed  = "failed"
+	// Vetoed by a send hook, such as an outgoing rule, so never sent
+	SendStatusBlocked = "blocked"
+	// Set from the recipient's receipts after sending
+	SendStatusDelivered = "delivered"
+	SendStatusRead      = "read"
+)
+
+// Priorities of messages in the send queue. When sends are throttled, higher priority
+// messages go first, e.g. one-time codes ahead of a campaign.
+const (
+	SendPriorityHigh   = "high"
+	SendPriorityNormal = "normal"
+	SendPriorityLow    = "low"
+)
+
+// NormalizeSendPriority returns the priority, normal when empty, and whether it's valid
+func NormalizeSendPriority(priority string) (string, bool) {
+	switch priority = strings.ToLower(strings.TrimSpace(priority)); priority {
+	case "":
+		return SendPriorityNormal, true
+	case SendPriorityHigh, SendPriorityNormal, SendPriorityLow:
+		return priority, true
+	}
+	return priority, false
+}
+
+// SendJob groups the messages of one bulk send
+type SendJob struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OutgoingMessage is a message sent through the send queue, which paces sends so bulk
+// sends don't trip WhatsApp's spam detection
+type OutgoingMessage struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	UserID      uint   `gorm:"not null;index" json:"-"`
+	JobID       *uint  `gorm:"index" json:"job_id,omitempty"`
+	PhoneNumber string `gorm:"not null" json:"phone_number"`
+	Message     string `gorm:"type:text;not null" json:"-"`
+	Source      string `gorm:"not null" json:"-"`                         // MessageSource of the message_sent event
+	Priority    string `gorm:"not null;default:'normal'" json:"priority"` // high, normal or low
+	// queued, sending, sent, delivered, read, failed or blocked
+	Status            string     `gorm:"not null;index" json:"status"`
+	Error             string     `json:"error,omitempty"`
+	WhatsAppMessageID string     `gorm:"column:whatsapp_message_id;index" json:"message_id,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	SentAt            *time.Time `json:"sent_at,omitempty"`
+	// Sent with a test-mode API token: simulated, never sent to WhatsApp
+	TestMode bool `gorm:"default:false" json:"test_mode,omitempty"`
+
+	// Media messages carry an attachment, with Message as its caption. The attachment
+	// is dropped once the message is sent or has failed.
+	MediaData     []byte `json:"-"`
+	MediaMimeType string `json:"media_mime_type,omitempty"`
+	MediaFilename string `json:"media_filename,omitempty"`
+}
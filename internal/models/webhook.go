@@ -1,7 +1,21 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/url"
 	"time"
+
+	"gorm.io/gorm"
+)
+
+// Webhook target types
+const (
+	TargetTypeHTTP  = "http"
+	TargetTypeKafka = "kafka"
+	TargetTypeNATS  = "nats"
+	TargetTypeMQTT  = "mqtt"
+	TargetTypeRedis = "redis"
 )
 
 // Webhook represents a user's webhook configuration
@@ -22,12 +36,115 @@ type Webhook struct {
 	FilterChatType       string `gorm:"default:'all'" json:"filter_chat_type"`              // "all", "individual", "group"
 	FilterGroupJIDs      string `gorm:"type:text" json:"filter_group_jids"`                 // Comma-separated group JIDs
 	FilterGroupNames     string `gorm:"type:text" json:"filter_group_names"`                // Comma-separated group names
+
+	// Optional Go template that reshapes the standard payload (e.g. into Slack's {"text": ...})
+	PayloadTemplate string `gorm:"type:text" json:"payload_template"`
+
+	// Maximum deliveries per minute; excess events wait in the queue (0 = unlimited)
+	RateLimitPerMinute int `gorm:"default:0" json:"rate_limit_per_minute"`
+
+	// Optional TLS settings for receivers behind mutual TLS or a private CA (PEM encoded)
+	TLSCACert     string `gorm:"type:text" json:"tls_ca_cert"`
+	TLSClientCert string `gorm:"type:text" json:"tls_client_cert"`
+	TLSClientKey  string `gorm:"type:text" json:"-"`
+
+	// Optional outbound proxy for HTTP deliveries (http://, https:// or socks5:// URL).
+	// Empty uses the global WEBHOOK_PROXY_URL; "direct" bypasses any proxy.
+	ProxyURL string `gorm:"type:text" json:"-"`
+
+	// Send large payloads with Content-Encoding: gzip (for receivers that accept it)
+	CompressPayloads bool `gorm:"default:false" json:"compress_payloads"`
+
+	// Skip an event when another of the user's webhooks already delivers it to the same
+	// URL (or broker target), e.g. for several webhooks feeding one aggregator
+	CollapseDuplicates bool `gorm:"default:false" json:"collapse_duplicates"`
+
+	// Optional JWS authentication: each delivery carries a short-lived JWT in the
+	// Authorization header, signed with an HMAC secret (HS256) or a PEM private key (RS256, ES256)
+	AuthJWTAlgorithm string `json:"auth_jwt_algorithm"`
+	AuthJWTKey       string `gorm:"type:text" json:"-"`
+	AuthJWTAudience  string `json:"auth_jwt_audience"` // Defaults to the webhook URL
+
+	// Where deliveries go. Non-HTTP targets keep their connection settings (including
+	// credentials) as JSON in TargetConfig, and URL holds a display form of the target.
+	TargetType   string `gorm:"not null;default:'http'" json:"target_type"`
+	TargetConfig string `gorm:"type:text" json:"-"`
+
+	// Round-trip bot mode: a {"reply": ...} response to a message_received delivery is
+	// sent back to the chat the message came from
+	ReplyEnabled bool `gorm:"default:false" json:"reply_enabled"`
+
+	// Test mode: deliveries are marked as test ("test": true and X-Webhook-Test), also
+	// get the events of test-mode API tokens, and replies are simulated rather than sent
+	TestMode bool `gorm:"default:false" json:"test_mode"`
+
+	// Payload version the webhook is pinned to; see PayloadVersion1 and PayloadVersion2
+	PayloadVersion int `gorm:"not null;default:1" json:"payload_version"`
+
+	// Failed deliveries are abandoned after MaxRetries retries, or once they're older
+	// than MaxDeliveryAge seconds (0 = no limit). Unset, WEBHOOK_MAX_RETRIES and
+	// WEBHOOK_MAX_DELIVERY_AGE apply.
+	MaxRetries     *int `json:"max_retries"`
+	MaxDeliveryAge *int `json:"max_delivery_age"`
+
+	// Health tracking
+	ConsecutiveFailures int        `gorm:"default:0" json:"consecutive_failures"`
+	DisabledReason      string     `json:"disabled_reason,omitempty"` // Set when the webhook was disabled automatically
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+
+	// Set while the webhook is in the trash. Trashed webhooks get no events, and are
+	// deleted for good with their delivery history after WEBHOOK_TRASH_RETENTION.
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// KafkaTargetConfig configures a "kafka" webhook target
+type KafkaTargetConfig struct {
+	Brokers       []string `json:"brokers"`
+	Topic         string   `json:"topic"`
+	Username      string   `json:"username,omitempty"`
+	Password      string   `json:"password,omitempty"`
+	SASLMechanism string   `json:"sasl_mechanism,omitempty"` // "plain", "scram-sha-256" or "scram-sha-512"
+	TLS           bool     `json:"tls,omitempty"`
+}
+
+// NATSTargetConfig configures a "nats" webhook target
+type NATSTargetConfig struct {
+	Servers   []string `json:"servers"` // e.g. nats://nats-1:4222
+	Subject   string   `json:"subject"` // May contain placeholders, e.g. pinglater.{event}.{phone}
+	Username  string   `json:"username,omitempty"`
+	Password  string   `json:"password,omitempty"`
+	Token     string   `json:"token,omitempty"`
+	TLS       bool     `json:"tls,omitempty"`
+	JetStream bool     `json:"jetstream,omitempty"` // Publish with JetStream acknowledgements
+}
+
+// MQTTTargetConfig configures an "mqtt" webhook target
+type MQTTTargetConfig struct {
+	Broker   string `json:"broker"` // tcp://host:1883 or ssl://host:8883
+	Topic    string `json:"topic"`  // May contain placeholders, e.g. pinglater/{event}/{phone}
+	QoS      int    `json:"qos"`    // 0, 1 or 2
+	Retain   bool   `json:"retain,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	ClientID string `json:"client_id,omitempty"` // Defaults to a random pinglater-<hex> ID
+}
+
+// RedisTargetConfig configures a "redis" webhook target
+type RedisTargetConfig struct {
+	Addr     string `json:"addr"` // host:port
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	DB       int    `json:"db,omitempty"`
+	TLS      bool   `json:"tls,omitempty"`
+	Mode     string `json:"mode,omitempty"`    // "publish" (default) or "stream"
+	Channel  string `json:"channel"`           // Channel or stream key, may contain placeholders
+	MaxLen   int64  `json:"max_len,omitempty"` // Approximate stream length cap in stream mode (0 = unbounded)
 }
 
 // WebhookDelivery logs each webhook delivery attempt
 type WebhookDelivery struct {
 	ID             uint       `gorm:"primaryKey" json:"id"`
-	WebhookID      uint       `gorm:"not null;index" json:"webhook_id"`
+	WebhookID      uint       `gorm:"not null;index;index:idx_delivery_webhook_created,priority:1" json:"webhook_id"`
 	EventType      string     `gorm:"not null" json:"event_type"`
 	Payload        string     `gorm:"type:text" json:"payload"`
 	ResponseStatus int        `json:"response_status"`
@@ -36,7 +153,45 @@ type WebhookDelivery struct {
 	ErrorMessage   string     `json:"error_message,omitempty"`
 	RetryCount     int        `gorm:"default:0" json:"retry_count"`
 	NextRetryAt    *time.Time `json:"next_retry_at,omitempty"`
-	CreatedAt      time.Time  `json:"created_at"`
+	DurationMs     int64      `gorm:"default:0" json:"duration_ms"` // Duration of the latest attempt
+	ReplyTo        string     `json:"reply_to,omitempty"`           // Chat JID a reply is sent to (reply mode only)
+	DeliveryID     string     `gorm:"index" json:"delivery_id"`     // Sent as X-Delivery-Id; the same for every retry
+	CreatedAt      time.Time  `gorm:"index:idx_delivery_webhook_created,priority:2" json:"created_at"`
+
+	// Why a failed delivery is no longer retried: AbandonedMaxRetries or AbandonedMaxAge
+	AbandonedReason string `json:"abandoned_reason,omitempty"`
+}
+
+// Reasons failed deliveries are abandoned
+const (
+	AbandonedMaxRetries = "max_retries" // Retried as many times as allowed
+	AbandonedMaxAge     = "max_age"     // Older than the maximum delivery age
+)
+
+// MaxWebhookRetries is the highest retry ceiling a webhook may have
+const MaxWebhookRetries = 20
+
+// Outbox statuses for queued webhook deliveries
+const (
+	OutboxStatusPending    = "pending"
+	OutboxStatusProcessing = "processing"
+)
+
+// WebhookOutbox holds a webhook delivery that has been accepted but not yet attempted.
+// Rows are written before any HTTP call is made and claimed transactionally by workers,
+// so a crash between triggering and delivering doesn't lose the event.
+type WebhookOutbox struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	WebhookID   uint       `gorm:"not null;index" json:"webhook_id"`
+	EventType   string     `gorm:"not null" json:"event_type"`
+	Payload     string     `gorm:"type:text" json:"payload"`
+	Status      string     `gorm:"not null;default:'pending';index" json:"status"`
+	ClaimedAt   *time.Time `json:"claimed_at,omitempty"`
+	ClaimedBy   string     `json:"claimed_by,omitempty"`   // Name of the instance that claimed it
+	AvailableAt *time.Time `json:"available_at,omitempty"` // Not claimable before this time (e.g. rate limited)
+	ReplyTo     string     `json:"reply_to,omitempty"`     // Chat JID a reply is sent to (reply mode only)
+	DeliveryID  string     `json:"delivery_id"`            // Carried over to the delivery record
+	CreatedAt   time.Time  `json:"created_at"`
 }
 
 // Available event types for webhooks
@@ -45,6 +200,20 @@ var AvailableWebhookEvents = []WebhookEventType{
 	{Type: "message_sent", Description: "Triggered when a message is sent"},
 	{Type: "connected", Description: "Triggered when WhatsApp connects"},
 	{Type: "disconnected", Description: "Triggered when WhatsApp disconnects"},
+	{Type: "reconnect_failed", Description: "Triggered when automatic reconnection gives up after the maximum number of attempts"},
+	{Type: "connection_degraded", Description: "Triggered when keepalive pings to WhatsApp start failing on an open connection"},
+	{Type: "connection_restored", Description: "Triggered when a degraded connection is healthy again"},
+	{Type: "stream_error", Description: "Triggered when WhatsApp closes or refuses the connection with an error, e.g. another client took over the session"},
+	{Type: "temporary_ban", Description: "Triggered when WhatsApp temporarily bans the account"},
+	{Type: "rate_limited", Description: "Triggered when WhatsApp rejects a send because messages are sent too fast"},
+	{Type: "update_available", Description: "Triggered when a newer PingLater release is published"},
+	{Type: "webhook_disabled", Description: "Triggered when a webhook is automatically disabled after repeated failures"},
+	{Type: "login_lockout", Description: "Triggered when a client IP or username is locked out after repeated failed logins"},
+	{Type: "message_delivered", Description: "Triggered when a sent message is delivered to the recipient's device"},
+	{Type: "message_read", Description: "Triggered when a sent message is read by the recipient"},
+	{Type: "group_participant_changed", Description: "Triggered when members join, leave, or are promoted or demoted in a group"},
+	{Type: "call_received", Description: "Triggered when an incoming voice or video call is received"},
+	{Type: "daily_summary", Description: "Triggered each morning with the daily summary report, when DAILY_SUMMARY_TIME is set"},
 }
 
 type WebhookEventType struct {
@@ -54,14 +223,17 @@ type WebhookEventType struct {
 
 // WebhookPayload represents the structure of webhook notifications
 type WebhookPayload struct {
-	WebhookID string      `json:"webhook_id"`
-	Event     string      `json:"event"`
-	Timestamp time.Time   `json:"timestamp"`
-	Data      interface{} `json:"data"`
+	PayloadVersion int         `json:"payload_version"` // Always 1; see WebhookPayloadV2
+	WebhookID      string      `json:"webhook_id"`
+	Event          string      `json:"event"`
+	Timestamp      time.Time   `json:"timestamp"`
+	Test           bool        `json:"test,omitempty"` // Sent to a test-mode webhook
+	Data           interface{} `json:"data"`
 }
 
 // MessageReceivedData represents the data for message_received events
 type MessageReceivedData struct {
+	Chat      string `json:"chat"` // JID of the chat the message was received in
 	From      string `json:"from"`
 	FromPhone string `json:"from_phone"`
 	FromName  string `json:"from_name,omitempty"`
@@ -70,21 +242,197 @@ type MessageReceivedData struct {
 	IsGroup   bool   `json:"is_group"`
 	GroupName string `json:"group_name,omitempty"`
 	Timestamp int64  `json:"timestamp"`
+	IsFromMe  bool   `json:"is_from_me"`
+
+	// Tags added by auto-responder rules
+	Tags []string `json:"tags,omitempty"`
+
+	// The sender's JID, the kind of message, and a media message's caption and
+	// attachment, in version 2 webhook payloads only
+	SenderJID string        `json:"-"`
+	Type      string        `json:"-"`
+	Caption   string        `json:"-"`
+	Media     *MessageMedia `json:"-"`
+}
+
+// MessageReceiptData represents the data for message_delivered and message_read events
+type MessageReceiptData struct {
+	Chat       string   `json:"chat"`
+	From       string   `json:"from"` // User whose device sent the receipt
+	FromPhone  string   `json:"from_phone"`
+	MessageIDs []string `json:"message_ids"`
+	IsGroup    bool     `json:"is_group"`
+	Timestamp  int64    `json:"timestamp"`
+
+	SenderJID string `json:"-"` // In version 2 webhook payloads only
+}
+
+// Actions in group_participant_changed events
+const (
+	GroupActionJoin    = "join"
+	GroupActionLeave   = "leave"
+	GroupActionPromote = "promote"
+	GroupActionDemote  = "demote"
+)
+
+// GroupParticipantChangedData represents the data for group_participant_changed events
+type GroupParticipantChangedData struct {
+	Group        string   `json:"group"` // Group JID
+	GroupName    string   `json:"group_name,omitempty"`
+	Action       string   `json:"action"` // "join", "leave", "promote" or "demote"
+	Participants []string `json:"participants"`
+	By           string   `json:"by,omitempty"` // User who made the change, if known
+	ByPhone      string   `json:"by_phone,omitempty"`
+	Reason       string   `json:"reason,omitempty"` // e.g. "invite" for joins via invite link
+	Timestamp    int64    `json:"timestamp"`
+}
+
+// CallReceivedData represents the data for call_received events
+type CallReceivedData struct {
+	CallID    string `json:"call_id"`
+	From      string `json:"from"`
+	FromPhone string `json:"from_phone"`
+	IsVideo   bool   `json:"is_video"`
+	IsGroup   bool   `json:"is_group"`
+	Group     string `json:"group,omitempty"` // Group JID for group calls
+	Timestamp int64  `json:"timestamp"`
+}
+
+// Sources of message_sent events
+const (
+	MessageSourceAPI            = "api"
+	MessageSourceBulk           = "bulk"
+	MessageSourceAlertmanager   = "alertmanager"
+	MessageSourceGrafana        = "grafana"
+	MessageSourceInboundWebhook = "inbound_webhook"
+	MessageSourceEmail          = "email"
+	MessageSourceWebhookReply   = "webhook_reply"
+	MessageSourceTwilio         = "twilio"
+	MessageSourceRule           = "rule"
+	MessageSourceCommand        = "command"
+	MessageSourceOutOfOffice    = "out_of_office"
+	MessageSourceCampaign       = "campaign"
+	MessageSourceDailySummary   = "daily_summary"
+)
+
+// MessageSentData represents the data for message_sent events
+type MessageSentData struct {
+	To        string `json:"to"`                 // Recipient JID
+	ToPhone   string `json:"to_phone,omitempty"` // Empty for group chats
+	Content   string `json:"content"`
+	MessageID string `json:"message_id"`
+	Source    string `json:"source"` // "api" or "webhook_reply"
+	Timestamp int64  `json:"timestamp"`
+}
+
+// ConnectionEventData represents the data for connected and disconnected events
+type ConnectionEventData struct {
+	PhoneNumber string `json:"phone_number,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+	Details     string `json:"details,omitempty"`
+	Timestamp   int64  `json:"timestamp"`
+}
+
+// Guidance codes in WhatsAppErrorData, telling what to do about an error
+const (
+	GuidanceStopSending       = "stop_sending"        // Pause all sending until the ban expires
+	GuidanceSlowDown          = "slow_down"           // Send less often; retrying right away makes it worse
+	GuidanceRetryLater        = "retry_later"         // WhatsApp-side problem; the client retries with backoff
+	GuidanceReconnect         = "reconnect"           // The connection dropped; the client reconnects
+	GuidanceCloseOtherSession = "close_other_session" // Another instance uses the session; stop it, then reconnect
+	GuidanceUpdateClient      = "update_client"       // WhatsApp rejected this client version; update PingLater
+)
+
+// WhatsAppErrorData represents the data for stream_error, temporary_ban and
+// rate_limited events
+type WhatsAppErrorData struct {
+	PhoneNumber string `json:"phone_number,omitempty"`
+	Code        string `json:"code"` // WhatsApp's error or ban reason code
+	Reason      string `json:"reason"`
+	Guidance    string `json:"guidance"`
+	ExpiresAt   int64  `json:"expires_at,omitempty"` // When a temporary ban ends (Unix seconds), if known
+	Timestamp   int64  `json:"timestamp"`
+}
+
+// WebhookReply is the response body a reply-mode webhook returns to answer a message
+type WebhookReply struct {
+	Reply string             `json:"reply"`
+	Media *WebhookReplyMedia `json:"media,omitempty"`
+}
+
+// WebhookReplyMedia is an attachment in a webhook reply, given inline as base64 or as a URL
+type WebhookReplyMedia struct {
+	URL      string `json:"url,omitempty"`
+	Data     string `json:"data,omitempty"` // Base64 encoded
+	MimeType string `json:"mime_type,omitempty"`
+	Filename string `json:"filename,omitempty"`
+}
+
+// WebhookHealth summarizes the recent delivery health of a webhook
+type WebhookHealth struct {
+	WebhookID           uint       `json:"webhook_id"`
+	URL                 string     `json:"url"`
+	IsActive            bool       `json:"is_active"`
+	Deliveries1h        int64      `json:"deliveries_1h"`
+	SuccessRate1h       *float64   `json:"success_rate_1h"` // nil when there were no deliveries
+	Deliveries24h       int64      `json:"deliveries_24h"`
+	SuccessRate24h      *float64   `json:"success_rate_24h"`
+	AvgLatencyMs        *float64   `json:"avg_latency_ms"` // Over the last 24h
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastErrorAt         *time.Time `json:"last_error_at,omitempty"`
+	DisabledReason      string     `json:"disabled_reason,omitempty"`
+}
+
+// WebhookDisabledData represents the data for webhook_disabled events
+type WebhookDisabledData struct {
+	WebhookID           uint      `json:"webhook_id"`
+	URL                 string    `json:"url"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastError           string    `json:"last_error"`
+	DisabledAt          time.Time `json:"disabled_at"`
+}
+
+// LoginLockoutData represents the data for login_lockout events
+type LoginLockoutData struct {
+	Scope       string    `json:"scope"` // "ip" or "username"
+	Username    string    `json:"username"`
+	IPAddress   string    `json:"ip_address"`
+	Failures    int       `json:"failures"`
+	LockedUntil time.Time `json:"locked_until"`
 }
 
 // WebhookCreateRequest represents the request body for creating a webhook
 type WebhookCreateRequest struct {
-	URL         string   `json:"url" binding:"required,url"`
+	URL         string   `json:"url" binding:"omitempty,url"` // Required for HTTP targets
 	Secret      string   `json:"secret,omitempty"`
 	Description string   `json:"description,omitempty"`
 	EventTypes  []string `json:"event_types" binding:"required"`
 	IsActive    bool     `json:"is_active"`
 	// Filter fields
-	FilterPhoneNumbers   []string `json:"filter_phone_numbers,omitempty"`
-	FilterPhoneMatchType string   `json:"filter_phone_match_type,omitempty"`
-	FilterChatType       string   `json:"filter_chat_type,omitempty"`
-	FilterGroupJIDs      []string `json:"filter_group_jids,omitempty"`
-	FilterGroupNames     []string `json:"filter_group_names,omitempty"`
+	FilterPhoneNumbers   []string        `json:"filter_phone_numbers,omitempty"`
+	FilterPhoneMatchType string          `json:"filter_phone_match_type,omitempty"`
+	FilterChatType       string          `json:"filter_chat_type,omitempty"`
+	FilterGroupJIDs      []string        `json:"filter_group_jids,omitempty"`
+	FilterGroupNames     []string        `json:"filter_group_names,omitempty"`
+	PayloadTemplate      string          `json:"payload_template,omitempty"`
+	RateLimitPerMinute   int             `json:"rate_limit_per_minute,omitempty"`
+	TLSCACert            string          `json:"tls_ca_cert,omitempty"`
+	TLSClientCert        string          `json:"tls_client_cert,omitempty"`
+	TLSClientKey         string          `json:"tls_client_key,omitempty"`
+	ProxyURL             string          `json:"proxy_url,omitempty"`
+	CompressPayloads     bool            `json:"compress_payloads,omitempty"`
+	CollapseDuplicates   bool            `json:"collapse_duplicates,omitempty"`
+	TargetType           string          `json:"target_type,omitempty"` // Defaults to "http"
+	TargetConfig         json.RawMessage `json:"target_config,omitempty"`
+	ReplyEnabled         bool            `json:"reply_enabled,omitempty"`
+	TestMode             bool            `json:"test_mode,omitempty"`
+	PayloadVersion       int             `json:"payload_version,omitempty"`  // Defaults to 1
+	MaxRetries           *int            `json:"max_retries,omitempty"`      // Negative or unset uses WEBHOOK_MAX_RETRIES
+	MaxDeliveryAge       *int            `json:"max_delivery_age,omitempty"` // Seconds, 0 = no limit; negative or unset uses WEBHOOK_MAX_DELIVERY_AGE
+	AuthJWTAlgorithm     string          `json:"auth_jwt_algorithm,omitempty"`
+	AuthJWTKey           string          `json:"auth_jwt_key,omitempty"`
+	AuthJWTAudience      string          `json:"auth_jwt_audience,omitempty"`
 }
 
 // WebhookUpdateRequest represents the request body for updating a webhook
@@ -95,11 +443,59 @@ type WebhookUpdateRequest struct {
 	EventTypes  []string `json:"event_types,omitempty"`
 	IsActive    *bool    `json:"is_active,omitempty"`
 	// Filter fields
-	FilterPhoneNumbers   []string `json:"filter_phone_numbers,omitempty"`
-	FilterPhoneMatchType string   `json:"filter_phone_match_type,omitempty"`
-	FilterChatType       string   `json:"filter_chat_type,omitempty"`
-	FilterGroupJIDs      []string `json:"filter_group_jids,omitempty"`
-	FilterGroupNames     []string `json:"filter_group_names,omitempty"`
+	FilterPhoneNumbers   []string        `json:"filter_phone_numbers,omitempty"`
+	FilterPhoneMatchType string          `json:"filter_phone_match_type,omitempty"`
+	FilterChatType       string          `json:"filter_chat_type,omitempty"`
+	FilterGroupJIDs      []string        `json:"filter_group_jids,omitempty"`
+	FilterGroupNames     []string        `json:"filter_group_names,omitempty"`
+	PayloadTemplate      *string         `json:"payload_template,omitempty"` // Empty string clears the template
+	RateLimitPerMinute   *int            `json:"rate_limit_per_minute,omitempty"`
+	TLSCACert            *string         `json:"tls_ca_cert,omitempty"`
+	TLSClientCert        *string         `json:"tls_client_cert,omitempty"`
+	TLSClientKey         *string         `json:"tls_client_key,omitempty"`
+	ProxyURL             *string         `json:"proxy_url,omitempty"` // Empty string restores the global proxy
+	CompressPayloads     *bool           `json:"compress_payloads,omitempty"`
+	CollapseDuplicates   *bool           `json:"collapse_duplicates,omitempty"`
+	TargetType           string          `json:"target_type,omitempty"`
+	TargetConfig         json.RawMessage `json:"target_config,omitempty"` // Replaces the whole config, credentials included
+	ReplyEnabled         *bool           `json:"reply_enabled,omitempty"`
+	TestMode             *bool           `json:"test_mode,omitempty"`
+	PayloadVersion       *int            `json:"payload_version,omitempty"`
+	MaxRetries           *int            `json:"max_retries,omitempty"`        // Negative restores WEBHOOK_MAX_RETRIES
+	MaxDeliveryAge       *int            `json:"max_delivery_age,omitempty"`   // Negative restores WEBHOOK_MAX_DELIVERY_AGE
+	AuthJWTAlgorithm     *string         `json:"auth_jwt_algorithm,omitempty"` // Empty string disables JWT authentication
+	AuthJWTKey           *string         `json:"auth_jwt_key,omitempty"`
+	AuthJWTAudience      *string         `json:"auth_jwt_audience,omitempty"`
+}
+
+// WebhookTestRequest represents the optional request body for testing a webhook
+type WebhookTestRequest struct {
+	EventType string `json:"event_type,omitempty"` // Send a sample of this event instead of the generic test payload
+	Replay    bool   `json:"replay,omitempty"`     // Resend the latest real delivery (of event_type, if given)
+}
+
+// Outcomes of a webhook filter check
+const (
+	FilterCheckPassed  = "passed"
+	FilterCheckFailed  = "failed"
+	FilterCheckSkipped = "skipped" // The filter isn't set or doesn't apply to the event
+)
+
+// WebhookFilterCheck is the outcome of one of a webhook's filters for an event
+type WebhookFilterCheck struct {
+	Filter string `json:"filter"` // "chat_type", "phone_numbers", "group_jids" or "group_names"
+	Result string `json:"result"` // "passed", "failed" or "skipped"
+	Reason string `json:"reason"`
+}
+
+// WebhookFilterTestResponse reports whether a sample message_received event would
+// match a webhook's filters, and why
+type WebhookFilterTestResponse struct {
+	Matches      bool                 `json:"matches"`       // All filters passed or were skipped
+	WouldDeliver bool                 `json:"would_deliver"` // Matches, and nothing else stops delivery
+	Checks       []WebhookFilterCheck `json:"checks"`
+	// Why the event wouldn't be delivered even if it matches, e.g. an inactive webhook
+	Blockers []string `json:"blockers,omitempty"`
 }
 
 // WebhookResponse represents a webhook in API responses
@@ -112,28 +508,81 @@ type WebhookResponse struct {
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	// Filter fields
-	FilterPhoneNumbers   []string `json:"filter_phone_numbers"`
-	FilterPhoneMatchType string   `json:"filter_phone_match_type"`
-	FilterChatType       string   `json:"filter_chat_type"`
-	FilterGroupJIDs      []string `json:"filter_group_jids"`
-	FilterGroupNames     []string `json:"filter_group_names"`
+	FilterPhoneNumbers   []string               `json:"filter_phone_numbers"`
+	FilterPhoneMatchType string                 `json:"filter_phone_match_type"`
+	FilterChatType       string                 `json:"filter_chat_type"`
+	FilterGroupJIDs      []string               `json:"filter_group_jids"`
+	FilterGroupNames     []string               `json:"filter_group_names"`
+	PayloadTemplate      string                 `json:"payload_template"`
+	RateLimitPerMinute   int                    `json:"rate_limit_per_minute"`
+	TLSCACert            string                 `json:"tls_ca_cert,omitempty"`
+	TLSClientCert        string                 `json:"tls_client_cert,omitempty"`
+	HasTLSClientKey      bool                   `json:"has_tls_client_key"`
+	ProxyURL             string                 `json:"proxy_url,omitempty"` // Password is masked
+	CompressPayloads     bool                   `json:"compress_payloads"`
+	CollapseDuplicates   bool                   `json:"collapse_duplicates"`
+	TargetType           string                 `json:"target_type"`
+	TargetConfig         map[string]interface{} `json:"target_config,omitempty"` // Credentials are omitted
+	ReplyEnabled         bool                   `json:"reply_enabled"`
+	TestMode             bool                   `json:"test_mode"`
+	PayloadVersion       int                    `json:"payload_version"`
+	MaxRetries           *int                   `json:"max_retries"`      // null when WEBHOOK_MAX_RETRIES applies
+	MaxDeliveryAge       *int                   `json:"max_delivery_age"` // null when WEBHOOK_MAX_DELIVERY_AGE applies
+	AuthJWTAlgorithm     string                 `json:"auth_jwt_algorithm,omitempty"`
+	AuthJWTAudience      string                 `json:"auth_jwt_audience,omitempty"`
+	HasAuthJWTKey        bool                   `json:"has_auth_jwt_key"`
+	// Health fields
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	DisabledReason      string     `json:"disabled_reason,omitempty"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+	DeletedAt           *time.Time `json:"deleted_at,omitempty"` // Only for webhooks in the trash
 }
 
 // WebhookDeliveryResponse represents a delivery log entry
 type WebhookDeliveryResponse struct {
 	ID             uint       `json:"id"`
+	DeliveryID     string     `json:"delivery_id"`
 	EventType      string     `json:"event_type"`
 	Success        bool       `json:"success"`
 	ResponseStatus int        `json:"response_status"`
 	ErrorMessage   string     `json:"error_message,omitempty"`
 	RetryCount     int        `json:"retry_count"`
 	NextRetryAt    *time.Time `json:"next_retry_at,omitempty"`
+	DurationMs     int64      `json:"duration_ms"`
 	CreatedAt      time.Time  `json:"created_at"`
+
+	AbandonedReason string `json:"abandoned_reason,omitempty"`
+}
+
+// ToResponse converts WebhookDelivery to WebhookDeliveryResponse
+func (d *WebhookDelivery) ToResponse() WebhookDeliveryResponse {
+	return WebhookDeliveryResponse{
+		ID:              d.ID,
+		DeliveryID:      d.DeliveryIDOrDefault(),
+		EventType:       d.EventType,
+		Success:         d.Success,
+		ResponseStatus:  d.ResponseStatus,
+		ErrorMessage:    d.ErrorMessage,
+		RetryCount:      d.RetryCount,
+		NextRetryAt:     d.NextRetryAt,
+		DurationMs:      d.DurationMs,
+		CreatedAt:       d.CreatedAt,
+		AbandonedReason: d.AbandonedReason,
+	}
+}
+
+// DeliveryIDOrDefault returns the delivery's X-Delivery-Id, deriving a stable one for
+// rows recorded before delivery IDs existed
+func (d *WebhookDelivery) DeliveryIDOrDefault() string {
+	if d.DeliveryID != "" {
+		return d.DeliveryID
+	}
+	return fmt.Sprintf("delivery-%d", d.ID)
 }
 
 // ToResponse converts Webhook to WebhookResponse (hides sensitive fields)
 func (w *Webhook) ToResponse() WebhookResponse {
-	return WebhookResponse{
+	response := WebhookResponse{
 		ID:                   w.ID,
 		URL:                  w.URL,
 		Description:          w.Description,
@@ -146,7 +595,70 @@ func (w *Webhook) ToResponse() WebhookResponse {
 		FilterChatType:       w.FilterChatType,
 		FilterGroupJIDs:      ParseEventTypes(w.FilterGroupJIDs),
 		FilterGroupNames:     ParseEventTypes(w.FilterGroupNames),
+		PayloadTemplate:      w.PayloadTemplate,
+		RateLimitPerMinute:   w.RateLimitPerMinute,
+		TLSCACert:            w.TLSCACert,
+		TLSClientCert:        w.TLSClientCert,
+		HasTLSClientKey:      w.TLSClientKey != "",
+		ProxyURL:             redactProxyURL(w.ProxyURL),
+		CompressPayloads:     w.CompressPayloads,
+		CollapseDuplicates:   w.CollapseDuplicates,
+		TargetType:           w.TargetTypeOrDefault(),
+		TargetConfig:         redactTargetConfig(w.TargetConfig),
+		ReplyEnabled:         w.ReplyEnabled,
+		TestMode:             w.TestMode,
+		PayloadVersion:       w.PayloadVersion,
+		MaxRetries:           w.MaxRetries,
+		MaxDeliveryAge:       w.MaxDeliveryAge,
+		AuthJWTAlgorithm:     w.AuthJWTAlgorithm,
+		AuthJWTAudience:      w.AuthJWTAudience,
+		HasAuthJWTKey:        w.AuthJWTKey != "",
+		ConsecutiveFailures:  w.ConsecutiveFailures,
+		DisabledReason:       w.DisabledReason,
+		DisabledAt:           w.DisabledAt,
+	}
+	if w.DeletedAt.Valid {
+		response.DeletedAt = &w.DeletedAt.Time
+	}
+	return response
+}
+
+// TargetTypeOrDefault returns the webhook's target type, treating rows created before
+// target types existed as HTTP
+func (w *Webhook) TargetTypeOrDefault() string {
+	if w.TargetType == "" {
+		return TargetTypeHTTP
+	}
+	return w.TargetType
+}
+
+// targetSecretKeys are target config fields never returned by the API
+var targetSecretKeys = map[string]bool{"password": true, "token": true, "secret": true}
+
+// redactTargetConfig decodes a stored target config for API responses, dropping credentials
+func redactTargetConfig(config string) map[string]interface{} {
+	if config == "" {
+		return nil
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(config), &values); err != nil {
+		return nil
+	}
+	for key := range values {
+		if targetSecretKeys[key] {
+			delete(values, key)
+		}
+	}
+	return values
+}
+
+// redactProxyURL masks the password of a proxy URL for API responses
+func redactProxyURL(proxyURL string) string {
+	parsed, err := url.Parse(proxyURL)
+	if err != nil || parsed.User == nil {
+		return proxyURL
 	}
+	return parsed.Redacted()
 }
 
 // ParseEventTypes converts comma-separated string to slice
@@ -0,0 +1,100 @@
+package models
+
+import "time"
+
+// Webhook payload versions. Each webhook pins one, so receivers move to a new version
+// when they're ready.
+const (
+	// The original payload: data as emitted, with Unix timestamps
+	PayloadVersion1 = 1
+	// Typed data: messages with their media, receipts with their status, and RFC 3339
+	// timestamps
+	PayloadVersion2 = 2
+
+	LatestPayloadVersion = PayloadVersion2
+)
+
+// Data types of version 2 payloads
+const (
+	PayloadDataMessage = "message" // message_received and message_sent
+	PayloadDataReceipt = "receipt" // message_delivered and message_read
+	PayloadDataEvent   = "event"   // Everything else, with the data as in version 1
+)
+
+// Kinds of messages, in MessageReceivedData.Type and version 2 payloads
+const (
+	MessageTypeText     = "text"
+	MessageTypeImage    = "image"
+	MessageTypeVideo    = "video"
+	MessageTypeAudio    = "audio"
+	MessageTypeDocument = "document"
+	MessageTypeSticker  = "sticker"
+	MessageTypeLocation = "location"
+	MessageTypeContact  = "contact"
+	MessageTypeOther    = "other"
+)
+
+// ValidPayloadVersion reports whether webhooks can be pinned to the payload version
+func ValidPayloadVersion(version int) bool {
+	return version >= PayloadVersion1 && version <= LatestPayloadVersion
+}
+
+// WebhookPayloadV2 is the version 2 webhook payload
+type WebhookPayloadV2 struct {
+	PayloadVersion int         `json:"payload_version"`
+	WebhookID      uint        `json:"webhook_id"`
+	Event          string      `json:"event"`
+	Timestamp      time.Time   `json:"timestamp"`
+	Test           bool        `json:"test,omitempty"`
+	DataType       string      `json:"data_type"` // message, receipt or event
+	Data           interface{} `json:"data"`
+}
+
+// PayloadParty is a user in version 2 payloads
+type PayloadParty struct {
+	JID   string `json:"jid"`
+	Phone string `json:"phone,omitempty"`
+	Name  string `json:"name,omitempty"`
+}
+
+// PayloadGroup is a group chat in version 2 payloads
+type PayloadGroup struct {
+	JID  string `json:"jid"`
+	Name string `json:"name,omitempty"`
+}
+
+// MessageMedia describes a received message's attachment. The attachment itself isn't
+// downloaded.
+type MessageMedia struct {
+	MimeType string `json:"mime_type,omitempty"`
+	Filename string `json:"filename,omitempty"` // Documents only
+	Size     uint64 `json:"size,omitempty"`
+	Seconds  uint32 `json:"seconds,omitempty"` // Audio and video length
+}
+
+// MessageDataV2 is a message_received or message_sent event in version 2 payloads
+type MessageDataV2 struct {
+	ID        string        `json:"id"`
+	Direction string        `json:"direction"` // incoming or outgoing
+	Chat      string        `json:"chat"`
+	From      *PayloadParty `json:"from,omitempty"` // Incoming messages
+	To        *PayloadParty `json:"to,omitempty"`   // Outgoing messages
+	Group     *PayloadGroup `json:"group,omitempty"`
+	Type      string        `json:"type"`           // text, image, video, audio, document, sticker, location, contact or other
+	Text      string        `json:"text,omitempty"` // The text, or a media message's caption
+	Media     *MessageMedia `json:"media,omitempty"`
+	IsFromMe  bool          `json:"is_from_me"`
+	Source    string        `json:"source,omitempty"` // Outgoing messages: what sent it
+	Tags      []string      `json:"tags,omitempty"`
+	Timestamp time.Time     `json:"timestamp"`
+}
+
+// ReceiptDataV2 is a message_delivered or message_read event in version 2 payloads
+type ReceiptDataV2 struct {
+	Status     string       `json:"status"` // delivered or read
+	Chat       string       `json:"chat"`
+	From       PayloadParty `json:"from"` // User whose device sent the receipt
+	MessageIDs []string     `json:"message_ids"`
+	IsGroup    bool         `json:"is_group"`
+	Timestamp  time.Time    `json:"timestamp"`
+}
@@ -0,0 +1,40 @@
+// Package openapi holds the OpenAPI description of the REST API
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"sync"
+
+	"github.com/goccy/go-yaml"
+	"github.com/user/pinglater/internal/version"
+)
+
+//go:embed openapi.yaml
+var spec []byte
+
+var (
+	jsonOnce sync.Once
+	jsonSpec []byte
+	jsonErr  error
+)
+
+// YAML returns the OpenAPI document as maintained in openapi.yaml
+func YAML() []byte {
+	return spec
+}
+
+// JSON returns the OpenAPI document as JSON, with info.version set to the running build
+func JSON() ([]byte, error) {
+	jsonOnce.Do(func() {
+		var doc map[string]interface{}
+		if jsonErr = yaml.Unmarshal(spec, &doc); jsonErr != nil {
+			return
+		}
+		if info, ok := doc["info"].(map[string]interface{}); ok {
+			info["version"] = version.Get().Version
+		}
+		jsonSpec, jsonErr = json.Marshal(doc)
+	})
+	return jsonSpec, jsonErr
+}
@@ -0,0 +1,159 @@
+// Package passwords hashes and verifies user passwords with bcrypt or Argon2id.
+package passwords
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrMismatch is returned when a password doesn't match its hash
+var ErrMismatch = errors.New("password does not match")
+
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+// Argon2id defaults: 64 MiB of memory, 3 passes, 2 lanes
+const (
+	defaultArgon2Memory      = 64 * 1024 // KiB
+	defaultArgon2Time        = 3
+	defaultArgon2Parallelism = 2
+	argon2SaltLength         = 16
+	argon2KeyLength          = 32
+)
+
+// Config selects the algorithm for new hashes
+type Config struct {
+	Algorithm         string
+	Argon2Memory      uint32 // KiB
+	Argon2Time        uint32
+	Argon2Parallelism uint8
+}
+
+var (
+	config     Config
+	configOnce sync.Once
+)
+
+func loadConfig() Config {
+	configOnce.Do(func() {
+		config = Config{
+			Algorithm:         AlgorithmBcrypt,
+			Argon2Memory:      uint32(envInt("ARGON2_MEMORY_KIB", defaultArgon2Memory)),
+			Argon2Time:        uint32(envInt("ARGON2_TIME", defaultArgon2Time)),
+			Argon2Parallelism: uint8(envInt("ARGON2_PARALLELISM", defaultArgon2Parallelism)),
+		}
+		switch algorithm := os.Getenv("PASSWORD_HASH"); algorithm {
+		case "", AlgorithmBcrypt:
+		case AlgorithmArgon2id:
+			config.Algorithm = AlgorithmArgon2id
+		default:
+			log.Printf("Unknown PASSWORD_HASH %q, using bcrypt", algorithm)
+		}
+	})
+	return config
+}
+
+// Hash hashes a password with the configured algorithm
+func Hash(password string) (string, error) {
+	cfg := loadConfig()
+	if cfg.Algorithm == AlgorithmArgon2id {
+		return hashArgon2id(password, cfg)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// Verify checks a password against a bcrypt or Argon2id hash. needsRehash reports that
+// the hash was made with another algorithm or weaker parameters than configured, so
+// the caller should store a fresh Hash of the password.
+func Verify(password, hash string) (needsRehash bool, err error) {
+	cfg := loadConfig()
+
+	if strings.HasPrefix(hash, "$argon2id$") {
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, err
+		}
+		computed := argon2.IDKey([]byte(password), salt, params.Argon2Time, params.Argon2Memory, params.Argon2Parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(computed, key) != 1 {
+			return false, ErrMismatch
+		}
+		needsRehash = cfg.Algorithm != AlgorithmArgon2id ||
+			params.Argon2Memory != cfg.Argon2Memory ||
+			params.Argon2Time != cfg.Argon2Time ||
+			params.Argon2Parallelism != cfg.Argon2Parallelism
+		return needsRehash, nil
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return false, ErrMismatch
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return cfg.Algorithm != AlgorithmBcrypt || (err == nil && cost < bcrypt.DefaultCost), nil
+}
+
+// hashArgon2id encodes the hash in the PHC string format used by the reference
+// implementation: $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func hashArgon2id(password string, cfg Config) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, cfg.Argon2Time, cfg.Argon2Memory, cfg.Argon2Parallelism, argon2KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, cfg.Argon2Memory, cfg.Argon2Time, cfg.Argon2Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func decodeArgon2id(hash string) (Config, []byte, []byte, error) {
+	var params Config
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, errors.New("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errors.New("unsupported argon2id version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Argon2Memory, &params.Argon2Time, &params.Argon2Parallelism); err != nil {
+		return params, nil, nil, errors.New("invalid argon2id parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, errors.New("invalid argon2id salt")
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, errors.New("invalid argon2id key")
+	}
+	return params, salt, key, nil
+}
+
+// envInt reads a positive integer from the environment, falling back to def
+func envInt(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("Invalid value for %s: %q, using default %d", key, value, def)
+		return def
+	}
+	return n
+}
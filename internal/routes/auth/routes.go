@@ -4,18 +4,32 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/user/pinglater/internal/api/handlers"
 	"github.com/user/pinglater/internal/api/middleware"
+	"github.com/user/pinglater/internal/models"
 )
 
 func RegisterRoutes(api *gin.RouterGroup) {
 	// Public routes
 	api.POST("/auth/login", handlers.Login)
 	api.POST("/auth/logout", handlers.Logout)
+	api.GET("/auth/status", handlers.GetAuthStatus)
+	api.POST("/auth/setup", handlers.Setup)
+
+	// Describes the API token used for the request; needs no particular scope
+	api.GET("/auth/token-info", middleware.AuthMiddlewareWithFallback(), handlers.GetTokenInfo)
+
+	// Short-lived tokens for opening the event streams
+	api.POST("/auth/stream-token", middleware.AuthMiddlewareWithFallback(), middleware.RequireScope(models.ScopeMessagesRead), handlers.CreateStreamToken)
 
 	// Protected routes
 	protected := api.Group("")
 	protected.Use(middleware.AuthMiddleware())
 	{
 		protected.GET("/auth/me", handlers.GetMe)
+		protected.POST("/auth/change-password", handlers.ChangePassword)
+
+		// Login session management
+		protected.GET("/auth/sessions", handlers.ListSessions)
+		protected.DELETE("/auth/sessions/:id", handlers.DeleteSession)
 
 		// API Token management routes
 		protected.GET("/auth/tokens", handlers.ListTokens)
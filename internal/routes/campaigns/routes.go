@@ -0,0 +1,29 @@
+package campaigns
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/api/handlers"
+	"github.com/user/pinglater/internal/api/middleware"
+	"github.com/user/pinglater/internal/models"
+)
+
+// RegisterRoutes adds broadcast campaigns to contact lists
+func RegisterRoutes(api *gin.RouterGroup) {
+	protected := api.Group("/campaigns")
+	protected.Use(middleware.AuthMiddlewareWithFallback())
+	{
+		read := protected.Group("")
+		read.Use(middleware.RequireScope(models.ScopeMessagesRead, models.ScopeMessagesSend))
+		read.GET("", handlers.ListCampaigns)
+		read.GET("/:id", handlers.GetCampaign)
+		read.GET("/:id/stats", handlers.GetCampaignStats)
+
+		manage := protected.Group("")
+		manage.Use(middleware.RequireScope(models.ScopeMessagesSend))
+		manage.POST("", handlers.CreateCampaign)
+		manage.PUT("/:id", handlers.UpdateCampaign)
+		manage.DELETE("/:id", handlers.DeleteCampaign)
+		manage.POST("/:id/send", handlers.SendCampaign)
+		manage.DELETE("/:id/schedule", handlers.UnscheduleCampaign)
+	}
+}
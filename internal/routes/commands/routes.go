@@ -0,0 +1,27 @@
+package commands
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/api/handlers"
+	"github.com/user/pinglater/internal/api/middleware"
+	"github.com/user/pinglater/internal/models"
+)
+
+// RegisterRoutes adds the management of bot commands. Like rules, commands act on
+// received messages, so they share the webhook scopes.
+func RegisterRoutes(api *gin.RouterGroup) {
+	protected := api.Group("/commands")
+	protected.Use(middleware.AuthMiddlewareWithFallback())
+	{
+		read := protected.Group("")
+		read.Use(middleware.RequireScope(models.ScopeWebhooksRead, models.ScopeWebhooksManage))
+		read.GET("", handlers.ListBotCommands)
+		read.GET("/:id", handlers.GetBotCommand)
+
+		manage := protected.Group("")
+		manage.Use(middleware.RequireScope(models.ScopeWebhooksManage))
+		manage.POST("", handlers.CreateBotCommand)
+		manage.PUT("/:id", handlers.UpdateBotCommand)
+		manage.DELETE("/:id", handlers.DeleteBotCommand)
+	}
+}
@@ -0,0 +1,33 @@
+package contacts
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/api/handlers"
+	"github.com/user/pinglater/internal/api/middleware"
+	"github.com/user/pinglater/internal/models"
+)
+
+// RegisterRoutes adds contact lists and campaign opt-outs. They're who campaigns are
+// sent to, so they share the message scopes.
+func RegisterRoutes(api *gin.RouterGroup) {
+	protected := api.Group("")
+	protected.Use(middleware.AuthMiddlewareWithFallback())
+	{
+		read := protected.Group("")
+		read.Use(middleware.RequireScope(models.ScopeMessagesRead, models.ScopeMessagesSend))
+		read.GET("/contact-lists", handlers.ListContactLists)
+		read.GET("/contact-lists/:id", handlers.GetContactList)
+		read.GET("/contact-lists/:id/contacts", handlers.ListContacts)
+		read.GET("/opt-outs", handlers.ListOptOuts)
+
+		manage := protected.Group("")
+		manage.Use(middleware.RequireScope(models.ScopeMessagesSend))
+		manage.POST("/contact-lists", handlers.CreateContactList)
+		manage.PUT("/contact-lists/:id", handlers.UpdateContactList)
+		manage.DELETE("/contact-lists/:id", handlers.DeleteContactList)
+		manage.POST("/contact-lists/:id/contacts", handlers.AddContacts)
+		manage.DELETE("/contact-lists/:id/contacts/:contactId", handlers.DeleteContact)
+		manage.POST("/opt-outs", handlers.CreateOptOut)
+		manage.DELETE("/opt-outs/:phone", handlers.DeleteOptOut)
+	}
+}
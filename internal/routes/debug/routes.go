@@ -0,0 +1,32 @@
+package debug
+
+import (
+	"net/http/pprof"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/api/handlers"
+	"github.com/user/pinglater/internal/api/middleware"
+)
+
+// RegisterRoutes adds the profiling and runtime stats endpoints. They reveal internals
+// and can slow the server down, so they are only registered when enabled and need an
+// admin JWT.
+func RegisterRoutes(api *gin.RouterGroup) {
+	admin := api.Group("/debug")
+	admin.Use(middleware.AuthMiddleware(), middleware.AdminMiddleware())
+	{
+		admin.GET("/runtime", handlers.GetRuntimeStats)
+
+		// net/http/pprof; the index page links to the profiles relative to itself
+		admin.GET("/pprof/", gin.WrapF(pprof.Index))
+		admin.GET("/pprof/cmdline", gin.WrapF(pprof.Cmdline))
+		admin.GET("/pprof/profile", gin.WrapF(pprof.Profile))
+		admin.GET("/pprof/symbol", gin.WrapF(pprof.Symbol))
+		admin.POST("/pprof/symbol", gin.WrapF(pprof.Symbol))
+		admin.GET("/pprof/trace", gin.WrapF(pprof.Trace))
+		// pprof.Index only serves named profiles under /debug/pprof/, so route them here
+		admin.GET("/pprof/:profile", func(c *gin.Context) {
+			pprof.Handler(c.Param("profile")).ServeHTTP(c.Writer, c.Request)
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package ignoredchats
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/api/handlers"
+	"github.com/user/pinglater/internal/api/middleware"
+	"github.com/user/pinglater/internal/models"
+)
+
+// RegisterRoutes adds the management of the ignore list. Like rules, it decides what
+// happens to received messages, so it shares the webhook scopes.
+func RegisterRoutes(api *gin.RouterGroup) {
+	protected := api.Group("/ignored-chats")
+	protected.Use(middleware.AuthMiddlewareWithFallback())
+	{
+		protected.GET("", middleware.RequireScope(models.ScopeWebhooksRead, models.ScopeWebhooksManage), handlers.ListIgnoredChats)
+
+		manage := protected.Group("")
+		manage.Use(middleware.RequireScope(models.ScopeWebhooksManage))
+		manage.POST("", handlers.CreateIgnoredChat)
+		manage.DELETE("/:id", handlers.DeleteIgnoredChat)
+	}
+}
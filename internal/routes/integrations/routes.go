@@ -0,0 +1,40 @@
+package integrations
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/api/handlers"
+	"github.com/user/pinglater/internal/api/middleware"
+	"github.com/user/pinglater/internal/models"
+)
+
+// RegisterRoutes adds the receivers that turn other systems' requests into WhatsApp
+// messages, and the management of inbound webhooks
+func RegisterRoutes(api *gin.RouterGroup) {
+	protected := api.Group("/integrations")
+	protected.Use(middleware.AuthMiddlewareWithFallback())
+	{
+		// Receivers send messages, so they need the messages:send scope
+		receive := protected.Group("")
+		receive.Use(middleware.RequireScope(models.ScopeMessagesSend))
+		receive.POST("/alertmanager", handlers.ReceiveAlertmanagerNotification)
+		receive.POST("/grafana", handlers.ReceiveGrafanaNotification)
+
+		// Inbound webhooks are managed like (outgoing) webhooks
+		read := protected.Group("")
+		read.Use(middleware.RequireScope(models.ScopeWebhooksRead, models.ScopeWebhooksManage))
+		read.GET("/inbound-webhooks", handlers.ListInboundWebhooks)
+		read.GET("/inbound-webhooks/:id", handlers.GetInboundWebhook)
+
+		manage := protected.Group("")
+		manage.Use(middleware.RequireScope(models.ScopeWebhooksManage))
+		manage.POST("/inbound-webhooks", handlers.CreateInboundWebhook)
+		manage.PUT("/inbound-webhooks/:id", handlers.UpdateInboundWebhook)
+		manage.DELETE("/inbound-webhooks/:id", handlers.DeleteInboundWebhook)
+	}
+
+	// Inbound webhooks also take the API token as a query parameter, for systems that
+	// can't set headers
+	inbound := api.Group("/integrations")
+	inbound.Use(middleware.QueryAPIToken(), middleware.AuthMiddlewareWithFallback(), middleware.RequireScope(models.ScopeMessagesSend))
+	inbound.POST("/inbound/:name", handlers.ReceiveInboundWebhook)
+}
@@ -0,0 +1,19 @@
+package outofoffice
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/api/handlers"
+	"github.com/user/pinglater/internal/api/middleware"
+	"github.com/user/pinglater/internal/models"
+)
+
+// RegisterRoutes adds the out-of-office mode. Like rules, it answers received messages,
+// so it shares the webhook scopes.
+func RegisterRoutes(api *gin.RouterGroup) {
+	protected := api.Group("/out-of-office")
+	protected.Use(middleware.AuthMiddlewareWithFallback())
+	{
+		protected.GET("", middleware.RequireScope(models.ScopeWebhooksRead, models.ScopeWebhooksManage), handlers.GetOutOfOffice)
+		protected.PUT("", middleware.RequireScope(models.ScopeWebhooksManage), handlers.UpdateOutOfOffice)
+	}
+}
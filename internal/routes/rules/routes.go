@@ -0,0 +1,27 @@
+package rules
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/api/handlers"
+	"github.com/user/pinglater/internal/api/middleware"
+	"github.com/user/pinglater/internal/models"
+)
+
+// RegisterRoutes adds the management of auto-responder rules. Rules act on received
+// messages like webhooks do, so they share the webhook scopes.
+func RegisterRoutes(api *gin.RouterGroup) {
+	protected := api.Group("/rules")
+	protected.Use(middleware.AuthMiddlewareWithFallback())
+	{
+		read := protected.Group("")
+		read.Use(middleware.RequireScope(models.ScopeWebhooksRead, models.ScopeWebhooksManage))
+		read.GET("", handlers.ListRules)
+		read.GET("/:id", handlers.GetRule)
+
+		manage := protected.Group("")
+		manage.Use(middleware.RequireScope(models.ScopeWebhooksManage))
+		manage.POST("", handlers.CreateRule)
+		manage.PUT("/:id", handlers.UpdateRule)
+		manage.DELETE("/:id", handlers.DeleteRule)
+	}
+}
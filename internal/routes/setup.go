@@ -6,9 +6,21 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/api/handlers"
+	"github.com/user/pinglater/internal/api/middleware"
 	"github.com/user/pinglater/internal/db"
 	"github.com/user/pinglater/internal/routes/auth"
+	"github.com/user/pinglater/internal/routes/campaigns"
+	"github.com/user/pinglater/internal/routes/commands"
+	"github.com/user/pinglater/internal/routes/contacts"
+	"github.com/user/pinglater/internal/routes/debug"
+	"github.com/user/pinglater/internal/routes/ignoredchats"
+	"github.com/user/pinglater/internal/routes/integrations"
+	"github.com/user/pinglater/internal/routes/outofoffice"
+	"github.com/user/pinglater/internal/routes/rules"
 	"github.com/user/pinglater/internal/routes/static"
+	"github.com/user/pinglater/internal/routes/twilio"
+	"github.com/user/pinglater/internal/routes/users"
 	"github.com/user/pinglater/internal/routes/webhooks"
 	"github.com/user/pinglater/internal/routes/whatsapp"
 )
@@ -19,9 +31,12 @@ func SetupRouter() *gin.Engine {
 	// Configure CORS
 	config := cors.DefaultConfig()
 	config.AllowAllOrigins = true
-	config.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization"}
+	config.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", "Idempotency-Key"}
 	r.Use(cors.New(config))
 
+	// Routes that take larger uploads set their own limit
+	r.Use(middleware.BodyLimit())
+
 	// Health check endpoint (no auth required for Docker health checks)
 	r.GET("/health", func(c *gin.Context) {
 		database := db.GetDB()
@@ -45,14 +60,42 @@ func SetupRouter() *gin.Engine {
 		})
 	})
 
+	// Kubernetes probes: liveness only needs the process, readiness needs the database
+	// and the WhatsApp store
+	r.GET("/healthz", handlers.Liveness)
+	r.GET("/readyz", handlers.Readiness)
+
 	// API routes
 	api := r.Group("/api")
 	{
+		api.GET("/version", handlers.GetVersion)
+		api.GET("/health", handlers.GetHealth) // Detailed report for uptime monitors
+
+		// API documentation (no auth, so SDK generators can fetch the spec)
+		api.GET("/docs", handlers.GetAPIDocs)
+		api.GET("/docs/openapi.json", handlers.GetOpenAPISpec)
+		api.GET("/docs/openapi.yaml", handlers.GetOpenAPISpecYAML)
+
 		auth.RegisterRoutes(api)
 		whatsapp.RegisterRoutes(api)
 		webhooks.RegisterRoutes(api)
+		users.RegisterRoutes(api)
+		integrations.RegisterRoutes(api)
+		rules.RegisterRoutes(api)
+		commands.RegisterRoutes(api)
+		ignoredchats.RegisterRoutes(api)
+		outofoffice.RegisterRoutes(api)
+		contacts.RegisterRoutes(api)
+		campaigns.RegisterRoutes(api)
+
+		if os.Getenv("DEBUG_ENDPOINTS_ENABLED") == "true" {
+			debug.RegisterRoutes(api)
+		}
 	}
 
+	// Twilio-compatible message API, at Twilio's paths rather than under /api
+	twilio.RegisterRoutes(r)
+
 	// Static routes
 	static.RegisterRoutes(r)
 
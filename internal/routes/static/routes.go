@@ -1,77 +1,84 @@
 package static
 
 import (
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/web"
 )
 
-// RegisterRoutes registers static file serving routes
+// RegisterRoutes serves the frontend: the copy embedded in the binary, or the directory
+// in WEB_DIR (e.g. ./web/out, to pick up rebuilds during development without rebuilding
+// the server)
 func RegisterRoutes(r *gin.Engine) {
-	staticPath := "./web/out"
-
-	log.Printf("Serving static files from: %s", staticPath)
-	// Check if static directory exists
-	if _, err := os.Stat(staticPath); !os.IsNotExist(err) {
-
-		// Dynamically serve files and directories
-		entries, err := os.ReadDir(staticPath)
-		if err == nil {
-			for _, entry := range entries {
-				name := entry.Name()
-				// Skip index.html as it's handled separately
-				if name == "index.html" {
-					continue
-				}
-
-				fullPath := filepath.Join(staticPath, name)
-				if entry.IsDir() {
-					r.Static("/"+name, fullPath)
-				} else {
-					r.StaticFile("/"+name, fullPath)
-				}
-			}
+	var files fs.FS
+	if dir := os.Getenv("WEB_DIR"); dir != "" {
+		if _, err := os.Stat(filepath.Join(dir, "index.html")); err != nil {
+			log.Printf("Warning: Static path not found: %s", dir)
+			return
 		}
+		log.Printf("Serving static files from: %s", dir)
+		files = os.DirFS(dir)
+	} else if embedded, ok := web.Files(); ok {
+		log.Println("Serving embedded static files")
+		files = embedded
+	} else {
+		log.Println("Warning: Binary built without the web frontend (run npm run build in web/ first)")
+		return
+	}
 
-		// Serve index.html for root path
-		r.GET("/", func(c *gin.Context) {
-			c.File(filepath.Join(staticPath, "index.html"))
-		})
-
-		// Return 404 page for all unmatched routes
-		r.NoRoute(func(c *gin.Context) {
-			// Skip API routes
-			if len(c.Request.URL.Path) >= 4 && c.Request.URL.Path[:4] == "/api" {
-				c.Next()
-				return
-			}
+	r.NoRoute(func(c *gin.Context) {
+		// Skip API routes
+		if strings.HasPrefix(c.Request.URL.Path, "/api") {
+			c.Next()
+			return
+		}
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			return
+		}
 
-			// Try 404.html first
-			p404 := filepath.Join(staticPath, "404.html")
-			if _, err := os.Stat(p404); err == nil {
-				c.File(p404)
-				return
+		name := strings.TrimPrefix(path.Clean(c.Request.URL.Path), "/")
+		if name == "" {
+			name = "index.html"
+		}
+		if page, ok := lookup(files, name); ok {
+			// Next.js puts content hashes in these names, so they never change
+			if strings.HasPrefix(name, "_next/static/") {
+				c.Header("Cache-Control", "public, max-age=31536000, immutable")
 			}
+			http.ServeFileFS(c.Writer, c.Request, files, page)
+			return
+		}
 
-			// Try 404/index.html
-			p404Index := filepath.Join(staticPath, "404", "index.html")
-			if _, err := os.Stat(p404Index); err == nil {
-				c.File(p404Index)
+		// Try the 404 page, then fall back to index.html for SPA routing
+		for _, page := range []string{"404.html", "404/index.html", "index.html"} {
+			if _, err := fs.Stat(files, page); err == nil {
+				http.ServeFileFS(c.Writer, c.Request, files, page)
 				return
 			}
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+	})
+}
 
-			// Fallback to index.html for SPA routing
-			indexPath := filepath.Join(staticPath, "index.html")
-			if _, err := os.Stat(indexPath); err == nil {
-				c.File(indexPath)
-			} else {
-				c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
-			}
-		})
-	} else {
-		log.Printf("Warning: Static path not found: %s", staticPath)
+// lookup finds the file serving name: the file itself, or a directory with an
+// index.html (which http.ServeFileFS redirects to and serves)
+func lookup(files fs.FS, name string) (string, bool) {
+	info, err := fs.Stat(files, name)
+	if err != nil {
+		return "", false
+	}
+	if info.IsDir() {
+		if _, err := fs.Stat(files, path.Join(name, "index.html")); err != nil {
+			return "", false
+		}
 	}
+	return name, true
 }
@@ -0,0 +1,20 @@
+package twilio
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/api/handlers"
+	"github.com/user/pinglater/internal/api/middleware"
+	"github.com/user/pinglater/internal/models"
+)
+
+// RegisterRoutes adds the Twilio-compatible message API at Twilio's own paths, so
+// Twilio clients only need their base URL changed. The account SID in the path is
+// ignored; clients authenticate with an API token as the Basic auth password.
+func RegisterRoutes(r *gin.Engine) {
+	accounts := r.Group("/2010-04-01/Accounts/:accountSid")
+	accounts.Use(middleware.BasicAuthAPIToken(), middleware.AuthMiddlewareWithFallback())
+	{
+		accounts.POST("/Messages.json", middleware.RequireScope(models.ScopeMessagesSend), handlers.CreateTwilioMessage)
+		accounts.GET("/Messages/:messageSid", middleware.RequireScope(models.ScopeMessagesSend, models.ScopeMessagesRead), handlers.GetTwilioMessage)
+	}
+}
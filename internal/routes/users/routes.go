@@ -0,0 +1,21 @@
+package users
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/user/pinglater/internal/api/handlers"
+	"github.com/user/pinglater/internal/api/middleware"
+)
+
+func RegisterRoutes(api *gin.RouterGroup) {
+	admin := api.Group("")
+	admin.Use(middleware.AuthMiddleware(), middleware.AdminMiddleware())
+	{
+		// User management
+		admin.GET("/users", handlers.ListUsers)
+		admin.POST("/users", handlers.CreateUser)
+		admin.GET("/users/:id", handlers.GetUser)
+		admin.PUT("/users/:id", handlers.UpdateUser)
+		admin.DELETE("/users/:id", handlers.DeleteUser)
+		admin.POST("/users/:id/reset-password", handlers.ResetUserPassword)
+	}
+}
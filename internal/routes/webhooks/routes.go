@@ -4,29 +4,48 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/user/pinglater/internal/api/handlers"
 	"github.com/user/pinglater/internal/api/middleware"
+	"github.com/user/pinglater/internal/models"
 )
 
 func RegisterRoutes(api *gin.RouterGroup) {
 	protected := api.Group("")
-	protected.Use(middleware.AuthMiddleware())
+	protected.Use(middleware.AuthMiddlewareWithFallback())
 	{
-		// Webhook CRUD
-		protected.GET("/webhooks", handlers.ListWebhooks)
-		protected.POST("/webhooks", handlers.CreateWebhook)
-		protected.GET("/webhooks/:id", handlers.GetWebhook)
-		protected.PUT("/webhooks/:id", handlers.UpdateWebhook)
-		protected.DELETE("/webhooks/:id", handlers.DeleteWebhook)
+		// Read-only routes accept either webhook scope
+		read := protected.Group("")
+		read.Use(middleware.RequireScope(models.ScopeWebhooksRead, models.ScopeWebhooksManage))
+		read.GET("/webhooks", handlers.ListWebhooks)
+		read.GET("/webhooks/:id", handlers.GetWebhook)
 
 		// Webhook events
-		protected.GET("/webhooks/events", handlers.ListWebhookEvents)
+		read.GET("/webhooks/events", handlers.ListWebhookEvents)
+
+		// Aggregated health of all webhooks
+		read.GET("/webhooks/health", handlers.GetWebhooksHealth)
+
+		// Deleted webhooks, kept for WEBHOOK_TRASH_RETENTION
+		read.GET("/webhooks/trash", handlers.ListWebhookTrash)
 
 		// Webhook deliveries
-		protected.GET("/webhooks/:id/deliveries", handlers.ListWebhookDeliveries)
+		read.GET("/webhooks/:id/deliveries", handlers.ListWebhookDeliveries)
+		read.GET("/webhooks/:id/deliveries/export", handlers.ExportWebhookDeliveries)
 
 		// Webhook stats
-		protected.GET("/webhooks/:id/stats", handlers.GetWebhookStats)
+		read.GET("/webhooks/:id/stats", handlers.GetWebhookStats)
+
+		// Check a sample event against the webhook's filters; nothing is sent
+		read.POST("/webhooks/:id/filters/test", handlers.TestWebhookFilters)
+
+		// Webhook CRUD
+		manage := protected.Group("")
+		manage.Use(middleware.RequireScope(models.ScopeWebhooksManage))
+		manage.POST("/webhooks", handlers.CreateWebhook)
+		manage.PUT("/webhooks/:id", handlers.UpdateWebhook)
+		manage.DELETE("/webhooks/:id", handlers.DeleteWebhook)
+		manage.POST("/webhooks/trash/:id/restore", handlers.RestoreWebhook)
+		manage.DELETE("/webhooks/trash/:id", handlers.PurgeWebhook)
 
 		// Test webhook
-		protected.POST("/webhooks/:id/test", handlers.TestWebhook)
+		manage.POST("/webhooks/:id/test", handlers.TestWebhook)
 	}
 }
@@ -1,27 +1,77 @@
 package whatsapp
 
 import (
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/user/pinglater/internal/api/handlers"
 	"github.com/user/pinglater/internal/api/middleware"
 	"github.com/user/pinglater/internal/models"
+	"github.com/user/pinglater/internal/whatsapp"
 )
 
+// backupTimeout bounds session backup downloads and restore uploads
+const backupTimeout = 10 * time.Minute
+
 func RegisterRoutes(api *gin.RouterGroup) {
 	protected := api.Group("")
 	protected.Use(middleware.AuthMiddlewareWithFallback())
 	{
-		protected.GET("/whatsapp/status", handlers.GetWhatsAppStatus)
-		protected.GET("/whatsapp/qr", handlers.GetWhatsAppQR)
-		protected.GET("/whatsapp/current-qr", handlers.GetCurrentQRCode) // Polling alternative to SSE
-		protected.POST("/whatsapp/connect", handlers.ConnectWhatsApp)
-		protected.POST("/whatsapp/disconnect", handlers.DisconnectWhatsApp)
-		protected.GET("/whatsapp/events", handlers.GetEvents)
-		protected.GET("/whatsapp/metrics", handlers.GetMetrics)
+		// The linked device, only for its owner and admins
+		protected.GET("/whatsapp/status", middleware.RequireScope(models.ScopeStatusRead), middleware.RequireDeviceOwner(), handlers.GetWhatsAppStatus)
+		protected.GET("/whatsapp/device", middleware.RequireScope(models.ScopeStatusRead), middleware.RequireDeviceOwner(), handlers.GetWhatsAppDevice)
+		protected.GET("/whatsapp/metrics", middleware.RequireScope(models.ScopeMetricsRead), handlers.GetMetrics)
+		protected.GET("/metrics/timeseries", middleware.RequireScope(models.ScopeMetricsRead), handlers.GetMessageTimeseries)
+
+		// Recent events of the event stream, which carry message content
+		protected.GET("/events", middleware.RequireScope(models.ScopeMessagesRead), handlers.ListEvents)
+
+		// Pairing and connection management, only for the device's owner and admins
+		sessionGroup := protected.Group("")
+		sessionGroup.Use(middleware.RequireScope(models.ScopeSessionManage), middleware.RequireDeviceOwner())
+		sessionGroup.GET("/whatsapp/qr", middleware.NoTimeout(), handlers.GetWhatsAppQR)
+		sessionGroup.GET("/whatsapp/current-qr", handlers.GetCurrentQRCode) // Polling alternative to SSE
+		sessionGroup.GET("/whatsapp/qr.png", handlers.GetQRCodeImage)       // Rendered QR code
+		sessionGroup.POST("/whatsapp/connect", handlers.ConnectWhatsApp)
+		sessionGroup.POST("/whatsapp/pair-code", handlers.PairWithCode) // Link by phone number instead of QR
+		sessionGroup.POST("/whatsapp/disconnect", handlers.DisconnectWhatsApp)
+		sessionGroup.POST("/whatsapp/logout", handlers.LogoutWhatsApp) // Unlink the device
 
 		// Send message requires specific scope
 		sendGroup := protected.Group("")
-		sendGroup.Use(middleware.RequireScope(models.ScopeMessagesSend))
+		// Retries replayed under an Idempotency-Key don't count towards the quota
+		sendGroup.Use(middleware.RequireScope(models.ScopeMessagesSend), middleware.Idempotency(), middleware.RequireMessageQuota())
 		sendGroup.POST("/whatsapp/send", handlers.SendMessage)
+
+		// Bulk sends count each recipient against the quota themselves
+		bulkGroup := protected.Group("")
+		bulkGroup.Use(middleware.RequireScope(models.ScopeMessagesSend), middleware.Idempotency())
+		bulkGroup.POST("/whatsapp/send/bulk", handlers.SendBulkMessages)
+		protected.GET("/whatsapp/send/bulk/:id", middleware.RequireScope(models.ScopeMessagesSend, models.ScopeMessagesRead), handlers.GetBulkSendJob)
+		protected.GET("/messages/:id", middleware.RequireScope(models.ScopeMessagesSend, models.ScopeMessagesRead), handlers.GetOutgoingMessage) // Status of an async send
+
+		// Messages recorded instead of sent in sandbox mode
+		protected.GET("/whatsapp/sandbox", middleware.RequireScope(models.ScopeMessagesSend, models.ScopeMessagesRead), handlers.GetSandboxMessages)
+		protected.DELETE("/whatsapp/sandbox", middleware.RequireScope(models.ScopeMessagesSend), handlers.ClearSandboxMessages)
+	}
+
+	// The event stream carries message content. Besides the usual credentials, streams
+	// take stream tokens from POST /auth/stream-token in the token query parameter.
+	// Streams stay open, so the server's timeouts don't apply to them
+	streams := api.Group("")
+	streams.Use(middleware.StreamAuthMiddleware())
+	{
+		streams.GET("/whatsapp/events", middleware.RequireScope(models.ScopeMessagesRead), middleware.NoTimeout(), handlers.GetEvents)
+		streams.GET("/whatsapp/ws", middleware.RequireScope(models.ScopeMessagesRead), middleware.NoTimeout(), handlers.WhatsAppWebSocket) // Events over WebSocket, plus send commands
+	}
+
+	// Session backups hold the account's keys, so only admins may move them
+	admin := api.Group("")
+	admin.Use(middleware.AuthMiddleware(), middleware.AdminMiddleware())
+	{
+		// Backups can be large, so give them time and room
+		admin.POST("/whatsapp/backup", middleware.RouteTimeout(backupTimeout), handlers.ExportWhatsAppSession)
+		admin.POST("/whatsapp/restore", middleware.RouteTimeout(backupTimeout), handlers.RestoreWhatsAppSession)
+		middleware.SetRouteBodyLimit(admin.BasePath()+"/whatsapp/restore", whatsapp.MaxBackupSize+1<<20)
 	}
 }
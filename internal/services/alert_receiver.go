@@ -0,0 +1,199 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Alert receivers: monitoring tools whose webhook notifications are sent as WhatsApp
+// messages. Grafana's alerting webhook uses Alertmanager's payload shape, so both are
+// handled alike.
+const (
+	AlertReceiverAlertmanager = "alertmanager"
+	AlertReceiverGrafana      = "grafana"
+)
+
+// DefaultAlertTemplate renders an alert notification as a short WhatsApp message. Like
+// webhook payload templates, it sees the payload as decoded JSON, so fields are
+// addressed by their JSON names.
+const DefaultAlertTemplate = `[{{ upper .status }}{{ if eq .status "firing" }}:{{ len .alerts }}{{ end }}] {{ or .commonLabels.alertname "Alerts" }}
+{{ range .alerts }}
+*{{ .labels.alertname }}*{{ if .labels.severity }} ({{ .labels.severity }}){{ end }}
+{{ or .annotations.summary .annotations.description "" }}
+{{ end }}`
+
+// ErrInvalidAlertPayload is returned for requests that aren't alert notifications
+var ErrInvalidAlertPayload = errors.New("invalid alert payload")
+
+// alertDefaultSeverity picks the recipients of alerts whose severity has none
+const alertDefaultSeverity = "default"
+
+// AlertReceiverConfig configures an alert receiver
+type AlertReceiverConfig struct {
+	// Template renders the message sent for a notification; empty uses
+	// DefaultAlertTemplate
+	Template string
+	// Recipients maps an alert's severity label to the phone numbers or group JIDs
+	// notified. Alerts with a severity not listed go to the "default" recipients.
+	Recipients map[string][]string
+}
+
+// AlertMessage is a rendered notification and who to send it to
+type AlertMessage struct {
+	Severity   string
+	Recipients []string
+	Message    string
+}
+
+type alertReceiver struct {
+	template   *template.Template
+	recipients map[string][]string
+}
+
+var (
+	alertReceiversMu sync.RWMutex
+	alertReceivers   = make(map[string]alertReceiver)
+)
+
+// ConfigureAlertReceiver sets the template and recipients of an alert receiver's
+// notifications. A receiver is disabled until recipients are configured.
+func ConfigureAlertReceiver(kind string, config AlertReceiverConfig) error {
+	text := config.Template
+	if text == "" {
+		text = DefaultAlertTemplate
+	}
+	t, err := template.New(kind).Funcs(payloadTemplateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return fmt.Errorf("invalid template: %w", err)
+	}
+
+	recipients := make(map[string][]string, len(config.Recipients))
+	for severity, list := range config.Recipients {
+		recipients[strings.ToLower(severity)] = list
+	}
+
+	alertReceiversMu.Lock()
+	defer alertReceiversMu.Unlock()
+	alertReceivers[kind] = alertReceiver{template: t, recipients: recipients}
+	return nil
+}
+
+// AlertReceiverEnabled reports whether an alert receiver has any recipients configured
+func AlertReceiverEnabled(kind string) bool {
+	alertReceiversMu.RLock()
+	defer alertReceiversMu.RUnlock()
+	return len(alertReceivers[kind].recipients) > 0
+}
+
+// ParseAlertRecipients parses a recipients list like
+// "critical=15551234567,120363025246125486@g.us;warning=15557654321;default=15551234567"
+func ParseAlertRecipients(value string) (map[string][]string, error) {
+	recipients := make(map[string][]string)
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		severity, list, ok := strings.Cut(entry, "=")
+		severity = strings.TrimSpace(severity)
+		if !ok || severity == "" {
+			return nil, fmt.Errorf("invalid recipients entry %q: expected severity=recipient,...", entry)
+		}
+		for _, recipient := range strings.Split(list, ",") {
+			recipient = strings.TrimPrefix(strings.TrimSpace(recipient), "+")
+			if recipient != "" {
+				recipients[severity] = append(recipients[severity], recipient)
+			}
+		}
+		if len(recipients[severity]) == 0 {
+			return nil, fmt.Errorf("no recipients for severity %q", severity)
+		}
+	}
+	return recipients, nil
+}
+
+// RenderAlertMessages renders an alert notification into one message per severity,
+// each holding only the alerts of that severity. Alerts whose severity has no
+// recipients, and no default recipients to fall back to, are dropped.
+func RenderAlertMessages(kind string, payload []byte) ([]AlertMessage, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAlertPayload, err)
+	}
+	alerts, ok := data["alerts"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: no alerts", ErrInvalidAlertPayload)
+	}
+
+	alertReceiversMu.RLock()
+	receiver := alertReceivers[kind]
+	alertReceiversMu.RUnlock()
+
+	// Group the alerts by the recipients they go to, keeping their order
+	bySeverity := make(map[string][]interface{})
+	for _, alert := range alerts {
+		severity := alertSeverity(alert)
+		if _, ok := receiver.recipients[severity]; !ok {
+			severity = alertDefaultSeverity
+		}
+		bySeverity[severity] = append(bySeverity[severity], alert)
+	}
+	severities := make([]string, 0, len(bySeverity))
+	for severity := range bySeverity {
+		severities = append(severities, severity)
+	}
+	sort.Strings(severities)
+
+	var messages []AlertMessage
+	for _, severity := range severities {
+		to := receiver.recipients[severity]
+		if len(to) == 0 {
+			continue
+		}
+		group := bySeverity[severity]
+
+		// The template sees the notification as sent, narrowed to these alerts
+		view := make(map[string]interface{}, len(data))
+		for key, value := range data {
+			view[key] = value
+		}
+		view["alerts"] = group
+		view["status"] = groupStatus(group)
+
+		var buf bytes.Buffer
+		if err := receiver.template.Execute(&buf, view); err != nil {
+			return nil, fmt.Errorf("failed to render %s template: %w", kind, err)
+		}
+		message := strings.TrimSpace(buf.String())
+		if message == "" {
+			continue
+		}
+		messages = append(messages, AlertMessage{Severity: severity, Recipients: to, Message: message})
+	}
+	return messages, nil
+}
+
+// alertSeverity returns an alert's severity label, lowercased
+func alertSeverity(alert interface{}) string {
+	fields, _ := alert.(map[string]interface{})
+	labels, _ := fields["labels"].(map[string]interface{})
+	severity, _ := labels["severity"].(string)
+	return strings.ToLower(severity)
+}
+
+// groupStatus is "firing" while any of the alerts fires, otherwise "resolved"
+func groupStatus(alerts []interface{}) string {
+	for _, alert := range alerts {
+		fields, _ := alert.(map[string]interface{})
+		if fields["status"] == "firing" {
+			return "firing"
+		}
+	}
+	return "resolved"
+}
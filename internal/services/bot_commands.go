@@ -0,0 +1,283 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/logging"
+	"github.com/user/pinglater/internal/models"
+	"github.com/user/pinglater/internal/whatsapp"
+)
+
+// defaultCommandPrefix starts chat commands unless SetCommandPrefix changes it
+const defaultCommandPrefix = "!"
+
+var commandLog = logging.Logger("commands")
+
+// commandName is what command names may look like
+var commandName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+var (
+	commandPrefixMu sync.RWMutex
+	commandPrefix   = defaultCommandPrefix
+)
+
+// builtinCommandHelp describes the built-in actions in !help, for commands without a
+// description
+var builtinCommandHelp = map[string]string{
+	models.CommandActionHelp:   "List commands",
+	models.CommandActionStatus: "WhatsApp connection and message counts",
+	models.CommandActionPing:   "Check that the bot answers",
+}
+
+// SetCommandPrefix sets what chat commands start with, e.g. "!" or "/"
+func SetCommandPrefix(prefix string) {
+	commandPrefixMu.Lock()
+	defer commandPrefixMu.Unlock()
+	commandPrefix = prefix
+}
+
+// CommandPrefix returns what chat commands start with
+func CommandPrefix() string {
+	commandPrefixMu.RLock()
+	defer commandPrefixMu.RUnlock()
+	return commandPrefix
+}
+
+// ValidateBotCommand checks a command's name, action and allowlist, and cleans up the
+// allowlist
+func ValidateBotCommand(cmd *models.BotCommand) error {
+	cmd.Name = strings.ToLower(strings.TrimSpace(cmd.Name))
+	if !commandName.MatchString(cmd.Name) {
+		return fmt.Errorf("name must be 1-32 lowercase letters, digits, - or _ (without the prefix)")
+	}
+
+	switch cmd.Action {
+	case models.CommandActionHelp, models.CommandActionStatus, models.CommandActionPing:
+	case models.CommandActionReply:
+		if strings.TrimSpace(cmd.Template) == "" {
+			return fmt.Errorf("template is required")
+		}
+		if err := ValidatePayloadTemplate(cmd.Template); err != nil {
+			return fmt.Errorf("invalid template: %w", err)
+		}
+	case models.CommandActionForward:
+		var count int64
+		if cmd.WebhookID != nil {
+			db.GetDB().Model(&models.Webhook{}).Where("id = ? AND user_id = ?", *cmd.WebhookID, cmd.UserID).Count(&count)
+		}
+		if count == 0 {
+			return fmt.Errorf("webhook_id must be one of your webhooks")
+		}
+	default:
+		return fmt.Errorf("action must be help, status, ping, reply or forward")
+	}
+
+	senders := cleanRecipients(strings.Split(cmd.AllowedSenders, ","))
+	if len(senders) == 0 {
+		return fmt.Errorf("allowed_senders is required: phone numbers, or * for anyone")
+	}
+	cmd.AllowedSenders = strings.Join(senders, ",")
+	return nil
+}
+
+// ParseCommand splits a message that starts with the command prefix into the command's
+// name and arguments. Quotes group words into one argument.
+func ParseCommand(content string) (name string, args []string, argText string, ok bool) {
+	prefix := CommandPrefix()
+	content = strings.TrimSpace(content)
+	if prefix == "" || !strings.HasPrefix(content, prefix) {
+		return "", nil, "", false
+	}
+	content = strings.TrimPrefix(content, prefix)
+
+	name = content
+	if i := strings.IndexFunc(content, unicode.IsSpace); i >= 0 {
+		name, argText = content[:i], content[i:]
+	}
+	name = strings.ToLower(name)
+	if !commandName.MatchString(name) {
+		return "", nil, "", false
+	}
+	argText = strings.TrimSpace(argText)
+	return name, splitCommandArgs(argText), argText, true
+}
+
+// splitCommandArgs splits arguments on spaces, keeping quoted text together
+func splitCommandArgs(text string) []string {
+	args := []string{}
+	var current strings.Builder
+	var quote rune
+	inArg := false
+	for _, r := range text {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote, inArg = r, true
+		case quote == 0 && unicode.IsSpace(r):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args
+}
+
+// commandAllowed reports whether a phone number is on a command's allowlist
+func commandAllowed(cmd *models.BotCommand, phone string) bool {
+	senders := cmd.GetAllowedSenders()
+	return contains(senders, "*") || phone != "" && models.PhoneNumberMatches(phone, senders)
+}
+
+// HandleCommand runs a received message that's one of the user's commands, sent by
+// someone on its allowlist, and reports whether it did. Other messages, including
+// commands from senders not on the allowlist, are left to rules and webhooks.
+func HandleCommand(userID uint, msg models.MessageReceivedData) bool {
+	// Our own messages include the bot's answers
+	if msg.IsFromMe {
+		return false
+	}
+	name, args, argText, ok := ParseCommand(msg.Content)
+	if !ok {
+		return false
+	}
+
+	// Find rather than First: most messages starting with the prefix aren't commands,
+	// and a missing record isn't worth logging
+	var matches []models.BotCommand
+	db.GetDB().Where("user_id = ? AND name = ? AND is_active = ?", userID, name, true).Limit(1).Find(&matches)
+	if len(matches) == 0 {
+		return false
+	}
+	cmd := matches[0]
+	if !commandAllowed(&cmd, msg.FromPhone) {
+		commandLog.Info("Command from sender not on its allowlist", "command", name, "from", msg.FromPhone)
+		return false
+	}
+	commandLog.Info("Running command", "command", name, "from", msg.FromPhone, "chat", msg.Chat)
+
+	data := models.CommandReceivedData{
+		Command:   name,
+		Args:      args,
+		ArgText:   argText,
+		Chat:      msg.Chat,
+		From:      msg.From,
+		FromPhone: msg.FromPhone,
+		FromName:  msg.FromName,
+		IsGroup:   msg.IsGroup,
+		MessageID: msg.MessageID,
+		Timestamp: msg.Timestamp,
+	}
+	switch cmd.Action {
+	case models.CommandActionHelp:
+		queueCommandReply(userID, msg.Chat, commandHelp(userID, msg.FromPhone))
+	case models.CommandActionStatus:
+		queueCommandReply(userID, msg.Chat, commandStatus(userID))
+	case models.CommandActionPing:
+		queueCommandReply(userID, msg.Chat, "pong")
+	case models.CommandActionReply:
+		payload, _ := json.Marshal(data)
+		rendered, err := RenderPayloadTemplate(cmd.Template, payload)
+		if err != nil {
+			commandLog.Error("Failed to render command reply", "command", name, "error", err)
+			break
+		}
+		queueCommandReply(userID, msg.Chat, strings.TrimSpace(string(rendered)))
+	case models.CommandActionForward:
+		if cmd.WebhookID == nil {
+			break
+		}
+		if err := GetWebhookService().ForwardEvent(userID, *cmd.WebhookID, models.CommandReceivedEvent, data); err != nil {
+			commandLog.Error("Failed to forward command", "command", name, "webhook_id", *cmd.WebhookID, "error", err)
+		}
+	}
+	return true
+}
+
+// commandHelp lists the commands a sender may use
+func commandHelp(userID uint, phone string) string {
+	var commands []models.BotCommand
+	db.GetDB().Where("user_id = ? AND is_active = ?", userID, true).Order("name").Find(&commands)
+
+	prefix := CommandPrefix()
+	lines := []string{"*Commands*"}
+	for i := range commands {
+		cmd := &commands[i]
+		if !commandAllowed(cmd, phone) {
+			continue
+		}
+		line := prefix + cmd.Name
+		description := cmd.Description
+		if description == "" {
+			description = builtinCommandHelp[cmd.Action]
+		}
+		if description != "" {
+			line += " - " + description
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// commandStatus reports the WhatsApp connection, the send queue and the last day's
+// message counts
+func commandStatus(userID uint) string {
+	status := whatsapp.GetClient().GetStatus()
+	var lines []string
+	switch {
+	case status.Connected && status.Degraded:
+		lines = append(lines, "WhatsApp: degraded ("+status.DegradedReason+")")
+	case status.Connected:
+		lines = append(lines, "WhatsApp: connected as +"+status.PhoneNumber)
+	default:
+		lines = append(lines, "WhatsApp: disconnected")
+	}
+
+	var queued int64
+	db.GetDB().Model(&models.OutgoingMessage{}).
+		Where("user_id = ? AND status IN ?", userID, []string{models.SendStatusQueued, models.SendStatusSending}).
+		Count(&queued)
+	lines = append(lines, fmt.Sprintf("Queued: %d", queued))
+
+	now := time.Now()
+	if points, err := MessageTimeseries(userID, now.Add(-23*time.Hour), now, time.Hour); err == nil {
+		var sent, received int64
+		for _, point := range points {
+			sent += point.Sent
+			received += point.Received
+		}
+		lines = append(lines, fmt.Sprintf("Last 24h: %d sent, %d received", sent, received))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// queueCommandReply queues a command's answer to the chat it came from
+func queueCommandReply(userID uint, chat, reply string) {
+	if reply == "" {
+		return
+	}
+	queued := []models.OutgoingMessage{{
+		UserID:      userID,
+		PhoneNumber: chat,
+		Message:     reply,
+		Source:      models.MessageSourceCommand,
+	}}
+	if err := GetSendQueue().Enqueue(db.GetDB(), queued); err != nil {
+		commandLog.Error("Failed to queue command reply", "chat", chat, "error", err)
+	}
+}
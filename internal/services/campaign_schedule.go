@@ -0,0 +1,92 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/models"
+)
+
+// campaignScheduleInterval is how often due scheduled campaigns are looked for
+const campaignScheduleInterval = 30 * time.Second
+
+// ErrCampaignNotScheduled is returned when unscheduling a campaign that isn't scheduled
+var ErrCampaignNotScheduled = errors.New("campaign not scheduled")
+
+// StartCampaignScheduler sends scheduled campaigns once they're due, including those
+// that came due while the server was down. With several instances, only the leader
+// sends them.
+func StartCampaignScheduler() {
+	go func() {
+		for {
+			if IsLeader() {
+				SendDueCampaigns(time.Now())
+			}
+			time.Sleep(campaignScheduleInterval)
+		}
+	}()
+}
+
+// ScheduleCampaign schedules a draft campaign to be sent at sendAt. It returns
+// ErrCampaignSent if the campaign isn't a draft anymore.
+func ScheduleCampaign(campaign *models.Campaign, sendAt time.Time) error {
+	result := db.GetDB().Model(&models.Campaign{}).
+		Where("id = ? AND status = ?", campaign.ID, models.CampaignStatusDraft).
+		Updates(map[string]interface{}{"status": models.CampaignStatusScheduled, "scheduled_at": sendAt, "schedule_error": ""})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCampaignSent
+	}
+	campaign.Status, campaign.ScheduledAt, campaign.ScheduleError = models.CampaignStatusScheduled, &sendAt, ""
+	campaignLog.Info("Campaign scheduled", "campaign_id", campaign.ID, "send_at", sendAt)
+	return nil
+}
+
+// UnscheduleCampaign makes a scheduled campaign a draft again. It returns
+// ErrCampaignNotScheduled if it isn't scheduled, e.g. because it was sent meanwhile.
+func UnscheduleCampaign(campaign *models.Campaign) error {
+	result := db.GetDB().Model(&models.Campaign{}).
+		Where("id = ? AND status = ?", campaign.ID, models.CampaignStatusScheduled).
+		Updates(map[string]interface{}{"status": models.CampaignStatusDraft, "scheduled_at": nil})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCampaignNotScheduled
+	}
+	campaign.Status, campaign.ScheduledAt = models.CampaignStatusDraft, nil
+	return nil
+}
+
+// SendDueCampaigns sends the scheduled campaigns due by now. Each is rendered for the
+// contacts on its list at the time, and queued like a campaign sent by hand. One that
+// can't be sent, e.g. because its list is now empty, goes back to being a draft with
+// the reason in schedule_error.
+func SendDueCampaigns(now time.Time) {
+	var due []models.Campaign
+	if err := db.GetDB().Where("status = ? AND scheduled_at <= ?", models.CampaignStatusScheduled, now).
+		Order("scheduled_at").Find(&due).Error; err != nil {
+		campaignLog.Error("Failed to read scheduled campaigns", "error", err)
+		return
+	}
+
+	for i := range due {
+		campaign := &due[i]
+		recipients, messages, err := PrepareCampaign(campaign)
+		if err == nil {
+			err = QueueCampaign(campaign, recipients, messages)
+		}
+		if errors.Is(err, ErrCampaignSent) {
+			continue // Unscheduled or deleted meanwhile
+		}
+		if err != nil {
+			campaignLog.Warn("Scheduled campaign not sent", "campaign_id", campaign.ID, "error", err)
+			db.GetDB().Model(&models.Campaign{}).
+				Where("id = ? AND status = ?", campaign.ID, models.CampaignStatusScheduled).
+				Updates(map[string]interface{}{"status": models.CampaignStatusDraft, "scheduled_at": nil, "schedule_error": err.Error()})
+		}
+	}
+}
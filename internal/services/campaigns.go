@@ -0,0 +1,359 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/logging"
+	"github.com/user/pinglater/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// campaignReplyWindow is how long after a campaign is sent a message from one of its
+// recipients counts as a reply to it
+const campaignReplyWindow = 7 * 24 * time.Hour
+
+// ErrCampaignSent is returned when sending a campaign that was already sent
+var ErrCampaignSent = errors.New("campaign already sent")
+
+var campaignLog = logging.Logger("campaigns")
+
+var (
+	optOutKeywordsMu sync.RWMutex
+	optOutKeywords   = []string{"stop", "unsubscribe"}
+)
+
+// SetOptOutKeywords sets the messages that opt their sender out of campaigns. A
+// direct message opts out when, trimmed, it's one of them, ignoring case.
+func SetOptOutKeywords(keywords []string) {
+	optOutKeywordsMu.Lock()
+	defer optOutKeywordsMu.Unlock()
+	optOutKeywords = cleanList(keywords, true)
+}
+
+// ValidateContactList checks a contact list's name
+func ValidateContactList(list *models.ContactList) error {
+	list.Name = strings.TrimSpace(list.Name)
+	if list.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	return nil
+}
+
+// ValidateCampaign checks a campaign's list, template and priority, and cleans up its tags
+func ValidateCampaign(campaign *models.Campaign) error {
+	campaign.Name = strings.TrimSpace(campaign.Name)
+	if campaign.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	var count int64
+	db.GetDB().Model(&models.ContactList{}).Where("id = ? AND user_id = ?", campaign.ListID, campaign.UserID).Count(&count)
+	if count == 0 {
+		return fmt.Errorf("list_id must be one of your contact lists")
+	}
+	if strings.TrimSpace(campaign.Template) == "" {
+		return fmt.Errorf("template is required")
+	}
+	if err := ValidatePayloadTemplate(campaign.Template); err != nil {
+		return fmt.Errorf("invalid template: %w", err)
+	}
+	priority, ok := models.NormalizeSendPriority(campaign.Priority)
+	if !ok {
+		return fmt.Errorf("priority must be high, normal or low")
+	}
+	campaign.Priority = priority
+	campaign.Tags = strings.Join(cleanList(strings.Split(campaign.Tags, ","), false), ",")
+	return nil
+}
+
+// PrepareCampaign renders a campaign for each contact it goes to. It returns a
+// recipient for each contact, and the messages to queue for those who haven't opted
+// out, in the same order.
+func PrepareCampaign(campaign *models.Campaign) ([]models.CampaignRecipient, []models.OutgoingMessage, error) {
+	var contacts []models.Contact
+	if err := db.GetDB().Where("list_id = ?", campaign.ListID).Order("id").Find(&contacts).Error; err != nil {
+		return nil, nil, err
+	}
+	if tags := campaign.GetTags(); len(tags) > 0 {
+		tagged := contacts[:0]
+		for _, contact := range contacts {
+			if contact.HasAnyTag(tags) {
+				tagged = append(tagged, contact)
+			}
+		}
+		contacts = tagged
+	}
+	if len(contacts) == 0 {
+		return nil, nil, fmt.Errorf("the campaign has no recipients")
+	}
+
+	phones := make([]string, len(contacts))
+	for i, contact := range contacts {
+		phones[i] = contact.PhoneNumber
+	}
+	optedOut, err := OptedOutNumbers(campaign.UserID, phones)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	recipients := make([]models.CampaignRecipient, 0, len(contacts))
+	messages := make([]models.OutgoingMessage, 0, len(contacts))
+	for i := range contacts {
+		contact := &contacts[i]
+		recipients = append(recipients, models.CampaignRecipient{
+			CampaignID:  campaign.ID,
+			PhoneNumber: contact.PhoneNumber,
+			Name:        contact.Name,
+		})
+		if optedOut[contact.PhoneNumber] {
+			continue
+		}
+
+		payload, _ := json.Marshal(map[string]interface{}{
+			"phone_number": contact.PhoneNumber,
+			"name":         contact.Name,
+			"tags":         contact.GetTags(),
+			"variables":    contact.GetVariables(),
+		})
+		rendered, err := RenderPayloadTemplate(campaign.Template, payload)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to render the template for %s: %w", contact.PhoneNumber, err)
+		}
+		message := strings.TrimSpace(string(rendered))
+		if message == "" {
+			return nil, nil, fmt.Errorf("the template renders an empty message for %s", contact.PhoneNumber)
+		}
+		messages = append(messages, models.OutgoingMessage{
+			UserID:      campaign.UserID,
+			PhoneNumber: contact.PhoneNumber,
+			Message:     message,
+			Source:      models.MessageSourceCampaign,
+			Priority:    campaign.Priority,
+		})
+	}
+	return recipients, messages, nil
+}
+
+// QueueCampaign queues a prepared campaign's messages and records its recipients. It
+// returns ErrCampaignSent if the campaign was sent, scheduled or unscheduled meanwhile.
+func QueueCampaign(campaign *models.Campaign, recipients []models.CampaignRecipient, messages []models.OutgoingMessage) error {
+	now := time.Now()
+	return db.GetDB().Transaction(func(tx *gorm.DB) error {
+		// Claim the campaign in the status it was read in first, so sending twice at
+		// once queues it once
+		result := tx.Model(&models.Campaign{}).
+			Where("id = ? AND status = ?", campaign.ID, campaign.Status).
+			Updates(map[string]interface{}{"status": models.CampaignStatusSent, "sent_at": now, "schedule_error": ""})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrCampaignSent
+		}
+
+		if len(messages) > 0 {
+			if err := GetSendQueue().Enqueue(tx, messages); err != nil {
+				return err
+			}
+		}
+		next := 0
+		for i := range recipients {
+			if next < len(messages) && messages[next].PhoneNumber == recipients[i].PhoneNumber {
+				recipients[i].MessageID = &messages[next].ID
+				next++
+			}
+		}
+		if err := tx.CreateInBatches(recipients, 100).Error; err != nil {
+			return err
+		}
+
+		campaign.Status, campaign.SentAt, campaign.ScheduleError = models.CampaignStatusSent, &now, ""
+		campaignLog.Info("Campaign queued", "campaign_id", campaign.ID, "recipients", len(recipients), "messages", len(messages))
+		return nil
+	})
+}
+
+// CampaignRecipients returns a campaign's recipients with the status of their messages
+func CampaignRecipients(campaignID uint) ([]models.CampaignRecipient, error) {
+	var recipients []models.CampaignRecipient
+	if err := db.GetDB().Where("campaign_id = ?", campaignID).Order("id").Find(&recipients).Error; err != nil {
+		return nil, err
+	}
+
+	var messageIDs []uint
+	for _, recipient := range recipients {
+		if recipient.MessageID != nil {
+			messageIDs = append(messageIDs, *recipient.MessageID)
+		}
+	}
+	messages := map[uint]models.OutgoingMessage{}
+	if len(messageIDs) > 0 {
+		var found []models.OutgoingMessage
+		if err := db.GetDB().Select("id", "status", "error").Where("id IN ?", messageIDs).Find(&found).Error; err != nil {
+			return nil, err
+		}
+		for _, msg := range found {
+			messages[msg.ID] = msg
+		}
+	}
+
+	for i := range recipients {
+		recipient := &recipients[i]
+		if recipient.MessageID == nil {
+			recipient.Status = models.RecipientStatusOptedOut
+			continue
+		}
+		msg := messages[*recipient.MessageID]
+		recipient.Status, recipient.Error = msg.Status, msg.Error
+	}
+	return recipients, nil
+}
+
+// CampaignStats aggregates a campaign's delivery funnel from its recipients' messages,
+// whose status follows the recipients' receipts
+func CampaignStats(campaignID uint) (models.CampaignStats, error) {
+	stats := models.CampaignStats{CampaignID: campaignID}
+
+	var rows []struct {
+		Status  *string
+		Count   int64
+		Replied int64
+	}
+	err := db.GetDB().Table("campaign_recipients").
+		Select("outgoing_messages.status AS status, COUNT(*) AS count, COUNT(campaign_recipients.replied_at) AS replied").
+		Joins("LEFT JOIN outgoing_messages ON outgoing_messages.id = campaign_recipients.message_id").
+		Where("campaign_recipients.campaign_id = ?", campaignID).
+		Group("outgoing_messages.status").
+		Scan(&rows).Error
+	if err != nil {
+		return stats, err
+	}
+
+	for _, row := range rows {
+		stats.Recipients += row.Count
+		stats.Replied += row.Replied
+		if row.Status == nil {
+			// Opted out, so nothing was queued
+			stats.OptedOut += row.Count
+			continue
+		}
+		stats.Queued += row.Count
+		switch *row.Status {
+		case models.SendStatusQueued, models.SendStatusSending:
+			stats.Pending += row.Count
+		case models.SendStatusFailed:
+			stats.Failed += row.Count
+		case models.SendStatusBlocked:
+			stats.Blocked += row.Count
+		case models.SendStatusRead:
+			stats.Read += row.Count
+			fallthrough
+		case models.SendStatusDelivered:
+			stats.Delivered += row.Count
+			fallthrough
+		case models.SendStatusSent:
+			stats.Sent += row.Count
+		}
+	}
+
+	stats.DeliveryRate = ratio(stats.Delivered, stats.Sent)
+	stats.ReadRate = ratio(stats.Read, stats.Delivered)
+	stats.ReplyRate = ratio(stats.Replied, stats.Sent)
+	return stats, nil
+}
+
+// ratio divides two counts, rounded to 4 places, and 0 when there's nothing to divide
+func ratio(part, whole int64) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return math.Round(float64(part)/float64(whole)*10000) / 10000
+}
+
+// RecordCampaignReply marks a received direct message as a reply to the latest campaign
+// sent to its sender in the last week, if they haven't replied to it yet
+func RecordCampaignReply(userID uint, msg models.MessageReceivedData) {
+	if msg.IsFromMe || msg.IsGroup || msg.FromPhone == "" {
+		return
+	}
+
+	var recipients []models.CampaignRecipient
+	err := db.GetDB().Model(&models.CampaignRecipient{}).
+		Joins("JOIN campaigns ON campaigns.id = campaign_recipients.campaign_id").
+		Where("campaigns.user_id = ? AND campaign_recipients.phone_number = ? AND campaign_recipients.message_id IS NOT NULL AND campaigns.sent_at >= ?",
+			userID, models.NormalizePhoneNumber(msg.FromPhone), time.Now().Add(-campaignReplyWindow)).
+		Order("campaigns.sent_at DESC").
+		Limit(1).
+		Find(&recipients).Error
+	if err != nil {
+		campaignLog.Error("Failed to look up campaign recipient", "user_id", userID, "error", err)
+		return
+	}
+	if len(recipients) == 0 || recipients[0].RepliedAt != nil {
+		return
+	}
+	db.GetDB().Model(&recipients[0]).Update("replied_at", time.Now())
+}
+
+// OptedOutNumbers reports which of the phone numbers opted out of the user's campaigns
+func OptedOutNumbers(userID uint, phones []string) (map[string]bool, error) {
+	optedOut := map[string]bool{}
+	if len(phones) == 0 {
+		return optedOut, nil
+	}
+	var found []string
+	err := db.GetDB().Model(&models.ContactOptOut{}).
+		Where("user_id = ? AND phone_number IN ?", userID, phones).
+		Pluck("phone_number", &found).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, phone := range found {
+		optedOut[phone] = true
+	}
+	return optedOut, nil
+}
+
+// RecordOptOut opts a phone number out of the user's campaigns, including the campaign
+// messages still queued for it
+func RecordOptOut(userID uint, phone, reason string) error {
+	phone = models.NormalizePhoneNumber(phone)
+	if phone == "" {
+		return fmt.Errorf("phone_number is required")
+	}
+	err := db.GetDB().Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.ContactOptOut{UserID: userID, PhoneNumber: phone, Reason: reason}).Error
+	if err != nil {
+		return err
+	}
+	return db.GetDB().Model(&models.OutgoingMessage{}).
+		Where("user_id = ? AND phone_number = ? AND source = ? AND status = ?", userID, phone, models.MessageSourceCampaign, models.SendStatusQueued).
+		Updates(map[string]interface{}{"status": models.SendStatusFailed, "error": "Recipient opted out"}).Error
+}
+
+// HandleOptOut opts the sender of a direct message out of the user's campaigns when the
+// message is an opt-out keyword. The message is otherwise handled as usual.
+func HandleOptOut(userID uint, msg models.MessageReceivedData) {
+	if msg.IsFromMe || msg.IsGroup || msg.FromPhone == "" {
+		return
+	}
+	optOutKeywordsMu.RLock()
+	keywords := optOutKeywords
+	optOutKeywordsMu.RUnlock()
+	if !contains(keywords, strings.TrimSpace(msg.Content)) {
+		return
+	}
+
+	if err := RecordOptOut(userID, msg.FromPhone, "keyword"); err != nil {
+		campaignLog.Error("Failed to record opt-out", "user_id", userID, "phone", msg.FromPhone, "error", err)
+		return
+	}
+	campaignLog.Info("Contact opted out of campaigns", "user_id", userID, "phone", msg.FromPhone)
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when a delivery is skipped because the target's circuit is open
+var ErrCircuitOpen = errors.New("circuit open: target is failing, delivery deferred to retry queue")
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuit tracks the health of a single delivery target
+type circuit struct {
+	state         circuitState
+	failures      int
+	openedAt      time.Time
+	probeInFlight bool
+}
+
+// CircuitBreaker short-circuits deliveries to targets that are clearly down, so a dead
+// endpoint doesn't cost a full HTTP timeout for every queued event
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	circuits  map[string]*circuit
+	threshold int           // Consecutive failures before the circuit opens
+	cooldown  time.Duration // How long the circuit stays open before a probe is allowed
+}
+
+// NewCircuitBreaker creates a circuit breaker. A threshold of 0 disables it.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		circuits:  make(map[string]*circuit),
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// Allow reports whether a request to the target may be attempted
+func (b *CircuitBreaker) Allow(target string) bool {
+	if b.threshold <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[target]
+	if !ok {
+		return true
+	}
+
+	switch c.state {
+	case circuitOpen:
+		if time.Since(c.openedAt) < b.cooldown {
+			return false
+		}
+		// Cooldown elapsed, let a single probe through
+		c.state = circuitHalfOpen
+		c.probeInFlight = true
+		return true
+	case circuitHalfOpen:
+		if c.probeInFlight {
+			return false
+		}
+		c.probeInFlight = true
+		return true
+	}
+	return true
+}
+
+// Record updates the target's circuit with the outcome of an attempt
+func (b *CircuitBreaker) Record(target string, success bool) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[target]
+	if !ok {
+		if success {
+			return
+		}
+		c = &circuit{}
+		b.circuits[target] = c
+	}
+
+	if success {
+		delete(b.circuits, target)
+		return
+	}
+
+	c.failures++
+	c.probeInFlight = false
+	if c.state == circuitHalfOpen || c.failures >= b.threshold {
+		c.state = circuitOpen
+		c.openedAt = time.Now()
+	}
+}
+
+// OpenCircuits returns the number of targets currently short-circuited
+func (b *CircuitBreaker) OpenCircuits() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	count := 0
+	for _, c := range b.circuits {
+		if c.state != circuitClosed {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"unicode/utf8"
+)
+
+// Defaults for delivery compression and stored response bodies
+const (
+	defaultGzipMinBytes     = 1024
+	defaultResponseMaxBytes = 64 << 10
+)
+
+// gzipPayload compresses a delivery body
+func gzipPayload(payload []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// shouldCompress reports whether a payload should be sent gzip-compressed. Only webhooks
+// whose receiver accepts Content-Encoding: gzip opt in, and small payloads aren't worth it.
+func (s *WebhookService) shouldCompress(compress bool, payload []byte) bool {
+	return compress && len(payload) >= s.gzipMinBytes
+}
+
+// readResponseBody reads at most limit bytes of a response body (0 = no limit)
+func readResponseBody(body io.Reader, limit int) string {
+	if limit <= 0 {
+		data, _ := io.ReadAll(body)
+		return string(data)
+	}
+	data, _ := io.ReadAll(io.LimitReader(body, int64(limit)))
+	return string(data)
+}
+
+// truncateBody cuts a stored body to limit bytes without splitting a UTF-8 character
+func truncateBody(body string, limit int) string {
+	if limit <= 0 || len(body) <= limit {
+		return body
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(body[cut]) {
+		cut--
+	}
+	return body[:cut]
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/logging"
+	"github.com/user/pinglater/internal/models"
+	"github.com/user/pinglater/internal/whatsapp"
+)
+
+var summaryLog = logging.Logger("summary")
+
+// connectionDrops counts disconnects since the last daily summary
+var connectionDrops atomic.Int64
+
+// DailySummaryConfig configures the daily summary report
+type DailySummaryConfig struct {
+	At string // Local time of day to send it, as HH:MM; empty disables the report
+	To string // Phone number to send it to; defaults to the linked account's own number
+}
+
+// RecordConnectionDrop counts a WhatsApp disconnect for the daily summary
+func RecordConnectionDrop() {
+	connectionDrops.Add(1)
+}
+
+// StartDailySummary sends the summary report of the last 24 hours each day at the
+// configured time: as a WhatsApp message, and as the daily_summary webhook event to the
+// linked device's owner, for delivery elsewhere such as email.
+func StartDailySummary(config DailySummaryConfig) error {
+	if config.At == "" {
+		return nil
+	}
+	at, err := time.Parse("15:04", config.At)
+	if err != nil {
+		return fmt.Errorf("time must be HH:MM, e.g. 08:00")
+	}
+
+	go func() {
+		for {
+			time.Sleep(time.Until(nextDailyRun(time.Now(), at.Hour(), at.Minute())))
+			if !IsLeader() {
+				summaryLog.Debug("Skipping the daily summary, another instance sends it")
+				continue
+			}
+			if err := SendDailySummary(config.To); err != nil {
+				summaryLog.Error("Failed to send the daily summary", "error", err)
+			}
+		}
+	}()
+	summaryLog.Info("Daily summary scheduled", "at", config.At)
+	return nil
+}
+
+// nextDailyRun returns the next time after now at the given local time of day
+func nextDailyRun(now time.Time, hour, minute int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// SendDailySummary builds the summary report and sends it to the phone number, or to
+// the linked account's own number when empty
+func SendDailySummary(to string) error {
+	summary, err := BuildDailySummary(time.Now())
+	if err != nil {
+		return err
+	}
+	connectionDrops.Add(-summary.ConnectionDrops)
+
+	client := whatsapp.GetClient()
+	ownerID := client.OwnerID()
+	if ownerID == 0 {
+		return fmt.Errorf("no user to send the summary for")
+	}
+	GetWebhookService().TriggerWebhooks(ownerID, string(models.EventTypeDailySummary), summary)
+
+	if to = models.NormalizePhoneNumber(to); to == "" {
+		to = client.GetPhoneNumber()
+	}
+	if to == "" {
+		summaryLog.Warn("Daily summary not sent to WhatsApp: no account linked and DAILY_SUMMARY_TO not set")
+		return nil
+	}
+	return GetSendQueue().Enqueue(db.GetDB(), []models.OutgoingMessage{{
+		UserID:      ownerID,
+		PhoneNumber: to,
+		Message:     FormatDailySummary(summary),
+		Source:      models.MessageSourceDailySummary,
+	}})
+}
+
+// BuildDailySummary reports the activity in the 24 hours before now, across all users.
+// Message counts are kept by the hour, so they cover whole hours.
+func BuildDailySummary(now time.Time) (*models.DailySummary, error) {
+	database := db.GetDB()
+	if database == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	summary := &models.DailySummary{
+		Since:           now.Add(-24 * time.Hour),
+		Until:           now,
+		ConnectionDrops: connectionDrops.Load(),
+		Connected:       whatsapp.GetClient().IsConnected(),
+	}
+	hourStart := summary.Since.UTC().Truncate(time.Hour)
+	var volume struct{ Sent, Received int64 }
+	if err := database.Model(&models.MessageVolume{}).
+		Select("COALESCE(SUM(sent), 0) AS sent, COALESCE(SUM(received), 0) AS received").
+		Where("hour >= ?", hourStart).Scan(&volume).Error; err != nil {
+		return nil, err
+	}
+	summary.MessagesSent, summary.MessagesReceived = volume.Sent, volume.Received
+
+	if err := database.Model(&models.WebhookDelivery{}).
+		Where("success = ? AND created_at >= ?", false, summary.Since).
+		Count(&summary.WebhookFailures).Error; err != nil {
+		return nil, err
+	}
+	if err := database.Model(&models.OutgoingMessage{}).
+		Where("status IN ?", []string{models.SendStatusQueued, models.SendStatusSending}).
+		Count(&summary.QueueBacklog).Error; err != nil {
+		return nil, err
+	}
+	if err := database.Model(&models.OutgoingMessage{}).
+		Where("status = ? AND created_at >= ?", models.SendStatusFailed, summary.Since).
+		Count(&summary.QueueFailed).Error; err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// FormatDailySummary renders the summary report as a WhatsApp message
+func FormatDailySummary(summary *models.DailySummary) string {
+	connection := "connected"
+	if !summary.Connected {
+		connection = "disconnected"
+	}
+	lines := []string{
+		"*PingLater daily summary*",
+		fmt.Sprintf("%s to %s", summary.Since.Format("Jan 2 15:04"), summary.Until.Format("Jan 2 15:04")),
+		"",
+		fmt.Sprintf("Messages sent: %d", summary.MessagesSent),
+		fmt.Sprintf("Messages received: %d", summary.MessagesReceived),
+		fmt.Sprintf("Webhook failures: %d", summary.WebhookFailures),
+		fmt.Sprintf("Send queue: %d waiting, %d failed", summary.QueueBacklog, summary.QueueFailed),
+		fmt.Sprintf("Connection drops: %d", summary.ConnectionDrops),
+		"WhatsApp: " + connection,
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/user/pinglater/internal/models"
+)
+
+// deliveryTargetKey identifies where a webhook delivers to, so webhooks pointing at the
+// same receiver can be recognised. HTTP URLs are compared case-insensitively on scheme
+// and host, ignoring a trailing slash; broker targets compare their whole config.
+func deliveryTargetKey(webhook *models.Webhook) string {
+	if isPublisherTarget(webhook) {
+		return webhook.TargetType + "\x00" + webhook.TargetConfig
+	}
+	parsed, err := url.Parse(webhook.URL)
+	if err != nil {
+		return webhook.URL
+	}
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	parsed.Host = strings.ToLower(parsed.Host)
+	parsed.Path = strings.TrimSuffix(parsed.Path, "/")
+	parsed.Fragment = ""
+	return parsed.String()
+}
+
+// orderForCollapse sorts webhooks so that those without collapse_duplicates come first,
+// then by ID. A receiver shared with an ordinary webhook then gets the event from that
+// webhook, and collapsing webhooks only add deliveries for targets nobody else covers.
+func orderForCollapse(webhooks []models.Webhook) {
+	sort.SliceStable(webhooks, func(i, j int) bool {
+		if webhooks[i].CollapseDuplicates != webhooks[j].CollapseDuplicates {
+			return !webhooks[i].CollapseDuplicates
+		}
+		return webhooks[i].ID < webhooks[j].ID
+	})
+}
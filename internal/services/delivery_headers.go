@@ -0,0 +1,72 @@
+package services
+
+import (
+	"net/http"
+	"os"
+	"strings"
+)
+
+// defaultUserAgent is sent with webhook deliveries unless WEBHOOK_USER_AGENT is set
+const defaultUserAgent = "PingLater-Webhook/1.0"
+
+// reservedDeliveryHeaders are set per delivery and can't be overridden by extra headers
+var reservedDeliveryHeaders = map[string]bool{
+	"Content-Type":        true,
+	"Content-Encoding":    true,
+	"Content-Length":      true,
+	"Authorization":       true,
+	"Host":                true,
+	"User-Agent":          true,
+	"X-Delivery-Id":       true,
+	"X-Webhook-Signature": true,
+	"X-Webhook-Test":      true,
+}
+
+// loadDeliveryHeaders builds the headers that identify this deployment on every delivery,
+// so receivers fanning in from several PingLater instances can tell them apart:
+// INSTANCE_ID and INSTANCE_ENVIRONMENT become X-Instance-Id and X-Instance-Environment,
+// and WEBHOOK_EXTRA_HEADERS adds comma-separated "Name: value" pairs
+func loadDeliveryHeaders() http.Header {
+	headers := make(http.Header)
+	if id := strings.TrimSpace(os.Getenv("INSTANCE_ID")); id != "" {
+		headers.Set("X-Instance-Id", id)
+	}
+	if env := strings.TrimSpace(os.Getenv("INSTANCE_ENVIRONMENT")); env != "" {
+		headers.Set("X-Instance-Environment", env)
+	}
+
+	for _, pair := range ParseEventTypesFromString(os.Getenv("WEBHOOK_EXTRA_HEADERS")) {
+		name, value, ok := strings.Cut(pair, ":")
+		name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			webhookLog.Warn("Ignoring invalid WEBHOOK_EXTRA_HEADERS entry, expected \"Name: value\"", "entry", pair)
+			continue
+		}
+		if reservedDeliveryHeaders[name] {
+			webhookLog.Warn("Ignoring WEBHOOK_EXTRA_HEADERS entry for a header PingLater sets itself", "header", name)
+			continue
+		}
+		headers.Set(name, strings.TrimSpace(value))
+	}
+	return headers
+}
+
+// deliveryUserAgent returns the User-Agent for webhook deliveries
+func deliveryUserAgent() string {
+	if ua := strings.TrimSpace(os.Getenv("WEBHOOK_USER_AGENT")); ua != "" {
+		return ua
+	}
+	return defaultUserAgent
+}
+
+// deliveryHeaderMap flattens headers to a map for broker targets, which carry one value per key
+func deliveryHeaderMap(headers http.Header) map[string]string {
+	if len(headers) == 0 {
+		return nil
+	}
+	flat := make(map[string]string, len(headers))
+	for name := range headers {
+		flat[name] = headers.Get(name)
+	}
+	return flat
+}
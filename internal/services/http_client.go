@@ -0,0 +1,174 @@
+package services
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/user/pinglater/internal/models"
+)
+
+// webhookTimeout is the per-request timeout for webhook deliveries
+const webhookTimeout = 30 * time.Second
+
+// cachedClient is a per-webhook HTTP client along with the config it was built from
+type cachedClient struct {
+	key    string
+	client *http.Client
+}
+
+// loadGlobalTLSConfig builds the TLS config shared by all webhook deliveries from the environment:
+// WEBHOOK_TLS_CA_FILE adds a CA bundle, WEBHOOK_TLS_CLIENT_CERT/WEBHOOK_TLS_CLIENT_KEY set a client certificate
+func loadGlobalTLSConfig() (*tls.Config, error) {
+	caFile := os.Getenv("WEBHOOK_TLS_CA_FILE")
+	certFile := os.Getenv("WEBHOOK_TLS_CLIENT_CERT")
+	keyFile := os.Getenv("WEBHOOK_TLS_CLIENT_KEY")
+
+	if caFile == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		caPEM, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool, err := systemPoolWith(caPEM)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// webhookTLSConfig layers a webhook's own CA bundle and client certificate over the global config
+func webhookTLSConfig(base *tls.Config, webhook *models.Webhook) (*tls.Config, error) {
+	var config *tls.Config
+	if base != nil {
+		config = base.Clone()
+	} else {
+		config = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	if webhook.TLSCACert != "" {
+		pool, err := systemPoolWith([]byte(webhook.TLSCACert))
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+
+	if webhook.TLSClientCert != "" || webhook.TLSClientKey != "" {
+		cert, err := tls.X509KeyPair([]byte(webhook.TLSClientCert), []byte(webhook.TLSClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// systemPoolWith returns the system cert pool extended with the given PEM bundle
+func systemPoolWith(caPEM []byte) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no valid certificates found in CA bundle")
+	}
+	return pool, nil
+}
+
+// newHTTPClient creates a webhook HTTP client using the given TLS and proxy settings
+func newHTTPClient(tlsConfig *tls.Config, proxy proxyConfig) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy.proxyFunc()
+	transport.DialContext = proxy.dialContext()
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	return &http.Client{
+		Timeout:   webhookTimeout,
+		Transport: transport,
+	}
+}
+
+// transportKey identifies the transport-affecting settings of a webhook, so cached
+// clients are rebuilt when they change
+func transportKey(webhook *models.Webhook) string {
+	h := sha256.New()
+	h.Write([]byte(webhook.TLSCACert))
+	h.Write([]byte{0})
+	h.Write([]byte(webhook.TLSClientCert))
+	h.Write([]byte{0})
+	h.Write([]byte(webhook.TLSClientKey))
+	h.Write([]byte{0})
+	h.Write([]byte(webhook.ProxyURL))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hasCustomTransport reports whether a webhook needs its own HTTP client
+func hasCustomTransport(webhook *models.Webhook) bool {
+	return webhook.TLSCACert != "" || webhook.TLSClientCert != "" || webhook.TLSClientKey != "" ||
+		webhook.ProxyURL != ""
+}
+
+// clientFor returns the HTTP client to use for a webhook
+func (s *WebhookService) clientFor(webhook *models.Webhook) (*http.Client, error) {
+	if !hasCustomTransport(webhook) {
+		return s.httpClient, nil
+	}
+
+	key := transportKey(webhook)
+
+	s.mu.RLock()
+	cached, ok := s.clients[webhook.ID]
+	s.mu.RUnlock()
+	if ok && cached.key == key {
+		return cached.client, nil
+	}
+
+	tlsConfig, err := webhookTLSConfig(s.baseTLS, webhook)
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := s.webhookProxy(webhook)
+	if err != nil {
+		return nil, err
+	}
+	client := newHTTPClient(tlsConfig, proxy)
+
+	s.mu.Lock()
+	s.clients[webhook.ID] = &cachedClient{key: key, client: client}
+	s.mu.Unlock()
+
+	return client, nil
+}
+
+// ValidateWebhookTLS checks that a webhook's TLS material parses
+func ValidateWebhookTLS(webhook *models.Webhook) error {
+	if webhook.TLSCACert == "" && webhook.TLSClientCert == "" && webhook.TLSClientKey == "" {
+		return nil
+	}
+	_, err := webhookTLSConfig(nil, webhook)
+	return err
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/models"
+)
+
+// ignoreListTTL is how long a user's ignore list is cached. Changes made through this
+// instance apply right away; those made through another instance sharing the
+// database, within this time.
+const ignoreListTTL = 30 * time.Second
+
+type cachedIgnoreList struct {
+	entries  []models.IgnoredChat
+	loadedAt time.Time
+}
+
+var (
+	ignoreLists   = make(map[uint]*cachedIgnoreList)
+	ignoreListsMu sync.Mutex
+)
+
+// IgnoresEvent reports whether an event comes from a chat on the user's ignore list.
+// It's checked for every received message, so the lists are cached.
+func IgnoresEvent(userID uint, data interface{}) bool {
+	if userID == 0 {
+		return false
+	}
+
+	var jids []string
+	switch d := data.(type) {
+	case models.MessageReceivedData:
+		jids = []string{d.Chat}
+		if !d.IsGroup && d.FromPhone != "" {
+			// Direct chats may be addressed by LID; match phone numbers too
+			jids = append(jids, d.FromPhone+"@s.whatsapp.net")
+		}
+	case models.GroupParticipantChangedData:
+		jids = []string{d.Group}
+	default:
+		return false
+	}
+
+	entries := ignoreList(userID)
+	for i := range entries {
+		if entries[i].MatchesChat(jids...) {
+			return true
+		}
+	}
+	return false
+}
+
+// InvalidateIgnoreList drops the cached ignore list of the user, after it changed
+func InvalidateIgnoreList(userID uint) {
+	ignoreListsMu.Lock()
+	delete(ignoreLists, userID)
+	ignoreListsMu.Unlock()
+}
+
+// ignoreList returns the user's ignore list, from the cache while it's fresh
+func ignoreList(userID uint) []models.IgnoredChat {
+	ignoreListsMu.Lock()
+	defer ignoreListsMu.Unlock()
+
+	if cached, ok := ignoreLists[userID]; ok && time.Since(cached.loadedAt) < ignoreListTTL {
+		return cached.entries
+	}
+	var entries []models.IgnoredChat
+	if err := db.GetDB().Where("user_id = ?", userID).Find(&entries).Error; err != nil {
+		ruleLog.Error("Failed to load ignore list", "user_id", userID, "error", err)
+		return nil
+	}
+	ignoreLists[userID] = &cachedIgnoreList{entries: entries, loadedAt: time.Now()}
+	return entries
+}
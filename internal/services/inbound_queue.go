@@ -0,0 +1,255 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/logging"
+	"github.com/user/pinglater/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// inboundPollInterval is how often the idle worker checks the queue without being woken
+	inboundPollInterval = 5 * time.Second
+	// inboundMaxAttempts is how many times processing an event may start before it's
+	// dropped, so an event that crashes the server can't do so on every start
+	inboundMaxAttempts = 3
+	// inboundBatchSize is how many events the worker reads at a time
+	inboundBatchSize = 100
+)
+
+var inboundLog = logging.Logger("inbound")
+
+// inboundDecoders decode the stored data of the event types the inbound queue takes
+var inboundDecoders = map[models.EventType]func([]byte) (interface{}, error){
+	models.EventTypeMessageReceived:         decodeMessageReceived,
+	models.EventTypeMessageDelivered:        decodeMessageReceipt,
+	models.EventTypeMessageRead:             decodeMessageReceipt,
+	models.EventTypeGroupParticipantChanged: decodeInboundData[models.GroupParticipantChangedData],
+	models.EventTypeCallReceived:            decodeInboundData[models.CallReceivedData],
+	models.EventTypeConnected:               decodeInboundData[models.ConnectionEventData],
+	models.EventTypeDisconnected:            decodeInboundData[models.ConnectionEventData],
+	models.EventTypeReconnectFailed:         decodeInboundData[models.ConnectionEventData],
+	models.EventTypeConnectionDegraded:      decodeInboundData[models.ConnectionEventData],
+	models.EventTypeConnectionRestored:      decodeInboundData[models.ConnectionEventData],
+	models.EventTypeStreamError:             decodeInboundData[models.WhatsAppErrorData],
+	models.EventTypeTemporaryBan:            decodeInboundData[models.WhatsAppErrorData],
+	models.EventTypeRateLimited:             decodeInboundData[models.WhatsAppErrorData],
+}
+
+// InboundQueue stores WhatsApp events before they're processed, and processes them one
+// at a time in order. An event is only deleted once its handler returns, so webhooks
+// get every event at least once: after a crash, events are processed again, without
+// re-queueing the webhook deliveries that already exist for them.
+type InboundQueue struct {
+	db *gorm.DB
+
+	mu      sync.RWMutex
+	handler func(eventID, userID uint, eventType string, data interface{})
+
+	wake     chan struct{}
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+var (
+	inboundQueue     *InboundQueue
+	inboundQueueOnce sync.Once
+)
+
+// GetInboundQueue returns the inbound queue, starting its worker on first use
+func GetInboundQueue() *InboundQueue {
+	inboundQueueOnce.Do(func() {
+		inboundQueue = &InboundQueue{
+			db:       db.GetDB(),
+			wake:     make(chan struct{}, 1),
+			stopChan: make(chan struct{}),
+		}
+		if inboundQueue.db == nil {
+			return
+		}
+		inboundQueue.wg.Add(1)
+		go inboundQueue.worker()
+	})
+	return inboundQueue
+}
+
+// SetHandler sets the function that processes events. It gets the event's ID in the
+// queue, or 0 for an event that couldn't be stored. Events wait in the queue until it's
+// set.
+func (q *InboundQueue) SetHandler(handler func(eventID, userID uint, eventType string, data interface{})) {
+	q.mu.Lock()
+	q.handler = handler
+	q.mu.Unlock()
+	q.wakeWorker()
+}
+
+// Accepts reports whether the queue takes events of the type
+func (q *InboundQueue) Accepts(eventType string) bool {
+	_, ok := inboundDecoders[models.EventType(eventType)]
+	return ok
+}
+
+// Enqueue stores an event for processing. If it can't be stored, it's processed right
+// away instead, without the guarantee.
+func (q *InboundQueue) Enqueue(userID uint, eventType string, data interface{}) {
+	raw, err := encodeInboundData(data)
+	if err == nil && q.db != nil {
+		err = q.db.Create(&models.InboundEvent{UserID: userID, EventType: eventType, Data: string(raw)}).Error
+		if err == nil {
+			q.wakeWorker()
+			return
+		}
+	}
+	inboundLog.Error("Failed to queue event, processing it now", "event", eventType, "error", err)
+	q.mu.RLock()
+	handler := q.handler
+	q.mu.RUnlock()
+	if handler != nil {
+		handler(0, userID, eventType, data)
+	}
+}
+
+// Stop waits for the event being processed, if any. The rest are processed after the
+// next start.
+func (q *InboundQueue) Stop() {
+	q.stopOnce.Do(func() { close(q.stopChan) })
+	q.wg.Wait()
+}
+
+func (q *InboundQueue) wakeWorker() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// worker processes queued events, oldest first, until the queue is stopped
+func (q *InboundQueue) worker() {
+	defer q.wg.Done()
+
+	for {
+		for q.processBatch() {
+		}
+
+		select {
+		case <-q.stopChan:
+			return
+		case <-q.wake:
+		case <-time.After(inboundPollInterval):
+		}
+	}
+}
+
+// processBatch processes the oldest queued events, and reports whether there may be more
+func (q *InboundQueue) processBatch() bool {
+	q.mu.RLock()
+	handler := q.handler
+	q.mu.RUnlock()
+	// With several instances, events stored by any of them are processed by the leader
+	if handler == nil || !IsLeader() {
+		return false
+	}
+
+	var events []models.InboundEvent
+	if err := q.db.Order("id").Limit(inboundBatchSize).Find(&events).Error; err != nil {
+		inboundLog.Error("Failed to read the inbound queue", "error", err)
+		return false
+	}
+	for i := range events {
+		select {
+		case <-q.stopChan:
+			return false
+		default:
+		}
+		q.process(&events[i], handler)
+	}
+	return len(events) == inboundBatchSize
+}
+
+// process runs the handler for an event and deletes it
+func (q *InboundQueue) process(event *models.InboundEvent, handler func(uint, uint, string, interface{})) {
+	// Count the attempt first, so one that crashes the server counts too
+	event.Attempts++
+	if err := q.db.Model(event).Update("attempts", event.Attempts).Error; err != nil {
+		inboundLog.Error("Failed to update inbound event", "id", event.ID, "error", err)
+		return
+	}
+
+	decode, ok := inboundDecoders[models.EventType(event.EventType)]
+	switch {
+	case !ok:
+		inboundLog.Warn("Dropping inbound event of unknown type", "id", event.ID, "event", event.EventType)
+	case event.Attempts > inboundMaxAttempts:
+		inboundLog.Error("Dropping inbound event after repeated failures", "id", event.ID, "event", event.EventType, "attempts", event.Attempts-1)
+	default:
+		data, err := decode([]byte(event.Data))
+		if err != nil {
+			inboundLog.Error("Dropping inbound event that can't be decoded", "id", event.ID, "event", event.EventType, "error", err)
+			break
+		}
+		handler(event.ID, event.UserID, event.EventType, data)
+	}
+
+	if err := q.db.Delete(event).Error; err != nil {
+		inboundLog.Error("Failed to delete processed inbound event", "id", event.ID, "error", err)
+	}
+}
+
+// queuedMessageReceived stores a received message with the fields its JSON leaves out
+type queuedMessageReceived struct {
+	models.MessageReceivedData
+	SenderJID string
+	Type      string
+	Caption   string
+	Media     *models.MessageMedia
+}
+
+// queuedMessageReceipt stores a receipt with the fields its JSON leaves out
+type queuedMessageReceipt struct {
+	models.MessageReceiptData
+	SenderJID string
+}
+
+func encodeInboundData(data interface{}) ([]byte, error) {
+	switch d := data.(type) {
+	case models.MessageReceivedData:
+		return json.Marshal(queuedMessageReceived{MessageReceivedData: d, SenderJID: d.SenderJID, Type: d.Type, Caption: d.Caption, Media: d.Media})
+	case models.MessageReceiptData:
+		return json.Marshal(queuedMessageReceipt{MessageReceiptData: d, SenderJID: d.SenderJID})
+	}
+	return json.Marshal(data)
+}
+
+func decodeMessageReceived(raw []byte) (interface{}, error) {
+	var queued queuedMessageReceived
+	if err := json.Unmarshal(raw, &queued); err != nil {
+		return nil, err
+	}
+	msg := queued.MessageReceivedData
+	msg.SenderJID, msg.Type, msg.Caption, msg.Media = queued.SenderJID, queued.Type, queued.Caption, queued.Media
+	return msg, nil
+}
+
+func decodeMessageReceipt(raw []byte) (interface{}, error) {
+	var queued queuedMessageReceipt
+	if err := json.Unmarshal(raw, &queued); err != nil {
+		return nil, err
+	}
+	receipt := queued.MessageReceiptData
+	receipt.SenderJID = queued.SenderJID
+	return receipt, nil
+}
+
+func decodeInboundData[T any](raw []byte) (interface{}, error) {
+	var data T
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("invalid %T: %w", data, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/user/pinglater/internal/models"
+)
+
+// inboundWebhookName is what inbound webhook names may look like, as they appear in URLs
+var inboundWebhookName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// ValidateInboundWebhook checks an inbound webhook's name, template and routing. It
+// cleans up recipients given with a leading +.
+func ValidateInboundWebhook(hook *models.InboundWebhook) error {
+	if !inboundWebhookName.MatchString(hook.Name) {
+		return fmt.Errorf("name must be 1-64 lowercase letters, digits, - or _")
+	}
+	if strings.TrimSpace(hook.Template) == "" {
+		return fmt.Errorf("template is required")
+	}
+	if err := ValidatePayloadTemplate(hook.Template); err != nil {
+		return fmt.Errorf("invalid template: %w", err)
+	}
+
+	recipients := cleanRecipients(hook.GetRecipients())
+	hook.SetRecipients(recipients)
+	routes := hook.GetRoutes()
+	for i, route := range routes {
+		if route.Field == "" {
+			return fmt.Errorf("route %d: field is required", i+1)
+		}
+		routes[i].Recipients = cleanRecipients(route.Recipients)
+		if len(routes[i].Recipients) == 0 {
+			return fmt.Errorf("route %d: recipients are required", i+1)
+		}
+	}
+	hook.SetRoutes(routes)
+
+	if len(recipients) == 0 && len(routes) == 0 {
+		return fmt.Errorf("recipients or routes are required")
+	}
+	return nil
+}
+
+// cleanRecipients trims recipients and drops empty ones
+func cleanRecipients(recipients []string) []string {
+	cleaned := make([]string, 0, len(recipients))
+	for _, recipient := range recipients {
+		recipient = strings.TrimPrefix(strings.TrimSpace(recipient), "+")
+		if recipient != "" {
+			cleaned = append(cleaned, recipient)
+		}
+	}
+	return cleaned
+}
+
+// RenderInboundWebhook renders a request to an inbound webhook into a message and picks
+// its recipients: those of the first route matching the request, otherwise the
+// webhook's default recipients. A body that isn't a JSON object is available to the
+// template as .body.
+func RenderInboundWebhook(hook *models.InboundWebhook, payload []byte) (string, []string, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		data = map[string]interface{}{"body": string(payload)}
+	}
+
+	recipients := hook.GetRecipients()
+	for _, route := range hook.GetRoutes() {
+		if value, ok := lookupField(data, route.Field); ok && value == route.Value {
+			recipients = route.Recipients
+			break
+		}
+	}
+
+	t, err := template.New("inbound").Funcs(payloadTemplateFuncs).Option("missingkey=zero").Parse(hook.Template)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", nil, fmt.Errorf("failed to render template: %w", err)
+	}
+	return strings.TrimSpace(buf.String()), recipients, nil
+}
+
+// lookupField finds a dotted path in decoded JSON and returns its value as text
+func lookupField(data map[string]interface{}, path string) (string, bool) {
+	var value interface{} = data
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if value, ok = object[key]; !ok {
+			return "", false
+		}
+	}
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case nil:
+		return "", true
+	case map[string]interface{}, []interface{}:
+		return "", false
+	default:
+		return fmt.Sprint(v), true
+	}
+}
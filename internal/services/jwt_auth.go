@@ -0,0 +1,94 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/user/pinglater/internal/models"
+)
+
+// deliveryJWTLifetime is how long a delivery's JWT is valid, enough to absorb clock skew
+// without letting a captured token be replayed for long
+const deliveryJWTLifetime = 5 * time.Minute
+
+// deliveryJWTIssuer is the iss claim of delivery JWTs
+const deliveryJWTIssuer = "pinglater"
+
+// deliveryJWTKey returns the signing method and key for a webhook's JWT settings
+func deliveryJWTKey(algorithm, key string) (jwt.SigningMethod, interface{}, error) {
+	if key == "" {
+		return nil, nil, fmt.Errorf("auth_jwt_key is required when auth_jwt_algorithm is set")
+	}
+
+	switch algorithm {
+	case "HS256":
+		if len(key) < 32 {
+			return nil, nil, fmt.Errorf("HS256 keys must be at least 32 characters")
+		}
+		return jwt.SigningMethodHS256, []byte(key), nil
+	case "RS256":
+		privateKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(key))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid RSA private key: %w", err)
+		}
+		return jwt.SigningMethodRS256, privateKey, nil
+	case "ES256":
+		privateKey, err := jwt.ParseECPrivateKeyFromPEM([]byte(key))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid EC private key: %w", err)
+		}
+		if privateKey.Curve.Params().Name != "P-256" {
+			return nil, nil, fmt.Errorf("ES256 requires a P-256 key")
+		}
+		return jwt.SigningMethodES256, privateKey, nil
+	}
+	return nil, nil, fmt.Errorf("auth_jwt_algorithm must be 'HS256', 'RS256' or 'ES256'")
+}
+
+// ValidateWebhookJWT checks that a webhook's JWT settings can sign deliveries
+func ValidateWebhookJWT(webhook *models.Webhook) error {
+	if webhook.AuthJWTAlgorithm == "" {
+		return nil
+	}
+	_, _, err := deliveryJWTKey(webhook.AuthJWTAlgorithm, webhook.AuthJWTKey)
+	return err
+}
+
+// signDeliveryJWT creates the short-lived JWT sent with a delivery. The body_sha256 claim
+// binds the token to this exact payload, so it can't be reused with a different body.
+func signDeliveryJWT(webhook *models.Webhook, payload []byte) (string, error) {
+	method, key, err := deliveryJWTKey(webhook.AuthJWTAlgorithm, webhook.AuthJWTKey)
+	if err != nil {
+		return "", err
+	}
+
+	audience := webhook.AuthJWTAudience
+	if audience == "" {
+		audience = webhook.URL
+	}
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+	bodyHash := sha256.Sum256(payload)
+	now := time.Now()
+
+	claims := jwt.MapClaims{
+		"iss":         deliveryJWTIssuer,
+		"sub":         strconv.FormatUint(uint64(webhook.ID), 10),
+		"aud":         audience,
+		"iat":         now.Unix(),
+		"nbf":         now.Unix(),
+		"exp":         now.Add(deliveryJWTLifetime).Unix(),
+		"jti":         hex.EncodeToString(jti),
+		"body_sha256": hex.EncodeToString(bodyHash[:]),
+	}
+
+	return jwt.NewWithClaims(method, claims).SignedString(key)
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/logging"
+	"github.com/user/pinglater/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// leaderLeaseName is the lease held by the instance running the background jobs
+	leaderLeaseName = "background_jobs"
+	// defaultLeaderLeaseTTL is how long a lease lasts without renewal when
+	// LEADER_LEASE_TTL is unset
+	defaultLeaderLeaseTTL = 30 * time.Second
+)
+
+var leaderLog = logging.Logger("leader")
+
+// LeaderElection picks one of the server instances sharing a database to run the
+// background jobs: webhook retries, the inbound queue, scheduled campaigns, the daily
+// summary and log retention. The leader holds a lease in the database and renews it;
+// if it stops, another instance takes over once the lease expires. A single instance
+// is always the leader.
+type LeaderElection struct {
+	db         *gorm.DB
+	instanceID string
+	ttl        time.Duration
+
+	leaseUntil atomic.Int64 // Unix nanoseconds; leader until then
+	leader     atomic.Bool  // For logging changes
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+var (
+	leaderElection     *LeaderElection
+	leaderElectionOnce sync.Once
+)
+
+// GetLeaderElection returns the leader election, trying to become the leader and
+// starting the renewal loop on first use
+func GetLeaderElection() *LeaderElection {
+	leaderElectionOnce.Do(func() {
+		ttl := envDuration("LEADER_LEASE_TTL", defaultLeaderLeaseTTL)
+		if ttl <= 0 {
+			ttl = defaultLeaderLeaseTTL
+		}
+		leaderElection = &LeaderElection{
+			db:         db.GetDB(),
+			instanceID: newInstanceID(),
+			ttl:        ttl,
+			stopChan:   make(chan struct{}),
+		}
+		if leaderElection.db == nil {
+			// Nothing to coordinate through; run everything here
+			leaderElection.leaseUntil.Store(1<<63 - 1)
+			return
+		}
+		leaderElection.renew()
+		leaderElection.wg.Add(1)
+		go leaderElection.run()
+	})
+	return leaderElection
+}
+
+// IsLeader reports whether this instance should run the background jobs
+func IsLeader() bool {
+	return GetLeaderElection().IsLeader()
+}
+
+// IsLeader reports whether this instance holds the lease
+func (e *LeaderElection) IsLeader() bool {
+	return time.Now().UnixNano() < e.leaseUntil.Load()
+}
+
+// InstanceID returns the ID this instance holds the lease under
+func (e *LeaderElection) InstanceID() string {
+	return e.instanceID
+}
+
+// Stop stops renewing the lease and releases it, so another instance takes over right
+// away instead of waiting for it to expire
+func (e *LeaderElection) Stop() {
+	e.stopOnce.Do(func() { close(e.stopChan) })
+	e.wg.Wait()
+	if e.db == nil {
+		return
+	}
+	e.leaseUntil.Store(0)
+	if err := e.db.Where("name = ? AND holder = ?", leaderLeaseName, e.instanceID).Delete(&models.LeaderLease{}).Error; err != nil {
+		leaderLog.Error("Failed to release the leader lease", "error", err)
+	}
+}
+
+// run renews the lease, or tries to take it over, several times per lease period
+func (e *LeaderElection) run() {
+	defer e.wg.Done()
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.stopChan:
+			return
+		case <-ticker.C:
+			e.renew()
+		}
+	}
+}
+
+// renew extends the lease if this instance holds it, or takes it if it has expired
+func (e *LeaderElection) renew() {
+	now := time.Now()
+	expires := now.Add(e.ttl)
+	acquired, err := e.acquire(now, expires)
+	if err != nil {
+		// Keep leading until the current lease runs out; another instance can't take
+		// over before then either
+		leaderLog.Error("Failed to renew the leader lease", "error", err)
+	} else if acquired {
+		e.leaseUntil.Store(expires.UnixNano())
+	} else {
+		e.leaseUntil.Store(0)
+	}
+
+	if leader := e.IsLeader(); leader != e.leader.Swap(leader) {
+		if leader {
+			leaderLog.Info("This instance now runs the background jobs", "instance_id", e.instanceID)
+		} else {
+			leaderLog.Warn("Another instance now runs the background jobs", "instance_id", e.instanceID)
+		}
+	}
+}
+
+// acquire updates the lease if this instance holds it or it has expired, or creates it
+// if there's none, and reports whether this instance holds it now
+func (e *LeaderElection) acquire(now, expires time.Time) (bool, error) {
+	result := e.db.Model(&models.LeaderLease{}).
+		Where("name = ? AND (holder = ? OR expires_at < ?)", leaderLeaseName, e.instanceID, now).
+		Updates(map[string]interface{}{"holder": e.instanceID, "expires_at": expires})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+
+	result = e.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.LeaderLease{Name: leaderLeaseName, Holder: e.instanceID, ExpiresAt: expires})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// newInstanceID returns an ID unique to this process: INSTANCE_ID or the host name, the
+// process ID and a random suffix, so instances sharing an INSTANCE_ID never share the
+// lease
+func newInstanceID() string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", instanceName(), os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// instanceName returns INSTANCE_ID or the host name, which stay the same when the
+// instance restarts
+func instanceName() string {
+	name := strings.TrimSpace(os.Getenv("INSTANCE_ID"))
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+	return name
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+
+	"github.com/user/pinglater/internal/logging"
+	"github.com/user/pinglater/internal/models"
+)
+
+// webhookLog is the webhook service's logger
+var webhookLog = logging.Logger("webhook")
+
+// logPayload logs a delivery at debug level. Payloads carry message content, so the body
+// itself is only included when WEBHOOK_LOG_PAYLOADS=true; otherwise just its size is.
+func (s *WebhookService) logPayload(msg string, webhook *models.Webhook, eventType string, payload []byte) {
+	attrs := []any{"webhook_id", webhook.ID, "event", eventType, "url", redactLogURL(webhook.URL), "bytes", len(payload)}
+	if s.logPayloads {
+		attrs = append(attrs, "payload", string(payload))
+	}
+	webhookLog.Debug(msg, attrs...)
+}
+
+// logDeliveryResult logs the outcome of a delivery attempt: info on success, warn on failure
+func logDeliveryResult(webhook *models.Webhook, eventType, deliveryID string, attempt int, success bool, status int, durationMs int64, err error) {
+	level, msg := slog.LevelInfo, "Webhook delivered"
+	attrs := []any{
+		"webhook_id", webhook.ID,
+		"event", eventType,
+		"delivery_id", deliveryID,
+		"attempt", attempt,
+		"status", status,
+		"duration_ms", durationMs,
+	}
+	if !success {
+		level, msg = slog.LevelWarn, "Webhook delivery failed"
+		if err != nil {
+			attrs = append(attrs, "error", err)
+		}
+	}
+	webhookLog.Log(context.Background(), level, msg, attrs...)
+}
+
+// redactLogURL drops credentials, the query string and the path from a webhook URL
+// before it is logged, since receivers often put secrets there (e.g. Slack hook tokens)
+func redactLogURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" {
+		return "invalid-url"
+	}
+	return parsed.Scheme + "://" + parsed.Host
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RecordMessageSent counts a message sent by the user in the current hour
+func RecordMessageSent(userID uint) {
+	recordMessageVolume(userID, "sent")
+}
+
+// RecordMessageReceived counts a message received by the user in the current hour
+func RecordMessageReceived(userID uint) {
+	recordMessageVolume(userID, "received")
+}
+
+func recordMessageVolume(userID uint, column string) {
+	database := db.GetDB()
+	if database == nil || userID == 0 {
+		return
+	}
+
+	row := models.MessageVolume{UserID: userID, Hour: time.Now().UTC().Truncate(time.Hour)}
+	if column == "sent" {
+		row.Sent = 1
+	} else {
+		row.Received = 1
+	}
+	err := database.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "hour"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{column: gorm.Expr(column + " + 1")}),
+	}).Create(&row).Error
+	if err != nil {
+		webhookLog.Warn("Failed to record message volume", "user_id", userID, "error", err)
+	}
+}
+
+// MessageTimeseries returns the user's sent and received message counts in buckets of
+// interval (an hour or a day, in UTC) covering [from, to). Empty buckets are included.
+func MessageTimeseries(userID uint, from, to time.Time, interval time.Duration) ([]models.MessageVolumePoint, error) {
+	database := db.GetDB()
+	if database == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	from, to = from.UTC().Truncate(interval), to.UTC()
+	var rows []models.MessageVolume
+	err := database.Where("user_id = ? AND hour >= ? AND hour < ?", userID, from, to).
+		Order("hour").Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	points := []models.MessageVolumePoint{}
+	index := make(map[time.Time]int)
+	for t := from; t.Before(to); t = t.Add(interval) {
+		index[t] = len(points)
+		points = append(points, models.MessageVolumePoint{Timestamp: t})
+	}
+	for _, row := range rows {
+		if i, ok := index[row.Hour.UTC().Truncate(interval)]; ok {
+			points[i].Sent += row.Sent
+			points[i].Received += row.Received
+		}
+	}
+	return points, nil
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"time"
+
+	"github.com/user/pinglater/internal/models"
+	"gorm.io/gorm"
+)
+
+// PipelineMetrics reports delivery concurrency, queue depth and retry backlog
+func (s *WebhookService) PipelineMetrics() models.WebhookPipelineMetrics {
+	m := models.WebhookPipelineMetrics{
+		InFlight:       s.inFlight.Load(),
+		Workers:        int(s.workers.Load()),
+		DeliveredTotal: s.deliveredTotal.Load(),
+		FailedTotal:    s.failedTotal.Load(),
+	}
+	if s.db == nil {
+		return m
+	}
+
+	now := time.Now()
+	s.db.Model(&models.WebhookOutbox{}).Count(&m.QueueDepth)
+	s.db.Model(&models.WebhookOutbox{}).
+		Where("status = ? AND available_at > ?", models.OutboxStatusPending, now).
+		Count(&m.QueueDeferred)
+
+	var oldest models.WebhookOutbox
+	if result := s.db.Order("id asc").Limit(1).Find(&oldest); result.Error == nil && result.RowsAffected > 0 {
+		m.OldestQueuedSeconds = int64(now.Sub(oldest.CreatedAt).Seconds())
+	}
+
+	// Mirrors the conditions retryFailedDeliveries uses to pick up deliveries
+	retries := s.db.Model(&models.WebhookDelivery{}).Where("success = ? AND next_retry_at IS NOT NULL", false)
+	retries.Session(&gorm.Session{}).Count(&m.RetryBacklog)
+	retries.Session(&gorm.Session{}).
+		Where("next_retry_at <= ?", now).
+		Count(&m.RetriesDue)
+
+	return m
+}
+
+// trackSend counts a delivery attempt as in flight until the returned func is called
+// with its outcome
+func (s *WebhookService) trackSend() func(success bool) {
+	s.inFlight.Add(1)
+	return func(success bool) {
+		s.inFlight.Add(-1)
+		if success {
+			s.deliveredTotal.Add(1)
+		} else {
+			s.failedTotal.Add(1)
+		}
+	}
+}
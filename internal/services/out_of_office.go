@@ -0,0 +1,110 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/logging"
+	"github.com/user/pinglater/internal/models"
+	"gorm.io/gorm/clause"
+)
+
+// outOfOfficeCooldown is how long a contact who got the out-of-office reply waits before
+// getting it again
+const outOfOfficeCooldown = 24 * time.Hour
+
+var outOfOfficeLog = logging.Logger("out_of_office")
+
+// ValidateOutOfOffice checks the out-of-office mode's message and period
+func ValidateOutOfOffice(ooo *models.OutOfOffice) error {
+	if ooo.IsActive && strings.TrimSpace(ooo.Message) == "" {
+		return fmt.Errorf("message is required")
+	}
+	if err := ValidatePayloadTemplate(ooo.Message); err != nil {
+		return fmt.Errorf("invalid message: %w", err)
+	}
+	if ooo.StartsAt != nil && ooo.EndsAt != nil && !ooo.EndsAt.After(*ooo.StartsAt) {
+		return fmt.Errorf("ends_at must be after starts_at")
+	}
+	return nil
+}
+
+// ApplyOutOfOffice sends the user's out-of-office reply to the sender of a received
+// message, if the mode is on and they haven't had the reply in the last day. Only
+// direct messages get it; groups would hear it from everyone who's away.
+func ApplyOutOfOffice(userID uint, msg models.MessageReceivedData) {
+	if msg.IsFromMe || msg.IsGroup || msg.FromPhone == "" {
+		return
+	}
+
+	var settings []models.OutOfOffice
+	db.GetDB().Where("user_id = ?", userID).Limit(1).Find(&settings)
+	now := time.Now()
+	if len(settings) == 0 || !settings[0].ActiveAt(now) {
+		return
+	}
+	if !claimOutOfOfficeReply(userID, msg.FromPhone, now) {
+		return
+	}
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	rendered, err := RenderPayloadTemplate(settings[0].Message, payload)
+	if err != nil {
+		outOfOfficeLog.Error("Failed to render out-of-office reply", "user_id", userID, "error", err)
+		return
+	}
+	reply := strings.TrimSpace(string(rendered))
+	if reply == "" {
+		return
+	}
+
+	queued := []models.OutgoingMessage{{
+		UserID:      userID,
+		PhoneNumber: msg.Chat,
+		Message:     reply,
+		Source:      models.MessageSourceOutOfOffice,
+	}}
+	if err := GetSendQueue().Enqueue(db.GetDB(), queued); err != nil {
+		outOfOfficeLog.Error("Failed to queue out-of-office reply", "user_id", userID, "error", err)
+		return
+	}
+	outOfOfficeLog.Info("Queued out-of-office reply", "user_id", userID, "to", msg.FromPhone)
+}
+
+// claimOutOfOfficeReply records that a contact gets the reply now, and reports whether
+// they're due one. Both steps are single statements, so two messages arriving together
+// get one reply between them.
+func claimOutOfOfficeReply(userID uint, contact string, now time.Time) bool {
+	database := db.GetDB()
+	result := database.Model(&models.OutOfOfficeReply{}).
+		Where("user_id = ? AND contact = ? AND replied_at <= ?", userID, contact, now.Add(-outOfOfficeCooldown)).
+		Update("replied_at", now)
+	if result.Error != nil {
+		outOfOfficeLog.Error("Failed to record out-of-office reply", "user_id", userID, "error", result.Error)
+		return false
+	}
+	if result.RowsAffected > 0 {
+		return true
+	}
+
+	// Not replied to before, or replied to within the cooldown
+	result = database.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.OutOfOfficeReply{UserID: userID, Contact: contact, RepliedAt: now})
+	if result.Error != nil {
+		outOfOfficeLog.Error("Failed to record out-of-office reply", "user_id", userID, "error", result.Error)
+		return false
+	}
+	return result.RowsAffected > 0
+}
+
+// ResetOutOfOfficeReplies forgets who got the reply, so everyone gets it again the next
+// time out-of-office mode is turned on
+func ResetOutOfOfficeReplies(userID uint) error {
+	return db.GetDB().Where("user_id = ?", userID).Delete(&models.OutOfOfficeReply{}).Error
+}
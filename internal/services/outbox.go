@@ -0,0 +1,251 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/user/pinglater/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultOutboxWorkers is the number of delivery workers when WEBHOOK_WORKERS is unset
+	defaultOutboxWorkers = 4
+	// outboxPollInterval is how often idle workers check the outbox without being woken
+	outboxPollInterval = 5 * time.Second
+	// outboxClaimTimeout is how long a claimed row may stay in processing before it is
+	// considered abandoned (e.g. the process crashed mid-delivery) and re-queued
+	outboxClaimTimeout = 5 * time.Minute
+)
+
+// enqueueDelivery writes a delivery to the outbox before any attempt is made
+func (s *WebhookService) enqueueDelivery(webhook *models.Webhook, eventType string, data interface{}) error {
+	return s.enqueueDeliveryWithID(webhook, eventType, data, uuid.NewString())
+}
+
+// enqueueDeliveryWithID writes a delivery with the given delivery ID to the outbox
+func (s *WebhookService) enqueueDeliveryWithID(webhook *models.Webhook, eventType string, data interface{}, deliveryID string) error {
+	payloadBytes, err := s.buildPayload(webhook, eventType, data)
+	if err != nil {
+		return err
+	}
+
+	item := models.WebhookOutbox{
+		WebhookID:  webhook.ID,
+		EventType:  eventType,
+		Payload:    string(payloadBytes),
+		Status:     models.OutboxStatusPending,
+		ReplyTo:    replyTarget(webhook, data),
+		DeliveryID: deliveryID,
+	}
+	return s.db.Create(&item).Error
+}
+
+// inboundDeliveryID derives the delivery ID of an inbound queue event for a webhook, so
+// an event processed again after a crash keeps its delivery IDs
+func inboundDeliveryID(inboundEventID, webhookID uint) string {
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(fmt.Sprintf("pinglater:inbound:%d:%d", inboundEventID, webhookID))).String()
+}
+
+// deliveryQueued reports whether a delivery with the ID is waiting in the outbox or was
+// already attempted
+func (s *WebhookService) deliveryQueued(deliveryID string) bool {
+	var count int64
+	s.db.Model(&models.WebhookOutbox{}).Where("delivery_id = ?", deliveryID).Count(&count)
+	if count == 0 {
+		s.db.Model(&models.WebhookDelivery{}).Where("delivery_id = ?", deliveryID).Count(&count)
+	}
+	return count > 0
+}
+
+// wakeOutboxWorkers nudges an idle worker without blocking
+func (s *WebhookService) wakeOutboxWorkers() {
+	select {
+	case s.outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+// startOutboxWorkers recovers abandoned rows and launches the delivery workers
+func (s *WebhookService) startOutboxWorkers() {
+	if s.db == nil {
+		return
+	}
+
+	workers := envInt("WEBHOOK_WORKERS", defaultOutboxWorkers)
+	if workers == 0 {
+		workers = defaultOutboxWorkers
+	}
+
+	s.requeueInterruptedOutboxItems()
+
+	s.workers.Store(int32(workers))
+	for i := 0; i < workers; i++ {
+		s.wg.Add(1)
+		go s.outboxWorker()
+	}
+}
+
+// outboxWorker claims and delivers outbox rows until the service is stopped
+func (s *WebhookService) outboxWorker() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain everything currently claimable before going idle
+		for {
+			select {
+			case <-s.stopChan:
+				return
+			default:
+			}
+
+			item, err := s.claimOutboxItem()
+			if err != nil {
+				webhookLog.Error("Failed to claim outbox item", "error", err)
+				break
+			}
+			if item == nil {
+				break
+			}
+			s.processOutboxItem(item)
+		}
+
+		select {
+		case <-s.stopChan:
+			return
+		case <-s.outboxWake:
+		case <-ticker.C:
+			s.requeueStaleOutboxItems()
+		}
+	}
+}
+
+// claimOutboxItem atomically moves the oldest pending row to processing.
+// Returns nil when there is nothing to claim.
+func (s *WebhookService) claimOutboxItem() (*models.WebhookOutbox, error) {
+	var claimed *models.WebhookOutbox
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var item models.WebhookOutbox
+		result := tx.Where("status = ? AND (available_at IS NULL OR available_at <= ?)", models.OutboxStatusPending, time.Now()).
+			Order("id asc").Limit(1).Find(&item)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		now := time.Now()
+		update := tx.Model(&models.WebhookOutbox{}).
+			Where("id = ? AND status = ?", item.ID, models.OutboxStatusPending).
+			Updates(map[string]interface{}{
+				"status":     models.OutboxStatusProcessing,
+				"claimed_at": now,
+				"claimed_by": s.instance,
+			})
+		if update.Error != nil {
+			return update.Error
+		}
+		// Another worker won the race; let the caller try again
+		if update.RowsAffected == 0 {
+			return nil
+		}
+
+		item.Status = models.OutboxStatusProcessing
+		item.ClaimedAt, item.ClaimedBy = &now, s.instance
+		claimed = &item
+		return nil
+	})
+
+	return claimed, err
+}
+
+// processOutboxItem delivers a claimed row and removes it from the outbox
+func (s *WebhookService) processOutboxItem(item *models.WebhookOutbox) {
+	var webhook models.Webhook
+	if err := s.db.First(&webhook, item.WebhookID).Error; err != nil {
+		webhookLog.Warn("Dropping outbox item, webhook not found", "outbox_id", item.ID, "webhook_id", item.WebhookID, "error", err)
+	} else if webhook.IsActive {
+		// Over the webhook's rate limit: put the row back until a slot frees up
+		if ok, availableAt := s.limiter.Reserve(webhook.ID, webhook.RateLimitPerMinute); !ok {
+			s.deferOutboxItem(item, availableAt)
+			return
+		}
+		if _, maxAge := s.retryLimits(&webhook); maxAge > 0 && time.Since(item.CreatedAt) > maxAge {
+			s.abandonOutboxItem(&webhook, item)
+		} else {
+			s.deliverWebhook(&webhook, item.EventType, []byte(item.Payload), item.ReplyTo, item.DeliveryID)
+		}
+	}
+
+	// The delivery record now owns the event (including any retries)
+	if err := s.db.Delete(&models.WebhookOutbox{}, item.ID).Error; err != nil {
+		webhookLog.Error("Failed to remove outbox item", "outbox_id", item.ID, "error", err)
+	}
+}
+
+// abandonOutboxItem records an event that waited in the outbox for longer than the
+// webhook's maximum delivery age as abandoned, without sending it
+func (s *WebhookService) abandonOutboxItem(webhook *models.Webhook, item *models.WebhookOutbox) {
+	delivery := models.WebhookDelivery{
+		WebhookID:       webhook.ID,
+		EventType:       item.EventType,
+		Payload:         item.Payload,
+		ErrorMessage:    "Not sent: queued for longer than the maximum delivery age",
+		ReplyTo:         item.ReplyTo,
+		DeliveryID:      item.DeliveryID,
+		AbandonedReason: models.AbandonedMaxAge,
+	}
+	if err := s.db.Create(&delivery).Error; err != nil {
+		webhookLog.Error("Failed to save webhook delivery", "webhook_id", webhook.ID, "error", err)
+	}
+	logAbandoned(webhook, item.EventType, item.DeliveryID, models.AbandonedMaxAge)
+}
+
+// deferOutboxItem releases a claimed row back to pending, not claimable before availableAt
+func (s *WebhookService) deferOutboxItem(item *models.WebhookOutbox, availableAt time.Time) {
+	err := s.db.Model(&models.WebhookOutbox{}).Where("id = ?", item.ID).Updates(map[string]interface{}{
+		"status":       models.OutboxStatusPending,
+		"claimed_at":   nil,
+		"claimed_by":   "",
+		"available_at": availableAt,
+	}).Error
+	if err != nil {
+		webhookLog.Error("Failed to defer outbox item", "outbox_id", item.ID, "error", err)
+	}
+}
+
+// requeueStaleOutboxItems returns rows abandoned in processing back to pending
+func (s *WebhookService) requeueStaleOutboxItems() {
+	cutoff := time.Now().Add(-outboxClaimTimeout)
+	s.requeueOutboxItems(s.db.Where("status = ? AND (claimed_at IS NULL OR claimed_at < ?)", models.OutboxStatusProcessing, cutoff))
+}
+
+// requeueInterruptedOutboxItems returns the rows this instance's previous run left in
+// processing (e.g. it crashed mid-delivery) back to pending right away. Other
+// instances may still be delivering theirs, so those wait for the claim timeout.
+func (s *WebhookService) requeueInterruptedOutboxItems() {
+	s.requeueOutboxItems(s.db.Where("status = ? AND claimed_by = ?", models.OutboxStatusProcessing, s.instance))
+}
+
+// requeueOutboxItems returns the processing rows matched by query back to pending
+func (s *WebhookService) requeueOutboxItems(query *gorm.DB) {
+	result := query.Model(&models.WebhookOutbox{}).
+		Updates(map[string]interface{}{
+			"status":     models.OutboxStatusPending,
+			"claimed_at": nil,
+			"claimed_by": "",
+		})
+	if result.Error != nil {
+		webhookLog.Error("Failed to requeue stale outbox items", "error", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		webhookLog.Warn("Requeued abandoned outbox items", "count", result.RowsAffected)
+	}
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/user/pinglater/internal/models"
+	"github.com/user/pinglater/internal/whatsapp"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// defaultRedaction replaces redacted text when an action doesn't say what with
+const defaultRedaction = "[redacted]"
+
+// cardNumberPattern finds candidate card numbers; cardNumber checks them
+var cardNumberPattern = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+
+func validateOutgoingRuleAction(userID uint, action models.RuleAction) error {
+	switch action.Type {
+	case models.RuleActionBlock:
+	case models.RuleActionAppend:
+		if strings.TrimSpace(action.Text) == "" {
+			return fmt.Errorf("text is required")
+		}
+	case models.RuleActionRedact:
+		switch {
+		case action.Preset != "" && action.Pattern != "":
+			return fmt.Errorf("pattern and preset can't go together")
+		case action.Preset != "":
+			if action.Preset != models.RedactPresetCardNumbers {
+				return fmt.Errorf("preset must be %s", models.RedactPresetCardNumbers)
+			}
+		case action.Pattern != "":
+			if _, err := regexp.Compile(action.Pattern); err != nil {
+				return fmt.Errorf("invalid pattern: %w", err)
+			}
+		default:
+			return fmt.Errorf("pattern or preset is required")
+		}
+	default:
+		return fmt.Errorf("type must be block, append or redact for outgoing rules")
+	}
+	return nil
+}
+
+// ApplyOutgoingRules runs the user's active outgoing rules on a message about to be
+// sent, in position order: append and redact actions change its text, and a block
+// action vetoes it. It's a whatsapp.SendHook, so it sees every message sent.
+func ApplyOutgoingRules(msg *whatsapp.OutgoingMessage) error {
+	if msg.UserID == 0 {
+		return nil
+	}
+
+	var rules []models.Rule
+	if err := activeRules(msg.UserID, models.RuleDirectionOutgoing, &rules); err != nil {
+		// Sending unchecked could leak what a redact rule is there to stop
+		ruleLog.Error("Failed to load outgoing rules", "user_id", msg.UserID, "error", err)
+		return fmt.Errorf("%w: outgoing rules couldn't be loaded", whatsapp.ErrSendHookFailed)
+	}
+
+	now := time.Now()
+	for i := range rules {
+		rule := &rules[i]
+		if !RuleMatches(rule, outgoingRuleSubject(msg), now) {
+			continue
+		}
+		ruleLog.Debug("Outgoing rule matched", "rule_id", rule.ID, "chat", msg.To.String())
+		recordRuleMatch(rule, now)
+
+		for _, action := range rule.GetActions() {
+			switch action.Type {
+			case models.RuleActionAppend:
+				if msg.Text != "" {
+					msg.Text += "\n"
+				}
+				msg.Text += action.Text
+			case models.RuleActionRedact:
+				msg.Text = redact(msg.Text, action)
+			case models.RuleActionBlock:
+				ruleLog.Info("Message blocked by rule", "rule_id", rule.ID, "chat", msg.To.String())
+				if action.Reason != "" {
+					return errors.New(action.Reason)
+				}
+				return fmt.Errorf("blocked by rule %q", rule.Name)
+			}
+		}
+		if rule.StopProcessing {
+			break
+		}
+	}
+	return nil
+}
+
+// outgoingRuleSubject describes a message about to be sent the way rule conditions
+// expect: senders match its recipient
+func outgoingRuleSubject(msg *whatsapp.OutgoingMessage) *models.MessageReceivedData {
+	subject := &models.MessageReceivedData{
+		Chat:    msg.To.String(),
+		IsGroup: msg.To.Server == types.GroupServer,
+		Content: msg.Text,
+	}
+	if !subject.IsGroup {
+		subject.FromPhone = msg.To.User
+	}
+	return subject
+}
+
+// redact replaces what a redact action matches in text
+func redact(text string, action models.RuleAction) string {
+	replacement := action.Replacement
+	if replacement == "" {
+		replacement = defaultRedaction
+	}
+
+	if action.Preset == models.RedactPresetCardNumbers {
+		return cardNumberPattern.ReplaceAllStringFunc(text, func(match string) string {
+			if !cardNumber(match) {
+				return match
+			}
+			return replacement
+		})
+	}
+	pattern, err := rulePattern(action.Pattern)
+	if err != nil {
+		return text
+	}
+	return pattern.ReplaceAllLiteralString(text, replacement)
+}
+
+// cardNumber reports whether the digits of a number pass the Luhn check
+func cardNumber(number string) bool {
+	sum, double := 0, false
+	for i := len(number) - 1; i >= 0; i-- {
+		ch := number[i]
+		if ch < '0' || ch > '9' {
+			continue
+		}
+		digit := int(ch - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	"github.com/user/pinglater/internal/models"
+)
+
+// payloadDataV2 converts an event's data to its version 2 form, and returns its data
+// type. Events without a typed form keep their version 1 data.
+func payloadDataV2(eventType string, data interface{}) (string, interface{}) {
+	switch d := data.(type) {
+	case models.MessageReceivedData:
+		return models.PayloadDataMessage, receivedMessageV2(d)
+	case *models.MessageReceivedData:
+		return models.PayloadDataMessage, receivedMessageV2(*d)
+	case models.MessageSentData:
+		return models.PayloadDataMessage, sentMessageV2(d)
+	case models.MessageReceiptData:
+		return models.PayloadDataReceipt, receiptV2(eventType, d)
+	}
+	return models.PayloadDataEvent, data
+}
+
+func receivedMessageV2(d models.MessageReceivedData) models.MessageDataV2 {
+	from := &models.PayloadParty{JID: d.SenderJID, Phone: d.FromPhone, Name: d.FromName}
+	if from.JID == "" {
+		from.JID = d.From
+	}
+	msg := models.MessageDataV2{
+		ID:        d.MessageID,
+		Direction: "incoming",
+		Chat:      d.Chat,
+		From:      from,
+		Type:      d.Type,
+		Text:      d.Content,
+		Media:     d.Media,
+		IsFromMe:  d.IsFromMe,
+		Tags:      d.Tags,
+		Timestamp: time.Unix(d.Timestamp, 0).UTC(),
+	}
+	if msg.Type == "" {
+		msg.Type = models.MessageTypeText
+	}
+	if msg.Text == "" {
+		msg.Text = d.Caption
+	}
+	if d.IsGroup {
+		msg.Group = &models.PayloadGroup{JID: d.Chat, Name: d.GroupName}
+	}
+	return msg
+}
+
+func sentMessageV2(d models.MessageSentData) models.MessageDataV2 {
+	msg := models.MessageDataV2{
+		ID:        d.MessageID,
+		Direction: "outgoing",
+		Chat:      d.To,
+		To:        &models.PayloadParty{JID: d.To, Phone: d.ToPhone},
+		Type:      models.MessageTypeText,
+		Text:      d.Content,
+		IsFromMe:  true,
+		Source:    d.Source,
+		Timestamp: time.Unix(d.Timestamp, 0).UTC(),
+	}
+	if strings.HasSuffix(d.To, "@g.us") {
+		msg.To = nil
+		msg.Group = &models.PayloadGroup{JID: d.To}
+	}
+	return msg
+}
+
+func receiptV2(eventType string, d models.MessageReceiptData) models.ReceiptDataV2 {
+	status := models.SendStatusDelivered
+	if eventType == string(models.EventTypeMessageRead) {
+		status = models.SendStatusRead
+	}
+	from := models.PayloadParty{JID: d.SenderJID, Phone: d.FromPhone}
+	if from.JID == "" {
+		from.JID = d.From
+	}
+	return models.ReceiptDataV2{
+		Status:     status,
+		Chat:       d.Chat,
+		From:       from,
+		MessageIDs: d.MessageIDs,
+		IsGroup:    d.IsGroup,
+		Timestamp:  time.Unix(d.Timestamp, 0).UTC(),
+	}
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/user/pinglater/internal/models"
+)
+
+// ProxyDirect as a webhook's proxy URL bypasses the global proxy
+const ProxyDirect = "direct"
+
+// proxyConfig is how a webhook HTTP client reaches its targets
+type proxyConfig struct {
+	url     *url.URL // Explicit proxy; nil means the environment's HTTP_PROXY/HTTPS_PROXY
+	direct  bool     // Never use a proxy
+	guarded bool     // Dial the proxy through the URL guard too, as for per-webhook proxies
+}
+
+// loadGlobalProxy reads WEBHOOK_PROXY_URL. When it is unset, deliveries follow the
+// standard HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables.
+func loadGlobalProxy() (proxyConfig, error) {
+	raw := os.Getenv("WEBHOOK_PROXY_URL")
+	if raw == "" {
+		return proxyConfig{}, nil
+	}
+	if raw == ProxyDirect {
+		return proxyConfig{direct: true}, nil
+	}
+	proxyURL, err := parseProxyURL(raw)
+	if err != nil {
+		return proxyConfig{}, err
+	}
+	return proxyConfig{url: proxyURL}, nil
+}
+
+// parseProxyURL checks an http://, https:// or socks5:// proxy URL
+func parseProxyURL(raw string) (*url.URL, error) {
+	proxyURL, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("proxy URL scheme must be http, https, socks5 or socks5h")
+	}
+	if proxyURL.Hostname() == "" {
+		return nil, fmt.Errorf("proxy URL must include a host")
+	}
+	return proxyURL, nil
+}
+
+// webhookProxy returns the proxy settings for a webhook, falling back to the global ones
+func (s *WebhookService) webhookProxy(webhook *models.Webhook) (proxyConfig, error) {
+	switch webhook.ProxyURL {
+	case "":
+		return s.proxy, nil
+	case ProxyDirect:
+		return proxyConfig{direct: true}, nil
+	}
+	proxyURL, err := parseProxyURL(webhook.ProxyURL)
+	if err != nil {
+		return proxyConfig{}, err
+	}
+	return proxyConfig{url: proxyURL, guarded: true}, nil
+}
+
+// ValidateWebhookProxy checks a webhook's proxy URL at create/update time. Unlike the
+// operator-configured global proxy, a per-webhook proxy must itself be an allowed
+// destination, so it can't be used to reach internal services.
+func ValidateWebhookProxy(webhook *models.Webhook) error {
+	if webhook.ProxyURL == "" || webhook.ProxyURL == ProxyDirect {
+		return nil
+	}
+	proxyURL, err := parseProxyURL(webhook.ProxyURL)
+	if err != nil {
+		return err
+	}
+	if err := GetURLGuard().ValidateHost(proxyURL.Hostname()); err != nil {
+		return fmt.Errorf("proxy not allowed: %w", err)
+	}
+	return nil
+}
+
+// proxyFunc returns the transport's Proxy hook. When a proxy connects on our behalf the
+// URL guard never sees the destination address, so the target host is checked here
+// before the request is handed to the proxy.
+func (p proxyConfig) proxyFunc() func(*http.Request) (*url.URL, error) {
+	if p.direct {
+		return nil
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		proxyURL := p.url
+		if proxyURL == nil {
+			envProxy, err := http.ProxyFromEnvironment(req)
+			if err != nil || envProxy == nil {
+				return nil, err
+			}
+			proxyURL = envProxy
+		}
+		if err := GetURLGuard().CheckProxiedHost(req.URL.Hostname()); err != nil {
+			return nil, err
+		}
+		return proxyURL, nil
+	}
+}
+
+// dialContext returns the transport's dialer. Connections to an operator-configured
+// proxy skip the URL guard, since corporate proxies usually live on private addresses;
+// per-webhook proxies are checked when dialed, whatever their name resolves to by then.
+func (p proxyConfig) dialContext() func(ctx context.Context, network, address string) (net.Conn, error) {
+	guard := GetURLGuard()
+	if p.direct || p.guarded {
+		return guard.DialContext
+	}
+
+	proxyHosts := make(map[string]bool)
+	if p.url != nil {
+		proxyHosts[strings.ToLower(p.url.Hostname())] = true
+	} else {
+		for _, key := range []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy"} {
+			if envProxy, err := url.Parse(os.Getenv(key)); err == nil && envProxy.Hostname() != "" {
+				proxyHosts[strings.ToLower(envProxy.Hostname())] = true
+			}
+		}
+	}
+	if len(proxyHosts) == 0 {
+		return guard.DialContext
+	}
+
+	direct := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(address)
+		if err == nil && proxyHosts[strings.ToLower(host)] {
+			return direct.DialContext(ctx, network, address)
+		}
+		return guard.DialContext(ctx, network, address)
+	}
+}
+
+// key identifies the proxy settings for client caching
+func (p proxyConfig) key() string {
+	switch {
+	case p.direct:
+		return ProxyDirect
+	case p.url != nil:
+		return p.url.String()
+	}
+	return ""
+}
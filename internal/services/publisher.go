@@ -0,0 +1,229 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/user/pinglater/internal/models"
+)
+
+// OutboundMessage is a webhook payload on its way to a non-HTTP target
+type OutboundMessage struct {
+	WebhookID  uint
+	EventType  string
+	Payload    []byte
+	Signature  string            // Hex HMAC-SHA256 of the payload, empty when the webhook has no secret
+	DeliveryID string            // Stable across retries, for consumer-side deduplication
+	Headers    map[string]string // Instance-identifying headers, for targets that carry headers
+}
+
+// Publisher delivers webhook payloads to a non-HTTP target such as a message broker
+type Publisher interface {
+	Publish(ctx context.Context, msg OutboundMessage) error
+	Close() error
+}
+
+// targetDriver validates and connects one webhook target type
+type targetDriver struct {
+	// validate checks a target config and returns a display URL for it
+	validate func(config string) (string, error)
+	// connect builds a publisher from a validated config
+	connect func(config string) (Publisher, error)
+}
+
+// targetDrivers are the supported non-HTTP target types
+var targetDrivers = map[string]targetDriver{
+	models.TargetTypeKafka: {validate: validateKafkaConfig, connect: newKafkaPublisher},
+	models.TargetTypeNATS:  {validate: validateNATSConfig, connect: newNATSPublisher},
+	models.TargetTypeMQTT:  {validate: validateMQTTConfig, connect: newMQTTPublisher},
+	models.TargetTypeRedis: {validate: validateRedisConfig, connect: newRedisPublisher},
+}
+
+// cachedPublisher is a per-webhook publisher along with the config it was built from
+type cachedPublisher struct {
+	key       string
+	publisher Publisher
+}
+
+// ValidateWebhookTarget checks a target type and its config. For non-HTTP targets it
+// returns the compacted config to store and a display URL for the webhook.
+func ValidateWebhookTarget(targetType string, config json.RawMessage) (string, string, error) {
+	if targetType == "" || targetType == models.TargetTypeHTTP {
+		return "", "", nil
+	}
+
+	driver, ok := targetDrivers[targetType]
+	if !ok {
+		return "", "", fmt.Errorf("unsupported target_type %q", targetType)
+	}
+	if len(config) == 0 {
+		return "", "", fmt.Errorf("target_config is required for %s targets", targetType)
+	}
+
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, config); err != nil {
+		return "", "", fmt.Errorf("target_config must be a JSON object: %w", err)
+	}
+
+	displayURL, err := driver.validate(compacted.String())
+	if err != nil {
+		return "", "", err
+	}
+	return compacted.String(), displayURL, nil
+}
+
+// isPublisherTarget reports whether a webhook is delivered through a Publisher instead of HTTP
+func isPublisherTarget(webhook *models.Webhook) bool {
+	return webhook.TargetTypeOrDefault() != models.TargetTypeHTTP
+}
+
+// publisherFor returns the publisher for a webhook, reconnecting when its config has
+// changed. Connecting can take a while, so it happens without holding s.mu; when two
+// deliveries connect at once, the first publisher cached wins and the other is closed.
+func (s *WebhookService) publisherFor(webhook *models.Webhook) (Publisher, error) {
+	driver, ok := targetDrivers[webhook.TargetType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported target_type %q", webhook.TargetType)
+	}
+
+	sum := sha256.Sum256([]byte(webhook.TargetType + "\x00" + webhook.TargetConfig))
+	key := hex.EncodeToString(sum[:])
+
+	s.mu.RLock()
+	cached, ok := s.publishers[webhook.ID]
+	s.mu.RUnlock()
+	if ok && cached.key == key {
+		return cached.publisher, nil
+	}
+
+	publisher, err := driver.connect(webhook.TargetConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	cached, ok = s.publishers[webhook.ID]
+	if ok && cached.key == key {
+		s.mu.Unlock()
+		publisher.Close()
+		return cached.publisher, nil
+	}
+	s.publishers[webhook.ID] = &cachedPublisher{key: key, publisher: publisher}
+	s.mu.Unlock()
+
+	// The config changed, so the old publisher is no longer used
+	if ok {
+		cached.publisher.Close()
+	}
+	return publisher, nil
+}
+
+// publish delivers a payload to a webhook's non-HTTP target. Brokers have no response
+// status, so deliveries are recorded with status 0 and only success or the error.
+func (s *WebhookService) publish(webhook *models.Webhook, eventType string, payload []byte, signature, deliveryID string) (bool, int, string, error) {
+	publisher, err := s.publisherFor(webhook)
+	if err != nil {
+		return false, 0, "", fmt.Errorf("failed to connect to %s target: %w", webhook.TargetType, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	headers := deliveryHeaderMap(s.headers)
+	if webhook.TestMode {
+		if headers == nil {
+			headers = make(map[string]string, 1)
+		}
+		headers["X-Webhook-Test"] = "true"
+	}
+
+	err = publisher.Publish(ctx, OutboundMessage{
+		WebhookID:  webhook.ID,
+		EventType:  eventType,
+		Payload:    payload,
+		Signature:  signature,
+		DeliveryID: deliveryID,
+		Headers:    headers,
+	})
+	if err != nil {
+		return false, 0, "", fmt.Errorf("failed to publish: %w", err)
+	}
+	return true, 0, "", nil
+}
+
+// closePublishers closes every cached publisher
+func (s *WebhookService) closePublishers() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, cached := range s.publishers {
+		cached.publisher.Close()
+		delete(s.publishers, id)
+	}
+}
+
+// payloadChatKey returns the chat a payload belongs to (data.from), used to keep a
+// chat's events in order on partitioned targets. Empty when the event has no chat.
+func payloadChatKey(payload []byte) string {
+	var envelope struct {
+		Data struct {
+			From string `json:"from"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		return ""
+	}
+	return envelope.Data.From
+}
+
+// targetPlaceholder matches {name} placeholders in subject and topic templates
+var targetPlaceholder = regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+
+// expandTargetTemplate fills {name} placeholders in a subject or topic template.
+// {event} and {webhook_id} come from the message, {phone} is the sender's phone number,
+// and any other name is looked up in the payload's data object. Values are passed through
+// escape so they can't break the target's syntax; missing values become "unknown".
+func expandTargetTemplate(tmpl string, msg OutboundMessage, escape func(string) string) string {
+	if !targetPlaceholder.MatchString(tmpl) {
+		return tmpl
+	}
+
+	var envelope struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	json.Unmarshal(msg.Payload, &envelope)
+
+	return targetPlaceholder.ReplaceAllStringFunc(tmpl, func(match string) string {
+		name := match[1 : len(match)-1]
+
+		if name == "phone" {
+			name = "from_phone"
+		}
+
+		var value string
+		switch name {
+		case "event":
+			value = msg.EventType
+		case "webhook_id":
+			value = strconv.FormatUint(uint64(msg.WebhookID), 10)
+		default:
+			switch v := envelope.Data[name].(type) {
+			case string:
+				value = v
+			case float64, bool:
+				value = fmt.Sprint(v)
+			}
+		}
+
+		value = escape(value)
+		if value == "" {
+			return "unknown"
+		}
+		return value
+	})
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+	"github.com/user/pinglater/internal/models"
+)
+
+// kafkaPublisher produces webhook payloads to a Kafka topic
+type kafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+// parseKafkaConfig decodes and checks a kafka target config
+func parseKafkaConfig(config string) (*models.KafkaTargetConfig, error) {
+	var cfg models.KafkaTargetConfig
+	if err := json.Unmarshal([]byte(config), &cfg); err != nil {
+		return nil, fmt.Errorf("invalid kafka target_config: %w", err)
+	}
+
+	if len(cfg.Brokers) == 0 {
+		return nil, fmt.Errorf("kafka target_config requires at least one broker")
+	}
+	for _, broker := range cfg.Brokers {
+		if _, port, err := net.SplitHostPort(broker); err != nil || port == "" {
+			return nil, fmt.Errorf("kafka broker %q must be host:port", broker)
+		}
+	}
+	if strings.TrimSpace(cfg.Topic) == "" {
+		return nil, fmt.Errorf("kafka target_config requires a topic")
+	}
+
+	switch strings.ToLower(cfg.SASLMechanism) {
+	case "":
+		if cfg.Username != "" {
+			return nil, fmt.Errorf("kafka sasl_mechanism is required when a username is set")
+		}
+	case "plain", "scram-sha-256", "scram-sha-512":
+		if cfg.Username == "" || cfg.Password == "" {
+			return nil, fmt.Errorf("kafka sasl_mechanism %s requires a username and password", cfg.SASLMechanism)
+		}
+	default:
+		return nil, fmt.Errorf("kafka sasl_mechanism must be 'plain', 'scram-sha-256' or 'scram-sha-512'")
+	}
+
+	return &cfg, nil
+}
+
+// validateKafkaConfig checks a kafka target config, including that its brokers are
+// allowed destinations, and returns a display URL such as kafka://broker:9092/topic
+func validateKafkaConfig(config string) (string, error) {
+	cfg, err := parseKafkaConfig(config)
+	if err != nil {
+		return "", err
+	}
+
+	for _, broker := range cfg.Brokers {
+		host, _, _ := net.SplitHostPort(broker)
+		if err := GetURLGuard().ValidateHost(host); err != nil {
+			return "", fmt.Errorf("kafka broker not allowed: %w", err)
+		}
+	}
+
+	return "kafka://" + strings.Join(cfg.Brokers, ",") + "/" + cfg.Topic, nil
+}
+
+// newKafkaPublisher builds a producer for a kafka target. Connections are made lazily
+// on the first publish, through the same URL guard as HTTP deliveries.
+func newKafkaPublisher(config string) (Publisher, error) {
+	cfg, err := parseKafkaConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &kafka.Transport{
+		Dial:        GetURLGuard().DialContext,
+		DialTimeout: 10 * time.Second,
+		ClientID:    "pinglater",
+	}
+	if cfg.TLS {
+		transport.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if cfg.SASLMechanism != "" {
+		mechanism, err := kafkaSASLMechanism(cfg)
+		if err != nil {
+			return nil, err
+		}
+		transport.SASL = mechanism
+	}
+
+	return &kafkaPublisher{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(cfg.Brokers...),
+			Topic:        cfg.Topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			WriteTimeout: webhookTimeout,
+			Transport:    transport,
+		},
+	}, nil
+}
+
+// kafkaSASLMechanism maps the configured mechanism name to a kafka-go implementation
+func kafkaSASLMechanism(cfg *models.KafkaTargetConfig) (sasl.Mechanism, error) {
+	switch strings.ToLower(cfg.SASLMechanism) {
+	case "plain":
+		return plain.Mechanism{Username: cfg.Username, Password: cfg.Password}, nil
+	case "scram-sha-256":
+		return scram.Mechanism(scram.SHA256, cfg.Username, cfg.Password)
+	case "scram-sha-512":
+		return scram.Mechanism(scram.SHA512, cfg.Username, cfg.Password)
+	}
+	return nil, fmt.Errorf("unsupported kafka sasl_mechanism %q", cfg.SASLMechanism)
+}
+
+// Publish produces one record. Records are keyed by chat so a chat's events stay
+// ordered within a partition; events without a chat are keyed by event type.
+func (p *kafkaPublisher) Publish(ctx context.Context, msg OutboundMessage) error {
+	key := payloadChatKey(msg.Payload)
+	if key == "" {
+		key = msg.EventType
+	}
+
+	headers := []kafka.Header{
+		{Key: "event_type", Value: []byte(msg.EventType)},
+		{Key: "webhook_id", Value: []byte(strconv.FormatUint(uint64(msg.WebhookID), 10))},
+		{Key: "content_type", Value: []byte("application/json")},
+		{Key: "delivery_id", Value: []byte(msg.DeliveryID)},
+	}
+	if msg.Signature != "" {
+		headers = append(headers, kafka.Header{Key: "signature", Value: []byte("sha256=" + msg.Signature)})
+	}
+	for name, value := range msg.Headers {
+		headers = append(headers, kafka.Header{Key: name, Value: []byte(value)})
+	}
+
+	return p.writer.WriteMessages(ctx, kafka.Message{
+		Key:     []byte(key),
+		Value:   msg.Payload,
+		Headers: headers,
+	})
+}
+
+// Close flushes and closes the producer
+func (p *kafkaPublisher) Close() error {
+	return p.writer.Close()
+}
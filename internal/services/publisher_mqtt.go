@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/user/pinglater/internal/models"
+)
+
+// mqttTopicEscaper replaces characters that would add topic levels or wildcards
+var mqttTopicEscaper = strings.NewReplacer("/", "_", "+", "_", "#", "_")
+
+// mqttDefaultPorts are the ports used when a broker URL has none
+var mqttDefaultPorts = map[string]string{"tcp": "1883", "mqtt": "1883", "ssl": "8883", "tls": "8883", "mqtts": "8883"}
+
+// mqttPublisher publishes webhook payloads to an MQTT broker
+type mqttPublisher struct {
+	client mqtt.Client
+	topic  string
+	qos    byte
+	retain bool
+}
+
+// parseMQTTConfig decodes and checks an mqtt target config
+func parseMQTTConfig(config string) (*models.MQTTTargetConfig, *url.URL, error) {
+	var cfg models.MQTTTargetConfig
+	if err := json.Unmarshal([]byte(config), &cfg); err != nil {
+		return nil, nil, fmt.Errorf("invalid mqtt target_config: %w", err)
+	}
+
+	broker, err := url.Parse(cfg.Broker)
+	if err != nil || broker.Hostname() == "" {
+		return nil, nil, fmt.Errorf("mqtt broker must be a URL such as tcp://host:1883")
+	}
+	port, ok := mqttDefaultPorts[broker.Scheme]
+	if !ok {
+		return nil, nil, fmt.Errorf("mqtt broker scheme must be tcp, mqtt, ssl, tls or mqtts")
+	}
+	if broker.Port() == "" {
+		broker.Host = net.JoinHostPort(broker.Hostname(), port)
+	}
+
+	if cfg.Topic == "" {
+		return nil, nil, fmt.Errorf("mqtt target_config requires a topic")
+	}
+	// Check the topic with every placeholder filled in
+	sample := targetPlaceholder.ReplaceAllString(cfg.Topic, "x")
+	if strings.ContainsAny(sample, "+#{}") {
+		return nil, nil, fmt.Errorf("mqtt topic must not contain wildcards or unknown placeholders")
+	}
+	if cfg.QoS < 0 || cfg.QoS > 2 {
+		return nil, nil, fmt.Errorf("mqtt qos must be 0, 1 or 2")
+	}
+
+	return &cfg, broker, nil
+}
+
+// validateMQTTConfig checks an mqtt target config, including that the broker is an
+// allowed destination, and returns a display URL such as tcp://broker:1883/pinglater/{event}
+func validateMQTTConfig(config string) (string, error) {
+	cfg, broker, err := parseMQTTConfig(config)
+	if err != nil {
+		return "", err
+	}
+	if err := GetURLGuard().ValidateHost(broker.Hostname()); err != nil {
+		return "", fmt.Errorf("mqtt broker not allowed: %w", err)
+	}
+	return broker.Scheme + "://" + broker.Host + "/" + strings.TrimPrefix(cfg.Topic, "/"), nil
+}
+
+// newMQTTPublisher connects to an mqtt target. A failed connection is reported as a
+// delivery error and retried on the next delivery.
+func newMQTTPublisher(config string) (Publisher, error) {
+	cfg, broker, err := parseMQTTConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	clientID := cfg.ClientID
+	if clientID == "" {
+		suffix := make([]byte, 4)
+		rand.Read(suffix)
+		clientID = "pinglater-" + hex.EncodeToString(suffix)
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(broker.String()).
+		SetClientID(clientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetConnectTimeout(10 * time.Second).
+		SetAutoReconnect(true).
+		SetCustomOpenConnectionFn(dialMQTT)
+
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(webhookTimeout) {
+		client.Disconnect(0)
+		return nil, fmt.Errorf("timed out connecting to %s", broker.Host)
+	}
+	if err := token.Error(); err != nil {
+		return nil, err
+	}
+
+	return &mqttPublisher{
+		client: client,
+		topic:  cfg.Topic,
+		qos:    byte(cfg.QoS),
+		retain: cfg.Retain,
+	}, nil
+}
+
+// dialMQTT opens broker connections through the URL guard
+func dialMQTT(uri *url.URL, options mqtt.ClientOptions) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), options.ConnectTimeout)
+	defer cancel()
+
+	conn, err := GetURLGuard().DialContext(ctx, "tcp", uri.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	switch uri.Scheme {
+	case "ssl", "tls", "mqtts":
+		tlsConn := tls.Client(conn, &tls.Config{MinVersion: tls.VersionTLS12, ServerName: uri.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+	return conn, nil
+}
+
+// Publish sends one message to the expanded topic. MQTT 3.1.1 has no message headers,
+// so only the payload is sent. With QoS 1 or 2 the delivery waits for the broker's
+// acknowledgement.
+func (p *mqttPublisher) Publish(ctx context.Context, msg OutboundMessage) error {
+	if !p.client.IsConnectionOpen() {
+		return fmt.Errorf("not connected to MQTT broker")
+	}
+
+	token := p.client.Publish(expandTargetTemplate(p.topic, msg, mqttTopicEscaper.Replace), p.qos, p.retain, msg.Payload)
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close disconnects from the broker, allowing a moment for in-flight messages
+func (p *mqttPublisher) Close() error {
+	p.client.Disconnect(250)
+	return nil
+}
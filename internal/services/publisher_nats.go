@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/user/pinglater/internal/models"
+)
+
+// natsSubjectEscaper replaces characters that would split or wildcard a subject token
+var natsSubjectEscaper = strings.NewReplacer(".", "_", " ", "_", "\t", "_", "*", "_", ">", "_")
+
+// natsPublisher publishes webhook payloads to NATS, optionally through JetStream
+type natsPublisher struct {
+	conn    *nats.Conn
+	js      jetstream.JetStream // nil for core NATS
+	subject string
+}
+
+// natsDialer routes NATS connections through the URL guard
+type natsDialer struct{}
+
+func (natsDialer) Dial(network, address string) (net.Conn, error) {
+	return GetURLGuard().DialContext(context.Background(), network, address)
+}
+
+// parseNATSConfig decodes and checks a nats target config
+func parseNATSConfig(config string) (*models.NATSTargetConfig, error) {
+	var cfg models.NATSTargetConfig
+	if err := json.Unmarshal([]byte(config), &cfg); err != nil {
+		return nil, fmt.Errorf("invalid nats target_config: %w", err)
+	}
+
+	if len(cfg.Servers) == 0 {
+		return nil, fmt.Errorf("nats target_config requires at least one server")
+	}
+	for _, server := range cfg.Servers {
+		u, err := url.Parse(server)
+		if err != nil || (u.Scheme != "nats" && u.Scheme != "tls") || u.Hostname() == "" {
+			return nil, fmt.Errorf("nats server %q must be a nats:// or tls:// URL", server)
+		}
+	}
+
+	if cfg.Subject == "" {
+		return nil, fmt.Errorf("nats target_config requires a subject")
+	}
+	// Check the subject with every placeholder filled in
+	sample := targetPlaceholder.ReplaceAllString(cfg.Subject, "x")
+	if strings.ContainsAny(sample, " \t*>{}") {
+		return nil, fmt.Errorf("nats subject must not contain whitespace, wildcards or unknown placeholders")
+	}
+	for _, token := range strings.Split(sample, ".") {
+		if token == "" {
+			return nil, fmt.Errorf("nats subject %q has an empty token", cfg.Subject)
+		}
+	}
+
+	if cfg.Token != "" && cfg.Username != "" {
+		return nil, fmt.Errorf("nats target_config accepts either a token or a username, not both")
+	}
+
+	return &cfg, nil
+}
+
+// validateNATSConfig checks a nats target config, including that its servers are
+// allowed destinations, and returns a display URL such as nats://nats:4222/pinglater.{event}
+func validateNATSConfig(config string) (string, error) {
+	cfg, err := parseNATSConfig(config)
+	if err != nil {
+		return "", err
+	}
+
+	hosts := make([]string, 0, len(cfg.Servers))
+	for _, server := range cfg.Servers {
+		u, _ := url.Parse(server)
+		if err := GetURLGuard().ValidateHost(u.Hostname()); err != nil {
+			return "", fmt.Errorf("nats server not allowed: %w", err)
+		}
+		hosts = append(hosts, u.Host)
+	}
+
+	return "nats://" + strings.Join(hosts, ",") + "/" + cfg.Subject, nil
+}
+
+// newNATSPublisher connects to a nats target. A failed connection is reported as a
+// delivery error and retried on the next delivery.
+func newNATSPublisher(config string) (Publisher, error) {
+	cfg, err := parseNATSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []nats.Option{
+		nats.Name("pinglater"),
+		nats.Timeout(10 * time.Second),
+		nats.MaxReconnects(-1),
+		nats.SetCustomDialer(natsDialer{}),
+	}
+	if cfg.TLS {
+		opts = append(opts, nats.Secure(&tls.Config{MinVersion: tls.VersionTLS12}))
+	}
+	if cfg.Username != "" {
+		opts = append(opts, nats.UserInfo(cfg.Username, cfg.Password))
+	}
+	if cfg.Token != "" {
+		opts = append(opts, nats.Token(cfg.Token))
+	}
+
+	conn, err := nats.Connect(strings.Join(cfg.Servers, ","), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	publisher := &natsPublisher{conn: conn, subject: cfg.Subject}
+	if cfg.JetStream {
+		js, err := jetstream.New(conn)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		publisher.js = js
+	}
+	return publisher, nil
+}
+
+// Publish sends one message to the expanded subject. Core NATS publishes are flushed so
+// the delivery only succeeds once the server has the message; JetStream publishes wait
+// for the stream's acknowledgement.
+func (p *natsPublisher) Publish(ctx context.Context, msg OutboundMessage) error {
+	if !p.conn.IsConnected() {
+		return fmt.Errorf("not connected to NATS (%s)", p.conn.Status())
+	}
+
+	natsMsg := nats.NewMsg(expandTargetTemplate(p.subject, msg, natsSubjectEscaper.Replace))
+	natsMsg.Data = msg.Payload
+	for name, value := range msg.Headers {
+		natsMsg.Header.Set(name, value)
+	}
+	natsMsg.Header.Set("Content-Type", "application/json")
+	natsMsg.Header.Set("Event-Type", msg.EventType)
+	natsMsg.Header.Set("Webhook-Id", strconv.FormatUint(uint64(msg.WebhookID), 10))
+	natsMsg.Header.Set("X-Delivery-Id", msg.DeliveryID)
+	// JetStream drops retries with a Nats-Msg-Id it has already stored
+	natsMsg.Header.Set(jetstream.MsgIDHeader, msg.DeliveryID)
+	if msg.Signature != "" {
+		natsMsg.Header.Set("X-Webhook-Signature", "sha256="+msg.Signature)
+	}
+
+	if p.js != nil {
+		_, err := p.js.PublishMsg(ctx, natsMsg)
+		return err
+	}
+
+	if err := p.conn.PublishMsg(natsMsg); err != nil {
+		return err
+	}
+	return p.conn.FlushWithContext(ctx)
+}
+
+// Close drains pending messages and closes the connection
+func (p *natsPublisher) Close() error {
+	return p.conn.Drain()
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/user/pinglater/internal/models"
+)
+
+// Redis target modes
+const (
+	redisModePublish = "publish"
+	redisModeStream  = "stream"
+)
+
+// redisPublisher sends webhook payloads to a Redis channel (PUBLISH) or stream (XADD)
+type redisPublisher struct {
+	client  *redis.Client
+	mode    string
+	channel string
+	maxLen  int64
+}
+
+// parseRedisConfig decodes and checks a redis target config
+func parseRedisConfig(config string) (*models.RedisTargetConfig, error) {
+	var cfg models.RedisTargetConfig
+	if err := json.Unmarshal([]byte(config), &cfg); err != nil {
+		return nil, fmt.Errorf("invalid redis target_config: %w", err)
+	}
+
+	if _, port, err := net.SplitHostPort(cfg.Addr); err != nil || port == "" {
+		return nil, fmt.Errorf("redis addr %q must be host:port", cfg.Addr)
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = redisModePublish
+	}
+	if cfg.Mode != redisModePublish && cfg.Mode != redisModeStream {
+		return nil, fmt.Errorf("redis mode must be 'publish' or 'stream'")
+	}
+	if strings.TrimSpace(cfg.Channel) == "" {
+		return nil, fmt.Errorf("redis target_config requires a channel")
+	}
+	if strings.ContainsAny(targetPlaceholder.ReplaceAllString(cfg.Channel, "x"), "{}") {
+		return nil, fmt.Errorf("redis channel has an unknown placeholder")
+	}
+	if cfg.DB < 0 || cfg.MaxLen < 0 {
+		return nil, fmt.Errorf("redis db and max_len must not be negative")
+	}
+
+	return &cfg, nil
+}
+
+// validateRedisConfig checks a redis target config, including that the server is an
+// allowed destination, and returns a display URL such as redis://cache:6379/0/stream/events
+func validateRedisConfig(config string) (string, error) {
+	cfg, err := parseRedisConfig(config)
+	if err != nil {
+		return "", err
+	}
+
+	host, _, _ := net.SplitHostPort(cfg.Addr)
+	if err := GetURLGuard().ValidateHost(host); err != nil {
+		return "", fmt.Errorf("redis server not allowed: %w", err)
+	}
+
+	scheme := "redis"
+	if cfg.TLS {
+		scheme = "rediss"
+	}
+	return fmt.Sprintf("%s://%s/%d/%s/%s", scheme, cfg.Addr, cfg.DB, cfg.Mode, cfg.Channel), nil
+}
+
+// newRedisPublisher builds a client for a redis target. Connections are made lazily
+// on the first publish, through the same URL guard as HTTP deliveries.
+func newRedisPublisher(config string) (Publisher, error) {
+	cfg, err := parseRedisConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var tlsConfig *tls.Config
+	if cfg.TLS {
+		host, _, _ := net.SplitHostPort(cfg.Addr)
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12, ServerName: host}
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:        cfg.Addr,
+		Username:    cfg.Username,
+		Password:    cfg.Password,
+		DB:          cfg.DB,
+		DialTimeout: 10 * time.Second,
+		// A custom dialer replaces go-redis' own, so TLS is layered on here
+		Dialer: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := GetURLGuard().DialContext(ctx, network, addr)
+			if err != nil || tlsConfig == nil {
+				return conn, err
+			}
+			tlsConn := tls.Client(conn, tlsConfig)
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return tlsConn, nil
+		},
+	})
+
+	return &redisPublisher{
+		client:  client,
+		mode:    cfg.Mode,
+		channel: cfg.Channel,
+		maxLen:  cfg.MaxLen,
+	}, nil
+}
+
+// Publish sends one message. In publish mode the payload is the message; in stream mode
+// the entry carries event, webhook_id, payload and (when set) signature fields.
+func (p *redisPublisher) Publish(ctx context.Context, msg OutboundMessage) error {
+	key := expandTargetTemplate(p.channel, msg, strings.TrimSpace)
+
+	if p.mode == redisModePublish {
+		return p.client.Publish(ctx, key, msg.Payload).Err()
+	}
+
+	values := map[string]interface{}{
+		"event":       msg.EventType,
+		"webhook_id":  strconv.FormatUint(uint64(msg.WebhookID), 10),
+		"payload":     msg.Payload,
+		"delivery_id": msg.DeliveryID,
+	}
+	if msg.Signature != "" {
+		values["signature"] = "sha256=" + msg.Signature
+	}
+	return p.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: key,
+		MaxLen: p.maxLen,
+		Approx: p.maxLen > 0,
+		Values: values,
+	}).Err()
+}
+
+// Close closes the client's connection pool
+func (p *redisPublisher) Close() error {
+	return p.client.Close()
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimitWindow is the sliding window for per-webhook delivery limits
+const rateLimitWindow = time.Minute
+
+// DeliveryRateLimiter enforces a maximum number of deliveries per minute for each webhook
+type DeliveryRateLimiter struct {
+	mu     sync.Mutex
+	recent map[uint][]time.Time // Delivery start times within the current window, oldest first
+}
+
+// NewDeliveryRateLimiter creates an empty rate limiter
+func NewDeliveryRateLimiter() *DeliveryRateLimiter {
+	return &DeliveryRateLimiter{recent: make(map[uint][]time.Time)}
+}
+
+// Reserve records a delivery for the webhook if it is within its limit. When the limit is
+// reached it returns false along with the earliest time the next delivery may start.
+// A limit of 0 means unlimited.
+func (l *DeliveryRateLimiter) Reserve(webhookID uint, perMinute int) (bool, time.Time) {
+	if perMinute <= 0 {
+		return true, time.Time{}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-rateLimitWindow)
+
+	times := l.recent[webhookID]
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	times = times[i:]
+
+	if len(times) >= perMinute {
+		l.recent[webhookID] = times
+		return false, times[len(times)-perMinute].Add(rateLimitWindow)
+	}
+
+	l.recent[webhookID] = append(times, now)
+	return true, time.Time{}
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/user/pinglater/internal/models"
+	"github.com/user/pinglater/internal/whatsapp"
+)
+
+// replyMediaMaxBytes caps the size of media sent in webhook replies (WhatsApp's own
+// limit for most media types)
+const replyMediaMaxBytes = 16 << 20
+
+// replyResponseMaxBytes is how much of a reply-mode response is read, enough for
+// base64-encoded media at the size limit
+const replyResponseMaxBytes = replyMediaMaxBytes*4/3 + 64<<10
+
+// ReplySender sends webhook replies back into WhatsApp chats
+type ReplySender interface {
+	SendMessage(userID uint, jid string, message string) (string, string, error)
+	SendMedia(userID uint, jid string, media models.MediaAttachment) (string, string, error)
+}
+
+// SetReplySender sets where reply-mode webhooks send their replies
+func (s *WebhookService) SetReplySender(sender ReplySender) {
+	s.mu.Lock()
+	s.replySender = sender
+	s.mu.Unlock()
+}
+
+// replyTarget returns the chat a reply-mode webhook should answer for an event, or ""
+// when the event can't be replied to. Messages we sent ourselves are never answered,
+// so a bot can't end up talking to itself.
+func replyTarget(webhook *models.Webhook, data interface{}) string {
+	if !webhook.ReplyEnabled || isPublisherTarget(webhook) {
+		return ""
+	}
+	switch d := data.(type) {
+	case models.MessageReceivedData:
+		if d.IsFromMe {
+			return ""
+		}
+		return d.Chat
+	case models.CommandReceivedData:
+		return d.Chat
+	}
+	return ""
+}
+
+// handleReply sends the reply from a successful reply-mode delivery. Responses that
+// aren't a JSON object with a reply or media are ignored.
+func (s *WebhookService) handleReply(webhook *models.Webhook, replyTo string, responseBody string) {
+	if replyTo == "" || responseBody == "" {
+		return
+	}
+
+	var reply models.WebhookReply
+	if err := json.Unmarshal([]byte(responseBody), &reply); err != nil {
+		return
+	}
+	if reply.Reply == "" && reply.Media == nil {
+		return
+	}
+
+	s.mu.RLock()
+	sender := s.replySender
+	s.mu.RUnlock()
+	if sender == nil && !webhook.TestMode {
+		return
+	}
+
+	// The text as sent, which send hooks may change
+	messageID, text := "", reply.Reply
+	var err error
+	if webhook.TestMode {
+		// Test-mode webhooks never answer real chats; the reply is only reported
+		if reply.Media != nil {
+			_, err = s.LoadMedia(reply.Media)
+		}
+		messageID = TestMessageID()
+	} else if reply.Media != nil {
+		var media models.MediaAttachment
+		media, err = s.LoadMedia(reply.Media)
+		if err == nil {
+			media.Caption = reply.Reply
+			messageID, text, err = sender.SendMedia(webhook.UserID, replyTo, media)
+		}
+	} else {
+		messageID, text, err = sender.SendMessage(webhook.UserID, replyTo, reply.Reply)
+	}
+
+	if errors.Is(err, whatsapp.ErrSendVetoed) {
+		webhookLog.Info("Webhook reply blocked", "webhook_id", webhook.ID, "chat", replyTo, "error", err)
+		return
+	}
+	if err != nil {
+		webhookLog.Error("Failed to send webhook reply", "webhook_id", webhook.ID, "chat", replyTo, "error", err)
+		s.notifyEvent(webhook.UserID, string(models.EventTypeConnectionError), "Failed to send webhook reply", err.Error())
+		return
+	}
+	if webhook.TestMode {
+		webhookLog.Info("Simulated test webhook reply", "webhook_id", webhook.ID, "chat", replyTo)
+	} else {
+		webhookLog.Info("Sent webhook reply", "webhook_id", webhook.ID, "chat", replyTo)
+		s.notifyEvent(webhook.UserID, string(models.EventTypeMessageSent), "Webhook reply sent to "+replyTo, text)
+	}
+
+	sent := models.MessageSentData{
+		To:        replyTo,
+		Content:   text,
+		MessageID: messageID,
+		Source:    models.MessageSourceWebhookReply,
+		Timestamp: time.Now().Unix(),
+	}
+	if user, server, ok := strings.Cut(replyTo, "@"); ok && server == "s.whatsapp.net" {
+		sent.ToPhone = user
+	}
+	if webhook.TestMode {
+		s.TriggerTestWebhooks(webhook.UserID, string(models.EventTypeMessageSent), sent)
+		return
+	}
+	RecordMessageSent(webhook.UserID)
+	s.TriggerMessageSent(webhook.UserID, sent)
+}
+
+// LoadMedia decodes inline media or downloads it through the guarded HTTP client. Webhook
+// replies and the Twilio-compatible API load their media through here.
+func (s *WebhookService) LoadMedia(media *models.WebhookReplyMedia) (models.MediaAttachment, error) {
+	attachment := models.MediaAttachment{
+		MimeType: media.MimeType,
+		Filename: media.Filename,
+	}
+
+	switch {
+	case media.Data != "":
+		data, err := base64.StdEncoding.DecodeString(media.Data)
+		if err != nil {
+			return attachment, fmt.Errorf("invalid media data: %w", err)
+		}
+		attachment.Data = data
+	case media.URL != "":
+		if err := GetURLGuard().ValidateURL(media.URL); err != nil {
+			return attachment, fmt.Errorf("media URL not allowed: %w", err)
+		}
+		resp, err := s.httpClient.Get(media.URL)
+		if err != nil {
+			return attachment, fmt.Errorf("failed to download media: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return attachment, fmt.Errorf("failed to download media: HTTP %d", resp.StatusCode)
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, replyMediaMaxBytes+1))
+		if err != nil {
+			return attachment, fmt.Errorf("failed to download media: %w", err)
+		}
+		attachment.Data = data
+		if attachment.MimeType == "" {
+			attachment.MimeType = resp.Header.Get("Content-Type")
+		}
+		if attachment.Filename == "" {
+			attachment.Filename = path.Base(resp.Request.URL.Path)
+		}
+	default:
+		return attachment, fmt.Errorf("media requires a url or data")
+	}
+
+	if len(attachment.Data) > replyMediaMaxBytes {
+		return attachment, fmt.Errorf("media exceeds %d bytes", replyMediaMaxBytes)
+	}
+	if attachment.MimeType == "" {
+		attachment.MimeType = http.DetectContentType(attachment.Data)
+	}
+	// Drop parameters such as "; charset=utf-8"
+	attachment.MimeType = strings.TrimSpace(strings.Split(attachment.MimeType, ";")[0])
+	return attachment, nil
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"time"
+
+	"github.com/user/pinglater/internal/models"
+	"gorm.io/gorm"
+)
+
+// retentionInterval is how often the delivery log pruner runs
+const retentionInterval = 1 * time.Hour
+
+// defaultTrashRetention is how long deleted webhooks stay in the trash when
+// WEBHOOK_TRASH_RETENTION is unset
+const defaultTrashRetention = 30 * 24 * time.Hour
+
+// processRetention periodically prunes and truncates the delivery log, and empties the
+// trash. WEBHOOK_DELIVERY_RETENTION (e.g. "720h") deletes deliveries older than the given
+// age; WEBHOOK_STORED_BODY_MAX_BYTES truncates payload and response bodies of finished
+// deliveries; WEBHOOK_TRASH_RETENTION deletes webhooks that have been in the trash that
+// long (0 keeps them until purged by hand).
+func (s *WebhookService) processRetention() {
+	defer s.wg.Done()
+
+	retention := envDuration("WEBHOOK_DELIVERY_RETENTION", 0)
+	maxBodyBytes := envInt("WEBHOOK_STORED_BODY_MAX_BYTES", 0)
+	trashRetention := envDuration("WEBHOOK_TRASH_RETENTION", defaultTrashRetention)
+	if retention <= 0 && maxBodyBytes <= 0 && trashRetention <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+
+	for {
+		if IsLeader() {
+			s.pruneDeliveries(retention, maxBodyBytes)
+			s.emptyTrash(trashRetention)
+		}
+
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pruneDeliveries deletes expired delivery rows and truncates oversized bodies
+func (s *WebhookService) pruneDeliveries(retention time.Duration, maxBodyBytes int) {
+	if s.db == nil {
+		return
+	}
+
+	if retention > 0 {
+		cutoff := time.Now().Add(-retention)
+		result := s.db.Where("created_at < ?", cutoff).Delete(&models.WebhookDelivery{})
+		if result.Error != nil {
+			webhookLog.Error("Failed to prune delivery log", "error", result.Error)
+		} else if result.RowsAffected > 0 {
+			webhookLog.Info("Pruned delivery log", "deleted", result.RowsAffected, "older_than", retention.String())
+		}
+	}
+
+	if maxBodyBytes > 0 {
+		// Payloads of deliveries still awaiting retry are needed intact to resend them
+		finished := s.db.Model(&models.WebhookDelivery{}).
+			Where("success = ? OR next_retry_at IS NULL", true)
+		for _, column := range []string{"payload", "response_body"} {
+			result := finished.Session(&gorm.Session{}).
+				Where("LENGTH("+column+") > ?", maxBodyBytes).
+				Update(column, gorm.Expr("SUBSTR("+column+", 1, ?)", maxBodyBytes))
+			if result.Error != nil {
+				webhookLog.Error("Failed to truncate delivery bodies", "column", column, "error", result.Error)
+			}
+		}
+	}
+}
+
+// emptyTrash deletes webhooks that have been in the trash for longer than retention
+func (s *WebhookService) emptyTrash(retention time.Duration) {
+	if s.db == nil || retention <= 0 {
+		return
+	}
+
+	var ids []uint
+	if err := s.db.Unscoped().Model(&models.Webhook{}).
+		Where("deleted_at < ?", time.Now().Add(-retention)).
+		Pluck("id", &ids).Error; err != nil {
+		webhookLog.Error("Failed to find expired webhooks in the trash", "error", err)
+		return
+	}
+	if len(ids) == 0 {
+		return
+	}
+	if err := PurgeWebhooks(s.db, ids); err != nil {
+		webhookLog.Error("Failed to empty the webhook trash", "error", err)
+		return
+	}
+	webhookLog.Info("Emptied the webhook trash", "deleted", len(ids), "older_than", retention.String())
+}
+
+// PurgeWebhooks deletes webhooks for good, with their delivery history
+func PurgeWebhooks(database *gorm.DB, ids []uint) error {
+	return database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id IN ?", ids).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("webhook_id IN ?", ids).Delete(&models.WebhookOutbox{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("id IN ?", ids).Delete(&models.Webhook{}).Error
+	})
+}
@@ -0,0 +1,319 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/logging"
+	"github.com/user/pinglater/internal/models"
+	"gorm.io/gorm"
+)
+
+var ruleLog = logging.Logger("rules")
+
+// ruleDays are the day names of rule time windows
+var ruleDays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// rulePatterns caches compiled rule patterns, as rules are evaluated on every message
+var rulePatterns sync.Map
+
+// ValidateRule checks a rule's conditions and actions, and cleans up its lists
+func ValidateRule(rule *models.Rule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if rule.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	switch rule.Direction {
+	case "":
+		rule.Direction = models.RuleDirectionIncoming
+	case models.RuleDirectionIncoming, models.RuleDirectionOutgoing:
+	default:
+		return fmt.Errorf("direction must be incoming or outgoing")
+	}
+
+	switch rule.ChatType {
+	case "":
+		rule.ChatType = "all"
+	case "all", "individual", "group":
+	default:
+		return fmt.Errorf("chat_type must be all, individual or group")
+	}
+	rule.Senders = strings.Join(cleanRecipients(strings.Split(rule.Senders, ",")), ",")
+	rule.Groups = strings.Join(cleanList(strings.Split(rule.Groups, ","), false), ",")
+	rule.Keywords = strings.Join(cleanList(strings.Split(rule.Keywords, ","), false), ",")
+
+	if rule.Pattern != "" {
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+
+	if (rule.StartTime == "") != (rule.EndTime == "") {
+		return fmt.Errorf("start_time and end_time go together")
+	}
+	for _, t := range []string{rule.StartTime, rule.EndTime} {
+		if _, err := time.Parse("15:04", t); t != "" && err != nil {
+			return fmt.Errorf("invalid time %q: expected HH:MM", t)
+		}
+	}
+	days := cleanList(strings.Split(rule.Days, ","), true)
+	for _, day := range days {
+		if _, ok := ruleDays[day]; !ok {
+			return fmt.Errorf("invalid day %q: expected mon, tue, wed, thu, fri, sat or sun", day)
+		}
+	}
+	rule.Days = strings.Join(days, ",")
+	if _, err := ruleLocation(rule.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone: %w", err)
+	}
+
+	actions := rule.GetActions()
+	if len(actions) == 0 {
+		return fmt.Errorf("at least one action is required")
+	}
+	for i, action := range actions {
+		validate := validateRuleAction
+		if rule.Direction == models.RuleDirectionOutgoing {
+			validate = validateOutgoingRuleAction
+		}
+		if err := validate(rule.UserID, action); err != nil {
+			return fmt.Errorf("action %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func validateRuleAction(userID uint, action models.RuleAction) error {
+	switch action.Type {
+	case models.RuleActionReply:
+		if strings.TrimSpace(action.Template) == "" {
+			return fmt.Errorf("template is required")
+		}
+		if err := ValidatePayloadTemplate(action.Template); err != nil {
+			return fmt.Errorf("invalid template: %w", err)
+		}
+	case models.RuleActionTag:
+		if strings.TrimSpace(action.Tag) == "" {
+			return fmt.Errorf("tag is required")
+		}
+	case models.RuleActionForward:
+		var count int64
+		db.GetDB().Model(&models.Webhook{}).Where("id = ? AND user_id = ?", action.WebhookID, userID).Count(&count)
+		if count == 0 {
+			return fmt.Errorf("webhook %d not found", action.WebhookID)
+		}
+	case models.RuleActionBlock:
+	case models.RuleActionAppend, models.RuleActionRedact:
+		return fmt.Errorf("%s is for outgoing rules", action.Type)
+	default:
+		return fmt.Errorf("type must be reply, tag, forward or block")
+	}
+	return nil
+}
+
+// cleanList trims a list's entries, optionally lowercasing them, and drops empty ones
+func cleanList(values []string, lower bool) []string {
+	cleaned := make([]string, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if lower {
+			value = strings.ToLower(value)
+		}
+		if value != "" {
+			cleaned = append(cleaned, value)
+		}
+	}
+	return cleaned
+}
+
+// ApplyRules runs the user's active incoming rules on a received message, in position order.
+// Tag actions add to the message's tags. It returns false when a rule blocks the
+// message, which then isn't delivered to webhooks.
+func ApplyRules(userID uint, msg *models.MessageReceivedData) bool {
+	// Rules answer other people; matching our own messages would let replies loop
+	if msg.IsFromMe {
+		return true
+	}
+
+	var rules []models.Rule
+	if err := activeRules(userID, models.RuleDirectionIncoming, &rules); err != nil {
+		ruleLog.Error("Failed to load rules", "user_id", userID, "error", err)
+		return true
+	}
+
+	now := time.Now()
+	for i := range rules {
+		rule := &rules[i]
+		if !RuleMatches(rule, msg, now) {
+			continue
+		}
+		ruleLog.Debug("Rule matched", "rule_id", rule.ID, "chat", msg.Chat)
+		recordRuleMatch(rule, now)
+
+		for _, action := range rule.GetActions() {
+			switch action.Type {
+			case models.RuleActionReply:
+				queueRuleReply(userID, rule, action.Template, msg)
+			case models.RuleActionTag:
+				if !contains(msg.Tags, action.Tag) {
+					msg.Tags = append(msg.Tags, action.Tag)
+				}
+			case models.RuleActionForward:
+				if err := GetWebhookService().ForwardEvent(userID, action.WebhookID, string(models.EventTypeMessageReceived), *msg); err != nil {
+					ruleLog.Error("Failed to forward message", "rule_id", rule.ID, "webhook_id", action.WebhookID, "error", err)
+				}
+			case models.RuleActionBlock:
+				ruleLog.Info("Message blocked by rule", "rule_id", rule.ID, "chat", msg.Chat)
+				return false
+			}
+		}
+		if rule.StopProcessing {
+			break
+		}
+	}
+	return true
+}
+
+// activeRules loads the user's active rules of a direction, in position order
+func activeRules(userID uint, direction string, rules *[]models.Rule) error {
+	return db.GetDB().Where("user_id = ? AND is_active = ? AND direction = ?", userID, true, direction).
+		Order("position, id").Find(rules).Error
+}
+
+// recordRuleMatch counts a match of the rule
+func recordRuleMatch(rule *models.Rule, now time.Time) {
+	db.GetDB().Model(rule).UpdateColumns(map[string]interface{}{
+		"match_count":     gorm.Expr("match_count + 1"),
+		"last_matched_at": now,
+	})
+}
+
+// RuleMatches reports whether a message meets all of a rule's conditions at a time
+func RuleMatches(rule *models.Rule, msg *models.MessageReceivedData, now time.Time) bool {
+	if rule.ChatType == "individual" && msg.IsGroup || rule.ChatType == "group" && !msg.IsGroup {
+		return false
+	}
+	if senders := rule.GetSenders(); len(senders) > 0 && !models.PhoneNumberMatches(msg.FromPhone, senders) {
+		return false
+	}
+	if groups := rule.GetGroups(); len(groups) > 0 {
+		matches := false
+		for _, group := range groups {
+			matches = matches || msg.IsGroup && strings.EqualFold(group, msg.Chat)
+		}
+		if !matches {
+			return false
+		}
+	}
+	if keywords := rule.GetKeywords(); len(keywords) > 0 {
+		content := strings.ToLower(msg.Content)
+		matches := false
+		for _, keyword := range keywords {
+			matches = matches || strings.Contains(content, strings.ToLower(keyword))
+		}
+		if !matches {
+			return false
+		}
+	}
+	if rule.Pattern != "" {
+		pattern, err := rulePattern(rule.Pattern)
+		if err != nil || !pattern.MatchString(msg.Content) {
+			return false
+		}
+	}
+	return inRuleWindow(rule, now)
+}
+
+// rulePattern compiles a rule's pattern, once
+func rulePattern(expr string) (*regexp.Regexp, error) {
+	if cached, ok := rulePatterns.Load(expr); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	rulePatterns.Store(expr, pattern)
+	return pattern, nil
+}
+
+// inRuleWindow reports whether a time falls on one of the rule's days and within its
+// hours. Days are matched against the time itself, so the hours after midnight of a
+// window spanning midnight belong to the next day.
+func inRuleWindow(rule *models.Rule, now time.Time) bool {
+	location, err := ruleLocation(rule.Timezone)
+	if err != nil {
+		location = time.Local
+	}
+	now = now.In(location)
+
+	if days := rule.GetDays(); len(days) > 0 {
+		matches := false
+		for _, day := range days {
+			matches = matches || ruleDays[day] == now.Weekday()
+		}
+		if !matches {
+			return false
+		}
+	}
+
+	if rule.StartTime == "" {
+		return true
+	}
+	start, errStart := time.Parse("15:04", rule.StartTime)
+	end, errEnd := time.Parse("15:04", rule.EndTime)
+	if errStart != nil || errEnd != nil {
+		return false
+	}
+	minute := now.Hour()*60 + now.Minute()
+	from, to := start.Hour()*60+start.Minute(), end.Hour()*60+end.Minute()
+	if from <= to {
+		return minute >= from && minute < to
+	}
+	return minute >= from || minute < to
+}
+
+// ruleLocation loads a rule's timezone; empty is the server's
+func ruleLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(name)
+}
+
+// queueRuleReply renders a reply action's template over the message and queues the
+// reply to the chat the message came from
+func queueRuleReply(userID uint, rule *models.Rule, tmpl string, msg *models.MessageReceivedData) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	rendered, err := RenderPayloadTemplate(tmpl, payload)
+	if err != nil {
+		ruleLog.Error("Failed to render rule reply", "rule_id", rule.ID, "error", err)
+		return
+	}
+	reply := strings.TrimSpace(string(rendered))
+	if reply == "" {
+		return
+	}
+
+	queued := []models.OutgoingMessage{{
+		UserID:      userID,
+		PhoneNumber: msg.Chat,
+		Message:     reply,
+		Source:      models.MessageSourceRule,
+	}}
+	if err := GetSendQueue().Enqueue(db.GetDB(), queued); err != nil {
+		ruleLog.Error("Failed to queue rule reply", "rule_id", rule.ID, "error", err)
+	}
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/user/pinglater/internal/models"
+	"github.com/user/pinglater/internal/version"
+)
+
+// Identifiers used in sample payloads. They are well-formed but clearly fake, so a
+// receiver can recognise test deliveries.
+const (
+	samplePhone     = "15550100001"
+	sampleJID       = samplePhone + "@s.whatsapp.net"
+	sampleOwnPhone  = "15550100000"
+	sampleGroupJID  = "120363000000000000@g.us"
+	sampleGroupName = "PingLater Sample Group"
+	sampleMessageID = "3EB0SAMPLE0000000000"
+)
+
+// ErrNoSampleEvent is returned when testing a webhook with an event type that has no sample
+var ErrNoSampleEvent = errors.New("no sample payload for event type")
+
+// sampleEventData returns realistic data for an event type, shaped exactly like the data
+// of real events, for testing receivers. ok is false for event types without a sample.
+func sampleEventData(eventType string, webhook *models.Webhook) (data interface{}, ok bool) {
+	now := time.Now()
+
+	switch models.EventType(eventType) {
+	case models.EventTypeMessageReceived:
+		return models.MessageReceivedData{
+			Chat:      sampleJID,
+			From:      sampleJID,
+			FromPhone: samplePhone,
+			FromName:  "Sample Contact",
+			Content:   "Hello from PingLater! This is a sample message.",
+			MessageID: sampleMessageID,
+			Timestamp: now.Unix(),
+			SenderJID: sampleJID,
+			Type:      models.MessageTypeText,
+		}, true
+	case models.EventTypeMessageSent:
+		return models.MessageSentData{
+			To:        sampleJID,
+			ToPhone:   samplePhone,
+			Content:   "Hello from PingLater! This is a sample message.",
+			MessageID: sampleMessageID,
+			Source:    models.MessageSourceAPI,
+			Timestamp: now.Unix(),
+		}, true
+	case models.EventTypeMessageDelivered, models.EventTypeMessageRead:
+		return models.MessageReceiptData{
+			Chat:       sampleJID,
+			From:       sampleJID,
+			FromPhone:  samplePhone,
+			MessageIDs: []string{sampleMessageID},
+			Timestamp:  now.Unix(),
+			SenderJID:  sampleJID,
+		}, true
+	case models.EventTypeConnected:
+		return models.ConnectionEventData{
+			PhoneNumber: sampleOwnPhone,
+			Reason:      "Connected to WhatsApp",
+			Timestamp:   now.Unix(),
+		}, true
+	case models.EventTypeDisconnected:
+		return models.ConnectionEventData{
+			PhoneNumber: sampleOwnPhone,
+			Reason:      "Disconnected from WhatsApp",
+			Timestamp:   now.Unix(),
+		}, true
+	case models.EventTypeReconnectFailed:
+		return models.ConnectionEventData{
+			PhoneNumber: sampleOwnPhone,
+			Reason:      "Gave up reconnecting to WhatsApp",
+			Details:     "10 reconnect attempts failed, use POST /api/whatsapp/connect to retry",
+			Timestamp:   now.Unix(),
+		}, true
+	case models.EventTypeConnectionDegraded:
+		return models.ConnectionEventData{
+			PhoneNumber: sampleOwnPhone,
+			Reason:      "WhatsApp connection degraded",
+			Details:     "2 keepalive pings failed, last success 45s ago",
+			Timestamp:   now.Unix(),
+		}, true
+	case models.EventTypeConnectionRestored:
+		return models.ConnectionEventData{
+			PhoneNumber: sampleOwnPhone,
+			Reason:      "WhatsApp connection restored",
+			Details:     "Keepalive pings restored",
+			Timestamp:   now.Unix(),
+		}, true
+	case models.EventTypeStreamError:
+		return models.WhatsAppErrorData{
+			PhoneNumber: sampleOwnPhone,
+			Code:        "replaced",
+			Reason:      "Another client connected with this session",
+			Guidance:    models.GuidanceCloseOtherSession,
+			Timestamp:   now.Unix(),
+		}, true
+	case models.EventTypeTemporaryBan:
+		return models.WhatsAppErrorData{
+			PhoneNumber: sampleOwnPhone,
+			Code:        "101",
+			Reason:      "101: you sent too many messages to people who don't have you in their address books",
+			Guidance:    models.GuidanceStopSending,
+			ExpiresAt:   now.Add(24 * time.Hour).Unix(),
+			Timestamp:   now.Unix(),
+		}, true
+	case models.EventTypeRateLimited:
+		return models.WhatsAppErrorData{
+			PhoneNumber: sampleOwnPhone,
+			Code:        "429",
+			Reason:      "Too many messages sent in a short time",
+			Guidance:    models.GuidanceSlowDown,
+			Timestamp:   now.Unix(),
+		}, true
+	case models.EventTypeGroupParticipantChanged:
+		return models.GroupParticipantChangedData{
+			Group:        sampleGroupJID,
+			GroupName:    sampleGroupName,
+			Action:       models.GroupActionJoin,
+			Participants: []string{sampleJID},
+			Reason:       "invite",
+			Timestamp:    now.Unix(),
+		}, true
+	case models.EventTypeCallReceived:
+		return models.CallReceivedData{
+			CallID:    "SAMPLE0000000000000000000000000",
+			From:      sampleJID,
+			FromPhone: samplePhone,
+			Timestamp: now.Unix(),
+		}, true
+	case models.EventTypeUpdateAvailable:
+		return map[string]interface{}{
+			"current_version": version.Version,
+			"latest_version":  "v99.0.0",
+			"release_url":     "https://github.com/thorved/PingLater/releases",
+		}, true
+	case models.EventTypeWebhookDisabled:
+		return models.WebhookDisabledData{
+			WebhookID:           webhook.ID,
+			URL:                 webhook.URL,
+			ConsecutiveFailures: 10,
+			LastError:           "HTTP 500",
+			DisabledAt:          now,
+		}, true
+	case models.EventTypeLoginLockout:
+		return models.LoginLockoutData{
+			Scope:       "username",
+			Username:    "admin",
+			IPAddress:   "203.0.113.7",
+			Failures:    5,
+			LockedUntil: now.Add(time.Minute),
+		}, true
+	}
+	return nil, false
+}
@@ -0,0 +1,351 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/logging"
+	"github.com/user/pinglater/internal/models"
+	"github.com/user/pinglater/internal/whatsapp"
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultSendInterval is the pause between queued sends when SEND_QUEUE_INTERVAL is unset
+	defaultSendInterval = 1 * time.Second
+	// sendQueuePollInterval is how often the idle worker checks the queue without being
+	// woken, and how often it checks whether WhatsApp is back while disconnected
+	sendQueuePollInterval = 5 * time.Second
+	// sendRateLimitBackoff is how long sending pauses after WhatsApp rate limits us
+	sendRateLimitBackoff = 1 * time.Minute
+	// sendQueueLookahead is how many of the next queued messages are considered when
+	// the send policy holds back messages to some chats
+	sendQueueLookahead = 50
+	// sendQueueOrder sends higher priority messages first, and each priority oldest first
+	sendQueueOrder = "CASE priority WHEN 'high' THEN 0 WHEN 'low' THEN 2 ELSE 1 END, id"
+)
+
+var sendLog = logging.Logger("send")
+
+// MessageSender sends queued messages into WhatsApp
+type MessageSender interface {
+	// CanSend reports whether WhatsApp is connected, or sends are sandboxed
+	CanSend() bool
+	// SendMessage and SendMedia send for a user, and return the message ID and the text
+	// or caption as sent, which send hooks may have changed
+	SendMessage(userID uint, jid string, message string) (string, string, error)
+	SendMedia(userID uint, jid string, media models.MediaAttachment) (string, string, error)
+	// CheckSendPolicy returns a whatsapp.ThrottledError while the send policy holds back
+	// messages to jid
+	CheckSendPolicy(jid string) error
+}
+
+// RecipientJID returns the JID of a recipient given as a phone number, or as a JID
+// (e.g. a group's, ending in @g.us)
+func RecipientJID(recipient string) string {
+	if strings.Contains(recipient, "@") {
+		return recipient
+	}
+	return recipient + "@s.whatsapp.net"
+}
+
+// TestMessageID returns a made-up message ID for a message simulated in test mode
+func TestMessageID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "TEST" + strings.ToUpper(hex.EncodeToString(b))
+}
+
+// SendQueue sends queued messages one at a time, pausing between them. Messages are
+// stored before sending, so the queue survives restarts. They're sent oldest first,
+// except that messages to a chat the send policy holds back wait while later ones go.
+type SendQueue struct {
+	db       *gorm.DB
+	interval time.Duration
+
+	mu       sync.RWMutex
+	sender   MessageSender
+	callback func(models.OutgoingMessage)
+
+	wake     chan struct{}
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+var (
+	sendQueue     *SendQueue
+	sendQueueOnce sync.Once
+)
+
+// GetSendQueue returns the send queue, starting its worker on first use
+func GetSendQueue() *SendQueue {
+	sendQueueOnce.Do(func() {
+		sendQueue = &SendQueue{
+			db:       db.GetDB(),
+			interval: envDuration("SEND_QUEUE_INTERVAL", defaultSendInterval),
+			wake:     make(chan struct{}, 1),
+			stopChan: make(chan struct{}),
+		}
+		if sendQueue.db == nil {
+			return
+		}
+		sendQueue.failInterruptedSends()
+		sendQueue.wg.Add(1)
+		go sendQueue.worker()
+	})
+	return sendQueue
+}
+
+// SetSender sets the WhatsApp client messages are sent with
+func (q *SendQueue) SetSender(sender MessageSender) {
+	q.mu.Lock()
+	q.sender = sender
+	q.mu.Unlock()
+	q.wakeWorker()
+}
+
+// SetCallback sets a function called after each queued message is sent or has failed
+func (q *SendQueue) SetCallback(callback func(models.OutgoingMessage)) {
+	q.mu.Lock()
+	q.callback = callback
+	q.mu.Unlock()
+}
+
+// Enqueue stores messages for sending, in order within each priority
+func (q *SendQueue) Enqueue(tx *gorm.DB, messages []models.OutgoingMessage) error {
+	for i := range messages {
+		messages[i].Status = models.SendStatusQueued
+		if messages[i].Priority == "" {
+			messages[i].Priority = models.SendPriorityNormal
+		}
+	}
+	if err := tx.CreateInBatches(messages, 100).Error; err != nil {
+		return err
+	}
+	q.wakeWorker()
+	return nil
+}
+
+// Stop waits for the message being sent, if any. Queued messages are sent after the
+// next start.
+func (q *SendQueue) Stop() {
+	q.stopOnce.Do(func() { close(q.stopChan) })
+	q.wg.Wait()
+}
+
+func (q *SendQueue) wakeWorker() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// failInterruptedSends fails messages that were being sent when the process stopped.
+// They may or may not have reached WhatsApp, and sending twice is worse than not at all.
+func (q *SendQueue) failInterruptedSends() {
+	result := q.db.Model(&models.OutgoingMessage{}).
+		Where("status = ?", models.SendStatusSending).
+		Updates(map[string]interface{}{
+			"status": models.SendStatusFailed,
+			"error":  "Interrupted by a restart; the message may not have been sent",
+		})
+	if result.Error != nil {
+		sendLog.Error("Failed to recover interrupted sends", "error", result.Error)
+	} else if result.RowsAffected > 0 {
+		sendLog.Warn("Marked interrupted sends as failed", "count", result.RowsAffected)
+	}
+}
+
+// worker sends queued messages, oldest first, until the queue is stopped
+func (q *SendQueue) worker() {
+	defer q.wg.Done()
+
+	for {
+		pause := q.sendNext()
+		if pause == 0 {
+			continue
+		}
+
+		// New messages only cut the idle wait short, not the pacing between sends
+		var wake chan struct{}
+		if pause == sendQueuePollInterval {
+			wake = q.wake
+		}
+		timer := time.NewTimer(pause)
+		select {
+		case <-q.stopChan:
+			timer.Stop()
+			return
+		case <-wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// sendNext sends the first queued message the send policy allows, highest priority
+// first, and returns how long to wait before the next
+func (q *SendQueue) sendNext() time.Duration {
+	select {
+	case <-q.stopChan:
+		return sendQueuePollInterval
+	default:
+	}
+
+	q.mu.RLock()
+	sender, callback := q.sender, q.callback
+	q.mu.RUnlock()
+	if q.simulateTestMessage(callback) {
+		return 0
+	}
+	if sender == nil || !sender.CanSend() {
+		return sendQueuePollInterval
+	}
+
+	var queued []models.OutgoingMessage
+	if err := q.db.Where("status = ? AND test_mode = ?", models.SendStatusQueued, false).Order(sendQueueOrder).Limit(sendQueueLookahead).Find(&queued).Error; err != nil {
+		sendLog.Error("Failed to read the send queue", "error", err)
+		return sendQueuePollInterval
+	}
+	msg, pause := nextAllowedMessage(sender, queued)
+	if msg == nil {
+		return pause
+	}
+	q.db.Model(msg).Update("status", models.SendStatusSending)
+
+	var messageID, text string
+	var err error
+	if msg.MediaMimeType != "" {
+		messageID, text, err = sender.SendMedia(msg.UserID, RecipientJID(msg.PhoneNumber), models.MediaAttachment{
+			Data:     msg.MediaData,
+			MimeType: msg.MediaMimeType,
+			Filename: msg.MediaFilename,
+			Caption:  msg.Message,
+		})
+	} else {
+		messageID, text, err = sender.SendMessage(msg.UserID, RecipientJID(msg.PhoneNumber), msg.Message)
+	}
+	if err != nil && (errors.Is(err, whatsapp.ErrRateLimited) || errors.Is(err, whatsapp.ErrThrottled) || !sender.CanSend()) {
+		// Not sent; try again once WhatsApp or the send policy lets us
+		q.db.Model(msg).Update("status", models.SendStatusQueued)
+		var throttled *whatsapp.ThrottledError
+		switch {
+		case errors.Is(err, whatsapp.ErrRateLimited):
+			sendLog.Warn("Rate limited by WhatsApp, pausing the send queue", "pause", sendRateLimitBackoff.String())
+			return sendRateLimitBackoff
+		case errors.As(err, &throttled) && !throttled.Recipient:
+			return throttled.RetryAfter
+		case errors.As(err, &throttled):
+			return 0 // Other chats' messages can still go
+		}
+		return sendQueuePollInterval
+	}
+
+	updates := map[string]interface{}{}
+	if msg.MediaData != nil {
+		updates["media_data"] = nil
+	}
+	if errors.Is(err, whatsapp.ErrSendVetoed) {
+		sendLog.Info("Queued message blocked", "id", msg.ID, "error", err)
+		msg.Status, msg.Error = models.SendStatusBlocked, err.Error()
+		updates["error"] = msg.Error
+	} else if err != nil {
+		sendLog.Warn("Failed to send queued message", "id", msg.ID, "error", err)
+		msg.Status, msg.Error = models.SendStatusFailed, err.Error()
+		updates["error"] = msg.Error
+	} else {
+		now := time.Now()
+		msg.Status, msg.WhatsAppMessageID, msg.SentAt = models.SendStatusSent, messageID, &now
+		updates["whatsapp_message_id"] = messageID
+		updates["sent_at"] = now
+		if text != msg.Message {
+			// Keep the text as the send hooks left it
+			msg.Message = text
+			updates["message"] = text
+		}
+	}
+	updates["status"] = msg.Status
+	if err := q.db.Model(msg).Updates(updates).Error; err != nil {
+		sendLog.Error("Failed to update queued message", "id", msg.ID, "error", err)
+	}
+
+	if callback != nil {
+		callback(*msg)
+	}
+	if q.interval <= 0 {
+		return 0
+	}
+	return q.interval
+}
+
+// simulateTestMessage marks the oldest queued test-mode message as sent without sending
+// it, and reports whether there was one. Test-mode messages don't wait for WhatsApp, the
+// queue's pacing or the send policy.
+func (q *SendQueue) simulateTestMessage(callback func(models.OutgoingMessage)) bool {
+	var msg models.OutgoingMessage
+	err := q.db.Where("status = ? AND test_mode = ?", models.SendStatusQueued, true).Order(sendQueueOrder).Limit(1).Find(&msg).Error
+	if err != nil || msg.ID == 0 {
+		return false
+	}
+
+	now := time.Now()
+	msg.Status, msg.WhatsAppMessageID, msg.SentAt = models.SendStatusSent, TestMessageID(), &now
+	err = q.db.Model(&msg).Updates(map[string]interface{}{
+		"status":              msg.Status,
+		"whatsapp_message_id": msg.WhatsAppMessageID,
+		"sent_at":             now,
+		"media_data":          nil,
+	}).Error
+	if err != nil {
+		sendLog.Error("Failed to update simulated test message", "id", msg.ID, "error", err)
+		return false
+	}
+	sendLog.Debug("Simulated test-mode message", "id", msg.ID, "to", msg.PhoneNumber)
+
+	if callback != nil {
+		callback(msg)
+	}
+	return true
+}
+
+// nextAllowedMessage returns the oldest of the queued messages the send policy allows
+// now. Without one, it returns how long to wait: until the global limit allows sending,
+// or the poll interval while every chat queued is held back or there's nothing queued.
+func nextAllowedMessage(sender MessageSender, queued []models.OutgoingMessage) (*models.OutgoingMessage, time.Duration) {
+	for i := range queued {
+		err := sender.CheckSendPolicy(RecipientJID(queued[i].PhoneNumber))
+		var throttled *whatsapp.ThrottledError
+		if !errors.As(err, &throttled) {
+			// Messages with invalid recipients are sent so they fail
+			return &queued[i], 0
+		}
+		if !throttled.Recipient {
+			return nil, throttled.RetryAfter
+		}
+	}
+	return nil, sendQueuePollInterval
+}
+
+// RecordReceipt moves queued messages the recipient received (delivered) or read
+// forward to that status. Receipts arriving out of order never move a message back.
+func (q *SendQueue) RecordReceipt(userID uint, messageIDs []string, status string) {
+	if q.db == nil || len(messageIDs) == 0 {
+		return
+	}
+	from := []string{models.SendStatusSent}
+	if status == models.SendStatusRead {
+		from = append(from, models.SendStatusDelivered)
+	}
+	err := q.db.Model(&models.OutgoingMessage{}).
+		Where("user_id = ? AND whatsapp_message_id IN ? AND status IN ?", userID, messageIDs, from).
+		Update("status", status).Error
+	if err != nil {
+		sendLog.Error("Failed to record message receipt", "status", status, "error", err)
+	}
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// blockedNetworks are ranges webhook deliveries may not reach unless explicitly allowed
+var blockedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",          // "This" network
+	"100.64.0.0/10",      // Carrier-grade NAT
+	"192.0.0.0/24",       // IETF protocol assignments
+	"198.18.0.0/15",      // Benchmarking
+	"fc00::/7",           // Unique local
+	"64:ff9b::/96",       // NAT64
+	"2001:db8::/32",      // Documentation
+	"240.0.0.0/4",        // Reserved
+	"255.255.255.255/32", // Broadcast
+)
+
+// URLGuard blocks outbound requests to private, loopback, and link-local addresses,
+// so authenticated users can't make the server POST to internal services such as
+// cloud metadata endpoints (169.254.169.254)
+type URLGuard struct {
+	allowPrivate bool
+	allowedNets  []*net.IPNet
+	allowedHosts map[string]bool
+	dialer       *net.Dialer
+}
+
+var (
+	urlGuard     *URLGuard
+	urlGuardOnce sync.Once
+)
+
+// GetURLGuard returns the URL guard configured from the environment:
+// WEBHOOK_ALLOW_PRIVATE_NETWORKS=true disables the check entirely,
+// WEBHOOK_ALLOWED_HOSTS and WEBHOOK_ALLOWED_CIDRS allowlist specific internal targets
+func GetURLGuard() *URLGuard {
+	urlGuardOnce.Do(func() {
+		urlGuard = &URLGuard{
+			allowPrivate: os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") == "true",
+			allowedHosts: make(map[string]bool),
+		}
+		for _, host := range ParseEventTypesFromString(os.Getenv("WEBHOOK_ALLOWED_HOSTS")) {
+			urlGuard.allowedHosts[strings.ToLower(host)] = true
+		}
+		for _, cidr := range ParseEventTypesFromString(os.Getenv("WEBHOOK_ALLOWED_CIDRS")) {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				webhookLog.Warn("Ignoring invalid WEBHOOK_ALLOWED_CIDRS entry", "cidr", cidr, "error", err)
+				continue
+			}
+			urlGuard.allowedNets = append(urlGuard.allowedNets, network)
+		}
+		urlGuard.dialer = &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control:   urlGuard.controlConn,
+		}
+	})
+	return urlGuard
+}
+
+// ValidateURL checks a webhook URL at create/update time
+func (g *URLGuard) ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("URL scheme must be http or https")
+	}
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("URL must include a host")
+	}
+	return g.ValidateHost(host)
+}
+
+// ValidateHost checks a destination host (name or IP) at create/update time
+func (g *URLGuard) ValidateHost(host string) error {
+	if g.allowPrivate || g.allowedHosts[strings.ToLower(host)] {
+		return nil
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return g.CheckIP(ip)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve host %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if err := g.CheckIP(addr.IP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckProxiedHost checks a destination that a proxy will connect to on our behalf.
+// Hosts that don't resolve locally are allowed, since behind a proxy only the proxy
+// may be able to resolve public names.
+func (g *URLGuard) CheckProxiedHost(host string) error {
+	if g.allowPrivate || g.allowedHosts[strings.ToLower(host)] {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return g.CheckIP(ip)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if err := g.CheckIP(addr.IP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckIP returns an error if the address is in a blocked range and not allowlisted
+func (g *URLGuard) CheckIP(ip net.IP) error {
+	if g.allowPrivate {
+		return nil
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	for _, network := range g.allowedNets {
+		if network.Contains(ip) {
+			return nil
+		}
+	}
+
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("destination %s is a private or reserved address", ip)
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return fmt.Errorf("destination %s is a private or reserved address", ip)
+		}
+	}
+	return nil
+}
+
+// DialContext dials through the guard. Allowlisted hostnames bypass the check; everything
+// else is verified against the address actually being connected to, which also defeats
+// DNS rebinding between validation and delivery.
+func (g *URLGuard) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err == nil && g.allowedHosts[strings.ToLower(host)] {
+		return (&net.Dialer{Timeout: g.dialer.Timeout, KeepAlive: g.dialer.KeepAlive}).DialContext(ctx, network, address)
+	}
+	return g.dialer.DialContext(ctx, network, address)
+}
+
+// controlConn runs after DNS resolution, right before the socket connects
+func (g *URLGuard) controlConn(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("unexpected non-IP dial address %s", host)
+	}
+	return g.CheckIP(ip)
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// payloadTemplateFuncs are the helpers available inside webhook payload templates
+var payloadTemplateFuncs = template.FuncMap{
+	// json renders a value as a JSON literal, so strings are quoted and escaped correctly
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"trim":  strings.TrimSpace,
+	"default": func(def interface{}, v interface{}) interface{} {
+		if v == nil || v == "" {
+			return def
+		}
+		return v
+	},
+}
+
+// ValidatePayloadTemplate checks that a payload template parses
+func ValidatePayloadTemplate(tmpl string) error {
+	if tmpl == "" {
+		return nil
+	}
+	_, err := template.New("payload").Funcs(payloadTemplateFuncs).Option("missingkey=zero").Parse(tmpl)
+	return err
+}
+
+// RenderPayloadTemplate transforms a standard webhook payload using a Go template.
+// The template sees the payload as decoded JSON, so fields are addressed by their
+// JSON names, e.g. {"text": {{ json .data.content }}}.
+func RenderPayloadTemplate(tmpl string, payload []byte) ([]byte, error) {
+	t, err := template.New("payload").Funcs(payloadTemplateFuncs).Option("missingkey=zero").Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload template: %w", err)
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return nil, fmt.Errorf("failed to decode payload for template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render payload template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -4,28 +4,63 @@ import (
 	"bytes"
 	"crypto/hmac"
 	"crypto/sha256"
+	"crypto/tls"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/user/pinglater/internal/db"
 	"github.com/user/pinglater/internal/models"
 	"gorm.io/gorm"
 )
 
+// EventCallback is called for service-level events that should be surfaced to the
+// dashboard of the user they concern
+type EventCallback func(userID uint, eventType string, message string, details string)
+
 // WebhookService handles webhook delivery with retry logic
 type WebhookService struct {
-	db         *gorm.DB
-	httpClient *http.Client
-	mu         sync.RWMutex
-	stopChan   chan struct{}
-	wg         sync.WaitGroup
+	db            *gorm.DB
+	httpClient    *http.Client
+	mu            sync.RWMutex
+	stopChan      chan struct{}
+	wg            sync.WaitGroup
+	outboxWake    chan struct{} // Signals outbox workers that new rows are available
+	eventCallback EventCallback
+	breaker       *CircuitBreaker
+	limiter       *DeliveryRateLimiter
+	baseTLS       *tls.Config               // Global TLS settings (custom CA, client cert) from the environment
+	proxy         proxyConfig               // Global outbound proxy from the environment
+	clients       map[uint]*cachedClient    // Per-webhook clients for webhooks with their own TLS or proxy settings
+	publishers    map[uint]*cachedPublisher // Per-webhook publishers for non-HTTP targets
+	replySender   ReplySender               // Sends replies for reply-mode webhooks
+	userAgent     string                    // User-Agent of HTTP deliveries
+	headers       http.Header               // Instance-identifying headers sent with every delivery
+	instance      string                    // Name the outbox rows this instance claims are marked with
+
+	// Pipeline metrics
+	inFlight       atomic.Int64
+	workers        atomic.Int32
+	deliveredTotal atomic.Int64
+	failedTotal    atomic.Int64
+
+	maxConsecutiveFailures int  // Auto-disable threshold, 0 disables the feature
+	gzipMinBytes           int  // Smallest payload compressed for webhooks with compression enabled
+	logPayloads            bool // Include payload bodies in debug logs
+	responseMaxBytes       int  // Longest response body kept in the delivery log
+
+	maxRetries     int           // Retries before a failed delivery is abandoned, unless the webhook sets its own
+	maxDeliveryAge time.Duration // Age after which a failed delivery is abandoned (0 = no limit), unless the webhook sets its own
 }
 
 var (
@@ -36,151 +71,382 @@ var (
 // GetWebhookService returns the singleton webhook service instance
 func GetWebhookService() *WebhookService {
 	once.Do(func() {
+		baseTLS, err := loadGlobalTLSConfig()
+		if err != nil {
+			webhookLog.Warn("Ignoring invalid global TLS configuration", "error", err)
+		}
+		proxy, err := loadGlobalProxy()
+		if err != nil {
+			webhookLog.Warn("Ignoring invalid WEBHOOK_PROXY_URL", "error", err)
+		}
+
 		webhookService = &WebhookService{
-			db: db.GetDB(),
-			httpClient: &http.Client{
-				Timeout: 30 * time.Second,
-			},
-			stopChan: make(chan struct{}),
+			db:                     db.GetDB(),
+			httpClient:             newHTTPClient(baseTLS, proxy),
+			baseTLS:                baseTLS,
+			proxy:                  proxy,
+			userAgent:              deliveryUserAgent(),
+			headers:                loadDeliveryHeaders(),
+			instance:               instanceName(),
+			clients:                make(map[uint]*cachedClient),
+			publishers:             make(map[uint]*cachedPublisher),
+			stopChan:               make(chan struct{}),
+			outboxWake:             make(chan struct{}, 1),
+			maxConsecutiveFailures: envInt("WEBHOOK_MAX_CONSECUTIVE_FAILURES", 10),
+			gzipMinBytes:           envInt("WEBHOOK_GZIP_MIN_BYTES", defaultGzipMinBytes),
+			logPayloads:            os.Getenv("WEBHOOK_LOG_PAYLOADS") == "true",
+			responseMaxBytes:       envInt("WEBHOOK_RESPONSE_MAX_BYTES", defaultResponseMaxBytes),
+			maxRetries:             clampRetries(envInt("WEBHOOK_MAX_RETRIES", defaultMaxRetries)),
+			maxDeliveryAge:         envDuration("WEBHOOK_MAX_DELIVERY_AGE", 0),
+			limiter:                NewDeliveryRateLimiter(),
+			breaker:                NewCircuitBreaker(envInt("WEBHOOK_CIRCUIT_THRESHOLD", 5), envDuration("WEBHOOK_CIRCUIT_COOLDOWN", 60*time.Second)),
 		}
 		// Start the retry processor
+		webhookService.wg.Add(1)
 		go webhookService.processRetries()
+		// Start the outbox workers
+		webhookService.startOutboxWorkers()
+		// Start the delivery log pruner
+		webhookService.wg.Add(1)
+		go webhookService.processRetention()
 	})
 	return webhookService
 }
 
-// Stop gracefully shuts down the webhook service
+// SetEventCallback sets a callback function that will be called on service events
+func (s *WebhookService) SetEventCallback(callback EventCallback) {
+	s.mu.Lock()
+	s.eventCallback = callback
+	s.mu.Unlock()
+}
+
+func (s *WebhookService) notifyEvent(userID uint, eventType, message, details string) {
+	s.mu.RLock()
+	callback := s.eventCallback
+	s.mu.RUnlock()
+	if callback != nil {
+		callback(userID, eventType, message, details)
+	}
+}
+
+// Stop gracefully shuts down the webhook service, waiting for in-flight deliveries.
+// Rows still queued in the outbox are delivered after the next start.
 func (s *WebhookService) Stop() {
 	close(s.stopChan)
 	s.wg.Wait()
+	s.closePublishers()
+}
+
+// Running reports whether the delivery workers and retry processor are running, i.e.
+// Stop hasn't been called
+func (s *WebhookService) Running() bool {
+	select {
+	case <-s.stopChan:
+		return false
+	default:
+		return true
+	}
 }
 
 // TriggerWebhooks triggers all active webhooks for a user and event type
 func (s *WebhookService) TriggerWebhooks(userID uint, eventType string, data interface{}) {
+	s.trigger(userID, eventType, data, false, 0)
+}
+
+// TriggerInboundWebhooks triggers webhooks for an event from the inbound queue. Its
+// deliveries get IDs derived from the queued event, and when the event is processed
+// again after a crash, deliveries already queued aren't queued twice.
+func (s *WebhookService) TriggerInboundWebhooks(inboundEventID, userID uint, eventType string, data interface{}) {
+	s.trigger(userID, eventType, data, false, inboundEventID)
+}
+
+// TriggerTestWebhooks triggers only the user's test-mode webhooks, for events caused by
+// a test-mode API token, such as its simulated messages
+func (s *WebhookService) TriggerTestWebhooks(userID uint, eventType string, data interface{}) {
+	s.trigger(userID, eventType, data, true, 0)
+}
+
+// trigger queues an event for the user's active webhooks subscribed to it, or only for
+// the test-mode ones. inboundEventID is the event's inbound queue ID, if it came from
+// there.
+func (s *WebhookService) trigger(userID uint, eventType string, data interface{}, testOnly bool, inboundEventID uint) {
 	if s.db == nil {
-		fmt.Println("[Webhook] Database is nil, cannot trigger webhooks")
+		webhookLog.Error("Database is nil, cannot trigger webhooks")
 		return
 	}
 
-	fmt.Printf("[Webhook] Triggering webhooks for user %d, event: %s\n", userID, eventType)
+	webhookLog.Debug("Triggering webhooks", "user_id", userID, "event", eventType, "test_only", testOnly)
 
 	// Get all active webhooks for this user that are subscribed to this event type
 	var webhooks []models.Webhook
-	result := s.db.Where("user_id = ? AND is_active = ?", userID, true).Find(&webhooks)
+	query := s.db.Where("user_id = ? AND is_active = ?", userID, true)
+	if testOnly {
+		query = query.Where("test_mode = ?", true)
+	}
+	result := query.Find(&webhooks)
 	if result.Error != nil {
-		fmt.Printf("[Webhook] Failed to fetch webhooks for user %d: %v\n", userID, result.Error)
+		webhookLog.Error("Failed to fetch webhooks", "user_id", userID, "error", result.Error)
 		return
 	}
 
-	fmt.Printf("[Webhook] Found %d active webhooks for user %d\n", len(webhooks), userID)
-
 	// Filter webhooks by event type and filters
+	orderForCollapse(webhooks)
+	delivered := make(map[string]bool) // Targets that get this event, for collapse_duplicates
 	triggeredCount := 0
 	for _, webhook := range webhooks {
 		eventTypes := models.ParseEventTypes(webhook.EventTypes)
-		fmt.Printf("[Webhook] Webhook %d event types: %v, checking for: %s\n", webhook.ID, eventTypes, eventType)
 		if contains(eventTypes, eventType) {
-			// Check if message data matches webhook filters
-			if msgData, ok := data.(models.MessageReceivedData); ok {
-				if !s.matchesFilters(&webhook, msgData) {
-					fmt.Printf("[Webhook] Webhook %d skipped - filters don't match\n", webhook.ID)
+			// Check if the event matches webhook filters
+			if subject, ok := filterSubjectFor(data); ok {
+				if !s.matchesFilters(&webhook, subject) {
+					webhookLog.Debug("Webhook skipped, filters don't match", "webhook_id", webhook.ID, "event", eventType)
 					continue
 				}
 			}
-			fmt.Printf("[Webhook] Triggering webhook %d to URL: %s\n", webhook.ID, webhook.URL)
-			// Deliver webhook asynchronously
-			go s.deliverWebhook(&webhook, eventType, data)
+			targetKey := deliveryTargetKey(&webhook)
+			if webhook.TestMode {
+				// Test deliveries are marked, so they never stand in for live ones
+				targetKey = "test:" + targetKey
+			}
+			if webhook.CollapseDuplicates && delivered[targetKey] {
+				webhookLog.Debug("Webhook skipped, event already sent to the same target", "webhook_id", webhook.ID, "event", eventType)
+				continue
+			}
+			deliveryID := uuid.NewString()
+			if inboundEventID != 0 {
+				deliveryID = inboundDeliveryID(inboundEventID, webhook.ID)
+				if s.deliveryQueued(deliveryID) {
+					webhookLog.Debug("Webhook skipped, event already queued before a restart", "webhook_id", webhook.ID, "event", eventType, "delivery_id", deliveryID)
+					delivered[targetKey] = true
+					continue
+				}
+			}
+			// Persist to the outbox; workers deliver asynchronously
+			if err := s.enqueueDeliveryWithID(&webhook, eventType, data, deliveryID); err != nil {
+				webhookLog.Error("Failed to enqueue delivery", "webhook_id", webhook.ID, "event", eventType, "error", err)
+				continue
+			}
+			delivered[targetKey] = true
 			triggeredCount++
 		}
 	}
 
-	fmt.Printf("[Webhook] Triggered %d webhooks\n", triggeredCount)
+	webhookLog.Debug("Triggered webhooks", "event", eventType, "active", len(webhooks), "triggered", triggeredCount)
+	if triggeredCount > 0 {
+		s.wakeOutboxWorkers()
+	}
 }
 
-// matchesFilters checks if message data matches webhook filter criteria
-func (s *WebhookService) matchesFilters(webhook *models.Webhook, data models.MessageReceivedData) bool {
-	// Check chat type filter
-	if webhook.FilterChatType != "" && webhook.FilterChatType != "all" {
-		isGroup := data.IsGroup
-		if webhook.FilterChatType == "individual" && isGroup {
-			return false
-		}
-		if webhook.FilterChatType == "group" && !isGroup {
+// filterSubject is what webhook filters are matched against
+type filterSubject struct {
+	Phone     string   // Phone number the event is about; phone filters are skipped when empty
+	IsGroup   bool     // Whether the event happened in a group
+	GroupIDs  []string // Identifiers the group JID filter matches against
+	GroupName string
+}
+
+// filterSubjectFor extracts the filterable fields of an event. Events without a chat,
+// such as connection changes, aren't filtered.
+func filterSubjectFor(data interface{}) (filterSubject, bool) {
+	switch d := data.(type) {
+	case models.MessageReceivedData:
+		return filterSubject{Phone: d.FromPhone, IsGroup: d.IsGroup, GroupIDs: []string{d.From, d.Chat}, GroupName: d.GroupName}, true
+	case models.MessageReceiptData:
+		return filterSubject{Phone: d.FromPhone, IsGroup: d.IsGroup, GroupIDs: []string{d.Chat}}, true
+	case models.GroupParticipantChangedData:
+		return filterSubject{IsGroup: true, GroupIDs: []string{d.Group}, GroupName: d.GroupName}, true
+	case models.CallReceivedData:
+		return filterSubject{Phone: d.FromPhone, IsGroup: d.IsGroup, GroupIDs: []string{d.Group}}, true
+	}
+	return filterSubject{}, false
+}
+
+// matchesFilters checks if an event matches webhook filter criteria
+func (s *WebhookService) matchesFilters(webhook *models.Webhook, data filterSubject) bool {
+	for _, check := range checkFilters(webhook, data) {
+		if check.Result == models.FilterCheckFailed {
 			return false
 		}
 	}
+	return true
+}
+
+// checkFilters checks an event against each of a webhook's filters. The event matches
+// if none fail.
+func checkFilters(webhook *models.Webhook, data filterSubject) []models.WebhookFilterCheck {
+	checks := make([]models.WebhookFilterCheck, 0, 4)
+	check := func(filter, result, reason string, args ...interface{}) {
+		checks = append(checks, models.WebhookFilterCheck{Filter: filter, Result: result, Reason: fmt.Sprintf(reason, args...)})
+	}
+
+	// Check chat type filter
+	switch {
+	case webhook.FilterChatType == "" || webhook.FilterChatType == "all":
+		check("chat_type", models.FilterCheckSkipped, "No chat type filter")
+	case webhook.FilterChatType == "individual" && data.IsGroup:
+		check("chat_type", models.FilterCheckFailed, "Group chat, but the webhook only gets direct chats")
+	case webhook.FilterChatType == "group" && !data.IsGroup:
+		check("chat_type", models.FilterCheckFailed, "Direct chat, but the webhook only gets group chats")
+	default:
+		check("chat_type", models.FilterCheckPassed, "Chat type is %s", webhook.FilterChatType)
+	}
 
 	// Check phone number filter (only for individual chats or if explicitly set)
 	phoneNumbers := models.ParseEventTypes(webhook.FilterPhoneNumbers)
-	if len(phoneNumbers) > 0 {
-		matches := models.PhoneNumberMatches(data.FromPhone, phoneNumbers)
+	switch {
+	case len(phoneNumbers) == 0:
+		check("phone_numbers", models.FilterCheckSkipped, "No phone number filter")
+	case data.Phone == "":
+		check("phone_numbers", models.FilterCheckSkipped, "The event has no phone number")
+	default:
+		matches := models.PhoneNumberMatches(data.Phone, phoneNumbers)
 		matchType := webhook.FilterPhoneMatchType
 		if matchType == "" {
 			matchType = "whitelist"
 		}
 
-		if matchType == "whitelist" && !matches {
-			return false
-		}
-		if matchType == "blacklist" && matches {
-			return false
+		switch {
+		case matchType == "whitelist" && !matches:
+			check("phone_numbers", models.FilterCheckFailed, "%s isn't on the whitelist", data.Phone)
+		case matchType == "blacklist" && matches:
+			check("phone_numbers", models.FilterCheckFailed, "%s is on the blacklist", data.Phone)
+		case matchType == "blacklist":
+			check("phone_numbers", models.FilterCheckPassed, "%s isn't on the blacklist", data.Phone)
+		default:
+			check("phone_numbers", models.FilterCheckPassed, "%s is on the whitelist", data.Phone)
 		}
 	}
 
 	// Check group filters (only relevant for group messages)
-	if data.IsGroup {
-		// Check group JID filter
-		groupJIDs := models.ParseEventTypes(webhook.FilterGroupJIDs)
-		if len(groupJIDs) > 0 {
-			matches := false
-			for _, jid := range groupJIDs {
-				if strings.EqualFold(jid, data.From) {
-					matches = true
-					break
+	groupJIDs := models.ParseEventTypes(webhook.FilterGroupJIDs)
+	switch {
+	case len(groupJIDs) == 0:
+		check("group_jids", models.FilterCheckSkipped, "No group JID filter")
+	case !data.IsGroup:
+		check("group_jids", models.FilterCheckSkipped, "Not a group chat")
+	default:
+		matched := ""
+		for _, jid := range groupJIDs {
+			for _, id := range data.GroupIDs {
+				if id != "" && strings.EqualFold(jid, id) {
+					matched = id
 				}
 			}
-			if !matches {
-				return false
-			}
 		}
+		if matched == "" {
+			check("group_jids", models.FilterCheckFailed, "None of %s is one of the groups", strings.Join(nonEmpty(data.GroupIDs), ", "))
+		} else {
+			check("group_jids", models.FilterCheckPassed, "%s is one of the groups", matched)
+		}
+	}
 
-		// Check group name filter
-		groupNames := models.ParseEventTypes(webhook.FilterGroupNames)
-		if len(groupNames) > 0 {
-			matches := false
-			for _, name := range groupNames {
-				if strings.EqualFold(name, data.GroupName) {
-					matches = true
-					break
-				}
-			}
-			if !matches {
-				return false
+	// Check group name filter
+	groupNames := models.ParseEventTypes(webhook.FilterGroupNames)
+	switch {
+	case len(groupNames) == 0:
+		check("group_names", models.FilterCheckSkipped, "No group name filter")
+	case !data.IsGroup:
+		check("group_names", models.FilterCheckSkipped, "Not a group chat")
+	case data.GroupName == "":
+		check("group_names", models.FilterCheckFailed, "The group's name is unknown")
+	default:
+		matches := false
+		for _, name := range groupNames {
+			if strings.EqualFold(name, data.GroupName) {
+				matches = true
+				break
 			}
 		}
+		if matches {
+			check("group_names", models.FilterCheckPassed, "%q is one of the group names", data.GroupName)
+		} else {
+			check("group_names", models.FilterCheckFailed, "%q isn't one of the group names", data.GroupName)
+		}
 	}
 
-	return true
+	return checks
 }
 
-// deliverWebhook sends a webhook notification and logs the delivery
-func (s *WebhookService) deliverWebhook(webhook *models.Webhook, eventType string, data interface{}) {
-	fmt.Printf("[Webhook] Delivering to webhook %d: %s\n", webhook.ID, webhook.URL)
+func nonEmpty(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// TestFilters reports whether a message_received event would match a webhook's
+// filters and be delivered, and why. A missing from_phone is taken from from, and a
+// chat with a group JID counts as a group, as they would be for a real message.
+func (s *WebhookService) TestFilters(webhook *models.Webhook, data models.MessageReceivedData) models.WebhookFilterTestResponse {
+	if data.FromPhone == "" {
+		data.FromPhone, _, _ = strings.Cut(data.From, "@")
+	}
+	if strings.HasSuffix(data.Chat, "@g.us") {
+		data.IsGroup = true
+	}
 
-	payload := models.WebhookPayload{
-		WebhookID: fmt.Sprintf("%d", webhook.ID),
-		Event:     eventType,
-		Timestamp: time.Now(),
-		Data:      data,
+	subject, _ := filterSubjectFor(data)
+	result := models.WebhookFilterTestResponse{Matches: true, Checks: checkFilters(webhook, subject)}
+	for _, check := range result.Checks {
+		if check.Result == models.FilterCheckFailed {
+			result.Matches = false
+		}
+	}
+
+	if !webhook.IsActive {
+		result.Blockers = append(result.Blockers, "The webhook is inactive")
+	}
+	if !contains(models.ParseEventTypes(webhook.EventTypes), string(models.EventTypeMessageReceived)) {
+		result.Blockers = append(result.Blockers, "The webhook isn't subscribed to message_received")
+	}
+	if IgnoresEvent(webhook.UserID, data) {
+		result.Blockers = append(result.Blockers, "The chat is on the ignore list")
+	}
+	result.WouldDeliver = result.Matches && len(result.Blockers) == 0
+	return result
+}
+
+// buildPayload builds the request body for an event in the webhook's payload version,
+// applying its payload template if set
+func (s *WebhookService) buildPayload(webhook *models.Webhook, eventType string, data interface{}) ([]byte, error) {
+	var payload interface{} = models.WebhookPayload{
+		PayloadVersion: models.PayloadVersion1,
+		WebhookID:      fmt.Sprintf("%d", webhook.ID),
+		Event:          eventType,
+		Timestamp:      time.Now(),
+		Test:           webhook.TestMode,
+		Data:           data,
+	}
+	if webhook.PayloadVersion == models.PayloadVersion2 {
+		dataType, typed := payloadDataV2(eventType, data)
+		payload = models.WebhookPayloadV2{
+			PayloadVersion: models.PayloadVersion2,
+			WebhookID:      webhook.ID,
+			Event:          eventType,
+			Timestamp:      time.Now(),
+			Test:           webhook.TestMode,
+			DataType:       dataType,
+			Data:           typed,
+		}
 	}
 
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
-		fmt.Printf("[Webhook] Failed to marshal webhook payload: %v\n", err)
-		return
+		return nil, fmt.Errorf("failed to marshal webhook payload: %w", err)
 	}
 
-	fmt.Printf("[Webhook] Payload: %s\n", string(payloadBytes))
+	if webhook.PayloadTemplate != "" {
+		return RenderPayloadTemplate(webhook.PayloadTemplate, payloadBytes)
+	}
+	return payloadBytes, nil
+}
+
+// deliverWebhook sends a queued webhook payload and logs the delivery
+func (s *WebhookService) deliverWebhook(webhook *models.Webhook, eventType string, payloadBytes []byte, replyTo, deliveryID string) {
+	s.logPayload("Delivering webhook", webhook, eventType, payloadBytes)
 
 	// Calculate HMAC signature if secret is configured
 	var signature string
@@ -190,66 +456,205 @@ func (s *WebhookService) deliverWebhook(webhook *models.Webhook, eventType strin
 
 	// Create delivery record
 	delivery := models.WebhookDelivery{
-		WebhookID: webhook.ID,
-		EventType: eventType,
-		Payload:   string(payloadBytes),
+		WebhookID:  webhook.ID,
+		EventType:  eventType,
+		Payload:    string(payloadBytes),
+		ReplyTo:    replyTo,
+		DeliveryID: deliveryID,
 	}
 
 	// Deliver the webhook
-	success, responseStatus, responseBody, err := s.sendWebhook(webhook.URL, payloadBytes, signature)
+	started := time.Now()
+	success, responseStatus, responseBody, err := s.sendWithBreaker(webhook, eventType, payloadBytes, signature, deliveryID)
+	delivery.DurationMs = time.Since(started).Milliseconds()
 
 	delivery.Success = success
 	delivery.ResponseStatus = responseStatus
-	delivery.ResponseBody = responseBody
+	delivery.ResponseBody = truncateBody(responseBody, s.responseMaxBytes)
 	if err != nil {
 		delivery.ErrorMessage = err.Error()
 	}
 
-	// If failed and retry count is less than max, schedule retry
-	if !success && delivery.RetryCount < 5 {
-		nextRetry := s.calculateNextRetry(delivery.RetryCount)
-		delivery.NextRetryAt = &nextRetry
+	// If failed, schedule a retry unless the webhook's limits say to give up
+	if !success {
+		delivery.NextRetryAt, delivery.AbandonedReason = s.scheduleRetry(webhook, 0, started)
 	}
 
 	// Save delivery record
 	if err := s.db.Create(&delivery).Error; err != nil {
-		fmt.Printf("[Webhook] Failed to save webhook delivery: %v\n", err)
-	} else {
-		fmt.Printf("[Webhook] Delivery record saved for webhook %d, success: %v\n", webhook.ID, success)
+		webhookLog.Error("Failed to save webhook delivery", "webhook_id", webhook.ID, "error", err)
+	}
+	logDeliveryResult(webhook, eventType, deliveryID, 0, success, responseStatus, delivery.DurationMs, err)
+	if delivery.AbandonedReason != "" {
+		logAbandoned(webhook, eventType, deliveryID, delivery.AbandonedReason)
+	}
+
+	// Short-circuited deliveries never reached the target, so they don't count towards auto-disable
+	if !errors.Is(err, ErrCircuitOpen) {
+		s.recordDeliveryResult(webhook, success, delivery.ErrorMessage, responseStatus)
+	}
+
+	if success {
+		s.handleReply(webhook, replyTo, responseBody)
+	}
+}
+
+// recordDeliveryResult tracks consecutive failures and disables webhooks that keep failing
+func (s *WebhookService) recordDeliveryResult(webhook *models.Webhook, success bool, errorMessage string, responseStatus int) {
+	if success {
+		s.db.Model(&models.Webhook{}).
+			Where("id = ? AND consecutive_failures <> ?", webhook.ID, 0).
+			Update("consecutive_failures", 0)
+		return
+	}
+
+	if err := s.db.Model(&models.Webhook{}).Where("id = ?", webhook.ID).
+		Update("consecutive_failures", gorm.Expr("consecutive_failures + ?", 1)).Error; err != nil {
+		webhookLog.Error("Failed to update failure count", "webhook_id", webhook.ID, "error", err)
+		return
+	}
+
+	if s.maxConsecutiveFailures <= 0 {
+		return
+	}
+
+	var current models.Webhook
+	if err := s.db.First(&current, webhook.ID).Error; err != nil {
+		return
+	}
+	if !current.IsActive || current.ConsecutiveFailures < s.maxConsecutiveFailures {
+		return
 	}
+
+	lastError := errorMessage
+	if lastError == "" {
+		lastError = fmt.Sprintf("HTTP %d", responseStatus)
+	}
+	reason := fmt.Sprintf("Disabled after %d consecutive failed deliveries (last error: %s)", current.ConsecutiveFailures, lastError)
+	now := time.Now()
+
+	// Only the first caller to flip is_active gets to announce it
+	result := s.db.Model(&models.Webhook{}).
+		Where("id = ? AND is_active = ?", current.ID, true).
+		Updates(map[string]interface{}{
+			"is_active":       false,
+			"disabled_reason": reason,
+			"disabled_at":     now,
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return
+	}
+
+	webhookLog.Warn("Webhook disabled", "webhook_id", current.ID, "reason", reason)
+	s.notifyEvent(current.UserID, string(models.EventTypeWebhookDisabled), fmt.Sprintf("Webhook %d disabled", current.ID), reason)
+	s.TriggerWebhooks(current.UserID, string(models.EventTypeWebhookDisabled), models.WebhookDisabledData{
+		WebhookID:           current.ID,
+		URL:                 current.URL,
+		ConsecutiveFailures: current.ConsecutiveFailures,
+		LastError:           lastError,
+		DisabledAt:          now,
+	})
+}
+
+// sendWithBreaker sends a webhook unless the target's circuit is open, and records the outcome
+func (s *WebhookService) sendWithBreaker(webhook *models.Webhook, eventType string, payload []byte, signature, deliveryID string) (bool, int, string, error) {
+	if !s.breaker.Allow(webhook.URL) {
+		webhookLog.Debug("Circuit open, deferring delivery", "webhook_id", webhook.ID, "url", redactLogURL(webhook.URL))
+		return false, 0, "", ErrCircuitOpen
+	}
+
+	success, responseStatus, responseBody, err := s.send(webhook, eventType, payload, signature, deliveryID)
+
+	// Only transport errors and 5xx responses indicate the target itself is unhealthy
+	s.breaker.Record(webhook.URL, err == nil && responseStatus < 500)
+
+	return success, responseStatus, responseBody, err
+}
+
+// send delivers a payload to the webhook's target: an HTTP POST or a broker publish
+func (s *WebhookService) send(webhook *models.Webhook, eventType string, payload []byte, signature, deliveryID string) (success bool, status int, body string, err error) {
+	done := s.trackSend()
+	defer func() { done(success) }()
+
+	if isPublisherTarget(webhook) {
+		return s.publish(webhook, eventType, payload, signature, deliveryID)
+	}
+	return s.sendWebhook(webhook, payload, signature, deliveryID)
 }
 
 // sendWebhook performs the actual HTTP POST to the webhook URL
-func (s *WebhookService) sendWebhook(url string, payload []byte, signature string) (bool, int, string, error) {
-	fmt.Printf("[Webhook] Sending POST request to: %s\n", url)
+func (s *WebhookService) sendWebhook(webhook *models.Webhook, payload []byte, signature, deliveryID string) (bool, int, string, error) {
+	compress := s.shouldCompress(webhook.CompressPayloads, payload)
+	success, status, body, err := s.postWebhook(webhook, payload, signature, deliveryID, compress)
+	if compress && err == nil && status == http.StatusUnsupportedMediaType {
+		// The receiver doesn't accept gzip after all; resend the plain body
+		webhookLog.Info("Receiver rejected gzip body, resending uncompressed", "webhook_id", webhook.ID)
+		return s.postWebhook(webhook, payload, signature, deliveryID, false)
+	}
+	return success, status, body, err
+}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payload))
+// postWebhook makes a single HTTP POST of a delivery. The signature and JWT body hash
+// always cover the uncompressed payload.
+func (s *WebhookService) postWebhook(webhook *models.Webhook, payload []byte, signature, deliveryID string, compress bool) (bool, int, string, error) {
+	client, err := s.clientFor(webhook)
+	if err != nil {
+		return false, 0, "", fmt.Errorf("invalid TLS configuration: %w", err)
+	}
+
+	body := payload
+	if compress {
+		if body, err = gzipPayload(payload); err != nil {
+			return false, 0, "", fmt.Errorf("failed to compress payload: %w", err)
+		}
+	}
+
+	req, err := http.NewRequest("POST", webhook.URL, bytes.NewBuffer(body))
 	if err != nil {
-		fmt.Printf("[Webhook] Failed to create request: %v\n", err)
 		return false, 0, "", fmt.Errorf("failed to create request: %w", err)
 	}
 
+	for name, values := range s.headers {
+		req.Header[name] = values
+	}
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("User-Agent", "PingLater-Webhook/1.0")
+	if compress {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	req.Header.Set("User-Agent", s.userAgent)
+	req.Header.Set("X-Delivery-Id", deliveryID)
+	if webhook.TestMode {
+		req.Header.Set("X-Webhook-Test", "true")
+	}
 
 	if signature != "" {
 		req.Header.Set("X-Webhook-Signature", "sha256="+signature)
-		fmt.Printf("[Webhook] Added signature header\n")
 	}
 
-	resp, err := s.httpClient.Do(req)
+	if webhook.AuthJWTAlgorithm != "" {
+		token, err := signDeliveryJWT(webhook, payload)
+		if err != nil {
+			return false, 0, "", fmt.Errorf("failed to sign delivery JWT: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
-		fmt.Printf("[Webhook] Failed to send request: %v\n", err)
 		return false, 0, "", fmt.Errorf("failed to send webhook: %w", err)
 	}
 	defer resp.Body.Close()
 
-	responseBody, _ := io.ReadAll(resp.Body)
-	responseBodyStr := string(responseBody)
+	// Reply-mode responses may carry inline media, so they get a larger read limit;
+	// the delivery log still only keeps responseMaxBytes of them
+	limit := s.responseMaxBytes
+	if webhook.ReplyEnabled && limit > 0 && limit < replyResponseMaxBytes {
+		limit = replyResponseMaxBytes
+	}
+	responseBodyStr := readResponseBody(resp.Body, limit)
 
 	// Consider 2xx status codes as success
 	success := resp.StatusCode >= 200 && resp.StatusCode < 300
-	fmt.Printf("[Webhook] Response status: %d, success: %v\n", resp.StatusCode, success)
 
 	return success, resp.StatusCode, responseBodyStr, nil
 }
@@ -261,8 +666,11 @@ func (s *WebhookService) calculateSignature(payload []byte, secret string) strin
 	return hex.EncodeToString(h.Sum(nil))
 }
 
+// defaultMaxRetries is the retry ceiling when WEBHOOK_MAX_RETRIES is unset
+const defaultMaxRetries = 5
+
 // calculateNextRetry calculates the next retry time using exponential backoff
-// Retry intervals: 1min, 5min, 15min, 30min, 60min
+// Retry intervals: 1min, 5min, 15min, 30min, then every 60min
 func (s *WebhookService) calculateNextRetry(retryCount int) time.Time {
 	intervals := []time.Duration{
 		1 * time.Minute,
@@ -279,8 +687,46 @@ func (s *WebhookService) calculateNextRetry(retryCount int) time.Time {
 	return time.Now().Add(intervals[retryCount])
 }
 
+// retryLimits returns a webhook's retry ceiling and maximum delivery age (0 = no limit)
+func (s *WebhookService) retryLimits(webhook *models.Webhook) (int, time.Duration) {
+	maxRetries, maxAge := s.maxRetries, s.maxDeliveryAge
+	if webhook.MaxRetries != nil {
+		maxRetries = *webhook.MaxRetries
+	}
+	if webhook.MaxDeliveryAge != nil {
+		maxAge = time.Duration(*webhook.MaxDeliveryAge) * time.Second
+	}
+	return maxRetries, maxAge
+}
+
+// scheduleRetry returns when a failed delivery, first attempted at firstAttempt and
+// retried retryCount times so far, is retried next. A delivery out of retries, or one
+// that would be older than the maximum age by then, is abandoned instead, and the
+// reason is returned.
+func (s *WebhookService) scheduleRetry(webhook *models.Webhook, retryCount int, firstAttempt time.Time) (*time.Time, string) {
+	maxRetries, maxAge := s.retryLimits(webhook)
+	if retryCount >= maxRetries {
+		return nil, models.AbandonedMaxRetries
+	}
+	nextRetry := s.calculateNextRetry(retryCount)
+	if maxAge > 0 && nextRetry.Sub(firstAttempt) > maxAge {
+		return nil, models.AbandonedMaxAge
+	}
+	return &nextRetry, ""
+}
+
+// clampRetries keeps a retry ceiling between 0 and models.MaxWebhookRetries
+func clampRetries(n int) int {
+	return max(0, min(n, models.MaxWebhookRetries))
+}
+
+func logAbandoned(webhook *models.Webhook, eventType, deliveryID, reason string) {
+	webhookLog.Warn("Abandoned webhook delivery", "webhook_id", webhook.ID, "event", eventType, "delivery_id", deliveryID, "reason", reason)
+}
+
 // processRetries runs in a background goroutine and processes failed webhook deliveries
 func (s *WebhookService) processRetries() {
+	defer s.wg.Done()
 	ticker := time.NewTicker(1 * time.Minute)
 	defer ticker.Stop()
 
@@ -289,7 +735,10 @@ func (s *WebhookService) processRetries() {
 		case <-s.stopChan:
 			return
 		case <-ticker.C:
-			s.retryFailedDeliveries()
+			// With several instances, only the leader retries
+			if IsLeader() {
+				s.retryFailedDeliveries()
+			}
 		}
 	}
 }
@@ -303,14 +752,14 @@ func (s *WebhookService) retryFailedDeliveries() {
 	now := time.Now()
 	var deliveries []models.WebhookDelivery
 
-	// Find failed deliveries that are due for retry
+	// Find failed deliveries that are due for retry. Abandoned ones have no next retry.
 	result := s.db.Where(
-		"success = ? AND retry_count < ? AND (next_retry_at IS NULL OR next_retry_at <= ?)",
-		false, 5, now,
+		"success = ? AND next_retry_at IS NOT NULL AND next_retry_at <= ?",
+		false, now,
 	).Find(&deliveries)
 
 	if result.Error != nil {
-		fmt.Printf("Failed to fetch failed deliveries: %v\n", result.Error)
+		webhookLog.Error("Failed to fetch failed deliveries", "error", result.Error)
 		return
 	}
 
@@ -328,7 +777,7 @@ func (s *WebhookService) retryDelivery(delivery *models.WebhookDelivery) {
 	// Get the webhook
 	var webhook models.Webhook
 	if err := s.db.First(&webhook, delivery.WebhookID).Error; err != nil {
-		fmt.Printf("Failed to fetch webhook %d for retry: %v\n", delivery.WebhookID, err)
+		webhookLog.Error("Failed to fetch webhook for retry", "webhook_id", delivery.WebhookID, "error", err)
 		return
 	}
 
@@ -337,6 +786,29 @@ func (s *WebhookService) retryDelivery(delivery *models.WebhookDelivery) {
 		return
 	}
 
+	// The limits may have been lowered since the retry was scheduled
+	maxRetries, maxAge := s.retryLimits(&webhook)
+	reason := ""
+	if delivery.RetryCount >= maxRetries {
+		reason = models.AbandonedMaxRetries
+	} else if maxAge > 0 && time.Since(delivery.CreatedAt) > maxAge {
+		reason = models.AbandonedMaxAge
+	}
+	if reason != "" {
+		s.db.Model(delivery).Updates(map[string]interface{}{
+			"next_retry_at":    nil,
+			"abandoned_reason": reason,
+		})
+		logAbandoned(&webhook, delivery.EventType, delivery.DeliveryIDOrDefault(), reason)
+		return
+	}
+
+	// Respect the webhook's rate limit; try again once a slot frees up
+	if ok, availableAt := s.limiter.Reserve(webhook.ID, webhook.RateLimitPerMinute); !ok {
+		s.db.Model(delivery).Update("next_retry_at", availableAt)
+		return
+	}
+
 	// Calculate signature
 	var signature string
 	if webhook.Secret != "" {
@@ -344,73 +816,123 @@ func (s *WebhookService) retryDelivery(delivery *models.WebhookDelivery) {
 	}
 
 	// Attempt delivery
-	success, responseStatus, responseBody, err := s.sendWebhook(webhook.URL, []byte(delivery.Payload), signature)
+	started := time.Now()
+	success, responseStatus, responseBody, err := s.sendWithBreaker(&webhook, delivery.EventType, []byte(delivery.Payload), signature, delivery.DeliveryIDOrDefault())
+	durationMs := time.Since(started).Milliseconds()
+
+	// A short-circuited attempt doesn't consume a retry; just push it back
+	if errors.Is(err, ErrCircuitOpen) {
+		nextRetry := s.calculateNextRetry(delivery.RetryCount)
+		s.db.Model(delivery).Updates(map[string]interface{}{
+			"error_message": err.Error(),
+			"next_retry_at": &nextRetry,
+		})
+		return
+	}
 
 	// Update delivery record
 	updates := map[string]interface{}{
 		"success":         success,
 		"response_status": responseStatus,
-		"response_body":   responseBody,
+		"response_body":   truncateBody(responseBody, s.responseMaxBytes),
 		"retry_count":     delivery.RetryCount + 1,
+		"duration_ms":     durationMs,
 	}
 
 	if err != nil {
 		updates["error_message"] = err.Error()
 	}
 
-	// Schedule next retry if still failed
-	if !success && delivery.RetryCount+1 < 5 {
-		nextRetry := s.calculateNextRetry(delivery.RetryCount + 1)
-		updates["next_retry_at"] = &nextRetry
-	} else {
-		updates["next_retry_at"] = nil
+	// Schedule next retry if still failed, unless the webhook's limits say to give up
+	updates["next_retry_at"] = nil
+	if !success {
+		var nextRetry *time.Time
+		nextRetry, reason = s.scheduleRetry(&webhook, delivery.RetryCount+1, delivery.CreatedAt)
+		updates["next_retry_at"] = nextRetry
+		if reason != "" {
+			updates["abandoned_reason"] = reason
+		}
 	}
 
 	if err := s.db.Model(delivery).Updates(updates).Error; err != nil {
-		fmt.Printf("Failed to update delivery record: %v\n", err)
+		webhookLog.Error("Failed to update delivery record", "delivery_id", delivery.DeliveryIDOrDefault(), "error", err)
+	}
+	logDeliveryResult(&webhook, delivery.EventType, delivery.DeliveryIDOrDefault(), delivery.RetryCount+1, success, responseStatus, durationMs, err)
+	if reason != "" {
+		logAbandoned(&webhook, delivery.EventType, delivery.DeliveryIDOrDefault(), reason)
 	}
-}
 
-// TestWebhook tests a webhook by sending a test payload
-func (s *WebhookService) TestWebhook(webhook *models.Webhook) (*models.WebhookDelivery, error) {
-	testData := map[string]interface{}{
-		"test":    true,
-		"message": "This is a test webhook from PingLater",
+	errorMessage := ""
+	if err != nil {
+		errorMessage = err.Error()
 	}
+	s.recordDeliveryResult(&webhook, success, errorMessage, responseStatus)
 
-	payload := models.WebhookPayload{
-		WebhookID: fmt.Sprintf("%d", webhook.ID),
-		Event:     "test",
-		Timestamp: time.Now(),
-		Data:      testData,
+	if success {
+		s.handleReply(&webhook, delivery.ReplyTo, responseBody)
 	}
+}
 
-	payloadBytes, err := json.Marshal(payload)
+// TestWebhook tests a webhook by sending a test payload. With an event type, a realistic
+// sample of that event is sent instead of the generic test payload.
+func (s *WebhookService) TestWebhook(webhook *models.Webhook, eventType string) (*models.WebhookDelivery, error) {
+	var data interface{}
+	if eventType == "" || eventType == "test" {
+		eventType = "test"
+		data = map[string]interface{}{
+			"test":    true,
+			"message": "This is a test webhook from PingLater",
+		}
+	} else {
+		sample, ok := sampleEventData(eventType, webhook)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrNoSampleEvent, eventType)
+		}
+		data = sample
+	}
+
+	payloadBytes, err := s.buildPayload(webhook, eventType, data)
 	if err != nil {
 		return nil, err
 	}
+	return s.sendTest(webhook, eventType, payloadBytes), nil
+}
 
+// ReplayDelivery resends the payload of an earlier delivery as a test. It gets a new
+// delivery ID, so receivers that deduplicate don't drop it.
+func (s *WebhookService) ReplayDelivery(webhook *models.Webhook, source *models.WebhookDelivery) *models.WebhookDelivery {
+	return s.sendTest(webhook, source.EventType, []byte(source.Payload))
+}
+
+// sendTest sends a test payload and returns its (unsaved) delivery record. Test deliveries
+// are recorded under the "test" event type so they don't skew per-event stats.
+func (s *WebhookService) sendTest(webhook *models.Webhook, eventType string, payloadBytes []byte) *models.WebhookDelivery {
 	var signature string
 	if webhook.Secret != "" {
 		signature = s.calculateSignature(payloadBytes, webhook.Secret)
 	}
 
 	delivery := &models.WebhookDelivery{
-		WebhookID: webhook.ID,
-		EventType: "test",
-		Payload:   string(payloadBytes),
+		WebhookID:  webhook.ID,
+		EventType:  "test",
+		Payload:    string(payloadBytes),
+		DeliveryID: uuid.NewString(),
 	}
 
-	success, responseStatus, responseBody, err := s.sendWebhook(webhook.URL, payloadBytes, signature)
+	s.logPayload("Sending test webhook", webhook, eventType, payloadBytes)
+	started := time.Now()
+	success, responseStatus, responseBody, err := s.send(webhook, eventType, payloadBytes, signature, delivery.DeliveryID)
+	delivery.DurationMs = time.Since(started).Milliseconds()
+	logDeliveryResult(webhook, "test", delivery.DeliveryID, 0, success, responseStatus, delivery.DurationMs, err)
 
 	delivery.Success = success
 	delivery.ResponseStatus = responseStatus
-	delivery.ResponseBody = responseBody
+	delivery.ResponseBody = truncateBody(responseBody, s.responseMaxBytes)
 	if err != nil {
 		delivery.ErrorMessage = err.Error()
 	}
 
-	return delivery, nil
+	return delivery
 }
 
 // contains checks if a string slice contains a specific string
@@ -459,11 +981,39 @@ func ParseEventTypesFromString(eventTypes string) []string {
 	return result
 }
 
+// ForwardEvent delivers an event to one of the user's webhooks, whatever its events and
+// filters. Auto-responder rules forward messages through here.
+func (s *WebhookService) ForwardEvent(userID, webhookID uint, eventType string, data interface{}) error {
+	var webhook models.Webhook
+	if err := s.db.Where("id = ? AND user_id = ?", webhookID, userID).First(&webhook).Error; err != nil {
+		return fmt.Errorf("webhook not found: %w", err)
+	}
+	if !webhook.IsActive {
+		webhookLog.Debug("Not forwarding to disabled webhook", "webhook_id", webhook.ID, "event", eventType)
+		return nil
+	}
+	if err := s.enqueueDelivery(&webhook, eventType, data); err != nil {
+		return err
+	}
+	s.wakeOutboxWorkers()
+	return nil
+}
+
 // TriggerMessageReceived is a convenience method for triggering message_received events
 func (s *WebhookService) TriggerMessageReceived(userID uint, data models.MessageReceivedData) {
 	s.TriggerWebhooks(userID, "message_received", data)
 }
 
+// TriggerMessageSent is a convenience method for triggering message_sent events
+func (s *WebhookService) TriggerMessageSent(userID uint, data models.MessageSentData) {
+	s.TriggerWebhooks(userID, "message_sent", data)
+}
+
+// TriggerConnectionEvent is a convenience method for triggering connected and disconnected events
+func (s *WebhookService) TriggerConnectionEvent(userID uint, eventType string, data models.ConnectionEventData) {
+	s.TriggerWebhooks(userID, eventType, data)
+}
+
 // GetWebhookStats returns statistics for a webhook
 func (s *WebhookService) GetWebhookStats(webhookID uint) (map[string]interface{}, error) {
 	if s.db == nil {
@@ -484,6 +1034,15 @@ func (s *WebhookService) GetWebhookStats(webhookID uint) (map[string]interface{}
 		successRate = float64(successCount) / float64(totalCount) * 100
 	}
 
+	// Latency over the most recent attempts that actually got a response
+	var durations []int64
+	s.db.Model(&models.WebhookDelivery{}).
+		Where("webhook_id = ? AND response_status > ?", webhookID, 0).
+		Order("created_at desc").
+		Limit(latencySampleSize).
+		Pluck("duration_ms", &durations)
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
 	return map[string]interface{}{
 		"total_deliveries":     totalCount,
 		"successful":           successCount,
@@ -491,5 +1050,42 @@ func (s *WebhookService) GetWebhookStats(webhookID uint) (map[string]interface{}
 		"success_rate":         strconv.FormatFloat(successRate, 'f', 2, 64) + "%",
 		"last_delivery_at":     lastDelivery.CreatedAt,
 		"last_delivery_status": lastDelivery.Success,
+		"latency_p50_ms":       percentile(durations, 50),
+		"latency_p95_ms":       percentile(durations, 95),
 	}, nil
 }
+
+// latencySampleSize is the number of recent deliveries used for latency percentiles
+const latencySampleSize = 1000
+
+// percentile returns the p-th percentile of sorted values (nearest-rank), or 0 if empty
+func percentile(sorted []int64, p int) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// envInt reads an integer from the environment, falling back to def
+func envInt(key string, def int) int {
+	if v := os.Getenv(key); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed >= 0 {
+			return parsed
+		}
+	}
+	return def
+}
+
+// envDuration reads a Go duration (e.g. "30s") from the environment, falling back to def
+func envDuration(key string, def time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if parsed, err := time.ParseDuration(v); err == nil {
+			return parsed
+		}
+	}
+	return def
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/user/pinglater/internal/models"
+)
+
+// deliveryWindowStats holds aggregated delivery counts for one webhook over a time window
+type deliveryWindowStats struct {
+	WebhookID    uint
+	Total        int64
+	Successful   int64
+	AvgLatencyMs *float64
+}
+
+// GetWebhookHealth returns a health summary for every webhook owned by a user
+func (s *WebhookService) GetWebhookHealth(userID uint) ([]models.WebhookHealth, error) {
+	if s.db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	var webhooks []models.Webhook
+	if err := s.db.Where("user_id = ?", userID).Order("id asc").Find(&webhooks).Error; err != nil {
+		return nil, err
+	}
+	if len(webhooks) == 0 {
+		return []models.WebhookHealth{}, nil
+	}
+
+	ids := make([]uint, len(webhooks))
+	for i, w := range webhooks {
+		ids[i] = w.ID
+	}
+
+	now := time.Now()
+	stats1h, err := s.deliveryStatsSince(ids, now.Add(-1*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	stats24h, err := s.deliveryStatsSince(ids, now.Add(-24*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+
+	health := make([]models.WebhookHealth, len(webhooks))
+	for i, w := range webhooks {
+		h := models.WebhookHealth{
+			WebhookID:           w.ID,
+			URL:                 w.URL,
+			IsActive:            w.IsActive,
+			ConsecutiveFailures: w.ConsecutiveFailures,
+			DisabledReason:      w.DisabledReason,
+		}
+
+		if st, ok := stats1h[w.ID]; ok {
+			h.Deliveries1h = st.Total
+			h.SuccessRate1h = successRate(st)
+		}
+		if st, ok := stats24h[w.ID]; ok {
+			h.Deliveries24h = st.Total
+			h.SuccessRate24h = successRate(st)
+			h.AvgLatencyMs = st.AvgLatencyMs
+		}
+
+		var lastFailure models.WebhookDelivery
+		result := s.db.Where("webhook_id = ? AND success = ?", w.ID, false).
+			Order("created_at desc").Limit(1).Find(&lastFailure)
+		if result.Error == nil && result.RowsAffected > 0 {
+			h.LastError = lastFailure.ErrorMessage
+			if h.LastError == "" {
+				h.LastError = fmt.Sprintf("HTTP %d", lastFailure.ResponseStatus)
+			}
+			h.LastErrorAt = &lastFailure.CreatedAt
+		}
+
+		health[i] = h
+	}
+
+	return health, nil
+}
+
+// deliveryStatsSince aggregates delivery counts and latency per webhook since the given time
+func (s *WebhookService) deliveryStatsSince(webhookIDs []uint, since time.Time) (map[uint]deliveryWindowStats, error) {
+	var rows []deliveryWindowStats
+	err := s.db.Model(&models.WebhookDelivery{}).
+		Select("webhook_id, COUNT(*) AS total, SUM(CASE WHEN success THEN 1 ELSE 0 END) AS successful, AVG(duration_ms) AS avg_latency_ms").
+		Where("webhook_id IN ? AND created_at >= ?", webhookIDs, since).
+		Group("webhook_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[uint]deliveryWindowStats, len(rows))
+	for _, row := range rows {
+		result[row.WebhookID] = row
+	}
+	return result, nil
+}
+
+// successRate returns the success percentage for a window, or nil if it had no deliveries
+func successRate(st deliveryWindowStats) *float64 {
+	if st.Total == 0 {
+		return nil
+	}
+	rate := float64(st.Successful) / float64(st.Total) * 100
+	return &rate
+}
@@ -0,0 +1,171 @@
+package smtpgateway
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+// maxMultipartDepth bounds how deeply nested multipart messages are read
+const maxMultipartDepth = 5
+
+// email is the part of a received email that's sent to WhatsApp
+type email struct {
+	From        string
+	Subject     string
+	Text        string
+	Attachments []attachment
+}
+
+type attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+var (
+	htmlBreaks = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>|</li>|</tr>|</h[1-6]>`)
+	htmlTags   = regexp.MustCompile(`(?s)<style.*?</style>|<script.*?</script>|<[^>]*>`)
+	blankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// parseEmail reads an email's sender, subject, text and attachments. The plain text
+// body is preferred; an HTML-only body is reduced to its text.
+func parseEmail(r io.Reader) (*email, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email: %w", err)
+	}
+
+	decoder := new(mime.WordDecoder)
+	e := &email{}
+	if subject, err := decoder.DecodeHeader(msg.Header.Get("Subject")); err == nil {
+		e.Subject = strings.TrimSpace(subject)
+	}
+	if from, err := msg.Header.AddressList("From"); err == nil && len(from) > 0 {
+		e.From = from[0].Address
+	}
+
+	var plain, htmlText string
+	err = readPart(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), "", msg.Body, 0, e, &plain, &htmlText)
+	if err != nil {
+		return nil, err
+	}
+	e.Text = strings.TrimSpace(strings.ReplaceAll(plain, "\r\n", "\n"))
+	if e.Text == "" && htmlText != "" {
+		e.Text = htmlToText(strings.ReplaceAll(htmlText, "\r\n", "\n"))
+	}
+	return e, nil
+}
+
+// readPart reads one MIME part, recursing into multiparts. The first text/plain and
+// text/html bodies are kept; other parts, and parts marked as attachments, become
+// attachments.
+func readPart(contentType, encoding, disposition string, body io.Reader, depth int, e *email, plain, htmlText *string) error {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth >= maxMultipartDepth {
+			return nil
+		}
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("invalid multipart email: %w", err)
+			}
+			err = readPart(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"),
+				part.Header.Get("Content-Disposition"), part, depth+1, e, plain, htmlText)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := io.ReadAll(decodeTransfer(body, encoding))
+	if err != nil {
+		return fmt.Errorf("failed to decode email part: %w", err)
+	}
+
+	dispositionType, dispositionParams, _ := mime.ParseMediaType(disposition)
+	filename := dispositionParams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	isAttachment := dispositionType == "attachment" || filename != ""
+
+	switch {
+	case !isAttachment && mediaType == "text/plain" && *plain == "":
+		*plain = string(data)
+	case !isAttachment && mediaType == "text/html" && *htmlText == "":
+		*htmlText = string(data)
+	case !isAttachment && strings.HasPrefix(mediaType, "text/"):
+		// Further text alternatives add nothing
+	default:
+		if filename == "" {
+			filename = "attachment"
+			if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+				filename += exts[0]
+			}
+		}
+		if decoded, err := new(mime.WordDecoder).DecodeHeader(filename); err == nil {
+			filename = decoded
+		}
+		e.Attachments = append(e.Attachments, attachment{Filename: filename, ContentType: mediaType, Data: data})
+	}
+	return nil
+}
+
+// decodeTransfer undoes a part's Content-Transfer-Encoding
+func decodeTransfer(body io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	default:
+		return body
+	}
+}
+
+// htmlToText reduces an HTML body to its text
+func htmlToText(body string) string {
+	text := htmlBreaks.ReplaceAllString(body, "\n")
+	text = htmlTags.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	text = strings.Join(lines, "\n")
+	return strings.TrimSpace(blankLines.ReplaceAllString(text, "\n\n"))
+}
+
+// formatMessage turns an email into a WhatsApp message: the subject in bold, then the
+// text
+func formatMessage(e *email) string {
+	var b bytes.Buffer
+	if e.Subject != "" {
+		b.WriteString("*" + e.Subject + "*")
+		if e.Text != "" {
+			b.WriteString("\n\n")
+		}
+	}
+	b.WriteString(e.Text)
+	return b.String()
+}
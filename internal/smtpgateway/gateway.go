@@ -0,0 +1,271 @@
+// Package smtpgateway receives emails over SMTP and sends them as WhatsApp messages,
+// for systems that can only send alerts by email
+package smtpgateway
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-sasl"
+	"github.com/emersion/go-smtp"
+	"github.com/user/pinglater/internal/api/middleware"
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/logging"
+	"github.com/user/pinglater/internal/models"
+	"github.com/user/pinglater/internal/services"
+	"github.com/user/pinglater/internal/whatsapp"
+)
+
+const (
+	// maxRecipients bounds the RCPT TO addresses of one email
+	maxRecipients = 50
+	// connectionTimeout closes connections idle for this long
+	connectionTimeout = 1 * time.Minute
+)
+
+var smtpLog = logging.Logger("smtp")
+
+// Config configures the SMTP gateway
+type Config struct {
+	// Address to listen on, e.g. ":2525"
+	Addr string
+	// Domain announced in the SMTP greeting
+	Domain string
+	// Largest email accepted, attachments included
+	MaxMessageBytes int
+	// Certificates for STARTTLS; nil disables it
+	TLSConfig *tls.Config
+	// Allow AUTH without TLS, which sends the API token in the clear
+	AllowInsecureAuth bool
+}
+
+// Gateway is a running SMTP gateway
+type Gateway struct {
+	server *smtp.Server
+}
+
+// Start listens for SMTP connections. Clients log in with AUTH PLAIN or LOGIN, giving
+// an API token with the messages:send scope as the password (the username is ignored).
+func Start(config Config) (*Gateway, error) {
+	server := smtp.NewServer(backend{})
+	server.Addr = config.Addr
+	server.Domain = config.Domain
+	server.MaxMessageBytes = config.MaxMessageBytes
+	server.MaxRecipients = maxRecipients
+	server.ReadTimeout = connectionTimeout
+	server.WriteTimeout = connectionTimeout
+	server.TLSConfig = config.TLSConfig
+	server.AllowInsecureAuth = config.AllowInsecureAuth
+	server.ErrorLog = errorLogger{}
+	// Older mailers only know AUTH LOGIN
+	server.EnableAuth(sasl.Login, func(conn *smtp.Conn) sasl.Server {
+		return sasl.NewLoginServer(func(username, password string) error {
+			state := conn.State()
+			session, err := server.Backend.Login(&state, username, password)
+			if err != nil {
+				return err
+			}
+			conn.SetSession(session)
+			return nil
+		})
+	})
+
+	listener, err := net.Listen("tcp", config.Addr)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			smtpLog.Error("SMTP gateway stopped", "error", err)
+		}
+	}()
+	return &Gateway{server: server}, nil
+}
+
+// Close stops accepting emails and closes open connections
+func (g *Gateway) Close() {
+	g.server.Close()
+}
+
+// errorLogger sends go-smtp's errors to the smtp logger
+type errorLogger struct{}
+
+func (errorLogger) Printf(format string, v ...interface{}) {
+	smtpLog.Warn(strings.TrimSpace(fmt.Sprintf(format, v...)))
+}
+
+func (errorLogger) Println(v ...interface{}) {
+	smtpLog.Warn(strings.TrimSpace(fmt.Sprintln(v...)))
+}
+
+type backend struct{}
+
+func (backend) Login(state *smtp.ConnectionState, username, password string) (smtp.Session, error) {
+	token, err := middleware.AuthenticateAPIToken(password, models.ScopeMessagesSend)
+	if err != nil {
+		smtpLog.Warn("SMTP login rejected", "remote", state.RemoteAddr.String(), "error", err)
+		return nil, &smtp.SMTPError{Code: 535, EnhancedCode: smtp.EnhancedCode{5, 7, 8}, Message: "Authentication failed: " + err.Error()}
+	}
+	return &session{token: token}, nil
+}
+
+func (backend) AnonymousLogin(state *smtp.ConnectionState) (smtp.Session, error) {
+	return nil, smtp.ErrAuthRequired
+}
+
+// target is where one RCPT TO address sends the email: straight to a phone number, or
+// through an inbound webhook
+type target struct {
+	address string
+	phone   string
+	hook    *models.InboundWebhook
+}
+
+type session struct {
+	token   *models.APIToken
+	targets []target
+}
+
+func (s *session) Reset() {
+	s.targets = nil
+}
+
+func (s *session) Logout() error {
+	return nil
+}
+
+func (s *session) Mail(from string, opts smtp.MailOptions) error {
+	return nil
+}
+
+// Rcpt accepts addresses whose local part is a phone number, e.g.
+// 15551234567@whatsapp.example.com, or the name of one of the user's inbound webhooks
+func (s *session) Rcpt(to string) error {
+	local := strings.ToLower(to)
+	if i := strings.LastIndex(local, "@"); i >= 0 {
+		local = local[:i]
+	}
+
+	if phone := strings.TrimPrefix(local, "+"); isPhoneNumber(phone) {
+		s.targets = append(s.targets, target{address: to, phone: phone})
+		return nil
+	}
+
+	var hook models.InboundWebhook
+	err := db.GetDB().Where("user_id = ? AND name = ? AND is_active = ?", s.token.UserID, local, true).First(&hook).Error
+	if err != nil {
+		return &smtp.SMTPError{Code: 550, EnhancedCode: smtp.EnhancedCode{5, 1, 1}, Message: "No such phone number or inbound webhook: " + to}
+	}
+	s.targets = append(s.targets, target{address: to, hook: &hook})
+	return nil
+}
+
+// Data queues the email's messages for each recipient
+func (s *session) Data(r io.Reader) error {
+	e, err := parseEmail(r)
+	if err != nil {
+		return &smtp.SMTPError{Code: 554, EnhancedCode: smtp.EnhancedCode{5, 6, 0}, Message: err.Error()}
+	}
+
+	var messages []models.OutgoingMessage
+	for _, t := range s.targets {
+		text, recipients := formatMessage(e), []string{t.phone}
+		if t.hook != nil {
+			text, recipients, err = services.RenderInboundWebhook(t.hook, emailPayload(e, t.address))
+			if err != nil {
+				return &smtp.SMTPError{Code: 554, EnhancedCode: smtp.EnhancedCode{5, 6, 0}, Message: "Inbound webhook " + t.hook.Name + ": " + err.Error()}
+			}
+		}
+		for _, recipient := range recipients {
+			messages = append(messages, s.messagesFor(recipient, text, e.Attachments)...)
+		}
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+
+	if !s.token.CanUseAccount(whatsapp.GetClient().AccountID()) {
+		return &smtp.SMTPError{Code: 550, EnhancedCode: smtp.EnhancedCode{5, 7, 1}, Message: "API token may not send from this WhatsApp account"}
+	}
+	allowed, remaining, _, err := middleware.TakeMessageQuotaN(s.token, len(messages))
+	if err != nil {
+		return &smtp.SMTPError{Code: 451, EnhancedCode: smtp.EnhancedCode{4, 3, 0}, Message: "Failed to check message quota"}
+	}
+	if !allowed {
+		return &smtp.SMTPError{Code: 452, EnhancedCode: smtp.EnhancedCode{4, 5, 3}, Message: fmt.Sprintf("Daily message quota exceeded: %d messages left", remaining)}
+	}
+
+	for i := range messages {
+		messages[i].TestMode = s.token.TestMode
+	}
+	if err := services.GetSendQueue().Enqueue(db.GetDB(), messages); err != nil {
+		middleware.ReturnMessageQuotaN(s.token, len(messages))
+		smtpLog.Error("Failed to queue email", "error", err)
+		return &smtp.SMTPError{Code: 451, EnhancedCode: smtp.EnhancedCode{4, 3, 0}, Message: "Failed to queue messages"}
+	}
+	smtpLog.Info("Queued email", "from", e.From, "messages", len(messages))
+	return nil
+}
+
+// messagesFor returns the messages for one WhatsApp recipient: the text, then each
+// attachment
+func (s *session) messagesFor(recipient, text string, attachments []attachment) []models.OutgoingMessage {
+	var messages []models.OutgoingMessage
+	if text != "" {
+		messages = append(messages, models.OutgoingMessage{
+			UserID:      s.token.UserID,
+			PhoneNumber: recipient,
+			Message:     text,
+			Source:      models.MessageSourceEmail,
+		})
+	}
+	for _, a := range attachments {
+		messages = append(messages, models.OutgoingMessage{
+			UserID:        s.token.UserID,
+			PhoneNumber:   recipient,
+			Source:        models.MessageSourceEmail,
+			MediaData:     a.Data,
+			MediaMimeType: a.ContentType,
+			MediaFilename: a.Filename,
+		})
+	}
+	return messages
+}
+
+// emailPayload is what an inbound webhook's template and routes see of an email
+func emailPayload(e *email, to string) []byte {
+	attachments := make([]map[string]interface{}, len(e.Attachments))
+	for i, a := range e.Attachments {
+		attachments[i] = map[string]interface{}{
+			"filename":     a.Filename,
+			"content_type": a.ContentType,
+			"size":         len(a.Data),
+		}
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"from":        e.From,
+		"to":          to,
+		"subject":     e.Subject,
+		"text":        e.Text,
+		"attachments": attachments,
+	})
+	return payload
+}
+
+// isPhoneNumber reports whether an address's local part is a phone number
+func isPhoneNumber(s string) bool {
+	if len(s) < 6 || len(s) > 20 {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
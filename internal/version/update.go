@@ -0,0 +1,160 @@
+package version
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// releasesURL is the GitHub API endpoint for the latest PingLater release
+const releasesURL = "https://api.github.com/repos/thorved/PingLater/releases/latest"
+
+// UpdateInfo describes the result of the most recent update check
+type UpdateInfo struct {
+	LatestVersion   string    `json:"latest_version"`
+	ReleaseURL      string    `json:"release_url"`
+	UpdateAvailable bool      `json:"update_available"`
+	CheckedAt       time.Time `json:"checked_at"`
+}
+
+// UpdateCallback is called once per newly discovered release
+type UpdateCallback func(info UpdateInfo)
+
+// UpdateChecker periodically polls GitHub releases for a newer version
+type UpdateChecker struct {
+	httpClient *http.Client
+	mu         sync.RWMutex
+	latest     *UpdateInfo
+	notified   string // Last version we notified about, so each release is announced once
+	callback   UpdateCallback
+}
+
+var (
+	updateChecker *UpdateChecker
+	once          sync.Once
+)
+
+// GetUpdateChecker returns the singleton update checker
+func GetUpdateChecker() *UpdateChecker {
+	once.Do(func() {
+		updateChecker = &UpdateChecker{
+			httpClient: &http.Client{Timeout: 15 * time.Second},
+		}
+	})
+	return updateChecker
+}
+
+// SetCallback sets the function called when a newer release is found
+func (u *UpdateChecker) SetCallback(callback UpdateCallback) {
+	u.mu.Lock()
+	u.callback = callback
+	u.mu.Unlock()
+}
+
+// Start runs an immediate check and then one every interval
+func (u *UpdateChecker) Start(interval time.Duration) {
+	go func() {
+		u.check()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			u.check()
+		}
+	}()
+}
+
+// Latest returns the result of the last successful check, or nil if none has completed
+func (u *UpdateChecker) Latest() *UpdateInfo {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	if u.latest == nil {
+		return nil
+	}
+	info := *u.latest
+	return &info
+}
+
+// check fetches the latest release and fires the callback if it is newer
+func (u *UpdateChecker) check() {
+	req, err := http.NewRequest("GET", releasesURL, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "PingLater/"+Version)
+
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		fmt.Printf("[Update] Failed to check for updates: %v\n", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("[Update] Update check returned status %d\n", resp.StatusCode)
+		return
+	}
+
+	var release struct {
+		TagName string `json:"tag_name"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		fmt.Printf("[Update] Failed to decode release: %v\n", err)
+		return
+	}
+
+	info := UpdateInfo{
+		LatestVersion:   release.TagName,
+		ReleaseURL:      release.HTMLURL,
+		UpdateAvailable: IsNewer(release.TagName, Version),
+		CheckedAt:       time.Now(),
+	}
+
+	u.mu.Lock()
+	u.latest = &info
+	callback := u.callback
+	shouldNotify := info.UpdateAvailable && u.notified != info.LatestVersion
+	if shouldNotify {
+		u.notified = info.LatestVersion
+	}
+	u.mu.Unlock()
+
+	if shouldNotify && callback != nil {
+		callback(info)
+	}
+}
+
+// IsNewer reports whether candidate is a newer semantic version than current.
+// Development builds never report an update.
+func IsNewer(candidate, current string) bool {
+	if current == "dev" || candidate == "" {
+		return false
+	}
+	a := parseVersion(candidate)
+	b := parseVersion(current)
+	for i := 0; i < 3; i++ {
+		if a[i] != b[i] {
+			return a[i] > b[i]
+		}
+	}
+	return false
+}
+
+// parseVersion parses "v1.2.3" (pre-release suffixes ignored) into its numeric parts
+func parseVersion(v string) [3]int {
+	var parts [3]int
+	v = strings.TrimPrefix(v, "v")
+	if idx := strings.IndexAny(v, "-+"); idx >= 0 {
+		v = v[:idx]
+	}
+	for i, p := range strings.SplitN(v, ".", 3) {
+		n, _ := strconv.Atoi(p)
+		parts[i] = n
+	}
+	return parts
+}
@@ -0,0 +1,32 @@
+package version
+
+import "runtime"
+
+// Build information, injected at build time via:
+//
+//	go build -ldflags "-X github.com/user/pinglater/internal/version.Version=v1.2.3 \
+//	  -X github.com/user/pinglater/internal/version.Commit=abc1234 \
+//	  -X github.com/user/pinglater/internal/version.BuildDate=2024-01-15T10:30:00Z"
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+// Info describes the running build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build information of the running binary
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+}
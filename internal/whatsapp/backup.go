@@ -0,0 +1,213 @@
+package whatsapp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Backup archives are the gzipped device store sealed with AES-256-GCM, using a key
+// derived from the passphrase with Argon2id: magic | salt | nonce | ciphertext
+var backupMagic = []byte("PLTBAK1\n")
+
+const (
+	backupSaltSize = 16
+	// MaxBackupSize bounds restored archives; device stores are a few MB at most
+	MaxBackupSize = 256 << 20
+)
+
+var (
+	// ErrInvalidBackup is returned for a wrong passphrase or a damaged archive
+	ErrInvalidBackup = errors.New("wrong passphrase or invalid backup")
+	// ErrEmptyBackup is returned for a backup without a linked device
+	ErrEmptyBackup = errors.New("backup contains no linked WhatsApp device")
+	// ErrRestoreWhileConnected is returned when restoring over a live connection
+	ErrRestoreWhileConnected = errors.New("disconnect WhatsApp before restoring a backup")
+)
+
+// ExportStore writes an encrypted backup of the device store, so the linked session
+// can be moved to another instance without pairing again
+func (c *Client) ExportStore(w io.Writer, passphrase string) error {
+	tmp, err := os.MkdirTemp("", "pinglater-backup")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	// VACUUM INTO takes a consistent snapshot while the store is in use
+	snapshot := filepath.Join(tmp, "whatsapp.db")
+	db, err := sql.Open("sqlite", "file:"+storePath)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("VACUUM INTO ?", snapshot)
+	db.Close()
+	if err != nil {
+		return fmt.Errorf("failed to snapshot device store: %w", err)
+	}
+
+	data, err := os.ReadFile(snapshot)
+	if err != nil {
+		return err
+	}
+	archive, err := sealBackup(data, passphrase)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(archive)
+	return err
+}
+
+// RestoreStore replaces the device store with an exported backup; AutoConnect then
+// resumes the restored session. The device is assigned to userID unless it already has
+// an owner.
+func (c *Client) RestoreStore(archive []byte, passphrase string, userID uint) error {
+	if c.IsConnected() {
+		return ErrRestoreWhileConnected
+	}
+	data, err := openBackup(archive, passphrase)
+	if err != nil {
+		return err
+	}
+
+	// Stage the store next to the live one so the final rename is atomic
+	staged := storePath + ".restore"
+	if err := os.WriteFile(staged, data, 0600); err != nil {
+		return err
+	}
+	defer os.Remove(staged)
+	if err := checkStore(staged); err != nil {
+		return err
+	}
+
+	c.stopReconnect()
+	c.mu.Lock()
+	client, container := c.client, c.container
+	c.client, c.container = nil, nil
+	c.deviceJID = ""
+	c.pairingUserID = userID
+	c.currentQR = ""
+	c.mu.Unlock()
+	if client != nil {
+		client.Disconnect()
+	}
+	if container != nil {
+		container.Close()
+	}
+
+	os.Remove(storePath + "-wal")
+	os.Remove(storePath + "-shm")
+	if err := os.Rename(staged, storePath); err != nil {
+		return fmt.Errorf("failed to replace device store: %w", err)
+	}
+	fmt.Println("WhatsApp device store restored from backup")
+
+	if err := c.Initialize(); err != nil {
+		return err
+	}
+	if c.client.Store.ID != nil {
+		c.claimDevice(*c.client.Store.ID, false)
+	}
+	return nil
+}
+
+// checkStore verifies that a file is a device store with a linked device
+func checkStore(path string) error {
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var devices int
+	if err := db.QueryRow("SELECT COUNT(*) FROM whatsmeow_device").Scan(&devices); err != nil {
+		return ErrInvalidBackup
+	}
+	if devices == 0 {
+		return ErrEmptyBackup
+	}
+	return nil
+}
+
+func sealBackup(data []byte, passphrase string) ([]byte, error) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, backupSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	gcm, err := backupCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := append([]byte{}, backupMagic...)
+	out = append(out, salt...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, compressed.Bytes(), backupMagic), nil
+}
+
+func openBackup(archive []byte, passphrase string) ([]byte, error) {
+	if !bytes.HasPrefix(archive, backupMagic) {
+		return nil, ErrInvalidBackup
+	}
+	rest := archive[len(backupMagic):]
+	if len(rest) < backupSaltSize {
+		return nil, ErrInvalidBackup
+	}
+	salt, rest := rest[:backupSaltSize], rest[backupSaltSize:]
+
+	gcm, err := backupCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < gcm.NonceSize() {
+		return nil, ErrInvalidBackup
+	}
+	nonce, sealed := rest[:gcm.NonceSize()], rest[gcm.NonceSize():]
+	compressed, err := gcm.Open(nil, nonce, sealed, backupMagic)
+	if err != nil {
+		return nil, ErrInvalidBackup
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, ErrInvalidBackup
+	}
+	defer zr.Close()
+	data, err := io.ReadAll(io.LimitReader(zr, MaxBackupSize))
+	if err != nil {
+		return nil, ErrInvalidBackup
+	}
+	return data, nil
+}
+
+func backupCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key := argon2.IDKey([]byte(passphrase), salt, 3, 64*1024, 2, 32)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
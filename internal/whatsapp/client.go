@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,11 +16,12 @@ import (
 	"go.mau.fi/whatsmeow/store/sqlstore"
 	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
-	waLog "go.mau.fi/whatsmeow/util/log"
 	"google.golang.org/protobuf/proto"
 )
 
-type EventCallback func(eventType string, message string, details string, data interface{})
+// EventCallback receives WhatsApp events. userID is the user owning the device, whose
+// webhooks and event streams the event belongs to.
+type EventCallback func(userID uint, eventType string, message string, details string, data interface{})
 
 type Client struct {
 	client        *whatsmeow.Client
@@ -29,13 +31,39 @@ type Client struct {
 	phoneNumber   string
 	mu            sync.RWMutex
 	stopChan      chan struct{}
+	stopOnce      sync.Once
 	container     *sqlstore.Container
 	eventCallback EventCallback
 	connectedAt   time.Time
 	currentQR     string    // Stores the latest QR code for polling
 	qrExpiry      time.Time // When the current QR expires
+
+	receiptWaiters map[string]chan types.ReceiptType // Pending receipt waits keyed by message ID
+
+	deviceJID     string // JID of the linked device; kept after logout clears the store
+	pairingUserID uint   // User who started the current pairing
+
+	reconnectConfig   ReconnectConfig
+	reconnectAttempts int           // Failed reconnects since the last successful connection
+	reconnect         *reconnectRun // Running reconnect loop, if any
+
+	watchdogConfig WatchdogConfig
+	degraded       bool // Keepalives are failing or the session isn't logged in
+	degradedReason string
+
+	throttle sendThrottle // Limits from the send policy, see ConfigureSendPolicy
+	sandbox  sandbox      // Sends recorded instead of sent, see EnableSandbox
+
+	groupNames groupNameCache // Subjects of groups, see groupName
+	hooks      sendHooks      // Run before every send, see AddSendHook
+
+	log     slogAdapter // whatsmeow logs, see ConfigureLogging
+	logFile *os.File
 }
 
+// storePath is the whatsmeow device store holding the linked session's keys
+const storePath = "./data/whatsapp.db"
+
 var (
 	instance *Client
 	once     sync.Once
@@ -44,9 +72,13 @@ var (
 func GetClient() *Client {
 	once.Do(func() {
 		instance = &Client{
-			qrChan:        make(chan string, 1),
-			connectedChan: make(chan bool, 1),
-			stopChan:      make(chan struct{}),
+			qrChan:          make(chan string, 1),
+			connectedChan:   make(chan bool, 1),
+			stopChan:        make(chan struct{}),
+			receiptWaiters:  make(map[string]chan types.ReceiptType),
+			throttle:        sendThrottle{byRecipient: make(map[string][]time.Time)},
+			reconnectConfig: defaultReconnectConfig,
+			watchdogConfig:  defaultWatchdogConfig,
 		}
 	})
 	return instance
@@ -64,7 +96,7 @@ func (c *Client) notifyEvent(eventType, message, details string, data interface{
 	callback := c.eventCallback
 	c.mu.RUnlock()
 	if callback != nil {
-		callback(eventType, message, details, data)
+		callback(c.OwnerID(), eventType, message, details, data)
 	}
 }
 
@@ -77,9 +109,8 @@ func (c *Client) Initialize() error {
 	// Initialize SQLite store for WhatsApp using the "sqlite" dialect
 	// The github.com/glebarez/go-sqlite driver registers as "sqlite"
 	// We use _pragma=foreign_keys(1) to enable foreign keys persistently
-	dbLog := waLog.Stdout("Database", "DEBUG", true)
 	ctx := context.Background()
-	container, err := sqlstore.New(ctx, "sqlite", "file:./data/whatsapp.db?_pragma=foreign_keys(1)", dbLog)
+	container, err := sqlstore.New(ctx, "sqlite", "file:"+storePath+"?_pragma=foreign_keys(1)", c.logger("Database"))
 	if err != nil {
 		return fmt.Errorf("failed to create whatsapp store: %w", err)
 	}
@@ -95,8 +126,12 @@ func (c *Client) Initialize() error {
 	}
 
 	// Create client
-	clientLog := waLog.Stdout("Client", "DEBUG", true)
-	c.client = whatsmeow.NewClient(deviceStore, clientLog)
+	c.client = whatsmeow.NewClient(deviceStore, c.logger("Client"))
+	// Reconnects are supervised by reconnectLoop, with backoff and progress events
+	c.client.EnableAutoReconnect = false
+	// Ack messages only once the event callback has stored them, so WhatsApp redelivers
+	// any received while the server was going down
+	c.client.SynchronousAck = true
 
 	// Set up event handler
 	c.client.AddEventHandler(c.handleEvent)
@@ -120,6 +155,8 @@ func (c *Client) AutoConnect() error {
 		c.connected = true
 		c.phoneNumber = c.client.Store.ID.User
 		c.mu.Unlock()
+		// Sessions from before device ownership was tracked go to the default owner
+		c.claimDevice(*c.client.Store.ID, false)
 		c.updateSessionStatus(true, c.client.Store.ID.User)
 		fmt.Println("WhatsApp reconnected successfully")
 	}
@@ -130,32 +167,42 @@ func (c *Client) AutoConnect() error {
 func (c *Client) handleEvent(evt interface{}) {
 	switch v := evt.(type) {
 	case *events.LoggedOut:
+		c.stopReconnect()
+		c.clearDegraded()
 		c.mu.Lock()
 		c.connected = false
 		c.phoneNumber = ""
 		c.connectedAt = time.Time{}
 		c.mu.Unlock()
+		ownerID := c.OwnerID()
 		c.updateSessionStatus(false, "")
 		c.notifyEvent("disconnected", "Logged out from WhatsApp", "Session invalidated", nil)
+		c.releaseDevice(ownerID)
 		// Session was invalidated (401), need to reinitialize and get new QR
 		go c.retryWithNewQR()
 	case *events.Connected:
 		c.mu.Lock()
 		c.connected = true
 		c.connectedAt = time.Now()
+		c.reconnectAttempts = 0
 		c.mu.Unlock()
+		c.clearDegraded()
 		c.notifyEvent("connected", "Connected to WhatsApp", "", nil)
 	case *events.Disconnected:
 		c.mu.Lock()
 		c.connected = false
 		c.connectedAt = time.Time{}
 		c.mu.Unlock()
+		c.clearDegraded()
 		c.notifyEvent("disconnected", "Disconnected from WhatsApp", "", nil)
+		// Only unexpected drops are reported as Disconnected, so try to get back online
+		c.startReconnect()
 	case *events.PairSuccess:
 		c.mu.Lock()
 		c.phoneNumber = v.ID.User
 		c.connectedAt = time.Now()
 		c.mu.Unlock()
+		c.claimDevice(v.ID, true)
 		c.updateSessionStatus(true, v.ID.User)
 		c.notifyEvent("connected", "WhatsApp paired successfully", "Phone: "+v.ID.User, nil)
 		// Signal successful connection
@@ -167,6 +214,28 @@ func (c *Client) handleEvent(evt interface{}) {
 		// Handle incoming message
 		data := c.extractMessageData(v)
 		c.notifyEvent("message_received", "Message received", "From: "+v.Info.Sender.User, data)
+	case *events.Receipt:
+		c.resolveReceiptWaiters(v)
+		c.handleReceipt(v)
+	case *events.GroupInfo:
+		c.handleGroupInfo(v)
+	case *events.KeepAliveTimeout:
+		c.handleKeepAliveTimeout(v)
+	case *events.KeepAliveRestored:
+		c.markHealthy("Keepalive pings restored")
+	case *events.TemporaryBan:
+		c.handleTemporaryBan(v)
+	case *events.StreamReplaced:
+		c.handleStreamReplaced()
+	case *events.StreamError:
+		c.handleStreamError(v)
+	case *events.ConnectFailure:
+		c.handleConnectFailure(v)
+	case *events.ClientOutdated:
+		c.handleClientOutdated()
+	case *events.CallOffer:
+		data := c.extractCallData(v)
+		c.notifyEvent("call_received", "Incoming call", "From: "+data.FromPhone, data)
 	}
 }
 
@@ -177,16 +246,12 @@ func (c *Client) updateSessionStatus(connected bool, phoneNumber string) {
 		return
 	}
 
-	// Get the first user for single-user system
-	var user models.User
-	var userID uint
-	if result := database.First(&user); result.Error == nil {
-		userID = user.ID
-	}
+	// The session row belongs to the device's owner
+	userID := c.OwnerID()
 
 	now := time.Now()
 	var session models.WhatsAppSession
-	result := database.First(&session)
+	result := database.Where("user_id = ?", userID).First(&session)
 	if result.Error != nil {
 		// Create new session
 		session = models.WhatsAppSession{
@@ -198,7 +263,6 @@ func (c *Client) updateSessionStatus(connected bool, phoneNumber string) {
 		database.Create(&session)
 	} else {
 		// Update existing
-		session.UserID = userID
 		session.Connected = connected
 		session.PhoneNumber = phoneNumber
 		if connected {
@@ -292,6 +356,8 @@ func (c *Client) Connect() error {
 }
 
 func (c *Client) Disconnect() error {
+	c.stopReconnect()
+	c.clearDegraded()
 	if c.client != nil {
 		c.client.Disconnect()
 		c.mu.Lock()
@@ -304,6 +370,26 @@ func (c *Client) Disconnect() error {
 	return nil
 }
 
+// Shutdown stops the background loops (reconnect, watchdog, self-test), disconnects
+// and closes the device store. The session is kept, so the next start resumes it.
+func (c *Client) Shutdown() {
+	c.stopOnce.Do(func() { close(c.stopChan) })
+	c.Disconnect()
+
+	c.mu.Lock()
+	container := c.container
+	c.container = nil
+	c.mu.Unlock()
+	if container != nil {
+		if err := container.Close(); err != nil {
+			fmt.Printf("Failed to close WhatsApp store: %v\n", err)
+		}
+	}
+	if c.logFile != nil {
+		c.logFile.Close()
+	}
+}
+
 func (c *Client) GetQRCode() chan string {
 	return c.qrChan
 }
@@ -357,23 +443,184 @@ func (c *Client) GetConnectedAt() time.Time {
 	return c.connectedAt
 }
 
-func (c *Client) SendMessage(jid string, message string) error {
-	if !c.IsConnected() {
-		return fmt.Errorf("whatsapp not connected")
+// SendMessage sends a text message for a user and returns the WhatsApp message ID and
+// the text as sent. The send hooks may change or veto it first.
+func (c *Client) SendMessage(userID uint, jid string, message string) (string, string, error) {
+	return c.sendText(userID, jid, message, true)
+}
+
+// sendText sends a text message, passing it through the send hooks if runHooks is set
+func (c *Client) sendText(userID uint, jid string, message string, runHooks bool) (string, string, error) {
+	if !c.CanSend() {
+		return "", "", fmt.Errorf("whatsapp not connected")
 	}
 
 	// Parse the JID from string
 	parsedJID, err := types.ParseJID(jid)
 	if err != nil {
-		return fmt.Errorf("invalid JID: %w", err)
+		return "", "", fmt.Errorf("invalid JID: %w", err)
+	}
+	// Before the send policy, so vetoed messages don't count towards its limits
+	if runHooks {
+		if message, err = c.runSendHooks(userID, parsedJID, message, nil); err != nil {
+			return "", "", err
+		}
+	}
+	if err := c.waitForSendPolicy(parsedJID); err != nil {
+		return "", "", err
+	}
+	if c.Sandboxed() {
+		return c.recordSandboxSend(parsedJID, message, nil), message, nil
 	}
 
 	msg := &waE2E.Message{
 		Conversation: &message,
 	}
 
-	_, err = c.client.SendMessage(context.Background(), parsedJID, msg)
-	return err
+	resp, err := c.client.SendMessage(context.Background(), parsedJID, msg)
+	if err != nil {
+		return "", "", c.checkRateLimit(err)
+	}
+	return resp.ID, message, nil
+}
+
+// SendMedia uploads an attachment for a user and sends it as an image, video, audio or
+// document message depending on its MIME type. Returns the WhatsApp message ID and the
+// caption as sent. The send hooks may change its caption or veto it first.
+func (c *Client) SendMedia(userID uint, jid string, media models.MediaAttachment) (string, string, error) {
+	if !c.CanSend() {
+		return "", "", fmt.Errorf("whatsapp not connected")
+	}
+
+	parsedJID, err := types.ParseJID(jid)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid JID: %w", err)
+	}
+	if media.Caption, err = c.runSendHooks(userID, parsedJID, media.Caption, &media); err != nil {
+		return "", "", err
+	}
+	if err := c.waitForSendPolicy(parsedJID); err != nil {
+		return "", "", err
+	}
+	if c.Sandboxed() {
+		return c.recordSandboxSend(parsedJID, media.Caption, &media), media.Caption, nil
+	}
+
+	mediaType := whatsmeow.MediaDocument
+	switch {
+	case strings.HasPrefix(media.MimeType, "image/"):
+		mediaType = whatsmeow.MediaImage
+	case strings.HasPrefix(media.MimeType, "video/"):
+		mediaType = whatsmeow.MediaVideo
+	case strings.HasPrefix(media.MimeType, "audio/"):
+		mediaType = whatsmeow.MediaAudio
+	}
+
+	uploaded, err := c.client.Upload(context.Background(), media.Data, mediaType)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to upload media: %w", err)
+	}
+
+	msg := &waE2E.Message{}
+	switch mediaType {
+	case whatsmeow.MediaImage:
+		msg.ImageMessage = &waE2E.ImageMessage{
+			Caption:       proto.String(media.Caption),
+			Mimetype:      proto.String(media.MimeType),
+			URL:           &uploaded.URL,
+			DirectPath:    &uploaded.DirectPath,
+			MediaKey:      uploaded.MediaKey,
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    &uploaded.FileLength,
+		}
+	case whatsmeow.MediaVideo:
+		msg.VideoMessage = &waE2E.VideoMessage{
+			Caption:       proto.String(media.Caption),
+			Mimetype:      proto.String(media.MimeType),
+			URL:           &uploaded.URL,
+			DirectPath:    &uploaded.DirectPath,
+			MediaKey:      uploaded.MediaKey,
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    &uploaded.FileLength,
+		}
+	case whatsmeow.MediaAudio:
+		msg.AudioMessage = &waE2E.AudioMessage{
+			Mimetype:      proto.String(media.MimeType),
+			URL:           &uploaded.URL,
+			DirectPath:    &uploaded.DirectPath,
+			MediaKey:      uploaded.MediaKey,
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    &uploaded.FileLength,
+		}
+	default:
+		msg.DocumentMessage = &waE2E.DocumentMessage{
+			Caption:       proto.String(media.Caption),
+			Mimetype:      proto.String(media.MimeType),
+			FileName:      proto.String(media.Filename),
+			URL:           &uploaded.URL,
+			DirectPath:    &uploaded.DirectPath,
+			MediaKey:      uploaded.MediaKey,
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    &uploaded.FileLength,
+		}
+	}
+
+	resp, err := c.client.SendMessage(context.Background(), parsedJID, msg)
+	if err != nil {
+		return "", "", c.checkRateLimit(err)
+	}
+	// Audio has no caption field, so send any text separately. The send policy counted
+	// the pair as one message.
+	if mediaType == whatsmeow.MediaAudio && media.Caption != "" {
+		caption := &waE2E.Message{Conversation: proto.String(media.Caption)}
+		if _, err := c.client.SendMessage(context.Background(), parsedJID, caption); err != nil {
+			return resp.ID, media.Caption, c.checkRateLimit(err)
+		}
+	}
+	return resp.ID, media.Caption, nil
+}
+
+// WaitForReceipt blocks until a receipt arrives for the given message ID or the timeout elapses
+func (c *Client) WaitForReceipt(messageID string, timeout time.Duration) (types.ReceiptType, bool) {
+	ch := make(chan types.ReceiptType, 1)
+	c.mu.Lock()
+	c.receiptWaiters[messageID] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.receiptWaiters, messageID)
+		c.mu.Unlock()
+	}()
+
+	select {
+	case receiptType := <-ch:
+		return receiptType, true
+	case <-time.After(timeout):
+		return "", false
+	}
+}
+
+// resolveReceiptWaiters wakes up any WaitForReceipt callers for the receipted message IDs
+func (c *Client) resolveReceiptWaiters(receipt *events.Receipt) {
+	if receipt.Type == types.ReceiptTypeServerError || receipt.Type == types.ReceiptTypeRetry {
+		return
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, id := range receipt.MessageIDs {
+		if ch, ok := c.receiptWaiters[id]; ok {
+			select {
+			case ch <- receipt.Type:
+			default:
+			}
+		}
+	}
 }
 
 func (c *Client) GetStatus() models.WhatsAppStatus {
@@ -384,6 +631,9 @@ func (c *Client) GetStatus() models.WhatsAppStatus {
 		Connected:       c.connected,
 		PhoneNumber:     c.phoneNumber,
 		QRCodeAvailable: len(c.qrChan) > 0,
+		Degraded:        c.degraded,
+		DegradedReason:  c.degradedReason,
+		Sandbox:         c.Sandboxed(),
 	}
 }
 
@@ -393,11 +643,14 @@ func (c *Client) extractMessageData(msg *events.Message) models.MessageReceivedD
 	fromPhone := c.getSenderPhoneNumber(msg)
 
 	data := models.MessageReceivedData{
+		Chat:      msg.Info.Chat.String(),
 		From:      msg.Info.Sender.User,
 		FromPhone: fromPhone,
+		SenderJID: msg.Info.Sender.ToNonAD().String(),
 		MessageID: msg.Info.ID,
 		Timestamp: msg.Info.Timestamp.Unix(),
 		IsGroup:   msg.Info.IsGroup,
+		IsFromMe:  msg.Info.IsFromMe,
 	}
 
 	// Extract message content
@@ -408,6 +661,7 @@ func (c *Client) extractMessageData(msg *events.Message) models.MessageReceivedD
 			data.Content = *msg.Message.ExtendedTextMessage.Text
 		}
 	}
+	data.Type, data.Caption, data.Media = messageKind(msg.Message)
 
 	// Get sender name if available
 	if msg.Info.PushName != "" {
@@ -416,7 +670,7 @@ func (c *Client) extractMessageData(msg *events.Message) models.MessageReceivedD
 
 	// Get group name if it's a group message
 	if msg.Info.IsGroup {
-		data.GroupName = msg.Info.Chat.String()
+		data.GroupName = c.groupName(msg.Info.Chat)
 	}
 
 	return data
@@ -424,19 +678,25 @@ func (c *Client) extractMessageData(msg *events.Message) models.MessageReceivedD
 
 // getSenderPhoneNumber extracts the phone number from a message, handling LID addressing
 func (c *Client) getSenderPhoneNumber(msg *events.Message) string {
-	// First, check if SenderAlt contains the phone number (when using LID addressing)
-	if !msg.Info.SenderAlt.IsEmpty() && msg.Info.SenderAlt.Server == types.DefaultUserServer {
-		return msg.Info.SenderAlt.User
+	return c.phoneNumberFor(msg.Info.Sender, msg.Info.SenderAlt)
+}
+
+// phoneNumberFor resolves a user's phone number, handling LID addressing. alt is the
+// alternative address WhatsApp sent alongside the JID, if any.
+func (c *Client) phoneNumberFor(jid, alt types.JID) string {
+	// First, check if the alternative address contains the phone number (when using LID addressing)
+	if !alt.IsEmpty() && alt.Server == types.DefaultUserServer {
+		return alt.User
 	}
 
-	// If the sender is a LID, try to look up the phone number from the store
-	if msg.Info.Sender.Server == types.HiddenUserServer {
-		pn, err := c.client.Store.LIDs.GetPNForLID(context.Background(), msg.Info.Sender)
+	// If the user is a LID, try to look up the phone number from the store
+	if jid.Server == types.HiddenUserServer {
+		pn, err := c.client.Store.LIDs.GetPNForLID(context.Background(), jid)
 		if err == nil && !pn.IsEmpty() {
 			return pn.User
 		}
 	}
 
-	// Fallback to the sender's User field (already a phone number)
-	return msg.Info.Sender.User
+	// Fallback to the JID's User field (already a phone number)
+	return jid.User
 }
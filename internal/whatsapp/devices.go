@@ -0,0 +1,153 @@
+package whatsapp
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/user/pinglater/internal/db"
+	"github.com/user/pinglater/internal/models"
+	"go.mau.fi/whatsmeow/proto/waAdv"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// ConnectAs starts a connection on behalf of a user. If it leads to a new pairing, the
+// device is assigned to that user.
+func (c *Client) ConnectAs(userID uint) error {
+	c.mu.Lock()
+	c.pairingUserID = userID
+	c.mu.Unlock()
+	return c.Connect()
+}
+
+// OwnerID returns the user that owns the linked device and receives its events. Devices
+// without an owner (not paired yet, or the owner was deleted) belong to the first
+// active admin.
+func (c *Client) OwnerID() uint {
+	c.mu.RLock()
+	jid := c.deviceJID
+	c.mu.RUnlock()
+
+	database := db.GetDB()
+	if database == nil {
+		return 0
+	}
+	if jid != "" {
+		var device models.WhatsAppDevice
+		if err := database.Where("jid = ?", jid).First(&device).Error; err == nil {
+			return device.UserID
+		}
+	}
+	return defaultOwnerID()
+}
+
+// AccountID returns the ID of the linked device's account, or 0 when no device is linked
+func (c *Client) AccountID() uint {
+	c.mu.RLock()
+	jid := c.deviceJID
+	c.mu.RUnlock()
+
+	database := db.GetDB()
+	if jid == "" || database == nil {
+		return 0
+	}
+	var device models.WhatsAppDevice
+	if err := database.Where("jid = ?", jid).First(&device).Error; err != nil {
+		return 0
+	}
+	return device.ID
+}
+
+// DeviceInfo describes the linked device. It returns ErrNotLinked when no device is
+// linked.
+func (c *Client) DeviceInfo() (models.WhatsAppDeviceInfo, error) {
+	c.mu.RLock()
+	client := c.client
+	connected := c.connected
+	c.mu.RUnlock()
+	if client == nil || client.Store.ID == nil {
+		return models.WhatsAppDeviceInfo{}, ErrNotLinked
+	}
+
+	device := client.Store
+	info := models.WhatsAppDeviceInfo{
+		AccountID:    c.AccountID(),
+		JID:          device.ID.String(),
+		PhoneNumber:  device.ID.User,
+		Platform:     device.Platform,
+		PushName:     device.PushName,
+		BusinessName: device.BusinessName,
+		Connected:    connected,
+	}
+
+	// The signed device identity carries the time the phone linked the device
+	if device.Account != nil {
+		var identity waAdv.ADVDeviceIdentity
+		if err := proto.Unmarshal(device.Account.GetDetails(), &identity); err == nil && identity.GetTimestamp() > 0 {
+			pairedAt := time.Unix(int64(identity.GetTimestamp()), 0)
+			info.PairedAt = &pairedAt
+		}
+	}
+	// Otherwise fall back to when PingLater first saw the device
+	if info.PairedAt == nil {
+		var record models.WhatsAppDevice
+		if database := db.GetDB(); database != nil && database.Where("jid = ?", info.JID).First(&record).Error == nil {
+			info.PairedAt = &record.CreatedAt
+		}
+	}
+	return info, nil
+}
+
+// claimDevice records the owner of a linked device. A newly paired device goes to the
+// user who started the pairing; a device that is already mapped keeps its owner unless
+// reassign is set.
+func (c *Client) claimDevice(jid types.JID, reassign bool) {
+	c.mu.Lock()
+	c.deviceJID = jid.String()
+	ownerID := c.pairingUserID
+	c.mu.Unlock()
+
+	database := db.GetDB()
+	if database == nil {
+		return
+	}
+	if ownerID == 0 {
+		ownerID = defaultOwnerID()
+	}
+
+	device := models.WhatsAppDevice{JID: jid.String()}
+	query := database.Where(models.WhatsAppDevice{JID: jid.String()})
+	owner := models.WhatsAppDevice{UserID: ownerID, PhoneNumber: jid.User}
+	if reassign {
+		query = query.Assign(owner)
+	} else {
+		query = query.Attrs(owner)
+	}
+	if err := query.FirstOrCreate(&device).Error; err != nil {
+		fmt.Printf("Failed to record owner of WhatsApp device %s: %v\n", jid, err)
+	}
+}
+
+// releaseDevice forgets the mapping of a device that was logged out. The next pairing
+// goes to the same user.
+func (c *Client) releaseDevice(ownerID uint) {
+	c.mu.Lock()
+	jid := c.deviceJID
+	c.deviceJID = ""
+	c.pairingUserID = ownerID
+	c.mu.Unlock()
+
+	if database := db.GetDB(); database != nil && jid != "" {
+		database.Where("jid = ?", jid).Delete(&models.WhatsAppDevice{})
+	}
+}
+
+// defaultOwnerID returns the first active admin, who set up the deployment's WhatsApp
+// connection
+func defaultOwnerID() uint {
+	var user models.User
+	if err := db.GetDB().Where("is_admin = ? AND is_active = ?", true, true).Order("id asc").First(&user).Error; err != nil {
+		return 0
+	}
+	return user.ID
+}
@@ -0,0 +1,109 @@
+package whatsapp
+
+import (
+	"github.com/user/pinglater/internal/models"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// handleReceipt emits message_delivered and message_read for receipts from other users.
+// Receipts from our own devices and other receipt types (played, sender, retry...) are ignored.
+func (c *Client) handleReceipt(receipt *events.Receipt) {
+	if receipt.IsFromMe {
+		return
+	}
+
+	var eventType, message string
+	switch receipt.Type {
+	case types.ReceiptTypeDelivered:
+		eventType, message = "message_delivered", "Message delivered"
+	case types.ReceiptTypeRead:
+		eventType, message = "message_read", "Message read"
+	default:
+		return
+	}
+
+	data := models.MessageReceiptData{
+		Chat:       receipt.Chat.String(),
+		From:       receipt.Sender.User,
+		FromPhone:  c.phoneNumberFor(receipt.Sender, receipt.SenderAlt),
+		MessageIDs: receipt.MessageIDs,
+		IsGroup:    receipt.IsGroup,
+		Timestamp:  receipt.Timestamp.Unix(),
+		SenderJID:  receipt.Sender.ToNonAD().String(),
+	}
+	c.notifyEvent(eventType, message, "By: "+data.FromPhone, data)
+}
+
+// handleGroupInfo emits one group_participant_changed event per membership change in
+// a group update. Other group changes (name, topic, settings) are ignored.
+func (c *Client) handleGroupInfo(info *events.GroupInfo) {
+	// Keep up with renames
+	if info.Name != nil {
+		c.groupNames.set(info.JID, info.Name.Name, groupNameTTL)
+	}
+
+	changes := []struct {
+		action string
+		jids   []types.JID
+	}{
+		{models.GroupActionJoin, info.Join},
+		{models.GroupActionLeave, info.Leave},
+		{models.GroupActionPromote, info.Promote},
+		{models.GroupActionDemote, info.Demote},
+	}
+
+	for _, change := range changes {
+		if len(change.jids) == 0 {
+			continue
+		}
+
+		data := models.GroupParticipantChangedData{
+			Group:        info.JID.String(),
+			Action:       change.action,
+			Participants: make([]string, 0, len(change.jids)),
+			Timestamp:    info.Timestamp.Unix(),
+		}
+		data.GroupName = c.groupName(info.JID)
+		for _, jid := range change.jids {
+			data.Participants = append(data.Participants, jid.String())
+		}
+		if info.Sender != nil {
+			data.By = info.Sender.User
+			var alt types.JID
+			if info.SenderPN != nil {
+				alt = *info.SenderPN
+			}
+			data.ByPhone = c.phoneNumberFor(*info.Sender, alt)
+		}
+		if change.action == models.GroupActionJoin {
+			data.Reason = info.JoinReason
+		}
+
+		c.notifyEvent("group_participant_changed", "Group participants changed",
+			data.Action+" in "+data.Group, data)
+	}
+}
+
+// extractCallData extracts call data from an incoming call offer
+func (c *Client) extractCallData(offer *events.CallOffer) models.CallReceivedData {
+	creator, creatorAlt := offer.CallCreator, offer.CallCreatorAlt
+	if creator.IsEmpty() {
+		creator, creatorAlt = offer.From, types.JID{}
+	}
+
+	data := models.CallReceivedData{
+		CallID:    offer.CallID,
+		From:      creator.User,
+		FromPhone: c.phoneNumberFor(creator, creatorAlt),
+		IsGroup:   !offer.GroupJID.IsEmpty(),
+		Timestamp: offer.Timestamp.Unix(),
+	}
+	if data.IsGroup {
+		data.Group = offer.GroupJID.String()
+	}
+	if offer.Data != nil {
+		_, data.IsVideo = offer.Data.GetOptionalChildByTag("video")
+	}
+	return data
+}
@@ -0,0 +1,77 @@
+package whatsapp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+const (
+	// groupNameTTL is how long a group's subject is cached. Renames seen in group info
+	// events update it right away.
+	groupNameTTL = 6 * time.Hour
+	// groupNameRetry is how long a group whose info couldn't be fetched goes without a
+	// name before it's asked for again
+	groupNameRetry = 5 * time.Minute
+	// groupInfoTimeout bounds the group info request made while handling a message
+	groupInfoTimeout = 5 * time.Second
+)
+
+// groupNameCache keeps the subjects of groups messages arrive in, so each isn't
+// fetched from WhatsApp for every message
+type groupNameCache struct {
+	mu      sync.Mutex
+	entries map[types.JID]groupNameEntry
+}
+
+type groupNameEntry struct {
+	name    string
+	expires time.Time
+}
+
+func (g *groupNameCache) get(jid types.JID) (string, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	entry, ok := g.entries[jid]
+	if !ok || time.Now().After(entry.expires) {
+		return "", false
+	}
+	return entry.name, true
+}
+
+func (g *groupNameCache) set(jid types.JID, name string, ttl time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.entries == nil {
+		g.entries = make(map[types.JID]groupNameEntry)
+	}
+	g.entries[jid] = groupNameEntry{name: name, expires: time.Now().Add(ttl)}
+}
+
+// groupName returns the subject of a group, fetching it from WhatsApp unless it's
+// cached. It's empty if the group's info can't be fetched.
+func (c *Client) groupName(jid types.JID) string {
+	if name, ok := c.groupNames.get(jid); ok {
+		return name
+	}
+
+	c.mu.RLock()
+	client := c.client
+	c.mu.RUnlock()
+	if client == nil {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), groupInfoTimeout)
+	defer cancel()
+	info, err := client.GetGroupInfo(ctx, jid)
+	if err != nil {
+		c.logger("Groups").Warnf("Failed to fetch the name of group %s: %v", jid, err)
+		c.groupNames.set(jid, "", groupNameRetry)
+		return ""
+	}
+	c.groupNames.set(jid, info.Name, groupNameTTL)
+	return info.Name
+}
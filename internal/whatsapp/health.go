@@ -0,0 +1,25 @@
+package whatsapp
+
+import (
+	"context"
+	"errors"
+)
+
+// CheckStore verifies that the device store is open and answers queries
+func (c *Client) CheckStore(ctx context.Context) error {
+	c.mu.RLock()
+	container := c.container
+	c.mu.RUnlock()
+	if container == nil {
+		return errors.New("WhatsApp store is not open")
+	}
+	_, err := container.GetAllDevices(ctx)
+	return err
+}
+
+// IsReconnecting reports whether the reconnect loop is trying to restore the connection
+func (c *Client) IsReconnecting() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.reconnect != nil
+}
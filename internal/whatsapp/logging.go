@@ -0,0 +1,93 @@
+package whatsapp
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/user/pinglater/internal/logging"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// LogConfig controls whatsmeow's protocol logging, which is very chatty below warn
+type LogConfig struct {
+	Level string // debug, info, warn, error or none
+	File  string // Write to this file instead of the application log
+}
+
+const levelNone = slog.Level(math.MaxInt32)
+
+// ConfigureLogging routes the store and client logs of the next Initialize. Logs going
+// to the application log are also limited by LOG_LEVEL.
+func (c *Client) ConfigureLogging(config LogConfig) error {
+	level := slog.LevelWarn
+	switch value := strings.ToLower(config.Level); value {
+	case "":
+	case "none", "off":
+		level = levelNone
+	default:
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("invalid log level %q", config.Level)
+		}
+	}
+
+	logger := logging.Logger("whatsapp")
+	if config.File != "" {
+		file, err := os.OpenFile(config.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open WhatsApp log file: %w", err)
+		}
+		c.mu.Lock()
+		if c.logFile != nil {
+			c.logFile.Close()
+		}
+		c.logFile = file
+		c.mu.Unlock()
+		logger = slog.New(logging.NewHandler(file, level)).With("component", "whatsapp")
+	}
+
+	c.mu.Lock()
+	c.log = slogAdapter{logger: logger, min: level}
+	c.mu.Unlock()
+	return nil
+}
+
+// logger returns the whatsmeow logger for a module
+func (c *Client) logger(module string) waLog.Logger {
+	c.mu.RLock()
+	log := c.log
+	c.mu.RUnlock()
+	if log.logger == nil {
+		log = slogAdapter{logger: logging.Logger("whatsapp"), min: slog.LevelWarn}
+	}
+	return log.Sub(module)
+}
+
+// slogAdapter implements whatsmeow's logger on top of slog
+type slogAdapter struct {
+	logger *slog.Logger
+	module string
+	min    slog.Level
+}
+
+func (l slogAdapter) logf(level slog.Level, msg string, args []interface{}) {
+	if level < l.min {
+		return
+	}
+	l.logger.Log(context.Background(), level, fmt.Sprintf(msg, args...), "module", l.module)
+}
+
+func (l slogAdapter) Debugf(msg string, args ...interface{}) { l.logf(slog.LevelDebug, msg, args) }
+func (l slogAdapter) Infof(msg string, args ...interface{})  { l.logf(slog.LevelInfo, msg, args) }
+func (l slogAdapter) Warnf(msg string, args ...interface{})  { l.logf(slog.LevelWarn, msg, args) }
+func (l slogAdapter) Errorf(msg string, args ...interface{}) { l.logf(slog.LevelError, msg, args) }
+
+func (l slogAdapter) Sub(module string) waLog.Logger {
+	if l.module != "" {
+		module = l.module + "/" + module
+	}
+	return slogAdapter{logger: l.logger, module: module, min: l.min}
+}
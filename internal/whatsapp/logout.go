@@ -0,0 +1,53 @@
+package whatsapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotLinked is returned when logging out without a linked device
+var ErrNotLinked = errors.New("no WhatsApp account is linked")
+
+// Logout unlinks the device: it asks WhatsApp to remove it from the phone's linked
+// devices, deletes it from the local store and resets the session, so a new pairing can
+// start. Unlike Disconnect, the session can't be resumed afterwards. When WhatsApp can't
+// be reached the device is only removed locally and remote is false; the phone then
+// keeps listing it until it expires or is removed there.
+func (c *Client) Logout() (remote bool, err error) {
+	c.stopReconnect()
+	if c.client == nil || c.client.Store.ID == nil {
+		return false, ErrNotLinked
+	}
+	ownerID := c.OwnerID()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := c.client.Logout(ctx); err != nil {
+		fmt.Printf("WhatsApp logout request failed, removing the device locally: %v\n", err)
+		c.client.Disconnect()
+		if c.client.Store.ID != nil {
+			if err := c.client.Store.Delete(ctx); err != nil {
+				return false, fmt.Errorf("failed to delete WhatsApp device: %w", err)
+			}
+		}
+	} else {
+		remote = true
+	}
+
+	c.mu.Lock()
+	c.connected = false
+	c.phoneNumber = ""
+	c.connectedAt = time.Time{}
+	c.currentQR = ""
+	// The next Connect starts over with a fresh device
+	c.client = nil
+	c.mu.Unlock()
+
+	c.updateSessionStatus(false, "")
+	c.notifyEvent("disconnected", "Logged out from WhatsApp", "Device unlinked", nil)
+	c.releaseDevice(ownerID)
+	return remote, nil
+}
@@ -0,0 +1,37 @@
+package whatsapp
+
+import (
+	"github.com/user/pinglater/internal/models"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+)
+
+// messageKind returns the kind of a received message, its caption if it's a media
+// message, and a description of its attachment
+func messageKind(msg *waE2E.Message) (string, string, *models.MessageMedia) {
+	switch {
+	case msg == nil:
+		return models.MessageTypeOther, "", nil
+	case msg.Conversation != nil || msg.ExtendedTextMessage != nil:
+		return models.MessageTypeText, "", nil
+	case msg.ImageMessage != nil:
+		m := msg.ImageMessage
+		return models.MessageTypeImage, m.GetCaption(), &models.MessageMedia{MimeType: m.GetMimetype(), Size: m.GetFileLength()}
+	case msg.VideoMessage != nil:
+		m := msg.VideoMessage
+		return models.MessageTypeVideo, m.GetCaption(), &models.MessageMedia{MimeType: m.GetMimetype(), Size: m.GetFileLength(), Seconds: m.GetSeconds()}
+	case msg.AudioMessage != nil:
+		m := msg.AudioMessage
+		return models.MessageTypeAudio, "", &models.MessageMedia{MimeType: m.GetMimetype(), Size: m.GetFileLength(), Seconds: m.GetSeconds()}
+	case msg.DocumentMessage != nil:
+		m := msg.DocumentMessage
+		return models.MessageTypeDocument, m.GetCaption(), &models.MessageMedia{MimeType: m.GetMimetype(), Filename: m.GetFileName(), Size: m.GetFileLength()}
+	case msg.StickerMessage != nil:
+		m := msg.StickerMessage
+		return models.MessageTypeSticker, "", &models.MessageMedia{MimeType: m.GetMimetype(), Size: m.GetFileLength()}
+	case msg.LocationMessage != nil || msg.LiveLocationMessage != nil:
+		return models.MessageTypeLocation, "", nil
+	case msg.ContactMessage != nil || msg.ContactsArrayMessage != nil:
+		return models.MessageTypeContact, "", nil
+	}
+	return models.MessageTypeOther, "", nil
+}
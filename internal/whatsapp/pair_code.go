@@ -0,0 +1,68 @@
+package whatsapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+)
+
+// pairCodeDisplayName is shown on the phone under Linked devices. WhatsApp only accepts
+// common "Browser (OS)" combinations here.
+const pairCodeDisplayName = "Chrome (Linux)"
+
+// ErrSessionExists is returned when pairing while a device is already linked
+var ErrSessionExists = errors.New("a WhatsApp session already exists, connect instead")
+
+// PairPhone links a device by phone number instead of a QR code. It returns the
+// 8-character code the user enters on the phone under Linked devices > Link with phone
+// number. The device is assigned to userID once paired.
+func (c *Client) PairPhone(userID uint, phoneNumber string) (string, error) {
+	if c.IsConnected() {
+		return "", fmt.Errorf("already connected")
+	}
+	if c.client != nil && c.client.Store.ID != nil {
+		return "", ErrSessionExists
+	}
+
+	// Pairing codes ride on the QR login websocket, so start the normal QR flow and wait
+	// for its first code, which means the connection is ready
+	if c.client == nil || !c.client.IsConnected() {
+		if err := c.ConnectAs(userID); err != nil {
+			return "", err
+		}
+	} else {
+		c.mu.Lock()
+		c.pairingUserID = userID
+		c.mu.Unlock()
+	}
+	if err := c.waitForQR(15 * time.Second); err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	code, err := c.client.PairPhone(ctx, phoneNumber, true, whatsmeow.PairClientChrome, pairCodeDisplayName)
+	if err != nil {
+		return "", fmt.Errorf("failed to request pairing code: %w", err)
+	}
+	c.notifyEvent("qr_generated", "Pairing code generated", "Phone: "+phoneNumber, nil)
+	return code, nil
+}
+
+// waitForQR waits until the QR login flow has produced a code
+func (c *Client) waitForQR(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		c.mu.RLock()
+		ready := c.currentQR != ""
+		c.mu.RUnlock()
+		if ready {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("timed out waiting for the WhatsApp login connection")
+}
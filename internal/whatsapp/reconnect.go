@@ -0,0 +1,140 @@
+package whatsapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/user/pinglater/internal/models"
+	"go.mau.fi/whatsmeow"
+)
+
+// ReconnectConfig controls reconnection after the connection drops unexpectedly. The
+// delay before each attempt doubles from BaseDelay up to MaxDelay, with ±20% jitter.
+type ReconnectConfig struct {
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	MaxAttempts int // Attempts before giving up with a reconnect_failed alert (0 = never)
+}
+
+var defaultReconnectConfig = ReconnectConfig{
+	BaseDelay:   2 * time.Second,
+	MaxDelay:    5 * time.Minute,
+	MaxAttempts: 10,
+}
+
+// reconnectRun is one running reconnect loop
+type reconnectRun struct {
+	cancel context.CancelFunc
+}
+
+// ConfigureReconnect replaces the reconnect backoff settings
+func (c *Client) ConfigureReconnect(config ReconnectConfig) {
+	if config.BaseDelay <= 0 {
+		config.BaseDelay = defaultReconnectConfig.BaseDelay
+	}
+	if config.MaxDelay < config.BaseDelay {
+		config.MaxDelay = config.BaseDelay
+	}
+	c.mu.Lock()
+	c.reconnectConfig = config
+	c.mu.Unlock()
+}
+
+// startReconnect starts the reconnect loop unless one is already running
+func (c *Client) startReconnect() {
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &reconnectRun{cancel: cancel}
+
+	c.mu.Lock()
+	if c.reconnect != nil {
+		c.mu.Unlock()
+		cancel()
+		return
+	}
+	c.reconnect = run
+	c.mu.Unlock()
+
+	go c.reconnectLoop(ctx, run)
+}
+
+// stopReconnect cancels a running reconnect loop, e.g. after a manual disconnect
+func (c *Client) stopReconnect() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.reconnect != nil {
+		c.reconnect.cancel()
+		c.reconnect = nil
+	}
+	c.reconnectAttempts = 0
+}
+
+// reconnectLoop retries the connection with backoff. Attempts are counted until the
+// next successful login, so a connection that drops again right after the handshake
+// continues the backoff instead of restarting it.
+func (c *Client) reconnectLoop(ctx context.Context, run *reconnectRun) {
+	defer func() {
+		c.mu.Lock()
+		if c.reconnect == run {
+			c.reconnect = nil
+		}
+		c.mu.Unlock()
+	}()
+
+	for {
+		c.mu.Lock()
+		c.reconnectAttempts++
+		attempt := c.reconnectAttempts
+		config := c.reconnectConfig
+		client := c.client
+		if config.MaxAttempts > 0 && attempt > config.MaxAttempts {
+			c.reconnectAttempts = 0
+		}
+		c.mu.Unlock()
+
+		// Without a stored session there's nothing to resume; pairing is needed
+		if client == nil || client.Store.ID == nil {
+			return
+		}
+
+		if config.MaxAttempts > 0 && attempt > config.MaxAttempts {
+			details := fmt.Sprintf("%d reconnect attempts failed, use POST /api/whatsapp/connect to retry", config.MaxAttempts)
+			c.notifyEvent(string(models.EventTypeReconnectFailed), "Gave up reconnecting to WhatsApp", details,
+				c.connectionEventData("Gave up reconnecting to WhatsApp", details))
+			return
+		}
+
+		delay := config.delay(attempt)
+		c.notifyEvent(string(models.EventTypeReconnecting), "Reconnecting to WhatsApp",
+			fmt.Sprintf("Attempt %d in %s", attempt, delay.Round(time.Second)), nil)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.stopChan:
+			return
+		case <-time.After(delay):
+		}
+
+		err := client.Connect()
+		if err == nil || errors.Is(err, whatsmeow.ErrAlreadyConnected) {
+			return
+		}
+		fmt.Printf("WhatsApp reconnect attempt %d failed: %v\n", attempt, err)
+	}
+}
+
+// delay returns the backoff before an attempt (1-based)
+func (cfg ReconnectConfig) delay(attempt int) time.Duration {
+	d := cfg.BaseDelay
+	for i := 1; i < attempt && d < cfg.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > cfg.MaxDelay {
+		d = cfg.MaxDelay
+	}
+	jitter := time.Duration((rand.Float64()*0.4 - 0.2) * float64(d))
+	return d + jitter
+}
@@ -0,0 +1,104 @@
+package whatsapp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/pinglater/internal/models"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// sandboxHistory is how many sandboxed sends are kept for GET /whatsapp/sandbox
+const sandboxHistory = 500
+
+// SandboxMessage is a message recorded in sandbox mode instead of being sent
+type SandboxMessage struct {
+	ID            string    `json:"id"` // Made-up message ID, starting with SANDBOX
+	To            string    `json:"to"` // Recipient JID
+	Message       string    `json:"message"`
+	MediaMimeType string    `json:"media_mime_type,omitempty"`
+	MediaFilename string    `json:"media_filename,omitempty"`
+	MediaSize     int       `json:"media_size,omitempty"`
+	SentAt        time.Time `json:"sent_at"`
+}
+
+// sandbox records sends while sandbox mode is on. The history is kept in memory only.
+type sandbox struct {
+	mu       sync.Mutex
+	enabled  bool
+	messages []SandboxMessage // Oldest first, at most sandboxHistory
+}
+
+// EnableSandbox turns on sandbox mode: messages go through the whole pipeline (send
+// policy, queue, events and webhooks) but are recorded instead of sent to WhatsApp, and
+// don't need a connection. For staging environments.
+func (c *Client) EnableSandbox() {
+	c.sandbox.mu.Lock()
+	c.sandbox.enabled = true
+	c.sandbox.mu.Unlock()
+}
+
+// Sandboxed reports whether sandbox mode is on
+func (c *Client) Sandboxed() bool {
+	c.sandbox.mu.Lock()
+	defer c.sandbox.mu.Unlock()
+	return c.sandbox.enabled
+}
+
+// CanSend reports whether messages can be sent now: WhatsApp is connected, or sends are
+// sandboxed
+func (c *Client) CanSend() bool {
+	return c.Sandboxed() || c.IsConnected()
+}
+
+// SandboxMessages returns the messages recorded in sandbox mode, newest first
+func (c *Client) SandboxMessages() []SandboxMessage {
+	c.sandbox.mu.Lock()
+	defer c.sandbox.mu.Unlock()
+	messages := make([]SandboxMessage, len(c.sandbox.messages))
+	for i, msg := range c.sandbox.messages {
+		messages[len(messages)-1-i] = msg
+	}
+	return messages
+}
+
+// ClearSandbox forgets the recorded messages
+func (c *Client) ClearSandbox() {
+	c.sandbox.mu.Lock()
+	c.sandbox.messages = nil
+	c.sandbox.mu.Unlock()
+}
+
+// recordSandboxSend records a message instead of sending it, and reports it on the
+// event stream. media is nil for text messages.
+func (c *Client) recordSandboxSend(jid types.JID, text string, media *models.MediaAttachment) string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	msg := SandboxMessage{
+		ID:      "SANDBOX" + strings.ToUpper(hex.EncodeToString(id)),
+		To:      jid.String(),
+		Message: text,
+		SentAt:  time.Now(),
+	}
+	if media != nil {
+		msg.MediaMimeType, msg.MediaFilename, msg.MediaSize = media.MimeType, media.Filename, len(media.Data)
+	}
+
+	c.sandbox.mu.Lock()
+	c.sandbox.messages = append(c.sandbox.messages, msg)
+	if len(c.sandbox.messages) > sandboxHistory {
+		c.sandbox.messages = c.sandbox.messages[len(c.sandbox.messages)-sandboxHistory:]
+	}
+	c.sandbox.mu.Unlock()
+
+	details := text
+	if media != nil {
+		details = fmt.Sprintf("[%s %s] %s", msg.MediaMimeType, msg.MediaFilename, text)
+	}
+	c.notifyEvent(string(models.EventTypeSandboxMessage), "Sandbox: message to "+msg.To+" recorded, not sent", details, msg)
+	return msg.ID
+}
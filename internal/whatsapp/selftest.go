@@ -0,0 +1,85 @@
+package whatsapp
+
+import (
+	"fmt"
+	"time"
+)
+
+// SelfTestConfig configures the periodic end-to-end connectivity self-test
+type SelfTestConfig struct {
+	Interval  time.Duration // How often to run the self-test
+	Timeout   time.Duration // How long to wait for a delivery receipt
+	TargetJID string        // Chat to send the probe to; defaults to the account's own number
+}
+
+// StartSelfTest runs a periodic self-test that sends a probe message and waits for its receipt.
+// A failed round trip is surfaced as a self_test_failed event, catching sessions that report
+// connected but can no longer actually deliver messages.
+func (c *Client) StartSelfTest(config SelfTestConfig) {
+	if config.Interval <= 0 {
+		return
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 60 * time.Second
+	}
+
+	fmt.Printf("WhatsApp self-test enabled, running every %s\n", config.Interval)
+
+	go func() {
+		ticker := time.NewTicker(config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.stopChan:
+				return
+			case <-ticker.C:
+				c.runSelfTest(config)
+			}
+		}
+	}()
+}
+
+// runSelfTest performs a single self-test round trip
+func (c *Client) runSelfTest(config SelfTestConfig) {
+	// Nothing to verify while we know we're disconnected; the disconnect event already covers it
+	if !c.IsConnected() {
+		return
+	}
+	// A sandboxed probe is never delivered, so there's no receipt to wait for
+	if c.Sandboxed() {
+		return
+	}
+
+	target := config.TargetJID
+	if target == "" {
+		phone := c.GetPhoneNumber()
+		if phone == "" {
+			return
+		}
+		target = phone + "@s.whatsapp.net"
+	}
+
+	started := time.Now()
+	probe := fmt.Sprintf("PingLater self-test %s", started.UTC().Format(time.RFC3339))
+
+	// The probe skips the send hooks, which could change it or veto it
+	messageID, _, err := c.sendText(0, target, probe, false)
+	if err != nil {
+		c.notifyEvent("self_test_failed", "Self-test message could not be sent", err.Error(), nil)
+		return
+	}
+
+	receiptType, ok := c.WaitForReceipt(messageID, config.Timeout)
+	if !ok {
+		c.notifyEvent("self_test_failed", "Self-test receipt not received",
+			fmt.Sprintf("No receipt for message %s within %s", messageID, config.Timeout), nil)
+		return
+	}
+
+	details := fmt.Sprintf("Round trip %s", time.Since(started).Round(time.Millisecond))
+	if receiptType != "" {
+		details += fmt.Sprintf(" (receipt: %s)", receiptType)
+	}
+	c.notifyEvent("self_test_passed", "Self-test succeeded", details, nil)
+}
@@ -0,0 +1,92 @@
+package whatsapp
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/user/pinglater/internal/models"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// OutgoingMessage is a message about to be sent, as send hooks see it
+type OutgoingMessage struct {
+	UserID uint      // User sending the message
+	To     types.JID // Recipient chat
+	Text   string    // Message text, or a media message's caption; hooks may change it
+	// The attachment of a media message, nil for text messages
+	Media *models.MediaAttachment
+}
+
+// SendHook runs before a message is sent, whichever path it comes from. It may change
+// the message's text, or veto the send by returning an error. Errors wrapping
+// ErrSendHookFailed fail the send without vetoing it.
+type SendHook func(msg *OutgoingMessage) error
+
+// ErrSendVetoed is returned when a send hook stops a message
+var ErrSendVetoed = errors.New("send vetoed")
+
+// ErrSendHookFailed marks errors of send hooks that couldn't check a message, e.g.
+// because their settings failed to load, as opposed to vetoing it
+var ErrSendHookFailed = errors.New("send hook failed")
+
+// SendVetoedError says which send hook stopped a message, and why. It matches
+// ErrSendVetoed.
+type SendVetoedError struct {
+	Hook string
+	Err  error
+}
+
+func (e *SendVetoedError) Error() string {
+	return fmt.Sprintf("%v by %s: %v", ErrSendVetoed, e.Hook, e.Err)
+}
+
+func (e *SendVetoedError) Is(target error) bool {
+	return target == ErrSendVetoed
+}
+
+func (e *SendVetoedError) Unwrap() error {
+	return e.Err
+}
+
+// sendHooks are run in the order they were added
+type sendHooks struct {
+	mu    sync.RWMutex
+	hooks []namedSendHook
+}
+
+type namedSendHook struct {
+	name string
+	hook SendHook
+}
+
+// AddSendHook adds a hook run before every message is sent, after the ones added
+// before it. name identifies it in SendVetoedErrors.
+func (c *Client) AddSendHook(name string, hook SendHook) {
+	c.hooks.mu.Lock()
+	c.hooks.hooks = append(c.hooks.hooks, namedSendHook{name: name, hook: hook})
+	c.hooks.mu.Unlock()
+}
+
+// runSendHooks passes a user's message through the send hooks and returns its text as
+// they left it, or a SendVetoedError
+func (c *Client) runSendHooks(userID uint, to types.JID, text string, media *models.MediaAttachment) (string, error) {
+	c.hooks.mu.RLock()
+	hooks := c.hooks.hooks
+	c.hooks.mu.RUnlock()
+	if len(hooks) == 0 {
+		return text, nil
+	}
+
+	msg := &OutgoingMessage{UserID: userID, To: to, Text: text, Media: media}
+	for _, h := range hooks {
+		err := h.hook(msg)
+		if errors.Is(err, ErrSendHookFailed) {
+			return "", fmt.Errorf("%s: %w", h.name, err)
+		}
+		if err != nil {
+			return "", &SendVetoedError{Hook: h.name, Err: err}
+		}
+	}
+	return msg.Text, nil
+}
@@ -0,0 +1,166 @@
+package whatsapp
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// SendPolicy limits how fast messages are sent, so the account doesn't look like a
+// spammer to WhatsApp. It applies to every send: API, bulk and campaign messages,
+// automatic replies and webhook replies. Zero values disable a limit.
+type SendPolicy struct {
+	MaxPerRecipientPerHour int           // Messages to one chat in any hour
+	MaxPerMinute           int           // Messages in any minute, across all chats
+	MinDelay               time.Duration // Pause between two sends
+	Jitter                 time.Duration // Random extra pause, up to this, so sends aren't evenly spaced
+}
+
+// ErrThrottled is returned when the send policy holds a message back
+var ErrThrottled = errors.New("send throttled by the send policy")
+
+// ThrottledError says which limit of the send policy held a message back, and when it
+// can be sent. It matches ErrThrottled.
+type ThrottledError struct {
+	Recipient  bool // The chat's hourly limit, rather than the global one
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	limit := "messages per minute"
+	if e.Recipient {
+		limit = "messages to this chat per hour"
+	}
+	return fmt.Sprintf("%v: too many %s, retry in %s", ErrThrottled, limit, e.RetryAfter.Round(time.Second))
+}
+
+func (e *ThrottledError) Is(target error) bool {
+	return target == ErrThrottled
+}
+
+// sendThrottle enforces the send policy. It counts sends in memory, so the counts start
+// over after a restart.
+type sendThrottle struct {
+	mu          sync.Mutex
+	policy      SendPolicy
+	recent      []time.Time            // Sends in the last minute
+	byRecipient map[string][]time.Time // Sends in the last hour, by chat
+	next        time.Time              // When MinDelay allows the next send
+	lastSweep   time.Time
+}
+
+// ConfigureSendPolicy sets the limits on sending
+func (c *Client) ConfigureSendPolicy(policy SendPolicy) {
+	c.throttle.mu.Lock()
+	c.throttle.policy = policy
+	c.throttle.mu.Unlock()
+}
+
+// CheckSendPolicy returns a ThrottledError if the send policy would hold back a message
+// to jid now, without counting one. The send queue uses it to skip messages to chats
+// that had enough for the hour.
+func (c *Client) CheckSendPolicy(jid string) error {
+	parsedJID, err := types.ParseJID(jid)
+	if err != nil {
+		return fmt.Errorf("invalid JID: %w", err)
+	}
+	c.throttle.mu.Lock()
+	defer c.throttle.mu.Unlock()
+	now := time.Now()
+	c.throttle.prune(now)
+	return c.throttle.check(parsedJID.ToNonAD().String(), now)
+}
+
+// waitForSendPolicy counts a send to jid, waiting out the policy's delay first. It
+// returns a ThrottledError instead if a limit is reached.
+func (c *Client) waitForSendPolicy(jid types.JID) error {
+	wait, err := c.throttle.reserve(jid.ToNonAD().String(), time.Now())
+	if err != nil || wait <= 0 {
+		return err
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-c.stopChan:
+		return fmt.Errorf("whatsapp client stopped")
+	}
+}
+
+// reserve counts a send to recipient and returns how long to wait before it
+func (t *sendThrottle) reserve(recipient string, now time.Time) (time.Duration, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.prune(now)
+	if err := t.check(recipient, now); err != nil {
+		return 0, err
+	}
+
+	var wait time.Duration
+	if t.next.After(now) {
+		wait = t.next.Sub(now)
+	}
+	at := now.Add(wait)
+	if t.policy.MaxPerMinute > 0 {
+		t.recent = append(t.recent, at)
+	}
+	if t.policy.MaxPerRecipientPerHour > 0 {
+		t.byRecipient[recipient] = append(t.byRecipient[recipient], at)
+	}
+	if t.policy.MinDelay > 0 || t.policy.Jitter > 0 {
+		delay := t.policy.MinDelay
+		if t.policy.Jitter > 0 {
+			delay += rand.N(t.policy.Jitter)
+		}
+		t.next = at.Add(delay)
+	}
+	return wait, nil
+}
+
+// check returns a ThrottledError if a limit is reached. The caller holds t.mu.
+func (t *sendThrottle) check(recipient string, now time.Time) error {
+	if max := t.policy.MaxPerRecipientPerHour; max > 0 {
+		sends := dropBefore(t.byRecipient[recipient], now.Add(-time.Hour))
+		t.byRecipient[recipient] = sends
+		if len(sends) >= max {
+			return &ThrottledError{Recipient: true, RetryAfter: sends[len(sends)-max].Add(time.Hour).Sub(now)}
+		}
+	}
+	if max := t.policy.MaxPerMinute; max > 0 && len(t.recent) >= max {
+		return &ThrottledError{RetryAfter: t.recent[len(t.recent)-max].Add(time.Minute).Sub(now)}
+	}
+	return nil
+}
+
+// prune forgets sends that no longer count towards a limit. The caller holds t.mu.
+func (t *sendThrottle) prune(now time.Time) {
+	t.recent = dropBefore(t.recent, now.Add(-time.Minute))
+
+	// Chats are swept once a minute rather than on every send
+	if now.Sub(t.lastSweep) < time.Minute {
+		return
+	}
+	t.lastSweep = now
+	for recipient, sends := range t.byRecipient {
+		if sends = dropBefore(sends, now.Add(-time.Hour)); len(sends) == 0 {
+			delete(t.byRecipient, recipient)
+		} else {
+			t.byRecipient[recipient] = sends
+		}
+	}
+}
+
+// dropBefore removes the times up to cutoff from the start of a sorted list
+func dropBefore(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	return times[i:]
+}
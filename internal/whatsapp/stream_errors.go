@@ -0,0 +1,117 @@
+package whatsapp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/user/pinglater/internal/models"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// ErrRateLimited is returned when WhatsApp rejects a send because too many were sent
+var ErrRateLimited = errors.New("rate limited by WhatsApp, slow down sending")
+
+// rateLimitedSendError is the error WhatsApp returns in a message send response when
+// the account sends too fast
+var rateLimitedSendError = fmt.Errorf("%w %d", whatsmeow.ErrServerReturnedError, 429)
+
+// handleTemporaryBan reports a temporary ban. WhatsApp refuses the connection until it
+// expires, so reconnecting earlier is pointless.
+func (c *Client) handleTemporaryBan(evt *events.TemporaryBan) {
+	c.stopReconnect()
+	c.markOffline()
+
+	data := c.errorEventData(strconv.Itoa(int(evt.Code)), evt.Code.String(), models.GuidanceStopSending)
+	details := evt.String()
+	if evt.Expire > 0 {
+		data.ExpiresAt = time.Now().Add(evt.Expire).Unix()
+	}
+	c.notifyEvent(string(models.EventTypeTemporaryBan), "WhatsApp account temporarily banned", details, data)
+}
+
+// handleStreamReplaced reports that another client took over the session. Reconnecting
+// would just kick that client off in turn.
+func (c *Client) handleStreamReplaced() {
+	c.stopReconnect()
+	c.markOffline()
+
+	data := c.errorEventData("replaced", "Another client connected with this session", models.GuidanceCloseOtherSession)
+	c.notifyEvent(string(models.EventTypeStreamError), "WhatsApp session replaced", data.Reason, data)
+}
+
+// handleStreamError reports a stream error WhatsApp sent with an unknown code. The
+// connection drops afterwards and is picked up by the reconnect loop.
+func (c *Client) handleStreamError(evt *events.StreamError) {
+	data := c.errorEventData(evt.Code, "WhatsApp closed the stream with an error", models.GuidanceReconnect)
+	c.notifyEvent(string(models.EventTypeStreamError), "WhatsApp stream error", "Code: "+evt.Code, data)
+}
+
+// handleConnectFailure reports a refused connection whose reason whatsmeow doesn't
+// handle itself. whatsmeow gives up on these, so retry with backoff unless the client
+// itself was rejected.
+func (c *Client) handleConnectFailure(evt *events.ConnectFailure) {
+	c.markOffline()
+
+	guidance := models.GuidanceRetryLater
+	if evt.Reason == events.ConnectFailureBadUserAgent {
+		guidance = models.GuidanceUpdateClient
+	}
+	reason := evt.Reason.String()
+	if evt.Message != "" {
+		reason += " (" + evt.Message + ")"
+	}
+	data := c.errorEventData(evt.Reason.NumberString(), reason, guidance)
+	c.notifyEvent(string(models.EventTypeStreamError), "WhatsApp refused the connection", reason, data)
+
+	if guidance == models.GuidanceRetryLater {
+		c.startReconnect()
+	}
+}
+
+// handleClientOutdated reports that WhatsApp no longer accepts this client version
+func (c *Client) handleClientOutdated() {
+	c.stopReconnect()
+	c.markOffline()
+
+	code := events.ConnectFailureClientOutdated
+	data := c.errorEventData(code.NumberString(), code.String(), models.GuidanceUpdateClient)
+	c.notifyEvent(string(models.EventTypeStreamError), "WhatsApp client is outdated", "Update PingLater to connect again", data)
+}
+
+// checkRateLimit turns WhatsApp's rate limit responses into ErrRateLimited and emits
+// rate_limited, so senders can back off
+func (c *Client) checkRateLimit(err error) error {
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, whatsmeow.ErrIQRateOverLimit) && err.Error() != rateLimitedSendError.Error() {
+		return err
+	}
+	data := c.errorEventData("429", "Too many messages sent in a short time", models.GuidanceSlowDown)
+	c.notifyEvent(string(models.EventTypeRateLimited), "Rate limited by WhatsApp", err.Error(), data)
+	return fmt.Errorf("%w: %v", ErrRateLimited, err)
+}
+
+// markOffline records that the connection is gone when whatsmeow disconnects without
+// a Disconnected event
+func (c *Client) markOffline() {
+	c.mu.Lock()
+	c.connected = false
+	c.connectedAt = time.Time{}
+	c.mu.Unlock()
+	c.clearDegraded()
+	c.updateSessionStatus(false, "")
+}
+
+func (c *Client) errorEventData(code, reason, guidance string) models.WhatsAppErrorData {
+	return models.WhatsAppErrorData{
+		PhoneNumber: c.GetPhoneNumber(),
+		Code:        code,
+		Reason:      reason,
+		Guidance:    guidance,
+		Timestamp:   time.Now().Unix(),
+	}
+}
@@ -0,0 +1,161 @@
+package whatsapp
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/user/pinglater/internal/models"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// WatchdogConfig configures connection health checking. Failed keepalive pings mark the
+// connection degraded (connection_degraded event); when they keep failing for
+// MaxFailTime, or the socket turns out to be closed, the client reconnects.
+type WatchdogConfig struct {
+	Interval          time.Duration // How often to check the socket (0 disables the periodic check)
+	KeepAliveFailures int           // Failed keepalives in a row before the connection counts as degraded
+	MaxFailTime       time.Duration // Failing keepalives for this long force a reconnect
+}
+
+const notLoggedInReason = "Connected but not logged in to WhatsApp"
+
+var defaultWatchdogConfig = WatchdogConfig{
+	Interval:          30 * time.Second,
+	KeepAliveFailures: 2,
+	MaxFailTime:       3 * time.Minute,
+}
+
+// StartWatchdog applies the health check settings and starts the periodic socket check
+func (c *Client) StartWatchdog(config WatchdogConfig) {
+	if config.KeepAliveFailures <= 0 {
+		config.KeepAliveFailures = defaultWatchdogConfig.KeepAliveFailures
+	}
+	if config.MaxFailTime <= 0 {
+		config.MaxFailTime = defaultWatchdogConfig.MaxFailTime
+	}
+	c.mu.Lock()
+	c.watchdogConfig = config
+	c.mu.Unlock()
+
+	if config.Interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.stopChan:
+				return
+			case <-ticker.C:
+				c.checkConnection()
+			}
+		}
+	}()
+}
+
+// checkConnection catches sockets that died without a disconnect event
+func (c *Client) checkConnection() {
+	c.mu.RLock()
+	connected := c.connected
+	client := c.client
+	c.mu.RUnlock()
+	if !connected || client == nil {
+		return
+	}
+
+	if !client.IsConnected() {
+		c.forceReconnect("WhatsApp socket closed unexpectedly")
+		return
+	}
+	c.mu.RLock()
+	reason := c.degradedReason
+	c.mu.RUnlock()
+	if !client.IsLoggedIn() {
+		c.markDegraded(notLoggedInReason)
+	} else if reason == notLoggedInReason {
+		c.markHealthy("Logged in to WhatsApp again")
+	}
+}
+
+// handleKeepAliveTimeout marks the connection degraded after repeated keepalive
+// failures and reconnects once they have gone on for too long
+func (c *Client) handleKeepAliveTimeout(evt *events.KeepAliveTimeout) {
+	c.mu.RLock()
+	config := c.watchdogConfig
+	c.mu.RUnlock()
+
+	if evt.ErrorCount < config.KeepAliveFailures {
+		return
+	}
+	since := "never"
+	if !evt.LastSuccess.IsZero() {
+		since = time.Since(evt.LastSuccess).Round(time.Second).String() + " ago"
+	}
+	c.markDegraded(fmt.Sprintf("%d keepalive pings failed, last success %s", evt.ErrorCount, since))
+
+	if !evt.LastSuccess.IsZero() && time.Since(evt.LastSuccess) > config.MaxFailTime {
+		c.forceReconnect("Keepalive pings failing for over " + config.MaxFailTime.String())
+	}
+}
+
+// forceReconnect drops a connection that is no longer working and starts reconnecting
+func (c *Client) forceReconnect(reason string) {
+	fmt.Printf("WhatsApp connection unhealthy, reconnecting: %s\n", reason)
+	if c.client != nil {
+		c.client.Disconnect()
+	}
+	c.mu.Lock()
+	c.connected = false
+	c.connectedAt = time.Time{}
+	c.mu.Unlock()
+	c.clearDegraded()
+
+	c.notifyEvent("disconnected", "Disconnected from WhatsApp", reason, nil)
+	c.startReconnect()
+}
+
+// markDegraded records that the connection is unhealthy, emitting connection_degraded
+// the first time
+func (c *Client) markDegraded(reason string) {
+	c.mu.Lock()
+	wasDegraded := c.degraded
+	c.degraded = true
+	c.degradedReason = reason
+	c.mu.Unlock()
+
+	if !wasDegraded {
+		c.notifyEvent(string(models.EventTypeConnectionDegraded), "WhatsApp connection degraded", reason,
+			c.connectionEventData("WhatsApp connection degraded", reason))
+	}
+}
+
+// markHealthy ends a degraded period, emitting connection_restored
+func (c *Client) markHealthy(reason string) {
+	if !c.clearDegraded() {
+		return
+	}
+	c.notifyEvent(string(models.EventTypeConnectionRestored), "WhatsApp connection restored", reason,
+		c.connectionEventData("WhatsApp connection restored", reason))
+}
+
+// clearDegraded resets the degraded state without an event, e.g. when the connection
+// is replaced anyway. It reports whether the connection was degraded.
+func (c *Client) clearDegraded() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	wasDegraded := c.degraded
+	c.degraded = false
+	c.degradedReason = ""
+	return wasDegraded
+}
+
+func (c *Client) connectionEventData(reason, details string) models.ConnectionEventData {
+	return models.ConnectionEventData{
+		PhoneNumber: c.GetPhoneNumber(),
+		Reason:      reason,
+		Details:     details,
+		Timestamp:   time.Now().Unix(),
+	}
+}
@@ -13,6 +13,8 @@ import { ThemeToggle } from '@/components/theme-toggle';
 import { Input } from '@/components/ui/input';
 import { Label } from '@/components/ui/label';
 import { ScrollArea } from '@/components/ui/scroll-area';
+import { Switch } from '@/components/ui/switch';
+import { Textarea } from '@/components/ui/textarea';
 import { 
   LogOut, 
   MessageCircle, 
@@ -32,7 +34,8 @@ import {
   Download,
   Trash2,
   Webhook,
-  Settings
+  Settings,
+  Plane
 } from 'lucide-react';
 
 type Event = {
@@ -42,6 +45,14 @@ type Event = {
   timestamp: string;
 };
 
+type OutOfOffice = {
+  is_active: boolean;
+  message: string;
+  starts_at: string | null;
+  ends_at: string | null;
+  active_now: boolean;
+};
+
 type Metrics = {
   connected: boolean;
   phone_number: string;
@@ -68,6 +79,16 @@ const getEventIcon = (type: string) => {
   }
 };
 
+// datetime-local inputs work in local time without a zone; the API takes RFC 3339
+const toLocalInput = (value: string | null) => {
+  if (!value) return '';
+  const date = new Date(value);
+  date.setMinutes(date.getMinutes() - date.getTimezoneOffset());
+  return date.toISOString().slice(0, 16);
+};
+
+const fromLocalInput = (value: string) => (value ? new Date(value).toISOString() : '');
+
 const formatDuration = (seconds: number) => {
   const hours = Math.floor(seconds / 3600);
   const minutes = Math.floor((seconds % 3600) / 60);
@@ -94,6 +115,14 @@ export default function Dashboard() {
   const [messageText, setMessageText] = useState('');
   const [sendingMessage, setSendingMessage] = useState(false);
 
+  // Out of office
+  const [outOfOffice, setOutOfOffice] = useState<OutOfOffice | null>(null);
+  const [oooMessage, setOooMessage] = useState('');
+  const [oooStartsAt, setOooStartsAt] = useState('');
+  const [oooEndsAt, setOooEndsAt] = useState('');
+  const [oooError, setOooError] = useState('');
+  const [savingOoo, setSavingOoo] = useState(false);
+
   // Define callbacks first (before the useEffect that uses them)
   const fetchStatus = useCallback(async () => {
     if (!token) return;
@@ -115,7 +144,20 @@ export default function Dashboard() {
     }
   }, [token]);
 
-  const subscribeToEvents = useCallback(() => {
+  const fetchOutOfOffice = useCallback(async () => {
+    if (!token) return;
+    try {
+      const data: OutOfOffice = await api.getOutOfOffice(token);
+      setOutOfOffice(data);
+      setOooMessage(data.message);
+      setOooStartsAt(toLocalInput(data.starts_at));
+      setOooEndsAt(toLocalInput(data.ends_at));
+    } catch (error) {
+      console.error('Failed to fetch out-of-office:', error);
+    }
+  }, [token]);
+
+  const subscribeToEvents = useCallback((lastEventId?: number) => {
     if (!token) return null;
 
     const es = api.subscribeToEvents(
@@ -125,7 +167,7 @@ export default function Dashboard() {
           type: event.type,
           message: event.data.message || event.data,
           details: event.data.details,
-          timestamp: new Date().toISOString(),
+          timestamp: event.data.timestamp || new Date().toISOString(),
         };
         setEvents((prev) => [...prev.slice(-49), newEvent]); // Keep last 50 events
 
@@ -137,7 +179,8 @@ export default function Dashboard() {
       },
       (error) => {
         console.error('Event subscription error:', error);
-      }
+      },
+      lastEventId
     );
 
     return es;
@@ -151,19 +194,34 @@ export default function Dashboard() {
     if (token) {
       fetchStatus();
       fetchMetrics();
+      fetchOutOfOffice();
       
-      // Subscribe to events
-      const eventsES = subscribeToEvents();
+      // Show recent activity, then subscribe to the events that follow it
+      let eventsES: { close(): void } | null = null;
+      let cancelled = false;
+      api.getRecentEvents(token)
+        .then(({ events: recent }) => {
+          setEvents(recent.map(({ type, message, details, timestamp }) => ({ type, message, details, timestamp })));
+          return recent.length > 0 ? recent[recent.length - 1].id : undefined;
+        })
+        .catch((error) => {
+          console.error('Failed to fetch recent events:', error);
+          return undefined;
+        })
+        .then((lastEventId) => {
+          if (!cancelled) eventsES = subscribeToEvents(lastEventId);
+        });
       
       // Periodic metrics refresh
       const metricsInterval = setInterval(fetchMetrics, 5000);
       
       return () => {
+        cancelled = true;
         eventsES?.close();
         clearInterval(metricsInterval);
       };
     }
-  }, [token, isLoading, fetchStatus, fetchMetrics, subscribeToEvents]);
+  }, [token, isLoading, fetchStatus, fetchMetrics, fetchOutOfOffice, subscribeToEvents]);
 
   // Auto-scroll events to bottom
   useEffect(() => {
@@ -184,6 +242,25 @@ export default function Dashboard() {
     }
   };
 
+  const saveOutOfOffice = async (isActive: boolean) => {
+    if (!token) return;
+    setSavingOoo(true);
+    setOooError('');
+    try {
+      const data: OutOfOffice = await api.updateOutOfOffice(token, {
+        is_active: isActive,
+        message: oooMessage,
+        starts_at: fromLocalInput(oooStartsAt),
+        ends_at: fromLocalInput(oooEndsAt),
+      });
+      setOutOfOffice(data);
+    } catch (error) {
+      setOooError(error instanceof Error ? error.message : 'Failed to save out-of-office');
+    } finally {
+      setSavingOoo(false);
+    }
+  };
+
   const connectWhatsApp = async () => {
     if (!token) return;
     setLoading(true);
@@ -612,6 +689,68 @@ export default function Dashboard() {
                   </CardContent>
                 </Card>
               )}
+
+              {/* Out of Office */}
+              <Card>
+                <CardHeader>
+                  <div className="flex items-center justify-between">
+                    <CardTitle className="flex items-center gap-2">
+                      <Plane className="h-5 w-5" />
+                      Out of Office
+                      {outOfOffice?.active_now && <Badge>Replying</Badge>}
+                    </CardTitle>
+                    <Switch
+                      checked={outOfOffice?.is_active || false}
+                      disabled={savingOoo}
+                      onCheckedChange={(checked) => saveOutOfOffice(checked)}
+                    />
+                  </div>
+                  <CardDescription>
+                    Reply automatically to people who message you directly, once a day each
+                  </CardDescription>
+                </CardHeader>
+                <CardContent className="space-y-4">
+                  <div className="space-y-2">
+                    <Label htmlFor="ooo-message">Message</Label>
+                    <Textarea
+                      id="ooo-message"
+                      placeholder="e.g., Hi {{ .from_name }}, I'm away until Monday and will reply then."
+                      value={oooMessage}
+                      onChange={(e) => setOooMessage(e.target.value)}
+                    />
+                  </div>
+                  <div className="grid grid-cols-1 sm:grid-cols-2 gap-4">
+                    <div className="space-y-2">
+                      <Label htmlFor="ooo-starts">From (optional)</Label>
+                      <Input
+                        id="ooo-starts"
+                        type="datetime-local"
+                        value={oooStartsAt}
+                        onChange={(e) => setOooStartsAt(e.target.value)}
+                      />
+                    </div>
+                    <div className="space-y-2">
+                      <Label htmlFor="ooo-ends">Until (optional)</Label>
+                      <Input
+                        id="ooo-ends"
+                        type="datetime-local"
+                        value={oooEndsAt}
+                        onChange={(e) => setOooEndsAt(e.target.value)}
+                      />
+                    </div>
+                  </div>
+                  {oooError && <p className="text-sm text-destructive">{oooError}</p>}
+                  <Button
+                    onClick={() => saveOutOfOffice(outOfOffice?.is_active || false)}
+                    disabled={savingOoo}
+                    variant="outline"
+                    className="w-full gap-2"
+                  >
+                    {savingOoo && <Loader2 className="h-4 w-4 animate-spin" />}
+                    Save
+                  </Button>
+                </CardContent>
+              </Card>
             </div>
 
             {/* Right Column - Events Feed */}
@@ -35,7 +35,8 @@ import {
   Loader2,
   AlertCircle,
   BarChart3,
-  History
+  History,
+  RotateCcw
 } from 'lucide-react';
 
 interface Webhook {
@@ -43,6 +44,7 @@ interface Webhook {
   url: string;
   description: string;
   is_active: boolean;
+  deleted_at?: string;
   event_types: string[];
   created_at: string;
   updated_at: string;
@@ -66,6 +68,7 @@ interface WebhookDelivery {
   error_message: string;
   retry_count: number;
   created_at: string;
+  abandoned_reason?: "max_retries" | "max_age";
 }
 
 interface WebhookStats {
@@ -82,6 +85,7 @@ export default function WebhooksPage() {
   const router = useRouter();
   
   const [webhooks, setWebhooks] = useState<Webhook[]>([]);
+  const [trash, setTrash] = useState<Webhook[]>([]);
   const [availableEvents, setAvailableEvents] = useState<WebhookEvent[]>([]);
   const [loading, setLoading] = useState(true);
   const [selectedWebhook, setSelectedWebhook] = useState<Webhook | null>(null);
@@ -121,6 +125,16 @@ export default function WebhooksPage() {
     }
   }, [token]);
 
+  const fetchTrash = useCallback(async () => {
+    if (!token) return;
+    try {
+      const data = await api.getWebhookTrash(token);
+      setTrash(data.webhooks || []);
+    } catch (error) {
+      console.error('Failed to fetch deleted webhooks:', error);
+    }
+  }, [token]);
+
   const fetchEvents = useCallback(async () => {
     if (!token) return;
     try {
@@ -157,9 +171,9 @@ export default function WebhooksPage() {
       return;
     }
     if (token) {
-      Promise.all([fetchWebhooks(), fetchEvents()]).then(() => setLoading(false));
+      Promise.all([fetchWebhooks(), fetchTrash(), fetchEvents()]).then(() => setLoading(false));
     }
-  }, [token, isLoading, fetchWebhooks, fetchEvents, router]);
+  }, [token, isLoading, fetchWebhooks, fetchTrash, fetchEvents, router]);
 
   useEffect(() => {
     if (selectedWebhook) {
@@ -273,13 +287,14 @@ export default function WebhooksPage() {
 
   const handleDelete = async (webhook: Webhook) => {
     if (!token) return;
-    if (!confirm(`Are you sure you want to delete the webhook "${webhook.description || webhook.url}"?`)) {
+    if (!confirm(`Delete the webhook "${webhook.description || webhook.url}"? It stays in the trash for 30 days and can be restored.`)) {
       return;
     }
     
     try {
       await api.deleteWebhook(token, webhook.id);
       fetchWebhooks();
+      fetchTrash();
       if (selectedWebhook?.id === webhook.id) {
         setSelectedWebhook(null);
       }
@@ -289,6 +304,32 @@ export default function WebhooksPage() {
     }
   };
 
+  const handleRestore = async (webhook: Webhook) => {
+    if (!token) return;
+    try {
+      await api.restoreWebhook(token, webhook.id);
+      fetchWebhooks();
+      fetchTrash();
+    } catch (error) {
+      console.error('Failed to restore webhook:', error);
+      alert('Failed to restore webhook.');
+    }
+  };
+
+  const handlePurge = async (webhook: Webhook) => {
+    if (!token) return;
+    if (!confirm(`Delete the webhook "${webhook.description || webhook.url}" and its delivery history for good? This cannot be undone.`)) {
+      return;
+    }
+    try {
+      await api.purgeWebhook(token, webhook.id);
+      fetchTrash();
+    } catch (error) {
+      console.error('Failed to delete webhook:', error);
+      alert('Failed to delete webhook.');
+    }
+  };
+
   const handleTest = async (webhook: Webhook) => {
     if (!token) return;
     setTestingWebhook(webhook.id);
@@ -468,6 +509,41 @@ export default function WebhooksPage() {
                 </div>
               </CardContent>
             </Card>
+
+            {trash.length > 0 && (
+              <Card className="mt-6">
+                <CardHeader>
+                  <CardTitle>Trash</CardTitle>
+                  <CardDescription>
+                    Deleted webhooks are kept for 30 days with their delivery history
+                  </CardDescription>
+                </CardHeader>
+                <CardContent>
+                  <div className="space-y-2">
+                    {trash.map(webhook => (
+                      <div key={webhook.id} className="p-3 rounded-lg border flex items-center justify-between">
+                        <div className="min-w-0 flex-1">
+                          <p className="font-medium text-sm truncate">
+                            {webhook.description || webhook.url}
+                          </p>
+                          <p className="text-xs text-muted-foreground">
+                            Deleted {webhook.deleted_at ? new Date(webhook.deleted_at).toLocaleString() : ''}
+                          </p>
+                        </div>
+                        <div className="flex gap-1 ml-2 shrink-0">
+                          <Button variant="ghost" size="sm" onClick={() => handleRestore(webhook)} title="Restore">
+                            <RotateCcw className="h-4 w-4" />
+                          </Button>
+                          <Button variant="ghost" size="sm" onClick={() => handlePurge(webhook)} title="Delete permanently">
+                            <Trash2 className="h-4 w-4" />
+                          </Button>
+                        </div>
+                      </div>
+                    ))}
+                  </div>
+                </CardContent>
+              </Card>
+            )}
           </div>
 
           {/* Webhook Details */}
@@ -759,6 +835,11 @@ export default function WebhooksPage() {
                                             {delivery.retry_count} retries
                                           </Badge>
                                         )}
+                                        {delivery.abandoned_reason && (
+                                          <Badge variant="outline" className="ml-1 text-xs">
+                                            {delivery.abandoned_reason === "max_age" ? "Too old, abandoned" : "Abandoned"}
+                                          </Badge>
+                                        )}
                                       </div>
                                     )}
                                   </TableCell>
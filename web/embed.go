@@ -0,0 +1,24 @@
+// Package web embeds the built frontend (npm run build) into the server binary
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// out holds a placeholder until the frontend is built, so the server compiles without it
+//
+//go:embed all:out
+var out embed.FS
+
+// Files returns the embedded frontend, or false if the binary was built without it
+func Files() (fs.FS, bool) {
+	files, err := fs.Sub(out, "out")
+	if err != nil {
+		return nil, false
+	}
+	if _, err := fs.Stat(files, "index.html"); err != nil {
+		return nil, false
+	}
+	return files, true
+}
@@ -72,6 +72,17 @@ export const api = {
     return res.json();
   },
 
+  async getMessageTimeseries(token: string, interval: 'hour' | 'day' = 'hour', from?: string, to?: string) {
+    const params = new URLSearchParams({ interval });
+    if (from) params.set('from', from);
+    if (to) params.set('to', to);
+    const res = await fetch(`${API_BASE_URL}/api/metrics/timeseries?${params}`, {
+      headers: { Authorization: `Bearer ${token}` },
+    });
+    if (!res.ok) throw new Error('Failed to fetch message volume');
+    return res.json();
+  },
+
   async sendMessage(token: string, phoneNumber: string, message: string) {
     const res = await fetch(`${API_BASE_URL}/api/whatsapp/send`, {
       method: 'POST',
@@ -94,51 +105,133 @@ export const api = {
     return res.json();
   },
 
-  subscribeToEvents(token: string, onEvent: (event: any) => void, onError?: (error: any) => void) {
-    const es = new EventSource(
-      `${API_BASE_URL}/api/whatsapp/events?token=${token}`,
-      { withCredentials: false }
-    );
+  // Short-lived token for opening the event stream, so the session token stays out of URLs
+  async createStreamToken(token: string): Promise<{ token: string; expires_at: string; expires_in: number }> {
+    const res = await fetch(`${API_BASE_URL}/api/auth/stream-token`, {
+      method: 'POST',
+      headers: { Authorization: `Bearer ${token}` },
+    });
+    if (!res.ok) throw new Error('Failed to create stream token');
+    return res.json();
+  },
 
-    es.onopen = () => {
-      console.log('Events SSE Connection opened');
-    };
+  // Recent activity of the event stream, oldest first
+  async getRecentEvents(token: string, limit = 50): Promise<{ events: { id: number; type: string; message: string; details?: string; timestamp: string }[] }> {
+    const res = await fetch(`${API_BASE_URL}/api/events?limit=${limit}`, {
+      headers: { Authorization: `Bearer ${token}` },
+    });
+    if (!res.ok) throw new Error('Failed to fetch events');
+    return res.json();
+  },
 
-    // Listen for specific event types
-    const eventTypes = ['connected', 'disconnected', 'message_sent', 'message_received', 'qr_generated', 'connection_error'];
-    
-    eventTypes.forEach(eventType => {
-      es.addEventListener(eventType, (event) => {
+  // lastEventId continues the stream after an event already shown, e.g. from getRecentEvents
+  subscribeToEvents(token: string, onEvent: (event: any) => void, onError?: (error: any) => void, lastEventId?: number) {
+    let es: EventSource | null = null;
+    let retry: ReturnType<typeof setTimeout> | undefined;
+    let closed = false;
+    let lastId = lastEventId ? String(lastEventId) : '';
+
+    const connect = (streamToken: string) => {
+      const resume = lastId ? `&last_event_id=${lastId}` : '';
+      const source = new EventSource(
+        `${API_BASE_URL}/api/whatsapp/events?token=${encodeURIComponent(streamToken)}${resume}`,
+        { withCredentials: false }
+      );
+
+      source.onopen = () => {
+        console.log('Events SSE Connection opened');
+      };
+
+      // Listen for specific event types
+      const eventTypes = ['connected', 'disconnected', 'message_sent', 'message_received', 'qr_generated', 'connection_error', 'stream_error', 'temporary_ban', 'rate_limited', 'replay_gap'];
+      
+      eventTypes.forEach(eventType => {
+        source.addEventListener(eventType, (event) => {
+          if (event.lastEventId) lastId = event.lastEventId;
+          try {
+            const data = JSON.parse(event.data);
+            onEvent({ type: eventType, data });
+          } catch (e) {
+            onEvent({ type: eventType, data: event.data });
+          }
+        });
+      });
+
+      // Handle ping events (heartbeat) silently
+      source.addEventListener('ping', () => {
+        // Heartbeat received - connection is alive
+      });
+
+      // Also listen for generic messages
+      source.onmessage = (event) => {
         try {
           const data = JSON.parse(event.data);
-          onEvent({ type: eventType, data });
+          onEvent({ type: 'message', data });
         } catch (e) {
-          onEvent({ type: eventType, data: event.data });
+          onEvent({ type: 'message', data: event.data });
         }
-      });
-    });
+      };
 
-    // Handle ping events (heartbeat) silently
-    es.addEventListener('ping', () => {
-      // Heartbeat received - connection is alive
-    });
+      source.onerror = (error) => {
+        console.error('Events SSE Error:', error);
+        if (onError) onError(error);
+        // The browser gives up once the stream token has expired; get a new one
+        if (source.readyState === EventSource.CLOSED && !closed) {
+          retry = setTimeout(open, 5000);
+        }
+      };
+
+      return source;
+    };
 
-    // Also listen for generic messages
-    es.onmessage = (event) => {
+    const open = async () => {
       try {
-        const data = JSON.parse(event.data);
-        onEvent({ type: 'message', data });
-      } catch (e) {
-        onEvent({ type: 'message', data: event.data });
+        const { token: streamToken } = await api.createStreamToken(token);
+        if (!closed) es = connect(streamToken);
+      } catch (error) {
+        if (onError) onError(error);
+        if (!closed) retry = setTimeout(open, 5000);
       }
     };
+    open();
 
-    es.onerror = (error) => {
-      console.error('Events SSE Error:', error);
-      if (onError) onError(error);
+    return {
+      close() {
+        closed = true;
+        clearTimeout(retry);
+        es?.close();
+      },
     };
+  },
 
-    return es;
+  // Out of office
+  async getOutOfOffice(token: string) {
+    const res = await fetch(`${API_BASE_URL}/api/out-of-office`, {
+      headers: { Authorization: `Bearer ${token}` },
+    });
+    if (!res.ok) throw new Error('Failed to fetch out-of-office');
+    return res.json();
+  },
+
+  async updateOutOfOffice(token: string, data: {
+    is_active?: boolean;
+    message?: string;
+    starts_at?: string;
+    ends_at?: string;
+  }) {
+    const res = await fetch(`${API_BASE_URL}/api/out-of-office`, {
+      method: 'PUT',
+      headers: { 
+        Authorization: `Bearer ${token}`,
+        'Content-Type': 'application/json'
+      },
+      body: JSON.stringify(data),
+    });
+    if (!res.ok) {
+      const errorData = await res.json().catch(() => ({ error: 'Unknown error' }));
+      throw new Error(errorData.error || `Failed to update out-of-office: ${res.status}`);
+    }
+    return res.json();
   },
 
   // Webhooks
@@ -210,6 +303,32 @@ export const api = {
     return res.json();
   },
 
+  async getWebhookTrash(token: string) {
+    const res = await fetch(`${API_BASE_URL}/api/webhooks/trash`, {
+      headers: { Authorization: `Bearer ${token}` },
+    });
+    if (!res.ok) throw new Error('Failed to fetch deleted webhooks');
+    return res.json();
+  },
+
+  async restoreWebhook(token: string, id: number) {
+    const res = await fetch(`${API_BASE_URL}/api/webhooks/trash/${id}/restore`, {
+      method: 'POST',
+      headers: { Authorization: `Bearer ${token}` },
+    });
+    if (!res.ok) throw new Error('Failed to restore webhook');
+    return res.json();
+  },
+
+  async purgeWebhook(token: string, id: number) {
+    const res = await fetch(`${API_BASE_URL}/api/webhooks/trash/${id}`, {
+      method: 'DELETE',
+      headers: { Authorization: `Bearer ${token}` },
+    });
+    if (!res.ok) throw new Error('Failed to delete webhook');
+    return res.json();
+  },
+
   async getWebhookEvents(token: string) {
     const res = await fetch(`${API_BASE_URL}/api/webhooks/events`, {
       headers: { Authorization: `Bearer ${token}` },